@@ -3,6 +3,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/dvcrn/antigravity-proxy/internal/antigravity"
@@ -24,33 +25,31 @@ func init() {
 		// Continue anyway, authentication will fail
 	}
 
-	// Perform startup auth check
-	logger.Get().Info().Msg("Performing startup authentication check...")
+	// Discover project ID (env override, LoadCodeAssist response, or onboarding flow).
+	// The loadCodeAssist call doubles as the startup auth check.
 	antigravityClient := antigravity.NewClient(provider)
-	loadAssistResponse, err := antigravityClient.LoadCodeAssist()
-	if err != nil {
-		logger.Get().Warn().Err(err).Msg("Startup authentication check failed.")
-	} else {
+	loadAssist := func(ctx context.Context) (*antigravity.LoadCodeAssistResponse, error) {
+		logger.Get().Info().Msg("Performing startup authentication check...")
+		loadAssistResponse, err := antigravityClient.LoadCodeAssist(ctx)
+		if err != nil {
+			logger.Get().Warn().Err(err).Msg("Startup authentication check failed.")
+			return nil, err
+		}
 		tier := fmt.Sprintf("%s (%s)", loadAssistResponse.CurrentTier.Name, loadAssistResponse.CurrentTier.ID)
 		logger.Get().Info().
 			Str("tier", tier).
 			Str("project_id", loadAssistResponse.CloudAICompanionProject).
 			Bool("gcp_managed", loadAssistResponse.GCPManaged).
 			Msg("Startup authentication check successful.")
+		return loadAssistResponse, nil
 	}
 
-	// Discover project ID (env override, LoadCodeAssist response, or onboarding flow)
 	var projectID string
 	envProjectID, _ := env.Get("CLOUDCODE_GCP_PROJECT_ID")
-	if loadAssistResponse != nil {
-		if discoveredProjectID, err := project.Discover(provider, envProjectID, loadAssistResponse); err != nil {
-			logger.Get().Warn().Err(err).Msg("Project discovery failed; continuing without explicit project ID")
-		} else {
-			projectID = discoveredProjectID
-		}
-	} else if envProjectID != "" {
-		// Fallback to explicit env override when LoadCodeAssist failed
-		projectID = envProjectID
+	if discoveredProjectID, err := project.Discover(context.Background(), provider, envProjectID, project.DefaultTimeout, loadAssist); err != nil {
+		logger.Get().Warn().Err(err).Msg("Project discovery failed; continuing without explicit project ID")
+	} else {
+		projectID = discoveredProjectID
 	}
 
 	if projectID == "" {
@@ -1,9 +1,17 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/dvcrn/antigravity-proxy/internal/antigravity"
+	"github.com/dvcrn/antigravity-proxy/internal/auth"
 	"github.com/dvcrn/antigravity-proxy/internal/credentials"
 	"github.com/dvcrn/antigravity-proxy/internal/env"
 	"github.com/dvcrn/antigravity-proxy/internal/logger"
@@ -11,33 +19,60 @@ import (
 	"github.com/dvcrn/antigravity-proxy/internal/server"
 )
 
+// defaultListenAddr is used when neither --listen, PROXY_LISTEN_ADDR nor PORT is set.
+const defaultListenAddr = "127.0.0.1:9878"
+
+// defaultShutdownTimeout is the grace period for in-flight requests on SIGINT/SIGTERM.
+const defaultShutdownTimeout = 30 * time.Second
+
 func main() {
-	port := env.GetOrDefault("PORT", "9878")
+	listen := flag.String("listen", "", "Address to listen on, e.g. 127.0.0.1:8080 (overrides PROXY_LISTEN_ADDR and PORT)")
+	logLevel := flag.String("log-level", "", "Minimum log level: trace, debug, info, warn or error (overrides LOG_LEVEL)")
+	flag.Parse()
+
+	if *logLevel != "" {
+		if err := logger.SetLevel(*logLevel); err != nil {
+			logger.Get().Fatal().Err(err).Msg("Invalid --log-level")
+		}
+	}
+
+	listenAddr := resolveListenAddr(*listen)
+	if err := server.ValidateListenAddr(listenAddr); err != nil {
+		logger.Get().Fatal().Err(err).Msg("Invalid listen address")
+	}
 
 	// Create file provider
 	provider, err := credentials.NewFileProvider()
 	if err != nil {
 		logger.Get().Fatal().Err(err).Msg("Failed to create credentials provider")
 	}
+	if creds, err := provider.GetCredentials(); err == nil {
+		if err := auth.CheckRequiredScopes(creds.Scope); err != nil {
+			logger.Get().Error().Err(err).Str("provider", provider.Name()).Msg("Stored credentials can't be used for CloudCode calls")
+		}
+	}
 
-	// Perform startup auth check
-	logger.Get().Info().Msg("Performing startup authentication check...")
+	// Discover project ID. The loadCodeAssist call doubles as the startup auth check and
+	// is skipped when the env override or a cached discovery result is available.
 	antigravityClient := antigravity.NewClient(provider)
-	loadAssistResponse, err := antigravityClient.LoadCodeAssist()
-	if err != nil {
-		logger.Get().Warn().Err(err).Msg("Startup authentication check failed.")
-	} else {
+	loadAssist := func(ctx context.Context) (*antigravity.LoadCodeAssistResponse, error) {
+		logger.Get().Info().Msg("Performing startup authentication check...")
+		loadAssistResponse, err := antigravityClient.LoadCodeAssist(ctx)
+		if err != nil {
+			logger.Get().Warn().Err(err).Msg("Startup authentication check failed.")
+			return nil, err
+		}
 		tier := fmt.Sprintf("%s (%s)", loadAssistResponse.CurrentTier.Name, loadAssistResponse.CurrentTier.ID)
 		logger.Get().Info().
 			Str("tier", tier).
 			Str("project_id", loadAssistResponse.CloudAICompanionProject).
 			Bool("gcp_managed", loadAssistResponse.GCPManaged).
 			Msg("Startup authentication check successful.")
+		return loadAssistResponse, nil
 	}
 
-	// Discover project ID
 	envProjectID, _ := env.Get("CLOUDCODE_GCP_PROJECT_ID")
-	projectID, err := project.Discover(provider, envProjectID, loadAssistResponse)
+	projectID, err := project.Discover(context.Background(), provider, envProjectID, project.DefaultTimeout, loadAssist)
 	if err != nil {
 		logger.Get().Fatal().Err(err).Msg("Failed to discover project ID")
 	}
@@ -45,8 +80,89 @@ func main() {
 	// Create server with provider and project ID
 	srv := server.NewServer(provider, projectID)
 
-	// Start server
-	if err := srv.Start(":" + port); err != nil {
-		logger.Get().Fatal().Err(err).Msg("Failed to start server")
+	// Optional: additional named accounts selectable via X-Antigravity-Account
+	if registry := accountRegistry(provider); registry != nil {
+		srv.SetAccountRegistry(registry)
+	}
+
+	// Start server; SIGINT/SIGTERM trigger a graceful shutdown that lets streams finish
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- srv.Start(listenAddr) }()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+
+	select {
+	case err := <-serveErr:
+		if err != nil {
+			logger.Get().Fatal().Err(err).Msg("Failed to start server")
+		}
+	case sig := <-signals:
+		timeout := shutdownTimeout()
+		logger.Get().Info().Str("signal", sig.String()).Dur("timeout", timeout).Msg("Received shutdown signal")
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			logger.Get().Error().Err(err).Msg("Graceful shutdown failed")
+		}
+	}
+}
+
+// shutdownTimeout returns how long in-flight requests may run after a shutdown signal,
+// from PROXY_SHUTDOWN_TIMEOUT (default defaultShutdownTimeout).
+func shutdownTimeout() time.Duration {
+	value := env.GetOrDefault("PROXY_SHUTDOWN_TIMEOUT", defaultShutdownTimeout.String())
+	timeout, err := time.ParseDuration(value)
+	if err != nil {
+		logger.Get().Warn().Err(err).Str("value", value).Dur("default", defaultShutdownTimeout).Msg("Invalid PROXY_SHUTDOWN_TIMEOUT, using default")
+		return defaultShutdownTimeout
+	}
+	return timeout
+}
+
+// resolveListenAddr picks the listen address: the --listen flag, then PROXY_LISTEN_ADDR,
+// then PORT (all interfaces, for compatibility), then defaultListenAddr.
+func resolveListenAddr(flagValue string) string {
+	if flagValue != "" {
+		return flagValue
+	}
+	if addr, ok := env.Get("PROXY_LISTEN_ADDR"); ok && addr != "" {
+		return addr
+	}
+	if port, ok := env.Get("PORT"); ok && port != "" {
+		return ":" + port
+	}
+	return defaultListenAddr
+}
+
+// accountRegistry builds the multi-account registry from ANTIGRAVITY_ACCOUNTS, a
+// comma-separated list of account names. Returns nil when no accounts are configured.
+// The startup provider always serves ANTIGRAVITY_DEFAULT_ACCOUNT (default "default").
+func accountRegistry(defaultProvider credentials.CredentialsProvider) *credentials.Registry {
+	raw, ok := env.Get("ANTIGRAVITY_ACCOUNTS")
+	if !ok || strings.TrimSpace(raw) == "" {
+		return nil
 	}
+
+	defaultAccount := env.GetOrDefault("ANTIGRAVITY_DEFAULT_ACCOUNT", "default")
+	registry := credentials.NewRegistry(defaultAccount)
+	registry.Register(defaultAccount, defaultProvider)
+
+	for _, account := range strings.Split(raw, ",") {
+		account = strings.TrimSpace(account)
+		if account == "" || account == defaultAccount {
+			continue
+		}
+		provider, err := credentials.NewFileProviderForAccount(account)
+		if err != nil {
+			logger.Get().Fatal().Err(err).Str("account", account).Msg("Failed to create credentials provider for account")
+		}
+		registry.Register(account, provider)
+	}
+
+	logger.Get().Info().
+		Strs("accounts", registry.Accounts()).
+		Str("default_account", defaultAccount).
+		Msg("Multi-account routing enabled")
+	return registry
 }
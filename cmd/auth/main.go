@@ -33,16 +33,35 @@ func main() {
 		noBrowser = flag.Bool("no-browser", false, "Don\"t attempt to open a browser; paste code/URL manually")
 		verify    = flag.Bool("verify", true, "Verify credentials via loadCodeAssist after saving")
 		printRaw  = flag.Bool("print", false, "Print oauth_creds.json to stdout instead of saving")
+		account   = flag.String("account", "", "Save credentials for a named account (oauth_creds_<account>.json) for use with X-Antigravity-Account")
+		refresh   = flag.Bool("refresh-only", false, "Refresh the stored access token with its refresh_token instead of logging in again")
+		redirect  = flag.String("redirect-uri", credentials.OAuthRedirectURI, "OAuth redirect URI; use port 0 (e.g. http://localhost:0/oauth-callback) to pick a free port")
+		strict    = flag.Bool("strict-port", false, "Fail instead of picking a free port when the redirect URI port is in use")
+		granted   = flag.Bool("include-granted-scopes", true, "Let the token include scopes granted to the client earlier; set to false to get exactly the requested scopes")
+		logLevel  = flag.String("log-level", "", "Minimum log level: trace, debug, info, warn or error (overrides LOG_LEVEL)")
 	)
 	flag.Parse()
 
+	if *logLevel != "" {
+		if err := logger.SetLevel(*logLevel); err != nil {
+			logger.Get().Fatal().Err(err).Msg("Invalid --log-level")
+		}
+	}
+
+	if *refresh {
+		refreshOnly(*account)
+		return
+	}
+
 	logger.Get().Info().Msg("Starting OAuth login flow")
 
 	cfg := auth.Config{
 		ClientID:     credentials.OAuthClientID,
 		ClientSecret: credentials.OAuthClientSecret,
-		RedirectURI:  credentials.OAuthRedirectURI,
+		RedirectURI:  *redirect,
 		Scopes:       defaultScopes,
+
+		ExcludeGrantedScopes: !*granted,
 	}
 
 	state, err := auth.GenerateState()
@@ -51,6 +70,26 @@ func main() {
 	verifier, challenge, err := auth.GeneratePKCEVerifier()
 	fatalIf(err)
 
+	// Bind the callback server before building the auth URL: with port 0 the redirect
+	// URI is only known once the listener is up
+	var callback *auth.CallbackServer
+	if !*noBrowser {
+		if *strict {
+			callback, err = auth.StartCallbackServer(cfg.RedirectURI)
+		} else {
+			callback, err = auth.StartCallbackServerOrFreePort(cfg.RedirectURI)
+		}
+		if err != nil {
+			logger.Get().Warn().Err(err).Msg("Callback server failed; falling back to manual paste mode")
+		} else {
+			defer callback.Close()
+			if callback.PortFallback() {
+				logger.Get().Warn().Str("requested", cfg.RedirectURI).Str("using", callback.RedirectURI()).Msg("Redirect URI port is in use; using a free port instead")
+			}
+			cfg.RedirectURI = callback.RedirectURI()
+		}
+	}
+
 	authURL, err := auth.AuthorizationURL(cfg, state, challenge)
 	fatalIf(err)
 
@@ -64,13 +103,13 @@ func main() {
 	var gotState string
 	fromCallback := false
 
-	if *noBrowser {
+	if callback == nil {
 		code, gotState = readCodeFromStdin()
 	} else {
 		tryOpenBrowser(authURL)
 		ctx, cancel := auth.DefaultTimeoutContext()
 		defer cancel()
-		res, err := auth.WaitForCallback(ctx, cfg.RedirectURI)
+		res, err := callback.Wait(ctx)
 		if err != nil {
 			logger.Get().Warn().Err(err).Msg("Callback server failed; falling back to manual paste mode")
 			code, gotState = readCodeFromStdin()
@@ -97,11 +136,11 @@ func main() {
 		logger.Get().Fatal().Msg("No refresh_token returned; re-run and ensure consent is granted")
 	}
 
-	ui, err := auth.FetchUserInfo(ctx, tokens.AccessToken)
+	email, err := auth.ResolveEmail(ctx, tokens)
 	if err != nil {
-		logger.Get().Warn().Err(err).Msg("Failed to fetch user info")
-	} else if ui.Email != "" {
-		logger.Get().Info().Str("email", ui.Email).Msg("Authenticated")
+		logger.Get().Warn().Err(err).Msg("Failed to resolve account email")
+	} else {
+		logger.Get().Info().Str("email", email).Msg("Authenticated")
 	}
 
 	creds := &credentials.OAuthCredentials{
@@ -111,6 +150,12 @@ func main() {
 		TokenType:    tokens.TokenType,
 		Scope:        tokens.Scope,
 		IDToken:      tokens.IDToken,
+		Email:        email,
+	}
+
+	// Without these every CloudCode call fails with an opaque 403, so stop before saving
+	if err := auth.CheckRequiredScopes(creds.Scope); err != nil {
+		logger.Get().Fatal().Err(err).Msg("Authorization is missing required scopes")
 	}
 
 	if *printRaw {
@@ -120,20 +165,52 @@ func main() {
 		return
 	}
 
-	provider, err := credentials.NewFileProvider()
+	provider, err := credentials.NewFileProviderForAccount(*account)
 	fatalIf(err)
 	fatalIf(provider.SaveCredentials(creds))
 
 	logger.Get().Info().Str("provider", provider.Name()).Msg("Saved credentials")
 
+	// Google may grant fewer scopes than requested (e.g. unchecked consent boxes),
+	// which only surfaces later as permission errors
+	if missing := auth.MissingScopes(cfg.Scopes, creds.Scope); len(missing) > 0 {
+		logger.Get().Warn().
+			Strs("missing_scopes", missing).
+			Msg("Google granted fewer scopes than requested; re-run and grant all permissions on the consent screen")
+	}
+
 	if *verify {
 		client := antigravity.NewClient(provider)
-		_, err := client.LoadCodeAssist()
+		_, err := client.LoadCodeAssist(ctx)
 		fatalIf(err)
 		logger.Get().Info().Msg("loadCodeAssist succeeded")
 	}
 }
 
+// refreshOnly rotates the stored access token using its refresh_token, without a new
+// browser login or consent.
+func refreshOnly(account string) {
+	provider, err := credentials.NewFileProviderForAccount(account)
+	fatalIf(err)
+
+	creds, err := provider.GetCredentials()
+	fatalIf(err)
+	if creds.RefreshToken == "" {
+		logger.Get().Fatal().Str("provider", provider.Name()).Msg("No refresh_token stored; run without -refresh-only to log in again")
+	}
+
+	fatalIf(provider.RefreshToken())
+
+	creds, err = provider.GetCredentials()
+	fatalIf(err)
+	expiry := time.UnixMilli(creds.ExpiryDate)
+	logger.Get().Info().
+		Str("provider", provider.Name()).
+		Time("expires_at", expiry).
+		Dur("valid_for", time.Until(expiry).Round(time.Second)).
+		Msg("Refreshed access token")
+}
+
 func fatalIf(err error) {
 	if err == nil {
 		return
@@ -0,0 +1,44 @@
+package anthropic
+
+import "encoding/json"
+
+// CacheControl marks the end of a prompt-caching prefix, e.g. {"type":"ephemeral"}.
+type CacheControl struct {
+	Type string `json:"type"`
+}
+
+// TextBlock is a text content block.
+type TextBlock struct {
+	Type         string        `json:"type"`
+	Text         string        `json:"text"`
+	CacheControl *CacheControl `json:"cache_control,omitempty"`
+}
+
+// SystemPrompt is the Messages API "system" field. It is either a string or an array
+// of text blocks; both decode into blocks, a string becoming a single text block.
+type SystemPrompt []TextBlock
+
+// UnmarshalJSON accepts both the string and block-array shapes of "system".
+func (s *SystemPrompt) UnmarshalJSON(b []byte) error {
+	if string(b) == "null" {
+		*s = nil
+		return nil
+	}
+
+	var single string
+	if err := json.Unmarshal(b, &single); err == nil {
+		if single == "" {
+			*s = nil
+		} else {
+			*s = SystemPrompt{{Type: "text", Text: single}}
+		}
+		return nil
+	}
+
+	var blocks []TextBlock
+	if err := json.Unmarshal(b, &blocks); err != nil {
+		return err
+	}
+	*s = SystemPrompt(blocks)
+	return nil
+}
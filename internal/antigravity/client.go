@@ -3,17 +3,29 @@ package antigravity
 import (
 	"bufio"
 	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/dvcrn/antigravity-proxy/internal/credentials"
 	serverhttp "github.com/dvcrn/antigravity-proxy/internal/http"
 	"github.com/dvcrn/antigravity-proxy/internal/logger"
+	"github.com/dvcrn/antigravity-proxy/internal/timing"
 )
 
+// ErrCredentials marks failures to obtain or refresh an access token, as opposed to
+// errors returned by upstream itself.
+var ErrCredentials = errors.New("upstream credentials unavailable")
+
 type UpstreamError struct {
 	StatusCode  int
 	Body        []byte
@@ -38,28 +50,106 @@ func (e *UpstreamError) Error() string {
 	return fmt.Sprintf("upstream returned status %d: %s", e.StatusCode, preview)
 }
 
+// ClientOptions configures timeouts for upstream calls.
+type ClientOptions struct {
+	// RequestTimeout bounds each endpoint attempt of non-streaming calls such as
+	// GenerateContent and FetchAvailableModels, including reading the response body, so
+	// a slow endpoint doesn't use up the fallback's time. Zero disables it.
+	RequestTimeout time.Duration
+
+	// StreamIdleTimeout cancels a StreamGenerateContent call when no SSE line
+	// arrives from upstream within the window. Zero disables it.
+	StreamIdleTimeout time.Duration
+
+	// SkipDailyEndpoint sends calls whose responses are decoded into typed structs
+	// (loadCodeAssist, generateContent, fetchAvailableModels) straight to prod, avoiding
+	// the daily endpoint's experimental response shapes. Streaming still tries daily first.
+	SkipDailyEndpoint bool
+
+	// GzipRequestThreshold gzips request bodies larger than this many bytes, sending
+	// them with Content-Encoding: gzip. Zero disables compression.
+	GzipRequestThreshold int
+
+	// ModelsCacheTTL is how long a FetchAvailableModels result is reused before
+	// upstream is asked again. Zero disables caching.
+	ModelsCacheTTL time.Duration
+
+	// RetryEmptyStream reopens a StreamGenerateContent call once when the stream
+	// ends without any content. Lines are held back until content arrives, so
+	// enabling it delays output that precedes the first content event.
+	RetryEmptyStream bool
+}
+
+// DefaultClientOptions returns the timeouts used by NewClient.
+func DefaultClientOptions() ClientOptions {
+	return ClientOptions{
+		RequestTimeout:    5 * time.Minute,
+		StreamIdleTimeout: 2 * time.Minute,
+		ModelsCacheTTL:    5 * time.Minute,
+	}
+}
+
 // Client is a client for the Antigravity Cloud Code API.
 type Client struct {
 	httpClient serverhttp.HTTPClient
 	provider   credentials.CredentialsProvider
+	opts       ClientOptions
+	models     *modelsCache
 }
 
-// NewClient creates a new Antigravity API client.
+// NewClient creates a new Antigravity API client with DefaultClientOptions.
 func NewClient(provider credentials.CredentialsProvider) *Client {
+	return NewClientWithOptions(provider, DefaultClientOptions())
+}
+
+// NewClientWithOptions creates a new Antigravity API client with the given options.
+func NewClientWithOptions(provider credentials.CredentialsProvider, opts ClientOptions) *Client {
 	return &Client{
-		httpClient: serverhttp.NewHTTPClient(),
+		httpClient: serverhttp.NewUpstreamHTTPClient(),
 		provider:   provider,
+		opts:       opts,
+		models:     &modelsCache{},
 	}
 }
 
+// withRequestTimeout derives a context bounded by the configured request timeout, for
+// one endpoint attempt.
+func (c *Client) withRequestTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.opts.RequestTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, c.opts.RequestTimeout)
+}
+
+// decodedEndpoints returns the endpoints to try for calls whose responses are decoded,
+// honoring SkipDailyEndpoint. Falls back to all endpoints if filtering leaves none.
+func (c *Client) decodedEndpoints() []string {
+	if !c.opts.SkipDailyEndpoint {
+		return Endpoints
+	}
+	endpoints := make([]string, 0, len(Endpoints))
+	for _, endpoint := range Endpoints {
+		if endpoint != endpointDaily {
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+	if len(endpoints) == 0 {
+		return Endpoints
+	}
+	return endpoints
+}
+
 func (c *Client) doRequest(ctx context.Context, method string, url string, body []byte, accept string) (*http.Response, error) {
+	rec := timing.FromContext(ctx)
+	credStart := time.Now()
 	creds, err := c.provider.GetCredentials()
+	rec.Since(timing.PhaseCredentials, timing.PhaseCredentialsDesc, credStart)
 	if err != nil {
-		return nil, fmt.Errorf("unable to get credentials: %w", err)
+		return nil, fmt.Errorf("%w: unable to get credentials: %w", ErrCredentials, err)
 	}
 
 	if creds.AccessToken == "" {
-		return nil, fmt.Errorf("access token is empty")
+		return nil, fmt.Errorf("%w: access token is empty", ErrCredentials)
 	}
 
 	resp, err := c.doRequestWithToken(ctx, method, url, body, accept, creds.AccessToken)
@@ -72,36 +162,146 @@ func (c *Client) doRequest(ctx context.Context, method string, url string, body
 	}
 	resp.Body.Close()
 
+	refreshStart := time.Now()
 	if err := c.provider.RefreshToken(); err != nil {
-		return nil, fmt.Errorf("failed to refresh token: %w", err)
+		return nil, fmt.Errorf("%w: failed to refresh token: %w", ErrCredentials, err)
 	}
 
 	refreshedCreds, err := c.provider.GetCredentials()
+	rec.Since(timing.PhaseCredentials, timing.PhaseCredentialsDesc, refreshStart)
 	if err != nil {
-		return nil, fmt.Errorf("failed to reload credentials after refresh: %w", err)
+		return nil, fmt.Errorf("%w: failed to reload credentials after refresh: %w", ErrCredentials, err)
 	}
 
 	return c.doRequestWithToken(ctx, method, url, body, accept, refreshedCreds.AccessToken)
 }
 
 func (c *Client) doRequestWithToken(ctx context.Context, method string, url string, body []byte, accept string, token string) (*http.Response, error) {
+	if c.opts.GzipRequestThreshold > 0 && len(body) > c.opts.GzipRequestThreshold {
+		compressed, err := gzipBody(body)
+		if err != nil {
+			return nil, fmt.Errorf("could not compress request body: %w", err)
+		}
+		resp, err := c.sendRequest(ctx, method, url, compressed, "gzip", accept, token)
+		if err != nil || resp.StatusCode != http.StatusUnsupportedMediaType {
+			return resp, err
+		}
+		// Upstream rejected the encoding; resend the body as-is
+		resp.Body.Close()
+		logger.Get().Warn().Str("url", url).Msg("Upstream rejected gzip request body, retrying uncompressed")
+	}
+
+	return c.sendRequest(ctx, method, url, body, "", accept, token)
+}
+
+func (c *Client) sendRequest(ctx context.Context, method string, url string, body []byte, contentEncoding string, accept string, token string) (*http.Response, error) {
 	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
 	if err != nil {
 		return nil, fmt.Errorf("could not create request: %w", err)
 	}
 
 	ApplyHeaders(req.Header, token, accept)
+	if contentEncoding != "" {
+		req.Header.Set("Content-Encoding", contentEncoding)
+	}
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("request execution error: %w", err)
 	}
 
+	if err := decodeResponseBody(resp); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
 	return resp, nil
 }
 
+// decodeResponseBody wraps resp.Body to decompress a gzip or deflate Content-Encoding.
+// The upstream transport disables transparent decompression for SSE, so nothing else
+// undoes it.
+func decodeResponseBody(resp *http.Response) error {
+	if resp.Uncompressed {
+		return nil
+	}
+	var reader io.ReadCloser
+	switch strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding"))) {
+	case "gzip", "x-gzip":
+		zr, err := gzip.NewReader(resp.Body)
+		if errors.Is(err, io.EOF) {
+			// Empty body despite the header
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("could not decode gzip response body: %w", err)
+		}
+		reader = zr
+	case "deflate":
+		// "deflate" is meant to be zlib-wrapped, but some servers send raw deflate
+		br := bufio.NewReader(resp.Body)
+		if header, err := br.Peek(2); err == nil && isZlibHeader(header) {
+			zr, err := zlib.NewReader(br)
+			if err != nil {
+				return fmt.Errorf("could not decode deflate response body: %w", err)
+			}
+			reader = zr
+		} else {
+			reader = flate.NewReader(br)
+		}
+	default:
+		return nil
+	}
+
+	resp.Body = &decodedBody{ReadCloser: reader, raw: resp.Body}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	return nil
+}
+
+// isZlibHeader reports whether b starts a zlib stream (RFC 1950): deflate method and a
+// header checksum divisible by 31.
+func isZlibHeader(b []byte) bool {
+	return b[0]&0x0f == 8 && (uint16(b[0])<<8|uint16(b[1]))%31 == 0
+}
+
+// decodedBody closes both the decompressor and the underlying response body.
+type decodedBody struct {
+	io.ReadCloser
+	raw io.ReadCloser
+}
+
+func (b *decodedBody) Close() error {
+	b.ReadCloser.Close()
+	return b.raw.Close()
+}
+
+// gzipBody compresses a request body.
+func gzipBody(body []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(body); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// AccountEmail returns the email saved with the client's credentials at login, or "" if
+// none was saved (credentials from before the email was recorded) or they can't be read.
+func (c *Client) AccountEmail() string {
+	creds, err := c.provider.GetCredentials()
+	if err != nil {
+		return ""
+	}
+	return creds.Email
+}
+
 // LoadCodeAssist performs a request to the Cloud Code API to check if the credentials are valid.
-func (c *Client) LoadCodeAssist() (*LoadCodeAssistResponse, error) {
+func (c *Client) LoadCodeAssist(ctx context.Context) (*LoadCodeAssistResponse, error) {
 	requestBody := LoadCodeAssistRequest{
 		Metadata: Metadata{
 			IdeType:    "IDE_UNSPECIFIED",
@@ -116,9 +316,9 @@ func (c *Client) LoadCodeAssist() (*LoadCodeAssistResponse, error) {
 	}
 
 	var lastErr error
-	for _, endpoint := range Endpoints {
+	for _, endpoint := range c.decodedEndpoints() {
 		url := fmt.Sprintf("%s/v1internal:loadCodeAssist", endpoint)
-		resp, err := c.doRequest(context.Background(), "POST", url, bodyBytes, "application/json")
+		resp, err := c.doRequest(ctx, "POST", url, bodyBytes, "application/json")
 		if err != nil {
 			lastErr = err
 			logger.Get().Warn().Err(err).Str("endpoint", endpoint).Msg("loadCodeAssist request failed")
@@ -134,7 +334,12 @@ func (c *Client) LoadCodeAssist() (*LoadCodeAssistResponse, error) {
 		}
 
 		if resp.StatusCode != http.StatusOK {
-			lastErr = fmt.Errorf("auth check failed with status %d: %s", resp.StatusCode, string(respBody))
+			lastErr = &UpstreamError{
+				StatusCode:  resp.StatusCode,
+				Body:        respBody,
+				ContentType: resp.Header.Get("Content-Type"),
+				Endpoint:    endpoint,
+			}
 			logger.Get().Warn().
 				Int("status", resp.StatusCode).
 				Str("endpoint", endpoint).
@@ -157,19 +362,19 @@ func (c *Client) LoadCodeAssist() (*LoadCodeAssistResponse, error) {
 }
 
 // GenerateContent performs a request to the Cloud Code API to generate content.
-func (c *Client) GenerateContent(req *GenerateContentRequest) (*GenerateContentResponse, error) {
-	prepareAntigravityRequest(req)
-
-	bodyBytes, err := json.Marshal(req)
+func (c *Client) GenerateContent(ctx context.Context, req *GenerateContentRequest) (*GenerateContentResponse, error) {
+	bodyBytes, err := RequestBody(ctx, req)
 	if err != nil {
-		return nil, fmt.Errorf("could not marshal request body: %w", err)
+		return nil, err
 	}
 
 	var lastErr error
-	for _, endpoint := range Endpoints {
+	for _, endpoint := range endpointsForModel(req.Model, c.decodedEndpoints()) {
 		url := fmt.Sprintf("%s/v1internal:generateContent", endpoint)
-		resp, err := c.doRequest(context.Background(), "POST", url, bodyBytes, "application/json")
+		attemptCtx, cancel := c.withRequestTimeout(ctx)
+		resp, err := c.doRequest(attemptCtx, "POST", url, bodyBytes, "application/json")
 		if err != nil {
+			cancel()
 			lastErr = err
 			logger.Get().Warn().Err(err).Str("endpoint", endpoint).Msg("generateContent request failed")
 			continue
@@ -177,6 +382,7 @@ func (c *Client) GenerateContent(req *GenerateContentRequest) (*GenerateContentR
 
 		respBody, err := ioutil.ReadAll(resp.Body)
 		resp.Body.Close()
+		cancel()
 		if err != nil {
 			lastErr = fmt.Errorf("could not read response body: %w", err)
 			logger.Get().Warn().Err(err).Str("endpoint", endpoint).Msg("generateContent response read failed")
@@ -201,6 +407,15 @@ func (c *Client) GenerateContent(req *GenerateContentRequest) (*GenerateContentR
 		if err := json.Unmarshal(respBody, &result); err != nil {
 			return nil, fmt.Errorf("could not unmarshal response body: %w", err)
 		}
+		// Some responses carry candidates at the top level without the "response" wrapper
+		if result.Response == nil {
+			var unwrapped map[string]interface{}
+			if err := json.Unmarshal(respBody, &unwrapped); err == nil {
+				if _, ok := unwrapped["candidates"]; ok {
+					result.Response = unwrapped
+				}
+			}
+		}
 
 		return &result, nil
 	}
@@ -215,81 +430,254 @@ func (c *Client) GenerateContent(req *GenerateContentRequest) (*GenerateContentR
 // It does not transform or interpret SSE content; lines are forwarded as-is.
 // The caller owns the lifecycle of the 'out' channel; this function will not close it.
 func (c *Client) StreamGenerateContent(ctx context.Context, req *GenerateContentRequest, out chan<- string) error {
-	prepareAntigravityRequest(req)
-
-	bodyBytes, err := json.Marshal(req)
+	bodyBytes, err := RequestBody(ctx, req)
 	if err != nil {
-		return fmt.Errorf("could not marshal request body: %w", err)
+		return err
 	}
 
+	endpoints := endpointsForModel(req.Model, Endpoints)
 	var lastErr error
-	for _, endpoint := range Endpoints {
-		url := fmt.Sprintf("%s/v1internal:streamGenerateContent?alt=sse", endpoint)
-		resp, err := c.doRequest(ctx, "POST", url, bodyBytes, "text/event-stream")
+	for i, endpoint := range endpoints {
+		resp, streamCtx, cancel, err := c.openStream(ctx, endpoint, bodyBytes)
 		if err != nil {
 			lastErr = err
-			logger.Get().Warn().Err(err).Str("endpoint", endpoint).Msg("streamGenerateContent request failed")
 			continue
 		}
 
-		if resp.StatusCode != http.StatusOK {
-			respBody, readErr := ioutil.ReadAll(resp.Body)
-			resp.Body.Close()
-			if readErr != nil {
-				lastErr = fmt.Errorf("streamGenerateContent failed with status %d and read error: %v", resp.StatusCode, readErr)
-				logger.Get().Warn().Err(readErr).Str("endpoint", endpoint).Msg("streamGenerateContent response read failed")
-				continue
-			}
+		// An empty stream is retried once on the next endpoint, or the same one when
+		// it is the last.
+		retryEndpoint := endpoint
+		if i+1 < len(endpoints) {
+			retryEndpoint = endpoints[i+1]
+		}
+		go c.forwardStream(ctx, bodyBytes, retryEndpoint, resp, streamCtx, cancel, endpoint, out)
 
-			const maxPreview = 1024
-			rprev := string(respBody)
-			if len(rprev) > maxPreview {
-				rprev = rprev[:maxPreview] + "..."
-			}
-			qprev := string(bodyBytes)
-			if len(qprev) > maxPreview {
-				qprev = qprev[:maxPreview] + "..."
-			}
-			logger.Get().Error().
-				Int("status", resp.StatusCode).
-				Str("endpoint", endpoint).
-				Int("response_body_len", len(respBody)).
-				Str("response_body_preview", rprev).
-				Int("request_body_len", len(bodyBytes)).
-				Str("request_body_preview", qprev).
-				Msg("Upstream error on streamGenerateContent")
+		return nil
+	}
 
-			lastErr = &UpstreamError{
-				StatusCode:  resp.StatusCode,
-				Body:        respBody,
-				ContentType: resp.Header.Get("Content-Type"),
-				Endpoint:    endpoint,
+	if lastErr != nil {
+		return lastErr
+	}
+	return fmt.Errorf("streamGenerateContent failed with no endpoints available")
+}
+
+// openStream starts a streamGenerateContent call on endpoint. On success the caller
+// owns the response body and must call cancel once done with it.
+func (c *Client) openStream(ctx context.Context, endpoint string, bodyBytes []byte) (*http.Response, context.Context, context.CancelFunc, error) {
+	url := fmt.Sprintf("%s/v1internal:streamGenerateContent?alt=sse", endpoint)
+	streamCtx, cancel := context.WithCancel(ctx)
+	resp, err := c.doRequest(streamCtx, "POST", url, bodyBytes, "text/event-stream")
+	if err != nil {
+		cancel()
+		logger.Get().Warn().Err(err).Str("endpoint", endpoint).Msg("streamGenerateContent request failed")
+		return nil, nil, nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, readErr := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		cancel()
+		if readErr != nil {
+			logger.Get().Warn().Err(readErr).Str("endpoint", endpoint).Msg("streamGenerateContent response read failed")
+			return nil, nil, nil, fmt.Errorf("streamGenerateContent error body read failed: %v: %w", readErr, &UpstreamError{
+				StatusCode: resp.StatusCode,
+				Endpoint:   endpoint,
+			})
+		}
+
+		const maxPreview = 1024
+		rprev := string(respBody)
+		if len(rprev) > maxPreview {
+			rprev = rprev[:maxPreview] + "..."
+		}
+		qprev := string(bodyBytes)
+		if !contentLoggingAllowed(ctx) {
+			qprev = ""
+		} else if len(qprev) > maxPreview {
+			qprev = qprev[:maxPreview] + "..."
+		}
+		logger.Get().Error().
+			Int("status", resp.StatusCode).
+			Str("endpoint", endpoint).
+			Int("response_body_len", len(respBody)).
+			Str("response_body_preview", rprev).
+			Int("request_body_len", len(bodyBytes)).
+			Str("request_body_preview", qprev).
+			Msg("Upstream error on streamGenerateContent")
+
+		return nil, nil, nil, &UpstreamError{
+			StatusCode:  resp.StatusCode,
+			Body:        respBody,
+			ContentType: resp.Header.Get("Content-Type"),
+			Endpoint:    endpoint,
+		}
+	}
+
+	return resp, streamCtx, cancel, nil
+}
+
+// forwardStream pipes an open stream's lines to out and closes it when done. With
+// RetryEmptyStream set, lines are held back until one carries content; a stream that
+// ends without any is discarded and reopened once on retryEndpoint. If the retry
+// can't be opened, the held lines of the first stream are sent instead.
+func (c *Client) forwardStream(ctx context.Context, bodyBytes []byte, retryEndpoint string, resp *http.Response, streamCtx context.Context, cancel context.CancelFunc, endpoint string, out chan<- string) {
+	defer close(out)
+
+	held, empty := c.pipeStream(resp, streamCtx, cancel, endpoint, out, c.opts.RetryEmptyStream)
+	if !empty || ctx.Err() != nil {
+		return
+	}
+
+	logger.Get().Warn().
+		Str("endpoint", endpoint).
+		Str("retry_endpoint", retryEndpoint).
+		Int("lines", len(held)).
+		Msg("Upstream stream ended without content; retrying")
+
+	resp, streamCtx, cancel, err := c.openStream(ctx, retryEndpoint, bodyBytes)
+	if err != nil {
+		logger.Get().Warn().Err(err).Str("endpoint", retryEndpoint).Msg("Empty stream retry failed; sending original stream")
+		for _, line := range held {
+			select {
+			case out <- line:
+			case <-ctx.Done():
+				return
 			}
-			continue
 		}
+		return
+	}
+	c.pipeStream(resp, streamCtx, cancel, retryEndpoint, out, false)
+}
+
+// pipeStream sends the stream's lines to out until it ends, then closes the body and
+// cancels streamCtx. When hold is set, lines are buffered until the first one with
+// content and returned along with empty=true if none ever had any.
+func (c *Client) pipeStream(resp *http.Response, streamCtx context.Context, cancel context.CancelFunc, endpoint string, out chan<- string, hold bool) (held []string, empty bool) {
+	defer cancel()
+	defer resp.Body.Close()
+
+	// Cancel the upstream request if no line arrives within the idle window.
+	// Cancelling the context unblocks the scanner with a read error.
+	idleTimeout := c.opts.StreamIdleTimeout
+	var idleTimer *time.Timer
+	if idleTimeout > 0 {
+		idleTimer = time.AfterFunc(idleTimeout, func() {
+			logger.Get().Warn().
+				Dur("idle_timeout", idleTimeout).
+				Str("endpoint", endpoint).
+				Msg("Upstream SSE stream idle; cancelling")
+			cancel()
+		})
+		defer idleTimer.Stop()
+	}
 
-		// Start a goroutine to stream lines to the provided channel.
-		go func() {
-			defer resp.Body.Close()
-			defer close(out)
+	send := func(line string) bool {
+		select {
+		case out <- line:
+			return true
+		case <-streamCtx.Done():
+			logger.Get().Info().Err(streamCtx.Err()).Msg("Upstream SSE stream cancelled")
+			return false
+		}
+	}
 
-			scanner := bufio.NewScanner(resp.Body)
-			// Increase the scanner buffer for large SSE events
-			scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	scanner := bufio.NewScanner(resp.Body)
+	// Increase the scanner buffer for large SSE events
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
 
-			for scanner.Scan() {
-				out <- scanner.Text()
+	// eventStart is where the current, not yet terminated event begins in held
+	eventStart := 0
+	for scanner.Scan() {
+		// Don't count time spent waiting on a slow consumer as upstream idle time
+		if idleTimer != nil {
+			idleTimer.Stop()
+		}
+		line := scanner.Text()
+		if hold {
+			held = append(held, line)
+			// Events can split their data over several lines, so check whole events
+			if line != "" || !eventHasContent(held[eventStart:]) {
+				if line == "" {
+					eventStart = len(held)
+				}
+				if idleTimer != nil {
+					idleTimer.Reset(idleTimeout)
+				}
+				continue
 			}
-			if err := scanner.Err(); err != nil {
-				logger.Get().Warn().Err(err).Msg("Upstream SSE scanner error")
+			hold = false
+			for _, l := range held {
+				if !send(l) {
+					return nil, false
+				}
+			}
+			held = nil
+		} else if !send(line) {
+			return nil, false
+		}
+		if idleTimer != nil {
+			idleTimer.Reset(idleTimeout)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		if streamCtx.Err() != nil {
+			logger.Get().Info().Err(streamCtx.Err()).Msg("Upstream SSE stream cancelled")
+		} else {
+			logger.Get().Warn().Err(err).Msg("Upstream SSE scanner error")
+		}
+	}
+	// A final event upstream didn't terminate with a blank line
+	if hold && eventHasContent(held[eventStart:]) {
+		for _, l := range held {
+			if !send(l) {
+				break
 			}
-		}()
+		}
+		return nil, false
+	}
+	return held, hold
+}
 
-		return nil
+// eventHasContent reports whether the lines of one SSE event, with multi-line data
+// joined, carry model output (see lineHasContent).
+func eventHasContent(lines []string) bool {
+	for _, line := range MergeSSEData(lines) {
+		if lineHasContent(line) {
+			return true
+		}
 	}
+	return false
+}
 
-	if lastErr != nil {
-		return lastErr
+// lineHasContent reports whether an SSE line is a data event whose candidates carry
+// model output: text, thoughts, function calls or inline data.
+func lineHasContent(line string) bool {
+	payload, ok := strings.CutPrefix(line, "data:")
+	if !ok {
+		return false
 	}
-	return fmt.Errorf("streamGenerateContent failed with no endpoints available")
+	type candidate struct {
+		Content Content `json:"content"`
+	}
+	var event struct {
+		Response *struct {
+			Candidates []candidate `json:"candidates"`
+		} `json:"response"`
+		Candidates []candidate `json:"candidates"`
+	}
+	if json.Unmarshal([]byte(strings.TrimSpace(payload)), &event) != nil {
+		return false
+	}
+	candidates := event.Candidates
+	if event.Response != nil {
+		candidates = append(candidates, event.Response.Candidates...)
+	}
+	for _, cand := range candidates {
+		for _, part := range cand.Content.Parts {
+			if part.Text != "" || part.FunctionCall != nil || part.InlineData != nil {
+				return true
+			}
+		}
+	}
+	return false
 }
@@ -0,0 +1,399 @@
+package antigravity
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dvcrn/antigravity-proxy/internal/credentials"
+)
+
+type staticProvider struct{}
+
+func (staticProvider) GetCredentials() (*credentials.OAuthCredentials, error) {
+	return &credentials.OAuthCredentials{AccessToken: "token"}, nil
+}
+func (staticProvider) SaveCredentials(*credentials.OAuthCredentials) error { return nil }
+func (staticProvider) RefreshToken() error                                 { return nil }
+func (staticProvider) Name() string                                        { return "static" }
+
+// hangingHTTPClient returns a 200 response whose body emits the given lines and then
+// blocks until the request context is cancelled.
+type hangingHTTPClient struct {
+	lines []string
+}
+
+func (h hangingHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	pr, pw := io.Pipe()
+	go func() {
+		for _, l := range h.lines {
+			_, _ = io.WriteString(pw, l+"\n")
+		}
+		<-req.Context().Done()
+		pw.CloseWithError(req.Context().Err())
+	}()
+	return &http.Response{StatusCode: http.StatusOK, Body: pr, Header: http.Header{}}, nil
+}
+
+func TestStreamGenerateContentIdleTimeoutClosesChannel(t *testing.T) {
+	c := &Client{
+		httpClient: hangingHTTPClient{lines: []string{"data: {}"}},
+		provider:   staticProvider{},
+		opts:       ClientOptions{StreamIdleTimeout: 50 * time.Millisecond},
+	}
+
+	out := make(chan string, 4)
+	if err := c.StreamGenerateContent(context.Background(), &GenerateContentRequest{Model: "gemini-3-flash"}, out); err != nil {
+		t.Fatalf("StreamGenerateContent returned error: %v", err)
+	}
+
+	var got []string
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case line, ok := <-out:
+			if !ok {
+				if len(got) != 1 || got[0] != "data: {}" {
+					t.Errorf("expected the single upstream line before idle close, got %v", got)
+				}
+				return
+			}
+			got = append(got, line)
+		case <-timeout:
+			t.Fatal("stream was not closed after idle timeout")
+		}
+	}
+}
+
+func TestStreamGenerateContentContextCancelClosesChannel(t *testing.T) {
+	c := &Client{
+		httpClient: hangingHTTPClient{},
+		provider:   staticProvider{},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	out := make(chan string)
+	if err := c.StreamGenerateContent(ctx, &GenerateContentRequest{Model: "gemini-3-flash"}, out); err != nil {
+		t.Fatalf("StreamGenerateContent returned error: %v", err)
+	}
+	cancel()
+
+	select {
+	case _, ok := <-out:
+		if ok {
+			t.Fatal("expected no lines after cancellation")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("stream was not closed after context cancellation")
+	}
+}
+
+func TestDecodedEndpointsSkipDaily(t *testing.T) {
+	origEndpoints := Endpoints
+	Endpoints = []string{endpointDaily, endpointProd}
+	defer func() { Endpoints = origEndpoints }()
+
+	c := NewClientWithOptions(staticProvider{}, ClientOptions{})
+	if got := c.decodedEndpoints(); len(got) != 2 {
+		t.Errorf("expected both endpoints by default, got %v", got)
+	}
+
+	c = NewClientWithOptions(staticProvider{}, ClientOptions{SkipDailyEndpoint: true})
+	if got := c.decodedEndpoints(); len(got) != 1 || got[0] != endpointProd {
+		t.Errorf("expected only prod endpoint, got %v", got)
+	}
+}
+
+// modelsHTTPClient answers fetchAvailableModels calls, blocking each until release is
+// closed and failing them while fail is set.
+type modelsHTTPClient struct {
+	calls   atomic.Int32
+	fail    atomic.Bool
+	release chan struct{}
+}
+
+func (m *modelsHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	m.calls.Add(1)
+	<-m.release
+	if m.fail.Load() {
+		return &http.Response{StatusCode: http.StatusInternalServerError, Body: io.NopCloser(strings.NewReader("boom")), Header: http.Header{}}, nil
+	}
+	body := `{"models":{"gemini-3-pro":{"displayName":"Gemini 3 Pro"}}}`
+	return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(body)), Header: http.Header{}}, nil
+}
+
+func TestFetchAvailableModelsCache(t *testing.T) {
+	origEndpoints := Endpoints
+	Endpoints = []string{"http://upstream.test"}
+	defer func() { Endpoints = origEndpoints }()
+
+	httpClient := &modelsHTTPClient{release: make(chan struct{})}
+	c := &Client{
+		httpClient: httpClient,
+		provider:   staticProvider{},
+		opts:       ClientOptions{ModelsCacheTTL: time.Minute},
+		models:     &modelsCache{},
+	}
+
+	// Concurrent callers share a single upstream request
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := c.FetchAvailableModels(context.Background())
+			errs <- err
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(httpClient.release)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("FetchAvailableModels returned error: %v", err)
+		}
+	}
+	if got := httpClient.calls.Load(); got != 1 {
+		t.Errorf("upstream calls = %d, want 1", got)
+	}
+
+	// Fresh results are served from the cache
+	if _, err := c.FetchAvailableModels(context.Background()); err != nil {
+		t.Fatalf("FetchAvailableModels returned error: %v", err)
+	}
+	if got := httpClient.calls.Load(); got != 1 {
+		t.Errorf("upstream calls after cached fetch = %d, want 1", got)
+	}
+
+	// Once expired, an upstream failure falls back to the stale list
+	c.models.fetchedAt = time.Now().Add(-2 * time.Minute)
+	httpClient.fail.Store(true)
+	resp, err := c.FetchAvailableModels(context.Background())
+	if err != nil {
+		t.Fatalf("expected stale models on upstream failure, got error: %v", err)
+	}
+	if _, ok := resp.Models["gemini-3-pro"]; !ok {
+		t.Errorf("stale models = %v, want gemini-3-pro", resp.Models)
+	}
+	if got := httpClient.calls.Load(); got != 2 {
+		t.Errorf("upstream calls after expiry = %d, want 2", got)
+	}
+}
+
+func TestFetchAvailableModelsErrorWithoutCache(t *testing.T) {
+	origEndpoints := Endpoints
+	Endpoints = []string{"http://upstream.test"}
+	defer func() { Endpoints = origEndpoints }()
+
+	httpClient := &modelsHTTPClient{release: make(chan struct{})}
+	close(httpClient.release)
+	httpClient.fail.Store(true)
+	c := &Client{
+		httpClient: httpClient,
+		provider:   staticProvider{},
+		opts:       ClientOptions{ModelsCacheTTL: time.Minute},
+		models:     &modelsCache{},
+	}
+
+	if _, err := c.FetchAvailableModels(context.Background()); err == nil {
+		t.Fatal("expected error when upstream fails with nothing cached")
+	}
+}
+
+func TestDoRequestGzipsLargeBodies(t *testing.T) {
+	type received struct {
+		encoding string
+		body     string
+	}
+	var got []received
+	reject := false
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reader io.Reader = r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			if reject {
+				w.WriteHeader(http.StatusUnsupportedMediaType)
+				got = append(got, received{encoding: "gzip"})
+				return
+			}
+			zr, err := gzip.NewReader(r.Body)
+			if err != nil {
+				t.Errorf("invalid gzip body: %v", err)
+				return
+			}
+			reader = zr
+		}
+		body, _ := io.ReadAll(reader)
+		got = append(got, received{encoding: r.Header.Get("Content-Encoding"), body: string(body)})
+	}))
+	defer upstream.Close()
+
+	c := NewClientWithOptions(staticProvider{}, ClientOptions{GzipRequestThreshold: 64})
+	small := `{"contents":[]}`
+	large := `{"contents":"` + strings.Repeat("x", 200) + `"}`
+
+	testCases := []struct {
+		name     string
+		body     string
+		reject   bool
+		expected []received
+	}{
+		{name: "small body is sent as-is", body: small, expected: []received{{body: small}}},
+		{name: "large body is gzipped", body: large, expected: []received{{encoding: "gzip", body: large}}},
+		{name: "415 falls back to uncompressed", body: large, reject: true, expected: []received{{encoding: "gzip"}, {body: large}}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got = nil
+			reject = tc.reject
+			resp, err := c.doRequest(context.Background(), http.MethodPost, upstream.URL, []byte(tc.body), "application/json")
+			if err != nil {
+				t.Fatalf("doRequest returned error: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Errorf("status = %d, want 200", resp.StatusCode)
+			}
+			if len(got) != len(tc.expected) {
+				t.Fatalf("upstream received %+v, want %+v", got, tc.expected)
+			}
+			for i := range tc.expected {
+				if got[i] != tc.expected[i] {
+					t.Errorf("request %d = %+v, want %+v", i, got[i], tc.expected[i])
+				}
+			}
+		})
+	}
+}
+
+func TestGenerateContentDecodesCompressedResponses(t *testing.T) {
+	const payload = `{"response":{"candidates":[{"content":{"role":"model","parts":[{"text":"hi"}]}}]}}`
+	compress := map[string]func(io.Writer) io.WriteCloser{
+		"gzip":    func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) },
+		"deflate": func(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) },
+		"raw deflate": func(w io.Writer) io.WriteCloser {
+			fw, _ := flate.NewWriter(w, flate.DefaultCompression)
+			return fw
+		},
+	}
+
+	for name, newWriter := range compress {
+		t.Run(name, func(t *testing.T) {
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Set("Content-Encoding", strings.TrimPrefix(name, "raw "))
+				zw := newWriter(w)
+				_, _ = io.WriteString(zw, payload)
+				zw.Close()
+			}))
+			defer upstream.Close()
+			origEndpoints := Endpoints
+			Endpoints = []string{upstream.URL}
+			defer func() { Endpoints = origEndpoints }()
+
+			c := NewClient(staticProvider{})
+			resp, err := c.GenerateContent(context.Background(), &GenerateContentRequest{Model: "gemini-3-flash"})
+			if err != nil {
+				t.Fatalf("GenerateContent returned error: %v", err)
+			}
+			candidates, ok := resp.Response["candidates"].([]interface{})
+			if !ok || len(candidates) != 1 {
+				t.Errorf("expected the decoded response candidates, got %+v", resp.Response)
+			}
+		})
+	}
+}
+
+func TestGenerateContentTimesOutEachEndpointAttempt(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Disconnects are only noticed once the body is consumed
+		_, _ = io.Copy(io.Discard, r.Body)
+		<-r.Context().Done()
+	}))
+	defer slow.Close()
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, `{"response":{"candidates":[]}}`)
+	}))
+	defer fast.Close()
+	origEndpoints := Endpoints
+	Endpoints = []string{slow.URL, fast.URL}
+	defer func() { Endpoints = origEndpoints }()
+
+	// The slow endpoint uses up its own timeout; the fallback still gets a full one
+	c := NewClientWithOptions(staticProvider{}, ClientOptions{RequestTimeout: 100 * time.Millisecond})
+	if _, err := c.GenerateContent(context.Background(), &GenerateContentRequest{Model: "gemini-3-flash"}); err != nil {
+		t.Fatalf("GenerateContent returned error: %v", err)
+	}
+}
+
+func TestStreamGenerateContentRetriesEmptyStream(t *testing.T) {
+	const (
+		emptyLine   = `data: {"response":{"candidates":[{"content":{"role":"model","parts":[]}}],"usageMetadata":{"promptTokenCount":3}}}`
+		contentLine = `data: {"response":{"candidates":[{"content":{"role":"model","parts":[{"text":"hi"}]}}]}}`
+	)
+	splitContent := []string{
+		`data: {"response":{"candidates":[{"content":{"role":"model",`,
+		`data: "parts":[{"text":"hi"}]}}]}}`,
+	}
+	tests := []struct {
+		name      string
+		retry     bool
+		first     []string
+		wantCalls int32
+		wantLines []string
+	}{
+		{name: "retry enabled", retry: true, first: []string{emptyLine, ""}, wantCalls: 2, wantLines: []string{contentLine, ""}},
+		{name: "retry disabled", retry: false, first: []string{emptyLine, ""}, wantCalls: 1, wantLines: []string{emptyLine, ""}},
+		{name: "content split over data lines", retry: true, first: append(splitContent, ""), wantCalls: 1, wantLines: append(splitContent, "")},
+		{
+			name: "unterminated final content event", retry: true, first: []string{emptyLine, "", contentLine}, wantCalls: 1,
+			wantLines: []string{emptyLine, "", contentLine},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/event-stream")
+				if calls.Add(1) == 1 {
+					_, _ = io.WriteString(w, strings.Join(tt.first, "\n")+"\n")
+					return
+				}
+				_, _ = io.WriteString(w, contentLine+"\n\n")
+			}))
+			defer upstream.Close()
+			origEndpoints := Endpoints
+			Endpoints = []string{upstream.URL}
+			defer func() { Endpoints = origEndpoints }()
+
+			c := NewClientWithOptions(staticProvider{}, ClientOptions{RetryEmptyStream: tt.retry})
+			out := make(chan string, 8)
+			if err := c.StreamGenerateContent(context.Background(), &GenerateContentRequest{Model: "gemini-3-flash"}, out); err != nil {
+				t.Fatalf("StreamGenerateContent returned error: %v", err)
+			}
+
+			var got []string
+			for line := range out {
+				got = append(got, line)
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.wantLines, "\n") {
+				t.Errorf("lines = %q, want %q", got, tt.wantLines)
+			}
+			if n := calls.Load(); n != tt.wantCalls {
+				t.Errorf("upstream calls = %d, want %d", n, tt.wantCalls)
+			}
+		})
+	}
+}
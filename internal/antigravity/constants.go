@@ -4,12 +4,14 @@ import (
 	"fmt"
 	"net/http"
 	"runtime"
+
+	"github.com/dvcrn/antigravity-proxy/internal/env"
 )
 
 const (
 	endpointDaily         = "https://daily-cloudcode-pa.googleapis.com"
 	endpointProd          = "https://cloudcode-pa.googleapis.com"
-	userAgentVersion      = "1.15.8"
+	defaultClientVersion  = "1.15.8"
 	RequestUserAgent      = "antigravity"
 	RequestTypeAgent      = "agent"
 	SystemInstructionText = "You are Antigravity, a powerful agentic AI coding assistant designed by the Google Deepmind team working on Advanced Agentic Coding.You are pair programming with a USER to solve their coding task. The task may require creating a new codebase, modifying or debugging an existing codebase, or simply answering a question.**Absolute paths only****Proactiveness**"
@@ -21,10 +23,21 @@ var Endpoints = []string{
 	endpointProd,
 }
 
-const clientMetadataHeader = `{"ideType":"IDE_UNSPECIFIED","platform":"PLATFORM_UNSPECIFIED","pluginType":"GEMINI"}`
+// Default client identification headers; each can be overridden by env so a client
+// version bump upstream doesn't need a rebuild.
+const (
+	defaultClientMetadata = `{"ideType":"IDE_UNSPECIFIED","platform":"PLATFORM_UNSPECIFIED","pluginType":"GEMINI"}`
+	defaultAPIClient      = "google-cloud-sdk vscode_cloudshelleditor/0.1"
+)
+
+// UserAgentVersion returns the Antigravity client version the proxy reports upstream:
+// ANTIGRAVITY_CLIENT_VERSION, or the built-in version when unset.
+func UserAgentVersion() string {
+	return env.GetOrDefault("ANTIGRAVITY_CLIENT_VERSION", defaultClientVersion)
+}
 
 func platformUserAgent() string {
-	return fmt.Sprintf("antigravity/%s %s/%s", userAgentVersion, runtime.GOOS, runtime.GOARCH)
+	return fmt.Sprintf("antigravity/%s %s/%s", UserAgentVersion(), runtime.GOOS, runtime.GOARCH)
 }
 
 func ApplyHeaders(header http.Header, token string, accept string) {
@@ -34,7 +47,7 @@ func ApplyHeaders(header http.Header, token string, accept string) {
 	header.Set("Authorization", "Bearer "+token)
 	header.Set("Content-Type", "application/json")
 	header.Set("User-Agent", platformUserAgent())
-	header.Set("X-Goog-Api-Client", "google-cloud-sdk vscode_cloudshelleditor/0.1")
-	header.Set("Client-Metadata", clientMetadataHeader)
+	header.Set("X-Goog-Api-Client", env.GetOrDefault("ANTIGRAVITY_API_CLIENT", defaultAPIClient))
+	header.Set("Client-Metadata", env.GetOrDefault("ANTIGRAVITY_CLIENT_METADATA", defaultClientMetadata))
 	header.Set("Accept", accept)
 }
@@ -0,0 +1,58 @@
+package antigravity
+
+import (
+	"net/http"
+	"runtime"
+	"testing"
+)
+
+func TestApplyHeadersClientIdentity(t *testing.T) {
+	testCases := []struct {
+		name           string
+		env            map[string]string
+		wantUserAgent  string
+		wantAPIClient  string
+		wantClientMeta string
+	}{
+		{
+			name:           "defaults",
+			wantUserAgent:  "antigravity/" + defaultClientVersion + " " + runtime.GOOS + "/" + runtime.GOARCH,
+			wantAPIClient:  defaultAPIClient,
+			wantClientMeta: defaultClientMetadata,
+		},
+		{
+			name: "overridden by env",
+			env: map[string]string{
+				"ANTIGRAVITY_CLIENT_VERSION":  "2.0.1",
+				"ANTIGRAVITY_API_CLIENT":      "google-cloud-sdk vscode_cloudshelleditor/0.2",
+				"ANTIGRAVITY_CLIENT_METADATA": `{"ideType":"ANTIGRAVITY","pluginType":"GEMINI"}`,
+			},
+			wantUserAgent:  "antigravity/2.0.1 " + runtime.GOOS + "/" + runtime.GOARCH,
+			wantAPIClient:  "google-cloud-sdk vscode_cloudshelleditor/0.2",
+			wantClientMeta: `{"ideType":"ANTIGRAVITY","pluginType":"GEMINI"}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, key := range []string{"ANTIGRAVITY_CLIENT_VERSION", "ANTIGRAVITY_API_CLIENT", "ANTIGRAVITY_CLIENT_METADATA"} {
+				t.Setenv(key, tc.env[key])
+			}
+
+			header := http.Header{}
+			ApplyHeaders(header, "token", "")
+			if got := header.Get("User-Agent"); got != tc.wantUserAgent {
+				t.Errorf("User-Agent = %q, want %q", got, tc.wantUserAgent)
+			}
+			if got := header.Get("X-Goog-Api-Client"); got != tc.wantAPIClient {
+				t.Errorf("X-Goog-Api-Client = %q, want %q", got, tc.wantAPIClient)
+			}
+			if got := header.Get("Client-Metadata"); got != tc.wantClientMeta {
+				t.Errorf("Client-Metadata = %q, want %q", got, tc.wantClientMeta)
+			}
+			if got := header.Get("Authorization"); got != "Bearer token" {
+				t.Errorf("Authorization = %q", got)
+			}
+		})
+	}
+}
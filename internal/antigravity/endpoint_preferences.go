@@ -0,0 +1,74 @@
+package antigravity
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// modelEndpointPreferences pins models to a single upstream endpoint at runtime, e.g. to
+// keep a model on prod while daily is broken for it. Shared by every client.
+var modelEndpointPreferences = struct {
+	sync.RWMutex
+	byModel map[string]string
+}{byModel: map[string]string{}}
+
+// ResolveEndpoint maps "prod" or "daily" to its endpoint URL. Any other value must be
+// one of Endpoints.
+func ResolveEndpoint(name string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "prod":
+		return endpointProd, nil
+	case "daily":
+		return endpointDaily, nil
+	}
+	for _, endpoint := range Endpoints {
+		if name == endpoint {
+			return endpoint, nil
+		}
+	}
+	return "", fmt.Errorf("unknown endpoint %q: use prod, daily or one of %v", name, Endpoints)
+}
+
+// SetModelEndpoint pins model to endpoint (see ResolveEndpoint) for generateContent and
+// streamGenerateContent calls.
+func SetModelEndpoint(model, endpoint string) error {
+	resolved, err := ResolveEndpoint(endpoint)
+	if err != nil {
+		return err
+	}
+	modelEndpointPreferences.Lock()
+	defer modelEndpointPreferences.Unlock()
+	modelEndpointPreferences.byModel[model] = resolved
+	return nil
+}
+
+// ClearModelEndpoint removes the endpoint preference for model, if any.
+func ClearModelEndpoint(model string) {
+	modelEndpointPreferences.Lock()
+	defer modelEndpointPreferences.Unlock()
+	delete(modelEndpointPreferences.byModel, model)
+}
+
+// ModelEndpoints returns a copy of the current model -> endpoint preferences.
+func ModelEndpoints() map[string]string {
+	modelEndpointPreferences.RLock()
+	defer modelEndpointPreferences.RUnlock()
+	out := make(map[string]string, len(modelEndpointPreferences.byModel))
+	for model, endpoint := range modelEndpointPreferences.byModel {
+		out[model] = endpoint
+	}
+	return out
+}
+
+// endpointsForModel returns the endpoints to try for model: just the preferred one when
+// the model is pinned, otherwise defaults.
+func endpointsForModel(model string, defaults []string) []string {
+	modelEndpointPreferences.RLock()
+	endpoint, ok := modelEndpointPreferences.byModel[model]
+	modelEndpointPreferences.RUnlock()
+	if !ok {
+		return defaults
+	}
+	return []string{endpoint}
+}
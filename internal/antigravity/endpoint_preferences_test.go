@@ -0,0 +1,69 @@
+package antigravity
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// recordingHTTPClient fails every call with a 503, recording the URLs tried.
+type recordingHTTPClient struct {
+	mu   sync.Mutex
+	urls []string
+}
+
+func (r *recordingHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	r.mu.Lock()
+	r.urls = append(r.urls, req.URL.String())
+	r.mu.Unlock()
+	return &http.Response{StatusCode: http.StatusServiceUnavailable, Body: io.NopCloser(strings.NewReader("unavailable")), Header: http.Header{}}, nil
+}
+
+func TestModelEndpointPreferenceHonored(t *testing.T) {
+	origEndpoints := Endpoints
+	Endpoints = []string{endpointDaily, endpointProd}
+	defer func() { Endpoints = origEndpoints }()
+
+	if err := SetModelEndpoint("gemini-3-pro", "prod"); err != nil {
+		t.Fatalf("SetModelEndpoint() error = %v", err)
+	}
+	defer ClearModelEndpoint("gemini-3-pro")
+	if err := SetModelEndpoint("gemini-3-flash", "staging"); err == nil {
+		t.Errorf("expected an unknown endpoint to be rejected")
+	}
+
+	tests := []struct {
+		model string
+		want  []string
+	}{
+		{model: "gemini-3-pro", want: []string{endpointProd}},
+		{model: "gemini-3-flash", want: []string{endpointDaily, endpointProd}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.model, func(t *testing.T) {
+			httpClient := &recordingHTTPClient{}
+			c := &Client{httpClient: httpClient, provider: staticProvider{}, models: &modelsCache{}}
+
+			_, _ = c.GenerateContent(context.Background(), &GenerateContentRequest{Model: tc.model})
+			_ = c.StreamGenerateContent(context.Background(), &GenerateContentRequest{Model: tc.model}, make(chan string))
+
+			var hosts []string
+			for _, u := range httpClient.urls {
+				hosts = append(hosts, u[:strings.Index(u, "/v1internal")])
+			}
+			want := append(append([]string{}, tc.want...), tc.want...)
+			if strings.Join(hosts, ",") != strings.Join(want, ",") {
+				t.Errorf("endpoints tried = %v, want %v", hosts, want)
+			}
+		})
+	}
+
+	ClearModelEndpoint("gemini-3-pro")
+	if got := endpointsForModel("gemini-3-pro", Endpoints); len(got) != 2 {
+		t.Errorf("expected cleared preference to restore all endpoints, got %v", got)
+	}
+}
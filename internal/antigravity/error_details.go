@@ -0,0 +1,94 @@
+package antigravity
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// Type URLs of the google.rpc detail messages parsed by ErrorDetails.
+const (
+	retryInfoType    = "type.googleapis.com/google.rpc.RetryInfo"
+	quotaFailureType = "type.googleapis.com/google.rpc.QuotaFailure"
+	errorInfoType    = "type.googleapis.com/google.rpc.ErrorInfo"
+)
+
+// QuotaViolation is one entry of a google.rpc.QuotaFailure detail.
+type QuotaViolation struct {
+	Subject         string            `json:"subject,omitempty"`
+	Description     string            `json:"description,omitempty"`
+	QuotaMetric     string            `json:"quotaMetric,omitempty"`
+	QuotaID         string            `json:"quotaId,omitempty"`
+	QuotaDimensions map[string]string `json:"quotaDimensions,omitempty"`
+}
+
+// ErrorDetails is the typed content of a Google error's details array. Entries of
+// other types are ignored.
+type ErrorDetails struct {
+	// RetryDelay is RetryInfo.retryDelay, or 0 when upstream sent none.
+	RetryDelay      time.Duration
+	QuotaViolations []QuotaViolation
+	// Reason and Metadata come from ErrorInfo, e.g. RATE_LIMIT_EXCEEDED.
+	Reason   string
+	Metadata map[string]string
+}
+
+// googleErrorDetailsBody is the part of Google's error shape ErrorDetails reads.
+type googleErrorDetailsBody struct {
+	Error struct {
+		Details []json.RawMessage `json:"details"`
+	} `json:"error"`
+}
+
+// Details parses the details array of the upstream error body. It returns a zero
+// ErrorDetails when the body isn't a Google error or carries no known details.
+func (e *UpstreamError) Details() ErrorDetails {
+	var details ErrorDetails
+	if e == nil {
+		return details
+	}
+
+	var body googleErrorDetailsBody
+	if json.Unmarshal(e.Body, &body) != nil {
+		return details
+	}
+
+	for _, raw := range body.Error.Details {
+		var entry struct {
+			Type string `json:"@type"`
+			// RetryInfo
+			RetryDelay string `json:"retryDelay"`
+			// QuotaFailure
+			Violations []QuotaViolation `json:"violations"`
+			// ErrorInfo
+			Reason   string            `json:"reason"`
+			Metadata map[string]string `json:"metadata"`
+		}
+		if json.Unmarshal(raw, &entry) != nil {
+			continue
+		}
+		switch entry.Type {
+		case retryInfoType:
+			details.RetryDelay = parseRetryDelay(entry.RetryDelay)
+		case quotaFailureType:
+			details.QuotaViolations = append(details.QuotaViolations, entry.Violations...)
+		case errorInfoType:
+			details.Reason = entry.Reason
+			details.Metadata = entry.Metadata
+		}
+	}
+	return details
+}
+
+// parseRetryDelay parses a protobuf Duration in its JSON form, e.g. "3.5s". Invalid or
+// negative values yield 0.
+func parseRetryDelay(value string) time.Duration {
+	if !strings.HasSuffix(value, "s") {
+		return 0
+	}
+	delay, err := time.ParseDuration(value)
+	if err != nil || delay < 0 {
+		return 0
+	}
+	return delay
+}
@@ -0,0 +1,55 @@
+package antigravity
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestUpstreamErrorDetails(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want ErrorDetails
+	}{
+		{
+			name: "retry info and quota failure",
+			body: `{"error":{"code":429,"message":"Quota exceeded","status":"RESOURCE_EXHAUSTED","details":[
+				{"@type":"type.googleapis.com/google.rpc.ErrorInfo","reason":"RATE_LIMIT_EXCEEDED","metadata":{"model":"gemini-3-flash"}},
+				{"@type":"type.googleapis.com/google.rpc.QuotaFailure","violations":[{"quotaMetric":"generativelanguage.googleapis.com/generate_content_requests","quotaId":"GenerateRequestsPerMinute","quotaDimensions":{"model":"gemini-3-flash"}}]},
+				{"@type":"type.googleapis.com/google.rpc.RetryInfo","retryDelay":"37.5s"}
+			]}}`,
+			want: ErrorDetails{
+				RetryDelay: 37500 * time.Millisecond,
+				QuotaViolations: []QuotaViolation{{
+					QuotaMetric:     "generativelanguage.googleapis.com/generate_content_requests",
+					QuotaID:         "GenerateRequestsPerMinute",
+					QuotaDimensions: map[string]string{"model": "gemini-3-flash"},
+				}},
+				Reason:   "RATE_LIMIT_EXCEEDED",
+				Metadata: map[string]string{"model": "gemini-3-flash"},
+			},
+		},
+		{
+			name: "invalid retry delay is ignored",
+			body: `{"error":{"details":[{"@type":"type.googleapis.com/google.rpc.RetryInfo","retryDelay":"soon"}]}}`,
+		},
+		{
+			name: "unknown detail types are ignored",
+			body: `{"error":{"details":[{"@type":"type.googleapis.com/google.rpc.Help","links":[]}]}}`,
+		},
+		{
+			name: "non-JSON body",
+			body: "<html>bad gateway</html>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := &UpstreamError{StatusCode: 429, Body: []byte(tt.body)}
+			if got := err.Details(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Details() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package antigravity
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/dvcrn/antigravity-proxy/internal/env"
+	"github.com/dvcrn/antigravity-proxy/internal/logger"
+	"github.com/dvcrn/antigravity-proxy/internal/warnings"
+)
+
+// fallbackModels returns the models to try for model: model itself followed by the
+// entries after it in MODEL_FALLBACK_CHAIN (comma-separated). Models that aren't in the
+// chain get no fallbacks.
+func fallbackModels(model string) []string {
+	var chain []string
+	for _, m := range strings.Split(env.GetOrDefault("MODEL_FALLBACK_CHAIN", ""), ",") {
+		if m = strings.TrimSpace(m); m != "" {
+			chain = append(chain, m)
+		}
+	}
+	for i, m := range chain {
+		if m == model {
+			return chain[i:]
+		}
+	}
+	return []string{model}
+}
+
+// isRetryableModelError reports whether err is an overload or quota failure that
+// another model may not hit.
+func isRetryableModelError(err error) bool {
+	var upstreamErr *UpstreamError
+	if !errors.As(err, &upstreamErr) {
+		return false
+	}
+	switch upstreamErr.StatusCode {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable, 529:
+		return true
+	}
+	return false
+}
+
+// GenerateContentWithFallback is like GenerateContent but walks MODEL_FALLBACK_CHAIN from
+// the requested model while upstream returns retryable errors. The model that served the
+// response is reported in GenerateContentResponse.Model.
+func (c *Client) GenerateContentWithFallback(ctx context.Context, req *GenerateContentRequest) (*GenerateContentResponse, error) {
+	models := fallbackModels(req.Model)
+	if len(models) == 1 {
+		resp, err := c.GenerateContent(ctx, req)
+		if resp != nil {
+			resp.Model = req.Model
+		}
+		return resp, err
+	}
+
+	// Each attempt is prepared separately, so keep a pristine copy to start from
+	base, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("could not marshal request body: %w", err)
+	}
+
+	var lastErr error
+	for i, model := range models {
+		attempt := &GenerateContentRequest{}
+		if err := json.Unmarshal(base, attempt); err != nil {
+			return nil, fmt.Errorf("could not copy request: %w", err)
+		}
+		attempt.Model = model
+
+		resp, err := c.GenerateContent(ctx, attempt)
+		if err == nil {
+			if i > 0 {
+				logger.Get().Warn().
+					Str("requested_model", req.Model).
+					Str("served_model", model).
+					Msg("Served request with fallback model")
+				warnings.FromContext(ctx).Addf("model %q was unavailable, served by fallback %q", req.Model, model)
+			}
+			resp.Model = model
+			return resp, nil
+		}
+		lastErr = err
+		if !isRetryableModelError(err) {
+			return nil, err
+		}
+		if i+1 < len(models) {
+			logger.Get().Warn().
+				Err(err).
+				Str("model", model).
+				Str("next_model", models[i+1]).
+				Msg("Model unavailable, trying next model in fallback chain")
+		}
+	}
+	return nil, lastErr
+}
@@ -0,0 +1,83 @@
+package antigravity
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGenerateContentWithFallback(t *testing.T) {
+	t.Setenv("MODEL_FALLBACK_CHAIN", "gemini-3-pro, gemini-2.5-pro, gemini-2.5-flash")
+
+	var tried []string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body GenerateContentRequest
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		tried = append(tried, body.Model)
+		switch body.Model {
+		case "gemini-3-pro":
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write([]byte(`{"error":{"code":503,"message":"The model is overloaded","status":"UNAVAILABLE"}}`))
+		case "gemini-2.5-pro":
+			w.WriteHeader(http.StatusTooManyRequests)
+			_, _ = w.Write([]byte(`{"error":{"code":429,"message":"Quota exceeded","status":"RESOURCE_EXHAUSTED"}}`))
+		default:
+			_, _ = w.Write([]byte(`{"response":{"candidates":[{"content":{"parts":[{"text":"ok"}]}}],"modelVersion":"` + body.Model + `"}}`))
+		}
+	}))
+	defer upstream.Close()
+	origEndpoints := Endpoints
+	Endpoints = []string{upstream.URL}
+	defer func() { Endpoints = origEndpoints }()
+
+	c := NewClient(staticProvider{})
+	req := &GenerateContentRequest{
+		Model:   "gemini-3-pro",
+		Request: GeminiInternalRequest{Contents: []Content{{Role: "user", Parts: []ContentPart{{Text: "hi"}}}}},
+	}
+	resp, err := c.GenerateContentWithFallback(context.Background(), req)
+	if err != nil {
+		t.Fatalf("GenerateContentWithFallback returned error: %v", err)
+	}
+	if resp.Model != "gemini-2.5-flash" {
+		t.Errorf("served model = %q, want gemini-2.5-flash", resp.Model)
+	}
+	if resp.Response["modelVersion"] != "gemini-2.5-flash" {
+		t.Errorf("response modelVersion = %v, want gemini-2.5-flash", resp.Response["modelVersion"])
+	}
+	want := []string{"gemini-3-pro", "gemini-2.5-pro", "gemini-2.5-flash"}
+	if len(tried) != len(want) {
+		t.Fatalf("tried models = %v, want %v", tried, want)
+	}
+	for i := range want {
+		if tried[i] != want[i] {
+			t.Errorf("tried models = %v, want %v", tried, want)
+			break
+		}
+	}
+}
+
+func TestGenerateContentWithFallbackStopsOnNonRetryableError(t *testing.T) {
+	t.Setenv("MODEL_FALLBACK_CHAIN", "gemini-3-pro,gemini-2.5-flash")
+
+	calls := 0
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"error":{"code":400,"message":"Invalid argument","status":"INVALID_ARGUMENT"}}`))
+	}))
+	defer upstream.Close()
+	origEndpoints := Endpoints
+	Endpoints = []string{upstream.URL}
+	defer func() { Endpoints = origEndpoints }()
+
+	c := NewClient(staticProvider{})
+	if _, err := c.GenerateContentWithFallback(context.Background(), &GenerateContentRequest{Model: "gemini-3-pro"}); err == nil {
+		t.Fatal("expected the 400 to be returned")
+	}
+	if calls != 1 {
+		t.Errorf("upstream calls = %d, want 1", calls)
+	}
+}
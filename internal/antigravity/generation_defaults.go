@@ -0,0 +1,73 @@
+package antigravity
+
+import (
+	"strconv"
+
+	"github.com/dvcrn/antigravity-proxy/internal/env"
+	"github.com/dvcrn/antigravity-proxy/internal/logger"
+)
+
+// generationDefaults are server-side generation settings used for fields the client
+// left unset. Zero values mean no default.
+type generationDefaults struct {
+	maxOutputTokens int
+	temperature     float64
+	topP            float64
+	topK            int
+}
+
+// generationDefaultsFromEnv reads DEFAULT_MAX_OUTPUT_TOKENS, DEFAULT_TEMPERATURE,
+// DEFAULT_TOP_P and DEFAULT_TOP_K. Invalid values are ignored with a warning.
+func generationDefaultsFromEnv() generationDefaults {
+	return generationDefaults{
+		maxOutputTokens: int(envNumber("DEFAULT_MAX_OUTPUT_TOKENS")),
+		temperature:     envNumber("DEFAULT_TEMPERATURE"),
+		topP:            envNumber("DEFAULT_TOP_P"),
+		topK:            int(envNumber("DEFAULT_TOP_K")),
+	}
+}
+
+func envNumber(key string) float64 {
+	raw, ok := env.Get(key)
+	if !ok {
+		return 0
+	}
+	n, err := strconv.ParseFloat(raw, 64)
+	if err != nil || n < 0 {
+		logger.Get().Warn().Str("key", key).Str("value", raw).Msg("Ignoring invalid generation default")
+		return 0
+	}
+	return n
+}
+
+func (d generationDefaults) empty() bool {
+	return d == generationDefaults{}
+}
+
+// applyGenerationDefaults fills unset generationConfig fields from the configured
+// defaults, creating the config when the client sent none. Client values always win;
+// since the fields are omitted when zero, an explicit 0 from the client counts as unset.
+func applyGenerationDefaults(req *GenerateContentRequest) {
+	defaults := generationDefaultsFromEnv()
+	if defaults.empty() {
+		return
+	}
+
+	cfg := req.Request.GenerationConfig
+	if cfg == nil {
+		cfg = &GeminiGenerationConfig{}
+		req.Request.GenerationConfig = cfg
+	}
+	if cfg.MaxOutputTokens == 0 {
+		cfg.MaxOutputTokens = defaults.maxOutputTokens
+	}
+	if cfg.Temperature == 0 {
+		cfg.Temperature = defaults.temperature
+	}
+	if cfg.TopP == 0 {
+		cfg.TopP = defaults.topP
+	}
+	if cfg.TopK == 0 {
+		cfg.TopK = defaults.topK
+	}
+}
@@ -0,0 +1,57 @@
+package antigravity
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestApplyGenerationDefaults(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		cfg  *GeminiGenerationConfig
+		want *GeminiGenerationConfig
+	}{
+		{
+			name: "no defaults leaves a missing config alone",
+			cfg:  nil,
+			want: nil,
+		},
+		{
+			name: "defaults create a missing config",
+			env:  map[string]string{"DEFAULT_MAX_OUTPUT_TOKENS": "8192", "DEFAULT_TEMPERATURE": "0.7"},
+			cfg:  nil,
+			want: &GeminiGenerationConfig{MaxOutputTokens: 8192, Temperature: 0.7},
+		},
+		{
+			name: "client values win",
+			env:  map[string]string{"DEFAULT_MAX_OUTPUT_TOKENS": "8192", "DEFAULT_TEMPERATURE": "0.7", "DEFAULT_TOP_P": "0.9", "DEFAULT_TOP_K": "40"},
+			cfg:  &GeminiGenerationConfig{MaxOutputTokens: 100, Temperature: 1.2},
+			want: &GeminiGenerationConfig{MaxOutputTokens: 100, Temperature: 1.2, TopP: 0.9, TopK: 40},
+		},
+		{
+			name: "invalid defaults are ignored",
+			env:  map[string]string{"DEFAULT_MAX_OUTPUT_TOKENS": "lots", "DEFAULT_TOP_K": "-1", "DEFAULT_TOP_P": "0.5"},
+			cfg:  nil,
+			want: &GeminiGenerationConfig{TopP: 0.5},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, key := range []string{"DEFAULT_MAX_OUTPUT_TOKENS", "DEFAULT_TEMPERATURE", "DEFAULT_TOP_P", "DEFAULT_TOP_K"} {
+				t.Setenv(key, tc.env[key])
+			}
+			req := &GenerateContentRequest{Model: "gemini-3-pro", Request: GeminiInternalRequest{GenerationConfig: tc.cfg}}
+			applyGenerationDefaults(req)
+
+			got := req.Request.GenerationConfig
+			if (got == nil) != (tc.want == nil) {
+				t.Fatalf("generationConfig = %+v, want %+v", got, tc.want)
+			}
+			if got != nil && !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("generationConfig = %+v, want %+v", *got, *tc.want)
+			}
+		})
+	}
+}
@@ -6,6 +6,10 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"sync"
+	"time"
+
+	"github.com/dvcrn/antigravity-proxy/internal/logger"
 )
 
 type FetchAvailableModelsResponse struct {
@@ -15,32 +19,117 @@ type FetchAvailableModelsResponse struct {
 type AvailableModel struct {
 	DisplayName string          `json:"displayName"`
 	QuotaInfo   json.RawMessage `json:"quotaInfo,omitempty"`
+	// MaxTokens and MaxOutputTokens are the model's token limits, when upstream reports them
+	MaxTokens       int `json:"maxTokens,omitempty"`
+	MaxOutputTokens int `json:"maxOutputTokens,omitempty"`
+}
+
+// modelsCache holds the last good fetchAvailableModels result and the fetch in flight,
+// so concurrent callers share one upstream request.
+type modelsCache struct {
+	mu        sync.Mutex
+	value     *FetchAvailableModelsResponse
+	fetchedAt time.Time
+	inflight  *modelsFetch
+}
+
+type modelsFetch struct {
+	done  chan struct{}
+	value *FetchAvailableModelsResponse
+	err   error
 }
 
+// FetchAvailableModels returns the models available to the account, reusing a result
+// younger than ModelsCacheTTL. When upstream fails and an older result is cached, the
+// stale result is returned instead of the error.
 func (c *Client) FetchAvailableModels(ctx context.Context) (*FetchAvailableModelsResponse, error) {
+	if c.models == nil || c.opts.ModelsCacheTTL <= 0 {
+		return c.fetchAvailableModels(ctx)
+	}
+
+	cache := c.models
+	cache.mu.Lock()
+	if cache.value != nil && time.Since(cache.fetchedAt) < c.opts.ModelsCacheTTL {
+		value := cache.value
+		cache.mu.Unlock()
+		return value, nil
+	}
+	fetch := cache.inflight
+	if fetch == nil {
+		fetch = &modelsFetch{done: make(chan struct{})}
+		cache.inflight = fetch
+		// Detach from the caller so one canceled request doesn't fail everyone waiting
+		go c.runModelsFetch(context.WithoutCancel(ctx), fetch)
+	}
+	cache.mu.Unlock()
+
+	select {
+	case <-fetch.done:
+		return fetch.value, fetch.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// runModelsFetch performs a shared fetch and stores the result, falling back to the
+// last good result on error.
+func (c *Client) runModelsFetch(ctx context.Context, fetch *modelsFetch) {
+	value, err := c.fetchAvailableModels(ctx)
+
+	cache := c.models
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	cache.inflight = nil
+
+	switch {
+	case err == nil:
+		cache.value = value
+		cache.fetchedAt = time.Now()
+		fetch.value = value
+	case cache.value != nil:
+		logger.Get().Warn().
+			Err(err).
+			Time("cached_at", cache.fetchedAt).
+			Msg("fetchAvailableModels failed, serving cached model list")
+		fetch.value = cache.value
+	default:
+		fetch.err = err
+	}
+	close(fetch.done)
+}
+
+func (c *Client) fetchAvailableModels(ctx context.Context) (*FetchAvailableModelsResponse, error) {
 	bodyBytes, err := json.Marshal(map[string]interface{}{})
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal request body: %w", err)
 	}
 
 	var lastErr error
-	for _, endpoint := range Endpoints {
+	for _, endpoint := range c.decodedEndpoints() {
 		url := fmt.Sprintf("%s/v1internal:fetchAvailableModels", endpoint)
-		resp, err := c.doRequest(ctx, http.MethodPost, url, bodyBytes, "application/json")
+		attemptCtx, cancel := c.withRequestTimeout(ctx)
+		resp, err := c.doRequest(attemptCtx, http.MethodPost, url, bodyBytes, "application/json")
 		if err != nil {
+			cancel()
 			lastErr = err
 			continue
 		}
 
 		respBody, err := io.ReadAll(resp.Body)
 		resp.Body.Close()
+		cancel()
 		if err != nil {
 			lastErr = fmt.Errorf("could not read response body: %w", err)
 			continue
 		}
 
 		if resp.StatusCode != http.StatusOK {
-			lastErr = fmt.Errorf("fetchAvailableModels failed with status %d: %s", resp.StatusCode, string(respBody))
+			lastErr = &UpstreamError{
+				StatusCode:  resp.StatusCode,
+				Body:        respBody,
+				ContentType: resp.Header.Get("Content-Type"),
+				Endpoint:    endpoint,
+			}
 			continue
 		}
 
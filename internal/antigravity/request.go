@@ -1,15 +1,35 @@
 package antigravity
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
+	"fmt"
 	"strings"
 
+	"github.com/dvcrn/antigravity-proxy/internal/env"
 	"github.com/dvcrn/antigravity-proxy/internal/logger"
+	"github.com/dvcrn/antigravity-proxy/internal/warnings"
 	"github.com/google/uuid"
 )
 
-func prepareAntigravityRequest(req *GenerateContentRequest) {
+// RequestBody prepares req and returns the JSON body GenerateContent and
+// StreamGenerateContent send upstream for it. Repairs are reported to the warnings
+// collector carried by ctx.
+func RequestBody(ctx context.Context, req *GenerateContentRequest) ([]byte, error) {
+	prepareAntigravityRequest(req, warnings.FromContext(ctx))
+
+	bodyBytes, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("could not marshal request body: %w", err)
+	}
+	return bodyBytes, nil
+}
+
+// prepareAntigravityRequest fills the CloudCode envelope fields and repairs the request.
+// Repairs are logged and, when warns is non-nil, reported back to the client.
+func prepareAntigravityRequest(req *GenerateContentRequest, warns *warnings.Collector) {
 	if req == nil {
 		return
 	}
@@ -29,37 +49,69 @@ func prepareAntigravityRequest(req *GenerateContentRequest) {
 			Int("pruned_parts", prunedParts).
 			Int("pruned_contents", prunedContents).
 			Msg("Removed empty content parts from request")
+		warns.Addf("removed %d empty content parts and %d empty contents", prunedParts, prunedContents)
 	}
 
+	applyGenerationDefaults(req)
 	applyGeminiThinkingPreset(req)
+	applyToolTurnThinking(req, warns)
+	clampTemperature(req, warns)
 
+	// Collect names before filling, which clears the nil schemas they're found by
+	missingNames := missingParameterNames(req.Request.Tools, 6)
 	if missing := fillMissingParameters(req.Request.Tools); missing > 0 {
 		logger.Get().Warn().
 			Int("missing_parameters", missing).
-			Str("missing_names", missingParameterNames(req.Request.Tools, 6)).
+			Str("missing_names", missingNames).
 			Msg("Defaulted missing parameters in request tools")
+		warns.Addf("defaulted missing parameters schema for %d tools: %s", missing, missingNames)
 	}
 
+	applySchemaCompat(req, warns)
+
 	if missing := ensureFunctionCallIDs(req.Request.Contents); missing > 0 {
 		logger.Get().Warn().
 			Int("missing_ids", missing).
 			Msg("Defaulted missing functionCall IDs in request contents")
+		warns.Addf("generated %d missing functionCall IDs", missing)
 	}
 
 	if missing := ensureFunctionResponseIDs(req.Request.Contents); missing > 0 {
 		logger.Get().Warn().
 			Int("missing_ids", missing).
 			Msg("Defaulted missing functionResponse IDs in request contents")
+		warns.Addf("generated %d missing functionResponse IDs", missing)
 	}
 
 	req.Request.SystemInstruction = buildAntigravitySystemInstruction(req.Request.SystemInstruction)
 }
 
-func buildAntigravitySystemInstruction(existing *SystemInstruction) *SystemInstruction {
-	parts := []ContentPart{
-		{Text: SystemInstructionText},
-		{Text: "Please ignore the following [ignore]" + SystemInstructionText + "[/ignore]"},
+// baseSystemInstructionParts returns the parts prepended to every system instruction:
+// ANTIGRAVITY_SYSTEM_PROMPT (default SystemInstructionText, "none" disables it) followed by
+// an [ignore] copy of it unless skipIgnoreBlock.
+func baseSystemInstructionParts() []ContentPart {
+	text := env.GetOrDefault("ANTIGRAVITY_SYSTEM_PROMPT", SystemInstructionText)
+	if text == "none" {
+		return nil
+	}
+
+	parts := []ContentPart{{Text: text}}
+	if !skipIgnoreBlock() {
+		parts = append(parts, ContentPart{Text: "Please ignore the following [ignore]" + text + "[/ignore]"})
 	}
+	return parts
+}
+
+// skipIgnoreBlock reports whether SKIP_SYSTEM_PROMPT_IGNORE_BLOCK is true. The [ignore]
+// copy mirrors the system instruction the Antigravity client sends. Upstream has been
+// seen to accept requests without it, so it is kept by default only to match the
+// client's request shape, at the cost of sending the base prompt twice per turn.
+func skipIgnoreBlock() bool {
+	return env.GetOrDefault("SKIP_SYSTEM_PROMPT_IGNORE_BLOCK", "false") == "true"
+}
+
+func buildAntigravitySystemInstruction(existing *SystemInstruction) *SystemInstruction {
+	parts := baseSystemInstructionParts()
 
 	if existing != nil {
 		for _, part := range existing.Parts {
@@ -69,6 +121,10 @@ func buildAntigravitySystemInstruction(existing *SystemInstruction) *SystemInstr
 		}
 	}
 
+	if len(parts) == 0 {
+		return nil
+	}
+
 	return &SystemInstruction{
 		Role:  "user",
 		Parts: parts,
@@ -223,7 +279,10 @@ func sanitizeContents(contents *[]Content) (int, int) {
 }
 
 func isEmptyContentPart(part ContentPart) bool {
-	if part.FunctionCall != nil || part.FunctionResponse != nil {
+	if part.FunctionCall != nil || part.FunctionResponse != nil || part.InlineData != nil {
+		return false
+	}
+	if part.FileData != nil && part.FileData.FileURI != "" {
 		return false
 	}
 	return part.Text == ""
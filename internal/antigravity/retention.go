@@ -0,0 +1,17 @@
+package antigravity
+
+import "context"
+
+type noContentLoggingKey struct{}
+
+// WithoutContentLogging marks ctx as belonging to a request that opted out of content
+// retention (OpenAI "store": false). Client logs then leave out request content.
+func WithoutContentLogging(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noContentLoggingKey{}, true)
+}
+
+// contentLoggingAllowed reports whether logs for the request on ctx may include its content.
+func contentLoggingAllowed(ctx context.Context) bool {
+	optedOut, _ := ctx.Value(noContentLoggingKey{}).(bool)
+	return !optedOut
+}
@@ -1,20 +1,39 @@
 package antigravity
 
-import "strings"
+import (
+	"strings"
+
+	"github.com/dvcrn/antigravity-proxy/internal/logger"
+	"github.com/dvcrn/antigravity-proxy/internal/warnings"
+)
 
 // ConvertSchema recursively converts a generic map representing a JSON schema
 // into the strongly-typed GeminiParameterSchema struct, only mapping supported fields.
+// Local $ref pointers are inlined first (see inlineSchemaRefs).
 func ConvertSchema(input map[string]interface{}) *GeminiParameterSchema {
+	return ConvertSchemaWithWarnings(input, nil)
+}
+
+// ConvertSchemaWithWarnings is ConvertSchema, recording dropped $ref pointers and
+// narrowed type unions in warns.
+func ConvertSchemaWithWarnings(input map[string]interface{}, warns *warnings.Collector) *GeminiParameterSchema {
+	return convertSchema(inlineSchemaRefs(input, warns), warns)
+}
+
+func convertSchema(input map[string]interface{}, warns *warnings.Collector) *GeminiParameterSchema {
 	if input == nil {
 		return nil
 	}
 
 	// Handle complex schemas with anyOf or oneOf by prioritizing the array definition.
+	// An explicit top-level type takes precedence over the union branches.
 	var subSchemas []interface{}
-	if anyOf, ok := input["anyOf"].([]interface{}); ok {
-		subSchemas = anyOf
-	} else if oneOf, ok := input["oneOf"].([]interface{}); ok {
-		subSchemas = oneOf
+	if _, hasType := input["type"]; !hasType {
+		if anyOf, ok := input["anyOf"].([]interface{}); ok {
+			subSchemas = anyOf
+		} else if oneOf, ok := input["oneOf"].([]interface{}); ok {
+			subSchemas = oneOf
+		}
 	}
 
 	if subSchemas != nil {
@@ -26,19 +45,25 @@ func ConvertSchema(input map[string]interface{}) *GeminiParameterSchema {
 					if parentDesc, ok := input["description"].(string); ok {
 						subSchemaMap["description"] = parentDesc
 					}
-					return ConvertSchema(subSchemaMap)
+					return convertSchema(subSchemaMap, warns)
 				}
 			}
 		}
 	}
 
 	output := &GeminiParameterSchema{}
-	if t, ok := input["type"].(string); ok {
+	switch t := input["type"].(type) {
+	case string:
 		output.Type = strings.ToUpper(t)
+	case []interface{}:
+		output.Type, output.Nullable = unionSchemaType(t, warns)
 	}
 	if d, ok := input["description"].(string); ok {
 		output.Description = d
 	}
+	if output.Description == "" {
+		output.Description = unionDescription(subSchemas)
+	}
 
 	if r, ok := input["required"].([]interface{}); ok {
 		for _, v := range r {
@@ -60,14 +85,146 @@ func ConvertSchema(input map[string]interface{}) *GeminiParameterSchema {
 		output.Properties = make(map[string]*GeminiParameterSchema)
 		for k, v := range p {
 			if vMap, ok := v.(map[string]interface{}); ok {
-				output.Properties[k] = ConvertSchema(vMap)
+				output.Properties[k] = convertSchema(vMap, warns)
 			}
 		}
 	}
 
+	output.PropertyOrdering = propertyOrdering(input, output.Properties)
+
 	if i, ok := input["items"].(map[string]interface{}); ok {
-		output.Items = ConvertSchema(i)
+		output.Items = convertSchema(i, warns)
+	}
+
+	output.MinItems = schemaInt(input["minItems"])
+	output.MaxItems = schemaInt(input["maxItems"])
+
+	if f, ok := input["format"].(string); ok && schemaFormats[output.Type][f] {
+		output.Format = f
+	}
+	switch output.Type {
+	case "NUMBER", "INTEGER":
+		output.Minimum = schemaNumber(input["minimum"])
+		output.Maximum = schemaNumber(input["maximum"])
+	case "STRING":
+		output.MinLength = schemaInt(input["minLength"])
+		output.MaxLength = schemaInt(input["maxLength"])
+		if p, ok := input["pattern"].(string); ok {
+			output.Pattern = p
+		}
 	}
 
 	return output
 }
+
+// unionDescription merges the distinct descriptions of anyOf/oneOf branches with "; ",
+// for unions whose parent schema has no description of its own.
+func unionDescription(subSchemas []interface{}) string {
+	var descriptions []string
+	seen := map[string]bool{}
+	for _, subSchema := range subSchemas {
+		subSchemaMap, _ := subSchema.(map[string]interface{})
+		d, _ := subSchemaMap["description"].(string)
+		if d = strings.TrimSpace(d); d != "" && !seen[d] {
+			seen[d] = true
+			descriptions = append(descriptions, d)
+		}
+	}
+	return strings.Join(descriptions, "; ")
+}
+
+// propertyOrdering returns the order Gemini should fill properties in: an explicit
+// propertyOrdering in the input, limited to declared properties. JSON declaration order
+// is lost once the schema is decoded into a map, so without one nil is returned and
+// Gemini falls back to its own order.
+func propertyOrdering(input map[string]interface{}, properties map[string]*GeminiParameterSchema) []string {
+	explicit, ok := input["propertyOrdering"].([]interface{})
+	if !ok {
+		return nil
+	}
+	var ordering []string
+	seen := make(map[string]bool, len(explicit))
+	for _, v := range explicit {
+		if name, ok := v.(string); ok && properties[name] != nil && !seen[name] {
+			seen[name] = true
+			ordering = append(ordering, name)
+		}
+	}
+	return ordering
+}
+
+// unionSchemaType maps a type array such as ["string", "null"] to a single Gemini type,
+// reporting whether "null" was listed. Gemini has no type unions, so with several
+// non-null types STRING is preferred (any value can be sent as text), else the first.
+func unionSchemaType(types []interface{}, warns *warnings.Collector) (string, bool) {
+	var nonNull []string
+	nullable := false
+	for _, v := range types {
+		s, ok := v.(string)
+		if !ok {
+			continue
+		}
+		if s == "null" {
+			nullable = true
+		} else {
+			nonNull = append(nonNull, strings.ToUpper(s))
+		}
+	}
+
+	switch len(nonNull) {
+	case 0:
+		return "", nullable
+	case 1:
+		return nonNull[0], nullable
+	}
+
+	chosen := nonNull[0]
+	for _, t := range nonNull {
+		if t == "STRING" {
+			chosen = t
+			break
+		}
+	}
+	logger.Get().Warn().Strs("types", nonNull).Str("chosen", chosen).Msg("Narrowing tool schema type union")
+	warns.Addf("tool schema type union %v narrowed to %s", nonNull, chosen)
+	return chosen, nullable
+}
+
+// schemaFormats are the format values Gemini accepts per type; other formats (uri,
+// email, ...) are dropped.
+var schemaFormats = map[string]map[string]bool{
+	"STRING":  {"enum": true, "date-time": true},
+	"NUMBER":  {"float": true, "double": true},
+	"INTEGER": {"int32": true, "int64": true},
+}
+
+// schemaNumber reads a numeric keyword such as minimum or maximum.
+func schemaNumber(v interface{}) *float64 {
+	var n float64
+	switch t := v.(type) {
+	case float64:
+		n = t
+	case int:
+		n = float64(t)
+	default:
+		return nil
+	}
+	return &n
+}
+
+// schemaInt reads a non-negative integer keyword, which arrives as float64 from JSON.
+func schemaInt(v interface{}) *int {
+	var n int
+	switch t := v.(type) {
+	case float64:
+		n = int(t)
+	case int:
+		n = t
+	default:
+		return nil
+	}
+	if n < 0 {
+		return nil
+	}
+	return &n
+}
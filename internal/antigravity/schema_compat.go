@@ -0,0 +1,157 @@
+package antigravity
+
+import (
+	"encoding/json"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/dvcrn/antigravity-proxy/internal/env"
+	"github.com/dvcrn/antigravity-proxy/internal/logger"
+	"github.com/dvcrn/antigravity-proxy/internal/warnings"
+)
+
+// schemaFeatureStrippers removes one schema feature from a single schema node, reporting
+// whether anything was removed. Keys are the feature names used in SCHEMA_COMPAT_RULES.
+var schemaFeatureStrippers = map[string]func(*GeminiParameterSchema) bool{
+	"enum": func(s *GeminiParameterSchema) bool {
+		removed := len(s.Enum) > 0
+		s.Enum = nil
+		return removed
+	},
+	"nullable": func(s *GeminiParameterSchema) bool {
+		removed := s.Nullable
+		s.Nullable = false
+		return removed
+	},
+	"minItems": func(s *GeminiParameterSchema) bool {
+		removed := s.MinItems != nil
+		s.MinItems = nil
+		return removed
+	},
+	"maxItems": func(s *GeminiParameterSchema) bool {
+		removed := s.MaxItems != nil
+		s.MaxItems = nil
+		return removed
+	},
+	"format": func(s *GeminiParameterSchema) bool {
+		removed := s.Format != ""
+		s.Format = ""
+		return removed
+	},
+	"minimum": func(s *GeminiParameterSchema) bool {
+		removed := s.Minimum != nil
+		s.Minimum = nil
+		return removed
+	},
+	"maximum": func(s *GeminiParameterSchema) bool {
+		removed := s.Maximum != nil
+		s.Maximum = nil
+		return removed
+	},
+	"minLength": func(s *GeminiParameterSchema) bool {
+		removed := s.MinLength != nil
+		s.MinLength = nil
+		return removed
+	},
+	"maxLength": func(s *GeminiParameterSchema) bool {
+		removed := s.MaxLength != nil
+		s.MaxLength = nil
+		return removed
+	},
+	"pattern": func(s *GeminiParameterSchema) bool {
+		removed := s.Pattern != ""
+		s.Pattern = ""
+		return removed
+	},
+	"propertyOrdering": func(s *GeminiParameterSchema) bool {
+		removed := len(s.PropertyOrdering) > 0
+		s.PropertyOrdering = nil
+		return removed
+	},
+}
+
+// schemaCompatRules returns the model glob -> unsupported schema features table from
+// SCHEMA_COMPAT_RULES, a JSON object such as {"claude-*":["minItems","maxItems"]}.
+// Returns nil when unset or invalid.
+func schemaCompatRules() map[string][]string {
+	raw, ok := env.Get("SCHEMA_COMPAT_RULES")
+	if !ok {
+		return nil
+	}
+	var rules map[string][]string
+	if err := json.Unmarshal([]byte(raw), &rules); err != nil {
+		logger.Get().Warn().Err(err).Msg("Ignoring invalid SCHEMA_COMPAT_RULES; expected a JSON object of model glob to feature list")
+		return nil
+	}
+	return rules
+}
+
+// incompatibleSchemaFeatures lists the features to strip for model, merged across every
+// matching rule.
+func incompatibleSchemaFeatures(model string, rules map[string][]string) []string {
+	modelLower := strings.ToLower(model)
+	seen := map[string]bool{}
+	var features []string
+	for pattern, list := range rules {
+		if ok, err := path.Match(strings.ToLower(pattern), modelLower); err != nil || !ok {
+			continue
+		}
+		for _, feature := range list {
+			if _, known := schemaFeatureStrippers[feature]; !known {
+				logger.Get().Warn().Str("feature", feature).Str("pattern", pattern).Msg("Unknown schema feature in SCHEMA_COMPAT_RULES")
+				continue
+			}
+			if !seen[feature] {
+				seen[feature] = true
+				features = append(features, feature)
+			}
+		}
+	}
+	sort.Strings(features)
+	return features
+}
+
+// applySchemaCompat strips schema features the target model is configured to reject
+// (see SCHEMA_COMPAT_RULES) from every tool's parameters, avoiding model-specific 400s.
+func applySchemaCompat(req *GenerateContentRequest, warns *warnings.Collector) {
+	features := incompatibleSchemaFeatures(req.Model, schemaCompatRules())
+	if len(features) == 0 {
+		return
+	}
+
+	stripped := 0
+	for toolIndex := range req.Request.Tools {
+		for fnIndex := range req.Request.Tools[toolIndex].FunctionDeclarations {
+			stripped += stripSchemaFeatures(req.Request.Tools[toolIndex].FunctionDeclarations[fnIndex].Parameters, features)
+		}
+	}
+	if stripped == 0 {
+		return
+	}
+
+	logger.Get().Warn().
+		Str("model", req.Model).
+		Strs("features", features).
+		Int("stripped", stripped).
+		Msg("Stripped schema features unsupported by model")
+	warns.Addf("stripped %d unsupported schema features (%s) for model %q", stripped, strings.Join(features, ","), req.Model)
+}
+
+// stripSchemaFeatures removes the features from schema and all nested schemas,
+// returning how many were removed.
+func stripSchemaFeatures(schema *GeminiParameterSchema, features []string) int {
+	if schema == nil {
+		return 0
+	}
+	stripped := 0
+	for _, feature := range features {
+		if schemaFeatureStrippers[feature](schema) {
+			stripped++
+		}
+	}
+	for _, prop := range schema.Properties {
+		stripped += stripSchemaFeatures(prop, features)
+	}
+	return stripped + stripSchemaFeatures(schema.Items, features)
+}
@@ -0,0 +1,49 @@
+package antigravity
+
+import "testing"
+
+func TestApplySchemaCompat(t *testing.T) {
+	t.Setenv("SCHEMA_COMPAT_RULES", `{"claude-*":["maxItems","nullable"]}`)
+
+	newRequest := func(model string) *GenerateContentRequest {
+		return &GenerateContentRequest{
+			Model: model,
+			Request: GeminiInternalRequest{Tools: []Tool{{FunctionDeclarations: []FunctionDeclaration{{
+				Name: "TodoWrite",
+				Parameters: &GeminiParameterSchema{
+					Type: "OBJECT",
+					Properties: map[string]*GeminiParameterSchema{
+						"todos": {Type: "ARRAY", MaxItems: intPtr(50), Items: &GeminiParameterSchema{Type: "STRING", Nullable: true}},
+					},
+				},
+			}}}}},
+		}
+	}
+
+	testCases := []struct {
+		name         string
+		model        string
+		wantStripped bool
+	}{
+		{name: "matching model is stripped", model: "claude-sonnet-4-5", wantStripped: true},
+		{name: "other models keep features", model: "gemini-3-pro", wantStripped: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := newRequest(tc.model)
+			applySchemaCompat(req, nil)
+
+			todos := req.Request.Tools[0].FunctionDeclarations[0].Parameters.Properties["todos"]
+			if got := todos.MaxItems == nil; got != tc.wantStripped {
+				t.Errorf("maxItems stripped = %v, want %v", got, tc.wantStripped)
+			}
+			if got := !todos.Items.Nullable; got != tc.wantStripped {
+				t.Errorf("nested nullable stripped = %v, want %v", got, tc.wantStripped)
+			}
+			if todos.Type != "ARRAY" {
+				t.Errorf("type = %q, want ARRAY", todos.Type)
+			}
+		})
+	}
+}
@@ -0,0 +1,170 @@
+package antigravity
+
+import (
+	"strings"
+
+	"github.com/dvcrn/antigravity-proxy/internal/logger"
+	"github.com/dvcrn/antigravity-proxy/internal/warnings"
+)
+
+// maxSchemaRefDepth caps how many $ref pointers are followed along one path.
+const maxSchemaRefDepth = 16
+
+// maxSchemaRefNodes caps how many objects and arrays inlining may produce in total.
+// The depth limit alone doesn't bound output size: definitions that each reference the
+// next several times grow exponentially.
+const maxSchemaRefNodes = 10000
+
+// inlineSchemaRefs returns a copy of root with local $ref pointers (e.g. "#/$defs/Foo",
+// as generated by Pydantic and zod) replaced by their targets, since Gemini schemas have
+// no references. Sibling keywords next to a $ref override the target's. Cyclic, too deep
+// or unresolvable references, and any left once maxSchemaRefNodes is reached, are
+// dropped with a warning. Schemas without $ref are
+// returned unchanged.
+func inlineSchemaRefs(root map[string]interface{}, warns *warnings.Collector) map[string]interface{} {
+	if !hasSchemaRef(root) {
+		return root
+	}
+
+	// Definitions are only expanded where they are referenced
+	body := make(map[string]interface{}, len(root))
+	for k, v := range root {
+		if k != "$defs" && k != "definitions" {
+			body[k] = v
+		}
+	}
+
+	r := &schemaRefResolver{root: root, warns: warns, warned: map[string]bool{}}
+	return r.resolve(body, nil).(map[string]interface{})
+}
+
+type schemaRefResolver struct {
+	root   map[string]interface{}
+	warns  *warnings.Collector
+	warned map[string]bool
+	// nodes counts the objects and arrays copied so far
+	nodes int
+}
+
+// resolve copies node, inlining any $ref. stack holds the references being expanded on
+// the current path, for cycle detection.
+func (r *schemaRefResolver) resolve(node interface{}, stack []string) interface{} {
+	switch v := node.(type) {
+	case map[string]interface{}:
+		r.nodes++
+		ref, isRef := v["$ref"].(string)
+		if !isRef {
+			out := make(map[string]interface{}, len(v))
+			for k, child := range v {
+				out[k] = r.resolve(child, stack)
+			}
+			return out
+		}
+
+		siblings := make(map[string]interface{}, len(v))
+		for k, child := range v {
+			if k != "$ref" {
+				siblings[k] = child
+			}
+		}
+
+		target, reason := r.lookup(ref, stack)
+		if target == nil {
+			r.warn(ref, reason)
+			if _, ok := siblings["type"]; !ok {
+				siblings["type"] = "object"
+			}
+			return r.resolve(siblings, stack)
+		}
+
+		merged := make(map[string]interface{}, len(target)+len(siblings))
+		for k, child := range target {
+			merged[k] = child
+		}
+		for k, child := range siblings {
+			merged[k] = child
+		}
+		return r.resolve(merged, append(stack, ref))
+
+	case []interface{}:
+		r.nodes++
+		out := make([]interface{}, len(v))
+		for i, child := range v {
+			out[i] = r.resolve(child, stack)
+		}
+		return out
+
+	default:
+		return v
+	}
+}
+
+// lookup finds the schema a local JSON pointer refers to, or returns why it can't be inlined.
+func (r *schemaRefResolver) lookup(ref string, stack []string) (map[string]interface{}, string) {
+	for _, seen := range stack {
+		if seen == ref {
+			return nil, "cyclic reference"
+		}
+	}
+	if len(stack) >= maxSchemaRefDepth {
+		return nil, "reference depth limit reached"
+	}
+	if r.nodes >= maxSchemaRefNodes {
+		return nil, "inlined schema size limit reached"
+	}
+	if !strings.HasPrefix(ref, "#") {
+		return nil, "only local references are supported"
+	}
+
+	var node interface{} = r.root
+	for _, token := range strings.Split(strings.TrimPrefix(ref, "#"), "/") {
+		if token == "" {
+			continue
+		}
+		token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+		m, ok := node.(map[string]interface{})
+		if !ok {
+			return nil, "unresolved reference"
+		}
+		if node, ok = m[token]; !ok {
+			return nil, "unresolved reference"
+		}
+	}
+
+	target, ok := node.(map[string]interface{})
+	if !ok {
+		return nil, "reference does not point to a schema"
+	}
+	return target, ""
+}
+
+func (r *schemaRefResolver) warn(ref, reason string) {
+	if r.warned[ref] {
+		return
+	}
+	r.warned[ref] = true
+	logger.Get().Warn().Str("ref", ref).Str("reason", reason).Msg("Dropping tool schema $ref")
+	r.warns.Addf("dropped tool schema $ref %q: %s", ref, reason)
+}
+
+// hasSchemaRef reports whether any node below v has a $ref keyword.
+func hasSchemaRef(v interface{}) bool {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		if _, ok := t["$ref"].(string); ok {
+			return true
+		}
+		for _, child := range t {
+			if hasSchemaRef(child) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, child := range t {
+			if hasSchemaRef(child) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,127 @@
+package antigravity
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/dvcrn/antigravity-proxy/internal/warnings"
+)
+
+func TestConvertSchemaInlinesRefs(t *testing.T) {
+	schema := map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"owner": map[string]interface{}{"$ref": "#/$defs/User", "description": "Who owns it."},
+			"tags": map[string]interface{}{
+				"type":  "array",
+				"items": map[string]interface{}{"$ref": "#/definitions/Tag"},
+			},
+		},
+		"$defs": map[string]interface{}{
+			"User": map[string]interface{}{
+				"type":        "object",
+				"description": "A user.",
+				"properties": map[string]interface{}{
+					"name": map[string]interface{}{"type": "string"},
+				},
+				"required": []interface{}{"name"},
+			},
+		},
+		"definitions": map[string]interface{}{
+			"Tag": map[string]interface{}{"type": "string", "enum": []interface{}{"a", "b"}},
+		},
+	}
+
+	warns := warnings.NewCollector()
+	got := ConvertSchemaWithWarnings(schema, warns)
+
+	owner := got.Properties["owner"]
+	if owner == nil || owner.Type != "OBJECT" || owner.Properties["name"] == nil || owner.Properties["name"].Type != "STRING" {
+		t.Fatalf("owner not inlined: %#v", owner)
+	}
+	if owner.Description != "Who owns it." {
+		t.Errorf("owner description = %q, want the sibling description to win", owner.Description)
+	}
+	if len(owner.Required) != 1 || owner.Required[0] != "name" {
+		t.Errorf("owner required = %v, want [name]", owner.Required)
+	}
+	tags := got.Properties["tags"]
+	if tags.Items == nil || tags.Items.Type != "STRING" || len(tags.Items.Enum) != 2 {
+		t.Errorf("tags items not inlined: %#v", tags.Items)
+	}
+	if len(warns.List()) != 0 {
+		t.Errorf("unexpected warnings: %v", warns.List())
+	}
+	if _, ok := schema["properties"].(map[string]interface{})["owner"].(map[string]interface{})["$ref"]; !ok {
+		t.Errorf("input schema was modified")
+	}
+}
+
+func TestConvertSchemaCyclicRef(t *testing.T) {
+	schema := map[string]interface{}{
+		"$ref": "#/$defs/Node",
+		"$defs": map[string]interface{}{
+			"Node": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"value":    map[string]interface{}{"type": "string"},
+					"children": map[string]interface{}{"type": "array", "items": map[string]interface{}{"$ref": "#/$defs/Node"}},
+					"missing":  map[string]interface{}{"$ref": "#/$defs/Missing"},
+				},
+			},
+		},
+	}
+
+	warns := warnings.NewCollector()
+	got := ConvertSchemaWithWarnings(schema, warns)
+
+	if got.Type != "OBJECT" || got.Properties["value"] == nil {
+		t.Fatalf("root ref not inlined: %#v", got)
+	}
+	children := got.Properties["children"]
+	if children.Items == nil || children.Items.Type != "OBJECT" || len(children.Items.Properties) != 0 {
+		t.Errorf("cyclic ref should be cut to an empty object, got %#v", children.Items)
+	}
+	if missing := got.Properties["missing"]; missing == nil || missing.Type != "OBJECT" {
+		t.Errorf("unresolved ref should become an empty object, got %#v", missing)
+	}
+	if n := len(warns.List()); n != 2 {
+		t.Errorf("got %d warnings, want one per dropped ref: %v", n, warns.List())
+	}
+}
+
+func TestConvertSchemaRefFanOutIsBounded(t *testing.T) {
+	// Each definition references the next one four times, so full inlining would
+	// produce 4^12 copies of the last definition.
+	const defsCount = 12
+	defs := map[string]interface{}{}
+	for i := 0; i < defsCount; i++ {
+		props := map[string]interface{}{}
+		for j := 0; j < 4; j++ {
+			if i+1 < defsCount {
+				props[fmt.Sprintf("p%d", j)] = map[string]interface{}{"$ref": fmt.Sprintf("#/$defs/D%d", i+1)}
+			} else {
+				props[fmt.Sprintf("p%d", j)] = map[string]interface{}{"type": "string"}
+			}
+		}
+		defs[fmt.Sprintf("D%d", i)] = map[string]interface{}{"type": "object", "properties": props}
+	}
+	schema := map[string]interface{}{"$ref": "#/$defs/D0", "$defs": defs}
+
+	done := make(chan *GeminiParameterSchema, 1)
+	warns := warnings.NewCollector()
+	go func() { done <- ConvertSchemaWithWarnings(schema, warns) }()
+
+	select {
+	case got := <-done:
+		if got == nil || got.Type != "OBJECT" || len(got.Properties) != 4 {
+			t.Fatalf("root ref not inlined: %#v", got)
+		}
+		if len(warns.List()) == 0 {
+			t.Error("expected a warning for refs dropped at the size limit")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("inlining a fan-out schema did not finish")
+	}
+}
@@ -0,0 +1,37 @@
+package antigravity
+
+import "strings"
+
+// MergeSSEData replaces the data: lines of one event with a single "data: " line holding
+// their values joined by newlines, at the position of the first one.
+func MergeSSEData(lines []string) []string {
+	var data []string
+	for _, l := range lines {
+		if strings.HasPrefix(l, "data:") {
+			data = append(data, SSEFieldValue(l, "data:"))
+		}
+	}
+	if len(data) < 2 {
+		return lines
+	}
+
+	out := make([]string, 0, len(lines)-len(data)+1)
+	merged := false
+	for _, l := range lines {
+		if !strings.HasPrefix(l, "data:") {
+			out = append(out, l)
+			continue
+		}
+		if !merged {
+			out = append(out, "data: "+strings.Join(data, "\n"))
+			merged = true
+		}
+	}
+	return out
+}
+
+// SSEFieldValue returns the value of an SSE field line, dropping the field name and the
+// single optional space after the colon.
+func SSEFieldValue(line, field string) string {
+	return strings.TrimPrefix(strings.TrimPrefix(line, field), " ")
+}
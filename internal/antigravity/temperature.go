@@ -0,0 +1,90 @@
+package antigravity
+
+import (
+	"encoding/json"
+	"path"
+	"strings"
+
+	"github.com/dvcrn/antigravity-proxy/internal/env"
+	"github.com/dvcrn/antigravity-proxy/internal/logger"
+	"github.com/dvcrn/antigravity-proxy/internal/warnings"
+)
+
+// temperatureRangeForModel returns the accepted temperature range for the model: the
+// TEMPERATURE_RANGES entry whose glob matches it (the longest glob when several do), or
+// else the family default. Claude models accept 0-1; Gemini (and anything
+// unrecognized) accepts 0-2.
+func temperatureRangeForModel(model string) (lo, hi float64) {
+	lower := strings.ToLower(model)
+	if r, ok := configuredTemperatureRange(lower, temperatureRanges()); ok {
+		return r[0], r[1]
+	}
+	if strings.Contains(lower, "claude") {
+		return 0, 1
+	}
+	return 0, 2
+}
+
+// temperatureRanges returns the model glob -> [min, max] table from TEMPERATURE_RANGES,
+// a JSON object such as {"gemini-3-*":[0,1.5]}. Returns nil when unset or invalid.
+func temperatureRanges() map[string][2]float64 {
+	raw, ok := env.Get("TEMPERATURE_RANGES")
+	if !ok {
+		return nil
+	}
+	var ranges map[string][2]float64
+	if err := json.Unmarshal([]byte(raw), &ranges); err != nil {
+		logger.Get().Warn().Err(err).Msg("Ignoring invalid TEMPERATURE_RANGES; expected a JSON object of model glob to [min, max]")
+		return nil
+	}
+	return ranges
+}
+
+// configuredTemperatureRange picks the range for a lowercased model from ranges.
+func configuredTemperatureRange(model string, ranges map[string][2]float64) ([2]float64, bool) {
+	var best [2]float64
+	bestPattern := ""
+	found := false
+	for pattern, r := range ranges {
+		if ok, err := path.Match(strings.ToLower(pattern), model); err != nil || !ok {
+			continue
+		}
+		if r[0] > r[1] {
+			logger.Get().Warn().Str("pattern", pattern).Floats64("range", r[:]).Msg("Ignoring TEMPERATURE_RANGES entry with min above max")
+			continue
+		}
+		if !found || len(pattern) > len(bestPattern) || (len(pattern) == len(bestPattern) && pattern < bestPattern) {
+			best, bestPattern, found = r, pattern, true
+		}
+	}
+	return best, found
+}
+
+// clampTemperature clamps generationConfig.temperature into the valid range for the
+// request's model family so upstream doesn't reject the request with a 400.
+func clampTemperature(req *GenerateContentRequest, warns *warnings.Collector) {
+	cfg := req.Request.GenerationConfig
+	// 0 means unset (the field is omitted), so a configured minimum isn't forced onto it
+	if cfg == nil || cfg.Temperature == 0 {
+		return
+	}
+
+	lo, hi := temperatureRangeForModel(req.Model)
+	clamped := cfg.Temperature
+	if clamped < lo {
+		clamped = lo
+	} else if clamped > hi {
+		clamped = hi
+	}
+	if clamped == cfg.Temperature {
+		return
+	}
+
+	logger.Get().Warn().
+		Str("model", req.Model).
+		Float64("requested_temperature", cfg.Temperature).
+		Float64("clamped_temperature", clamped).
+		Msg("Clamped temperature to model range")
+	warns.Addf("clamped temperature %g to %g for model %q", cfg.Temperature, clamped, req.Model)
+	cfg.Temperature = clamped
+}
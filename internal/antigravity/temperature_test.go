@@ -0,0 +1,70 @@
+package antigravity
+
+import "testing"
+
+func TestClampTemperature(t *testing.T) {
+	testCases := []struct {
+		name     string
+		model    string
+		input    float64
+		expected float64
+	}{
+		{name: "gemini above max", model: "gemini-3-pro", input: 2.5, expected: 2},
+		{name: "gemini within range", model: "gemini-3-flash", input: 1.3, expected: 1.3},
+		{name: "claude above max", model: "claude-sonnet-4-5", input: 1.5, expected: 1},
+		{name: "negative clamped to zero", model: "gemini-2.5-pro", input: -0.5, expected: 0},
+		{name: "unknown family uses gemini range", model: "custom-model", input: 3, expected: 2},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := &GenerateContentRequest{
+				Model:   tc.model,
+				Request: GeminiInternalRequest{GenerationConfig: &GeminiGenerationConfig{Temperature: tc.input}},
+			}
+			clampTemperature(req, nil)
+			if got := req.Request.GenerationConfig.Temperature; got != tc.expected {
+				t.Errorf("temperature = %v, want %v", got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestClampTemperatureConfiguredRanges(t *testing.T) {
+	t.Setenv("TEMPERATURE_RANGES", `{"gemini-*":[0.2,1.5],"gemini-3-pro*":[0,1],"claude-*":[1,0]}`)
+
+	testCases := []struct {
+		name     string
+		model    string
+		input    float64
+		expected float64
+	}{
+		{name: "over range clamped to configured max", model: "gemini-2.5-flash", input: 1.8, expected: 1.5},
+		{name: "negative clamped to configured min", model: "gemini-2.5-flash", input: -1, expected: 0.2},
+		{name: "most specific glob wins", model: "gemini-3-pro-high", input: 1.2, expected: 1},
+		{name: "invalid entry falls back to family default", model: "claude-sonnet-4-5", input: 1.5, expected: 1},
+		{name: "unmatched model uses family default", model: "custom-model", input: 3, expected: 2},
+		{name: "unset temperature left unset", model: "gemini-2.5-flash", input: 0, expected: 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := &GenerateContentRequest{
+				Model:   tc.model,
+				Request: GeminiInternalRequest{GenerationConfig: &GeminiGenerationConfig{Temperature: tc.input}},
+			}
+			clampTemperature(req, nil)
+			if got := req.Request.GenerationConfig.Temperature; got != tc.expected {
+				t.Errorf("temperature = %v, want %v", got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestClampTemperatureWithoutGenerationConfig(t *testing.T) {
+	req := &GenerateContentRequest{Model: "gemini-3-pro"}
+	clampTemperature(req, nil)
+	if req.Request.GenerationConfig != nil {
+		t.Error("expected generationConfig to stay nil")
+	}
+}
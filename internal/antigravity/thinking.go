@@ -3,7 +3,9 @@ package antigravity
 import (
 	"strings"
 
+	"github.com/dvcrn/antigravity-proxy/internal/env"
 	"github.com/dvcrn/antigravity-proxy/internal/logger"
+	"github.com/dvcrn/antigravity-proxy/internal/warnings"
 )
 
 func applyGeminiThinkingPreset(req *GenerateContentRequest) {
@@ -44,3 +46,64 @@ func applyGeminiThinkingPreset(req *GenerateContentRequest) {
 	// require thinking (e.g., some Gemini variants reject thinkingBudget=0).
 	req.Request.GenerationConfig.ThinkingConfig.ThinkingBudget = nil
 }
+
+// applyToolTurnThinking lowers thinking for tool-heavy turns (tools declared or the last
+// turn carrying a tool result) according to TOOL_TURN_THINKING: "low" forces
+// thinkingLevel=low, "off" sends thinkingBudget=0. It runs after the model-suffix preset
+// and overrides it.
+func applyToolTurnThinking(req *GenerateContentRequest, warns *warnings.Collector) {
+	if req == nil {
+		return
+	}
+
+	mode := strings.ToLower(strings.TrimSpace(env.GetOrDefault("TOOL_TURN_THINKING", "")))
+	if mode != "low" && mode != "off" {
+		return
+	}
+	if !isToolTurn(req.Request) {
+		return
+	}
+
+	if req.Request.GenerationConfig == nil {
+		req.Request.GenerationConfig = &GeminiGenerationConfig{}
+	}
+	if req.Request.GenerationConfig.ThinkingConfig == nil {
+		req.Request.GenerationConfig.ThinkingConfig = &ThinkingConfig{}
+	}
+	cfg := req.Request.GenerationConfig.ThinkingConfig
+
+	switch mode {
+	case "low":
+		cfg.ThinkingLevel = "low"
+		cfg.ThinkingBudget = nil
+	case "off":
+		budget := 0
+		cfg.ThinkingLevel = ""
+		cfg.ThinkingBudget = &budget
+		cfg.IncludeThoughts = false
+	}
+
+	logger.Get().Info().
+		Str("model", req.Model).
+		Str("tool_turn_thinking", mode).
+		Msg("Lowered thinking for tool turn")
+	warns.Addf("set thinking to %q for tool turn", mode)
+}
+
+// isToolTurn reports whether the request declares tools or its last content is a tool result.
+func isToolTurn(req GeminiInternalRequest) bool {
+	for _, tool := range req.Tools {
+		if len(tool.FunctionDeclarations) > 0 {
+			return true
+		}
+	}
+	if len(req.Contents) == 0 {
+		return false
+	}
+	for _, part := range req.Contents[len(req.Contents)-1].Parts {
+		if part.FunctionResponse != nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,58 @@
+package antigravity
+
+import "testing"
+
+func TestApplyToolTurnThinking(t *testing.T) {
+	tools := []Tool{{FunctionDeclarations: []FunctionDeclaration{{Name: "read_file"}}}}
+	toolResult := []Content{
+		{Role: "user", Parts: []ContentPart{{Text: "read it"}}},
+		{Role: "model", Parts: []ContentPart{{FunctionCall: &FunctionCall{Name: "read_file"}}}},
+		{Role: "user", Parts: []ContentPart{{FunctionResponse: &FunctionResponse{Name: "read_file"}}}},
+	}
+	plain := []Content{{Role: "user", Parts: []ContentPart{{Text: "hi"}}}}
+
+	testCases := []struct {
+		name       string
+		mode       string
+		model      string
+		tools      []Tool
+		contents   []Content
+		wantLevel  string
+		wantBudget *int
+	}{
+		{name: "low with tools overrides high preset", mode: "low", model: "gemini-3-pro-high", tools: tools, contents: plain, wantLevel: "low"},
+		{name: "low after tool result", mode: "low", model: "gemini-3-pro", contents: toolResult, wantLevel: "low"},
+		{name: "off with tools", mode: "off", model: "claude-sonnet-4-5", tools: tools, contents: plain, wantBudget: intPtr(0)},
+		{name: "no tools keeps preset", mode: "low", model: "gemini-3-pro-high", contents: plain, wantLevel: "high"},
+		{name: "disabled keeps preset", mode: "", model: "gemini-3-pro-high", tools: tools, contents: plain, wantLevel: "high"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("TOOL_TURN_THINKING", tc.mode)
+			req := &GenerateContentRequest{
+				Model:   tc.model,
+				Request: GeminiInternalRequest{Contents: tc.contents, Tools: tc.tools},
+			}
+			applyGeminiThinkingPreset(req)
+			applyToolTurnThinking(req, nil)
+
+			var level string
+			var budget *int
+			if req.Request.GenerationConfig != nil && req.Request.GenerationConfig.ThinkingConfig != nil {
+				level = req.Request.GenerationConfig.ThinkingConfig.ThinkingLevel
+				budget = req.Request.GenerationConfig.ThinkingConfig.ThinkingBudget
+			}
+			if level != tc.wantLevel {
+				t.Errorf("thinkingLevel = %q, want %q", level, tc.wantLevel)
+			}
+			if (budget == nil) != (tc.wantBudget == nil) || (budget != nil && *budget != *tc.wantBudget) {
+				t.Errorf("thinkingBudget = %v, want %v", budget, tc.wantBudget)
+			}
+		})
+	}
+}
+
+func intPtr(v int) *int {
+	return &v
+}
@@ -14,6 +14,20 @@ type ContentPart struct {
 	ThoughtSignature string            `json:"thoughtSignature,omitempty"`
 	FunctionCall     *FunctionCall     `json:"functionCall,omitempty"`
 	FunctionResponse *FunctionResponse `json:"functionResponse,omitempty"`
+	InlineData       *InlineData       `json:"inlineData,omitempty"`
+	FileData         *FileData         `json:"fileData,omitempty"`
+}
+
+// InlineData is media sent inline with a request, base64-encoded.
+type InlineData struct {
+	MimeType string `json:"mimeType"`
+	Data     string `json:"data"`
+}
+
+// FileData references media by URI (gs:// or a Files API URI) instead of inlining it.
+type FileData struct {
+	MimeType string `json:"mimeType,omitempty"`
+	FileURI  string `json:"fileUri"`
 }
 
 // Content represents a single message in the chat history for Gemini.
@@ -36,6 +50,19 @@ type GeminiParameterSchema struct {
 	Items       *GeminiParameterSchema            `json:"items,omitempty"`
 	Required    []string                          `json:"required,omitempty"`
 	Enum        []string                          `json:"enum,omitempty"`
+	Nullable    bool                              `json:"nullable,omitempty"`
+	// MinItems and MaxItems constrain array length; pointers so an explicit 0 is kept
+	MinItems *int `json:"minItems,omitempty"`
+	MaxItems *int `json:"maxItems,omitempty"`
+	// Format is only kept where Gemini accepts it (see schemaFormats)
+	Format    string   `json:"format,omitempty"`
+	Minimum   *float64 `json:"minimum,omitempty"`
+	Maximum   *float64 `json:"maximum,omitempty"`
+	MinLength *int     `json:"minLength,omitempty"`
+	MaxLength *int     `json:"maxLength,omitempty"`
+	Pattern   string   `json:"pattern,omitempty"`
+	// PropertyOrdering is the order Gemini fills Properties in (see propertyOrdering)
+	PropertyOrdering []string `json:"propertyOrdering,omitempty"`
 }
 
 // FunctionCall represents a tool call emitted by the model.
@@ -154,8 +181,16 @@ type ThinkingConfig struct {
 type GeminiGenerationConfig struct {
 	Temperature     float64         `json:"temperature,omitempty"`
 	TopP            float64         `json:"topP,omitempty"`
+	TopK            int             `json:"topK,omitempty"`
 	ThinkingConfig  *ThinkingConfig `json:"thinkingConfig,omitempty"`
 	MaxOutputTokens int             `json:"maxOutputTokens,omitempty"`
+	StopSequences   []string        `json:"stopSequences,omitempty"`
+	CandidateCount  int             `json:"candidateCount,omitempty"`
+	// Penalties are omitted when zero; some model variants reject them outright
+	FrequencyPenalty float64 `json:"frequencyPenalty,omitempty"`
+	PresencePenalty  float64 `json:"presencePenalty,omitempty"`
+	// Seed is a pointer because 0 is a valid seed
+	Seed *int `json:"seed,omitempty"`
 }
 
 // LoadCodeAssistRequest represents the request body for the loadCodeAssist endpoint.
@@ -212,6 +247,17 @@ type GeminiInternalRequest struct {
 // UnmarshalJSON: accept tools as array or single object (v1beta shape).
 // Adds leniency for public API payloads while keeping CloudCode shape.
 func (g *GeminiInternalRequest) UnmarshalJSON(b []byte) error {
+	return g.unmarshal(b, false)
+}
+
+// UnmarshalJSONStrict is UnmarshalJSON, but rejects unknown fields outside of tools the
+// way a json.Decoder with DisallowUnknownFields would. Custom UnmarshalJSON methods hide
+// the decoder's setting, so strict callers have to ask for this explicitly.
+func (g *GeminiInternalRequest) UnmarshalJSONStrict(b []byte) error {
+	return g.unmarshal(b, true)
+}
+
+func (g *GeminiInternalRequest) unmarshal(b []byte, strict bool) error {
 	// Define a raw holder to inspect tools shape without failing early
 	var raw struct {
 		Contents          []Content               `json:"contents"`
@@ -222,7 +268,11 @@ func (g *GeminiInternalRequest) UnmarshalJSON(b []byte) error {
 		SessionIDSnake    string                  `json:"session_id"`
 	}
 
-	if err := json.Unmarshal(b, &raw); err != nil {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	if strict {
+		dec.DisallowUnknownFields()
+	}
+	if err := dec.Decode(&raw); err != nil {
 		return err
 	}
 
@@ -290,8 +340,8 @@ func (g *GeminiInternalRequest) UnmarshalJSON(b []byte) error {
 
 	// If neither worked, fall back to strict error
 	// Re-attempt full strict unmarshal to surface a helpful error
-	type strict GeminiInternalRequest
-	var s strict
+	type plain GeminiInternalRequest
+	var s plain
 	if err := json.Unmarshal(b, &s); err != nil {
 		return err
 	}
@@ -355,4 +405,6 @@ func previewRawTools(raw json.RawMessage) string {
 // GenerateContentResponse represents the response from the generateContent endpoint.
 type GenerateContentResponse struct {
 	Response map[string]interface{} `json:"response"`
+	// Model is the model that served the response, set by GenerateContentWithFallback
+	Model string `json:"-"`
 }
@@ -0,0 +1,54 @@
+package auth
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// EmailFromIDToken returns the email claim of an OpenID Connect id_token. The signature
+// isn't verified: the token comes straight from Google's token endpoint over TLS and is
+// only used to label the account.
+func EmailFromIDToken(idToken string) (string, error) {
+	parts := strings.Split(idToken, ".")
+	if len(parts) != 3 {
+		return "", errors.New("id_token is not a JWT")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return "", fmt.Errorf("invalid id_token payload: %w", err)
+	}
+
+	var claims struct {
+		Email string `json:"email"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return "", fmt.Errorf("invalid id_token claims: %w", err)
+	}
+	if claims.Email == "" {
+		return "", errors.New("id_token has no email claim")
+	}
+	return claims.Email, nil
+}
+
+// ResolveEmail returns the account email from the id_token's email claim, falling back
+// to the userinfo endpoint when the token is missing or has no email (e.g. the email
+// scope wasn't granted).
+func ResolveEmail(ctx context.Context, tokens Tokens) (string, error) {
+	email, idTokenErr := EmailFromIDToken(tokens.IDToken)
+	if idTokenErr == nil {
+		return email, nil
+	}
+
+	ui, err := FetchUserInfo(ctx, tokens.AccessToken)
+	if err != nil {
+		return "", fmt.Errorf("%v; userinfo fallback failed: %w", idTokenErr, err)
+	}
+	if ui.Email == "" {
+		return "", fmt.Errorf("%v; userinfo returned no email", idTokenErr)
+	}
+	return ui.Email, nil
+}
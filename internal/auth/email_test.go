@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func fakeIDToken(claims string) string {
+	enc := base64.RawURLEncoding.EncodeToString
+	return enc([]byte(`{"alg":"RS256"}`)) + "." + enc([]byte(claims)) + ".sig"
+}
+
+func TestResolveEmail(t *testing.T) {
+	userInfoCalls := 0
+	userInfo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userInfoCalls++
+		if r.Header.Get("Authorization") != "Bearer access" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(`{"email":"userinfo@example.com"}`))
+	}))
+	defer userInfo.Close()
+	origURL := userInfoURL
+	userInfoURL = userInfo.URL
+	defer func() { userInfoURL = origURL }()
+
+	testCases := []struct {
+		name          string
+		tokens        Tokens
+		expected      string
+		expectErr     bool
+		expectFetches int
+	}{
+		{
+			name:     "email claim in id_token",
+			tokens:   Tokens{AccessToken: "access", IDToken: fakeIDToken(`{"sub":"1","email":"token@example.com"}`)},
+			expected: "token@example.com",
+		},
+		{
+			name:          "id_token without email falls back to userinfo",
+			tokens:        Tokens{AccessToken: "access", IDToken: fakeIDToken(`{"sub":"1"}`)},
+			expected:      "userinfo@example.com",
+			expectFetches: 1,
+		},
+		{
+			name:          "missing id_token falls back to userinfo",
+			tokens:        Tokens{AccessToken: "access"},
+			expected:      "userinfo@example.com",
+			expectFetches: 1,
+		},
+		{
+			name:          "both sources failing is an error",
+			tokens:        Tokens{AccessToken: "expired", IDToken: "not-a-jwt"},
+			expectErr:     true,
+			expectFetches: 1,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			userInfoCalls = 0
+			email, err := ResolveEmail(context.Background(), tc.tokens)
+			if tc.expectErr {
+				if err == nil {
+					t.Fatalf("expected an error, got email %q", email)
+				}
+			} else if err != nil {
+				t.Fatalf("ResolveEmail() error = %v", err)
+			}
+			if email != tc.expected {
+				t.Errorf("email = %q, want %q", email, tc.expected)
+			}
+			if userInfoCalls != tc.expectFetches {
+				t.Errorf("userinfo calls = %d, want %d", userInfoCalls, tc.expectFetches)
+			}
+		})
+	}
+}
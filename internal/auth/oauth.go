@@ -12,21 +12,35 @@ import (
 	"net"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
+
+	"github.com/dvcrn/antigravity-proxy/internal/env"
+	serverhttp "github.com/dvcrn/antigravity-proxy/internal/http"
 )
 
+// httpClient is used for the token exchange and user info calls, honoring HTTP_PROXY,
+// HTTPS_PROXY and NO_PROXY.
+var httpClient = serverhttp.NewHTTPClient()
+
 const (
 	googleAuthURL  = "https://accounts.google.com/o/oauth2/v2/auth"
 	googleTokenURL = "https://oauth2.googleapis.com/token"
-	userInfoURL    = "https://www.googleapis.com/oauth2/v1/userinfo?alt=json"
 )
 
+// userInfoURL is a variable so tests can point it at a fake server.
+var userInfoURL = "https://www.googleapis.com/oauth2/v1/userinfo?alt=json"
+
 type Config struct {
 	ClientID     string
 	ClientSecret string
 	RedirectURI  string
 	Scopes       []string
+	// ExcludeGrantedScopes drops include_granted_scopes so the token carries exactly
+	// Scopes, not ones granted to the client earlier.
+	ExcludeGrantedScopes bool
 }
 
 type Tokens struct {
@@ -57,7 +71,9 @@ func AuthorizationURL(cfg Config, state string, pkceChallenge string) (string, e
 	params.Set("scope", strings.Join(cfg.Scopes, " "))
 	params.Set("access_type", "offline")
 	params.Set("prompt", "consent")
-	params.Set("include_granted_scopes", "true")
+	if !cfg.ExcludeGrantedScopes {
+		params.Set("include_granted_scopes", "true")
+	}
 	params.Set("state", state)
 	params.Set("code_challenge", pkceChallenge)
 	params.Set("code_challenge_method", "S256")
@@ -89,24 +105,101 @@ type CallbackResult struct {
 	State string
 }
 
-func WaitForCallback(ctx context.Context, redirectURI string) (CallbackResult, error) {
+// Timeouts of the callback server, so stray connections to the port (scanners, half-open
+// sockets) are dropped instead of holding it open. The overall wait is bounded by the
+// context passed to Wait.
+var (
+	callbackReadHeaderTimeout = 10 * time.Second
+	callbackShutdownTimeout   = 5 * time.Second
+)
+
+// defaultCallbackIdleTimeout is how long an idle keep-alive connection to the callback
+// server stays open when OAUTH_CALLBACK_IDLE_TIMEOUT is unset.
+const defaultCallbackIdleTimeout = 30 * time.Second
+
+// callbackIdleTimeout returns OAUTH_CALLBACK_IDLE_TIMEOUT, falling back to
+// defaultCallbackIdleTimeout when unset or invalid.
+func callbackIdleTimeout() time.Duration {
+	value, ok := env.Get("OAUTH_CALLBACK_IDLE_TIMEOUT")
+	if !ok {
+		return defaultCallbackIdleTimeout
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return defaultCallbackIdleTimeout
+	}
+	return d
+}
+
+// CallbackServer is a local HTTP server receiving the OAuth redirect.
+type CallbackServer struct {
+	srv         *http.Server
+	ln          net.Listener
+	redirectURI string
+	// portFallback is set when the configured port was busy and a free one was bound
+	portFallback bool
+	resultCh     chan CallbackResult
+	errCh        chan error
+}
+
+// StartCallbackServer binds the callback listener for redirectURI. A redirect URI
+// without a port, or with port 0, binds an ephemeral port; use RedirectURI to get the
+// URI with the bound port for AuthorizationURL and ExchangeCode.
+func StartCallbackServer(redirectURI string) (*CallbackServer, error) {
+	return startCallbackServer(redirectURI, false)
+}
+
+// StartCallbackServerOrFreePort is StartCallbackServer, but binds an ephemeral port
+// when the redirect URI's port is already in use. RedirectURI reflects the port used.
+func StartCallbackServerOrFreePort(redirectURI string) (*CallbackServer, error) {
+	return startCallbackServer(redirectURI, true)
+}
+
+func startCallbackServer(redirectURI string, freePortFallback bool) (*CallbackServer, error) {
 	port, path, err := parseRedirectURI(redirectURI)
 	if err != nil {
-		return CallbackResult{}, err
+		return nil, err
+	}
+
+	ln, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	portFallback := false
+	if err != nil && freePortFallback && port != 0 && errors.Is(err, syscall.EADDRINUSE) {
+		port, portFallback = 0, true
+		ln, err = net.Listen("tcp", "127.0.0.1:0")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to bind OAuth callback port: %w", err)
 	}
 
-	resultCh := make(chan CallbackResult, 1)
-	errCh := make(chan error, 1)
+	cs := &CallbackServer{
+		ln:           ln,
+		redirectURI:  redirectURI,
+		portFallback: portFallback,
+		resultCh:     make(chan CallbackResult, 1),
+		errCh:        make(chan error, 1),
+	}
+	if port == 0 {
+		cs.redirectURI, err = withPort(redirectURI, cs.Port())
+		if err != nil {
+			ln.Close()
+			return nil, err
+		}
+	}
 
-	srv := &http.Server{}
 	mux := http.NewServeMux()
-	srv.Handler = mux
+	cs.srv = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: callbackReadHeaderTimeout,
+		ReadTimeout:       callbackReadHeaderTimeout,
+		WriteTimeout:      callbackReadHeaderTimeout,
+		IdleTimeout:       callbackIdleTimeout(),
+	}
 
 	mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
 		q := r.URL.Query()
 		if errStr := q.Get("error"); errStr != "" {
 			writeHTML(w, http.StatusBadRequest, "Authentication failed", "OAuth error: "+htmlEscape(errStr))
-			sendErrOnce(errCh, fmt.Errorf("oauth error: %s", errStr))
+			sendErrOnce(cs.errCh, fmt.Errorf("oauth error: %s", errStr))
 			return
 		}
 
@@ -114,39 +207,81 @@ func WaitForCallback(ctx context.Context, redirectURI string) (CallbackResult, e
 		state := q.Get("state")
 		if code == "" {
 			writeHTML(w, http.StatusBadRequest, "Authentication failed", "No authorization code received.")
-			sendErrOnce(errCh, errors.New("no authorization code received"))
+			sendErrOnce(cs.errCh, errors.New("no authorization code received"))
 			return
 		}
 
 		writeHTML(w, http.StatusOK, "Authentication successful", "You can close this window and return to the terminal.")
-		sendResultOnce(resultCh, CallbackResult{Code: code, State: state})
+		sendResultOnce(cs.resultCh, CallbackResult{Code: code, State: state})
 	})
 
-	ln, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
-	if err != nil {
-		return CallbackResult{}, err
-	}
-	defer ln.Close()
-
 	go func() {
-		if serveErr := srv.Serve(ln); serveErr != nil && !errors.Is(serveErr, http.ErrServerClosed) {
-			sendErrOnce(errCh, serveErr)
+		if serveErr := cs.srv.Serve(ln); serveErr != nil && !errors.Is(serveErr, http.ErrServerClosed) {
+			sendErrOnce(cs.errCh, serveErr)
 		}
 	}()
 
+	return cs, nil
+}
+
+// Port returns the port the callback server is bound to.
+func (cs *CallbackServer) Port() int {
+	return cs.ln.Addr().(*net.TCPAddr).Port
+}
+
+// RedirectURI returns the redirect URI with the bound port.
+func (cs *CallbackServer) RedirectURI() string {
+	return cs.redirectURI
+}
+
+// PortFallback reports whether a free port was bound because the configured one was in use.
+func (cs *CallbackServer) PortFallback() bool {
+	return cs.portFallback
+}
+
+// Wait blocks until the OAuth redirect arrives or ctx is done, then shuts the server down.
+func (cs *CallbackServer) Wait(ctx context.Context) (CallbackResult, error) {
+	defer cs.Close()
+
 	select {
 	case <-ctx.Done():
-		_ = srv.Shutdown(context.Background())
 		return CallbackResult{}, ctx.Err()
-	case err := <-errCh:
-		_ = srv.Shutdown(context.Background())
+	case err := <-cs.errCh:
 		return CallbackResult{}, err
-	case res := <-resultCh:
-		_ = srv.Shutdown(context.Background())
+	case res := <-cs.resultCh:
 		return res, nil
 	}
 }
 
+// Close shuts the callback server down, forcibly closing connections still open after
+// callbackShutdownTimeout. It is safe to call more than once.
+func (cs *CallbackServer) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), callbackShutdownTimeout)
+	defer cancel()
+	if err := cs.srv.Shutdown(ctx); err != nil {
+		return cs.srv.Close()
+	}
+	return nil
+}
+
+// WaitForCallback starts a callback server for redirectURI and waits for the redirect.
+// The redirect URI must have a fixed port, since the authorization URL is built before
+// this is called; use StartCallbackServer for ephemeral ports.
+func WaitForCallback(ctx context.Context, redirectURI string) (CallbackResult, error) {
+	port, _, err := parseRedirectURI(redirectURI)
+	if err != nil {
+		return CallbackResult{}, err
+	}
+	if port == 0 {
+		return CallbackResult{}, fmt.Errorf("WaitForCallback needs a fixed redirect_uri port; use StartCallbackServer for port 0")
+	}
+	cs, err := StartCallbackServer(redirectURI)
+	if err != nil {
+		return CallbackResult{}, err
+	}
+	return cs.Wait(ctx)
+}
+
 func ExchangeCode(ctx context.Context, cfg Config, code string, pkceVerifier string) (Tokens, error) {
 	form := url.Values{}
 	form.Set("client_id", cfg.ClientID)
@@ -162,7 +297,7 @@ func ExchangeCode(ctx context.Context, cfg Config, code string, pkceVerifier str
 	}
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := httpClient.Do(req)
 	if err != nil {
 		return Tokens{}, err
 	}
@@ -208,7 +343,7 @@ func FetchUserInfo(ctx context.Context, accessToken string) (UserInfo, error) {
 	}
 	req.Header.Set("Authorization", "Bearer "+accessToken)
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := httpClient.Do(req)
 	if err != nil {
 		return UserInfo{}, err
 	}
@@ -229,6 +364,9 @@ func FetchUserInfo(ctx context.Context, accessToken string) (UserInfo, error) {
 	return ui, nil
 }
 
+// minRedirectPort is the lowest fixed callback port allowed; lower ports need root.
+const minRedirectPort = 1024
+
 func parseRedirectURI(redirectURI string) (port int, path string, err error) {
 	u, err := url.Parse(redirectURI)
 	if err != nil {
@@ -240,14 +378,19 @@ func parseRedirectURI(redirectURI string) (port int, path string, err error) {
 	if u.Hostname() != "localhost" && u.Hostname() != "127.0.0.1" {
 		return 0, "", fmt.Errorf("redirect_uri must be localhost")
 	}
+	// Port 0 means bind an ephemeral port; a missing port is rejected rather than
+	// guessed, so the URI registered with Google always names the port explicitly
 	p := u.Port()
 	if p == "" {
-		return 0, "", fmt.Errorf("redirect_uri must include an explicit port")
+		return 0, "", fmt.Errorf("redirect_uri must include a port, or 0 for a free port")
 	}
 	parsedPort, err := net.LookupPort("tcp", p)
 	if err != nil {
 		return 0, "", fmt.Errorf("invalid redirect_uri port: %w", err)
 	}
+	if parsedPort != 0 && parsedPort < minRedirectPort {
+		return 0, "", fmt.Errorf("redirect_uri port %d is privileged; use a port from %d to 65535, or 0 for a free port", parsedPort, minRedirectPort)
+	}
 	cbPath := u.EscapedPath()
 	if cbPath == "" {
 		cbPath = "/"
@@ -255,6 +398,16 @@ func parseRedirectURI(redirectURI string) (port int, path string, err error) {
 	return parsedPort, cbPath, nil
 }
 
+// withPort returns redirectURI with its port replaced by port.
+func withPort(redirectURI string, port int) (string, error) {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		return "", err
+	}
+	u.Host = net.JoinHostPort(u.Hostname(), strconv.Itoa(port))
+	return u.String(), nil
+}
+
 func writeHTML(w http.ResponseWriter, status int, title string, body string) {
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	w.WriteHeader(status)
@@ -0,0 +1,210 @@
+package auth
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStartCallbackServerEphemeralPort(t *testing.T) {
+	for _, redirectURI := range []string{"http://localhost:0/oauth-callback", "http://127.0.0.1:0/oauth-callback"} {
+		t.Run(redirectURI, func(t *testing.T) {
+			cs, err := StartCallbackServer(redirectURI)
+			if err != nil {
+				t.Fatalf("StartCallbackServer() error = %v", err)
+			}
+			defer cs.Close()
+
+			if cs.Port() == 0 {
+				t.Fatal("expected an ephemeral port to be bound")
+			}
+			u, err := url.Parse(cs.RedirectURI())
+			if err != nil {
+				t.Fatalf("invalid redirect URI %q: %v", cs.RedirectURI(), err)
+			}
+			if u.Port() != strconv.Itoa(cs.Port()) || u.Path != "/oauth-callback" {
+				t.Errorf("RedirectURI() = %q, want bound port %d and the original path", cs.RedirectURI(), cs.Port())
+			}
+
+			// The rewritten URI is what the authorization URL carries
+			authURL, err := AuthorizationURL(Config{ClientID: "id", RedirectURI: cs.RedirectURI(), Scopes: []string{"openid"}}, "state", "challenge")
+			if err != nil {
+				t.Fatalf("AuthorizationURL() error = %v", err)
+			}
+			if !strings.Contains(authURL, url.QueryEscape(cs.RedirectURI())) {
+				t.Errorf("expected auth URL to use %q, got %s", cs.RedirectURI(), authURL)
+			}
+
+			go func() {
+				resp, err := http.Get(cs.RedirectURI() + "?code=abc&state=xyz")
+				if err == nil {
+					resp.Body.Close()
+				}
+			}()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			res, err := cs.Wait(ctx)
+			if err != nil {
+				t.Fatalf("Wait() error = %v", err)
+			}
+			if res.Code != "abc" || res.State != "xyz" {
+				t.Errorf("Wait() = %+v", res)
+			}
+		})
+	}
+}
+
+func TestStartCallbackServerOrFreePortBusyPort(t *testing.T) {
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to occupy a port: %v", err)
+	}
+	defer busy.Close()
+	busyPort := busy.Addr().(*net.TCPAddr).Port
+	redirectURI := "http://localhost:" + strconv.Itoa(busyPort) + "/oauth-callback"
+
+	if cs, err := StartCallbackServer(redirectURI); err == nil {
+		cs.Close()
+		t.Fatalf("StartCallbackServer() on a busy port should fail")
+	}
+
+	cs, err := StartCallbackServerOrFreePort(redirectURI)
+	if err != nil {
+		t.Fatalf("StartCallbackServerOrFreePort() error = %v", err)
+	}
+	defer cs.Close()
+
+	if !cs.PortFallback() || cs.Port() == busyPort {
+		t.Fatalf("expected a different port than the busy %d", busyPort)
+	}
+	want := "http://localhost:" + strconv.Itoa(cs.Port()) + "/oauth-callback"
+	if cs.RedirectURI() != want {
+		t.Errorf("RedirectURI() = %q, want %q", cs.RedirectURI(), want)
+	}
+
+	authURL, err := AuthorizationURL(Config{ClientID: "id", RedirectURI: cs.RedirectURI(), Scopes: []string{"openid"}}, "state", "challenge")
+	if err != nil {
+		t.Fatalf("AuthorizationURL() error = %v", err)
+	}
+	if !strings.Contains(authURL, url.QueryEscape(want)) {
+		t.Errorf("expected auth URL to use %q, got %s", want, authURL)
+	}
+}
+
+func TestParseRedirectURIPort(t *testing.T) {
+	tests := []struct {
+		redirectURI string
+		wantPort    int
+		wantErr     bool
+	}{
+		{redirectURI: "http://localhost:51121/oauth-callback", wantPort: 51121},
+		{redirectURI: "http://localhost:0/oauth-callback", wantPort: 0},
+		{redirectURI: "http://127.0.0.1/oauth-callback", wantErr: true},
+		{redirectURI: "http://localhost:1024/cb", wantPort: 1024},
+		{redirectURI: "http://localhost:80/cb", wantErr: true},
+		{redirectURI: "http://localhost:70000/cb", wantErr: true},
+		{redirectURI: "https://localhost:51121/cb", wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.redirectURI, func(t *testing.T) {
+			port, _, err := parseRedirectURI(tc.redirectURI)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("parseRedirectURI() error = %v, wantErr %v", err, tc.wantErr)
+			}
+			if !tc.wantErr && port != tc.wantPort {
+				t.Errorf("parseRedirectURI() port = %d, want %d", port, tc.wantPort)
+			}
+		})
+	}
+}
+
+func TestWaitForCallbackRequiresFixedPort(t *testing.T) {
+	if _, err := WaitForCallback(context.Background(), "http://localhost:0/oauth-callback"); err == nil {
+		t.Fatal("expected WaitForCallback to reject port 0")
+	}
+}
+
+func TestAuthorizationURLIncludeGrantedScopes(t *testing.T) {
+	tests := []struct {
+		name    string
+		exclude bool
+		want    string
+	}{
+		{name: "default includes granted scopes", exclude: false, want: "true"},
+		{name: "excluded", exclude: true, want: ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := Config{ClientID: "id", RedirectURI: "http://localhost:51121/oauth-callback", Scopes: []string{"openid"}, ExcludeGrantedScopes: tc.exclude}
+			authURL, err := AuthorizationURL(cfg, "state", "challenge")
+			if err != nil {
+				t.Fatalf("AuthorizationURL() error = %v", err)
+			}
+			u, err := url.Parse(authURL)
+			if err != nil {
+				t.Fatalf("invalid auth URL %q: %v", authURL, err)
+			}
+			if got := u.Query().Get("include_granted_scopes"); got != tc.want {
+				t.Errorf("include_granted_scopes = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCallbackServerSurvivesStalledConnection(t *testing.T) {
+	origTimeout := callbackReadHeaderTimeout
+	callbackReadHeaderTimeout = 200 * time.Millisecond
+	defer func() { callbackReadHeaderTimeout = origTimeout }()
+
+	cs, err := StartCallbackServer("http://127.0.0.1:0/oauth-callback")
+	if err != nil {
+		t.Fatalf("StartCallbackServer() error = %v", err)
+	}
+	defer cs.Close()
+
+	// A client that sends half a request line and then goes quiet
+	stalled, err := net.Dial("tcp", "127.0.0.1:"+strconv.Itoa(cs.Port()))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer stalled.Close()
+	if _, err := stalled.Write([]byte("GET /oauth-callback HTTP/1.1\r\nHost: loc")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	go func() {
+		resp, err := http.Get(cs.RedirectURI() + "?code=abc&state=xyz")
+		if err == nil {
+			resp.Body.Close()
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	start := time.Now()
+	res, err := cs.Wait(ctx)
+	if err != nil {
+		t.Fatalf("Wait() error = %v", err)
+	}
+	if res.Code != "abc" || res.State != "xyz" {
+		t.Errorf("Wait() = %+v", res)
+	}
+	// Wait shuts the server down; the stalled connection must not hold that up
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Wait() took %v with a stalled connection open", elapsed)
+	}
+
+	// The stalled connection is dropped by the header timeout
+	_ = stalled.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := stalled.Read(make([]byte, 1)); err == nil {
+		t.Error("expected the stalled connection to be closed")
+	}
+}
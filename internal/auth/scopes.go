@@ -0,0 +1,43 @@
+package auth
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MissingScopes returns the requested scopes absent from granted, the space-separated
+// scope string from the token response. Order follows requested.
+func MissingScopes(requested []string, granted string) []string {
+	have := make(map[string]bool)
+	for _, scope := range strings.Fields(granted) {
+		have[scope] = true
+	}
+
+	var missing []string
+	for _, scope := range requested {
+		if !have[scope] {
+			missing = append(missing, scope)
+		}
+	}
+	return missing
+}
+
+// RequiredScopes are the scopes CloudCode calls fail without; loadCodeAssist answers a
+// token lacking them with a bare 403.
+var RequiredScopes = []string{
+	"https://www.googleapis.com/auth/cloud-platform",
+}
+
+// CheckRequiredScopes returns an error naming the RequiredScopes absent from granted and
+// how to fix it. Credentials saved without a scope string can't be checked and pass.
+func CheckRequiredScopes(granted string) error {
+	if strings.TrimSpace(granted) == "" {
+		return nil
+	}
+	missing := MissingScopes(RequiredScopes, granted)
+	if len(missing) == 0 {
+		return nil
+	}
+	return fmt.Errorf("credentials are missing required OAuth scopes %s; run the auth command again and grant all permissions on the consent screen",
+		strings.Join(missing, ", "))
+}
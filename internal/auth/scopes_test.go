@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMissingScopes(t *testing.T) {
+	requested := []string{
+		"https://www.googleapis.com/auth/cloud-platform",
+		"https://www.googleapis.com/auth/userinfo.email",
+		"https://www.googleapis.com/auth/cclog",
+	}
+
+	testCases := []struct {
+		name     string
+		granted  string
+		expected []string
+	}{
+		{
+			name:    "all granted",
+			granted: "https://www.googleapis.com/auth/userinfo.email https://www.googleapis.com/auth/cclog https://www.googleapis.com/auth/cloud-platform openid",
+		},
+		{
+			name:     "cloud-platform missing",
+			granted:  "https://www.googleapis.com/auth/userinfo.email https://www.googleapis.com/auth/cclog",
+			expected: []string{"https://www.googleapis.com/auth/cloud-platform"},
+		},
+		{
+			name:     "nothing granted",
+			granted:  "",
+			expected: requested,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := MissingScopes(requested, tc.granted)
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("MissingScopes() = %v, want %v", got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestCheckRequiredScopes(t *testing.T) {
+	testCases := []struct {
+		name        string
+		granted     string
+		expectedErr string
+	}{
+		{name: "granted", granted: "openid https://www.googleapis.com/auth/cloud-platform"},
+		{name: "no scope stored", granted: ""},
+		{name: "cloud-platform missing", granted: "openid https://www.googleapis.com/auth/userinfo.email", expectedErr: "https://www.googleapis.com/auth/cloud-platform"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := CheckRequiredScopes(tc.granted)
+			if tc.expectedErr == "" {
+				if err != nil {
+					t.Errorf("CheckRequiredScopes() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.expectedErr) {
+				t.Errorf("CheckRequiredScopes() = %v, want error naming %s", err, tc.expectedErr)
+			}
+		})
+	}
+}
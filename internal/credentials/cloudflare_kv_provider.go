@@ -3,25 +3,19 @@
 package credentials
 
 import (
-	"context"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
-	"net/http"
-	"net/url"
-	"strings"
-	"time"
 
+	serverhttp "github.com/dvcrn/antigravity-proxy/internal/http"
 	"github.com/dvcrn/antigravity-proxy/internal/logger"
 
-	"github.com/syumai/workers/cloudflare/fetch"
 	"github.com/syumai/workers/cloudflare/kv"
 )
 
 // CloudflareKVProvider implements CredentialsProvider using Cloudflare KV storage
 type CloudflareKVProvider struct {
-	kvStore    *kv.Namespace
-	httpClient *fetch.Client
+	kvStore       *kv.Namespace
+	refreshConfig RefreshConfig
 }
 
 // NewCloudflareKVProvider creates a new Cloudflare KV-based credentials provider
@@ -33,9 +27,11 @@ func NewCloudflareKVProvider() (*CloudflareKVProvider, error) {
 		return nil, fmt.Errorf("failed to initialize KV namespace: %w", err)
 	}
 
+	refreshConfig := DefaultRefreshConfig()
+	refreshConfig.HTTPClient = serverhttp.NewHTTPClient()
 	return &CloudflareKVProvider{
-		kvStore:    kvStore,
-		httpClient: fetch.NewClient(),
+		kvStore:       kvStore,
+		refreshConfig: refreshConfig,
 	}, nil
 }
 
@@ -84,55 +80,11 @@ func (c *CloudflareKVProvider) RefreshToken() error {
 		return fmt.Errorf("failed to get credentials for refresh: %w", err)
 	}
 
-	if creds.RefreshToken == "" {
-		return fmt.Errorf("no refresh token available")
-	}
-
-	// Prepare refresh request
-	form := url.Values{}
-	form.Add("client_id", OAuthClientID)
-	form.Add("client_secret", OAuthClientSecret)
-	form.Add("refresh_token", creds.RefreshToken)
-	form.Add("grant_type", "refresh_token")
-
-	// Create fetch request for Workers
-	fetchReq, err := fetch.NewRequest(context.Background(), "POST", "https://oauth2.googleapis.com/token", strings.NewReader(form.Encode()))
-	if err != nil {
-		return err
-	}
-	fetchReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-
-	// Execute refresh request
-	resp, err := c.httpClient.Do(fetchReq, nil)
+	refreshResp, err := RefreshAccessToken(creds.RefreshToken, c.refreshConfig)
 	if err != nil {
 		return err
 	}
-	defer resp.Body.Close()
-
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return err
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("token refresh failed with status %d: %s", resp.StatusCode, string(body))
-	}
-
-	// Parse response
-	var refreshResp TokenRefreshResponse
-	if err := json.Unmarshal(body, &refreshResp); err != nil {
-		return err
-	}
-
-	// Update credentials
-	creds.AccessToken = refreshResp.AccessToken
-	creds.ExpiryDate = time.Now().Add(time.Duration(refreshResp.ExpiresIn)*time.Second).Unix() * 1000
-	creds.TokenType = refreshResp.TokenType
-
-	// Update scope if provided in refresh response
-	if refreshResp.Scope != "" {
-		creds.Scope = refreshResp.Scope
-	}
+	applyRefresh(creds, refreshResp)
 
 	// Save updated credentials
 	if err := c.SaveCredentials(creds); err != nil {
@@ -4,12 +4,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
-	"net/http"
-	"net/url"
 	"os"
 	"path/filepath"
-	"strings"
-	"time"
 
 	"github.com/dvcrn/antigravity-proxy/internal/env"
 	"github.com/dvcrn/antigravity-proxy/internal/logger"
@@ -17,16 +13,15 @@ import (
 
 // FileProvider implements CredentialsProvider using file-based storage
 type FileProvider struct {
-	filePath   string
-	httpClient *http.Client
+	filePath      string
+	account       string
+	refreshConfig RefreshConfig
 }
 
 // NewFileProvider creates a new file-based credentials provider
 func NewFileProvider() (*FileProvider, error) {
 	provider := &FileProvider{
-		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
-		},
+		refreshConfig: DefaultRefreshConfig(),
 	}
 
 	// Determine the file path
@@ -37,6 +32,36 @@ func NewFileProvider() (*FileProvider, error) {
 	return provider, nil
 }
 
+// NewFileProviderForAccount creates a file-based credentials provider for a named account.
+// Credentials are stored next to the default file as oauth_creds_<account>.json.
+// An empty account is equivalent to NewFileProvider.
+func NewFileProviderForAccount(account string) (*FileProvider, error) {
+	provider, err := NewFileProvider()
+	if err != nil || account == "" {
+		return provider, err
+	}
+
+	if !isValidAccountName(account) {
+		return nil, fmt.Errorf("invalid account name %q: only letters, digits, '-' and '_' are allowed", account)
+	}
+
+	provider.account = account
+	provider.filePath = filepath.Join(filepath.Dir(provider.filePath), fmt.Sprintf("oauth_creds_%s.json", account))
+	return provider, nil
+}
+
+// isValidAccountName reports whether an account name is safe to embed in a file name.
+func isValidAccountName(account string) bool {
+	for _, r := range account {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+		default:
+			return false
+		}
+	}
+	return account != ""
+}
+
 // determineFilePath sets the file path based on environment variables or defaults
 func (f *FileProvider) determineFilePath() error {
 	// 1. Check for file path in environment variable
@@ -80,6 +105,11 @@ func (f *FileProvider) GetCredentials() (*OAuthCredentials, error) {
 		}
 	}
 
+	// Named accounts must have their own file
+	if f.account != "" {
+		return nil, fmt.Errorf("OAuth credentials for account %q not found at %s", f.account, f.filePath)
+	}
+
 	// Fallback to raw JSON from environment variable
 	if credsJSON, ok := env.Get("CLOUDCODE_OAUTH_CREDS"); ok {
 		creds := &OAuthCredentials{}
@@ -130,54 +160,11 @@ func (f *FileProvider) RefreshToken() error {
 		return fmt.Errorf("failed to get credentials for refresh: %w", err)
 	}
 
-	if creds.RefreshToken == "" {
-		return fmt.Errorf("no refresh token available")
-	}
-
-	// Prepare refresh request
-	form := url.Values{}
-	form.Add("client_id", OAuthClientID)
-	form.Add("client_secret", OAuthClientSecret)
-	form.Add("refresh_token", creds.RefreshToken)
-	form.Add("grant_type", "refresh_token")
-
-	req, err := http.NewRequest("POST", "https://oauth2.googleapis.com/token", strings.NewReader(form.Encode()))
+	refreshResp, err := RefreshAccessToken(creds.RefreshToken, f.refreshConfig)
 	if err != nil {
 		return err
 	}
-	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
-
-	// Execute refresh request
-	resp, err := f.httpClient.Do(req)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return err
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("token refresh failed with status %d: %s", resp.StatusCode, string(body))
-	}
-
-	// Parse response
-	var refreshResp TokenRefreshResponse
-	if err := json.Unmarshal(body, &refreshResp); err != nil {
-		return err
-	}
-
-	// Update credentials
-	creds.AccessToken = refreshResp.AccessToken
-	creds.ExpiryDate = time.Now().Add(time.Duration(refreshResp.ExpiresIn)*time.Second).Unix() * 1000
-	creds.TokenType = refreshResp.TokenType
-
-	// Update scope if provided in refresh response
-	if refreshResp.Scope != "" {
-		creds.Scope = refreshResp.Scope
-	}
+	applyRefresh(creds, refreshResp)
 
 	// Save updated credentials
 	if err := f.SaveCredentials(creds); err != nil {
@@ -189,8 +176,21 @@ func (f *FileProvider) RefreshToken() error {
 	return nil
 }
 
+// SetRefreshConfig overrides the OAuth client and token endpoint used by RefreshToken.
+func (f *FileProvider) SetRefreshConfig(cfg RefreshConfig) {
+	f.refreshConfig = cfg
+}
+
+// FilePath returns the credentials file path, or "" when credentials come from CLOUDCODE_OAUTH_CREDS.
+func (f *FileProvider) FilePath() string {
+	return f.filePath
+}
+
 // Name returns the provider name
 func (f *FileProvider) Name() string {
+	if f.account != "" {
+		return fmt.Sprintf("FileProvider(%s, account=%s)", f.filePath, f.account)
+	}
 	if f.filePath != "" {
 		return fmt.Sprintf("FileProvider(%s)", f.filePath)
 	}
@@ -0,0 +1,91 @@
+package credentials
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// OAuthTokenURL is Google's OAuth token endpoint.
+const OAuthTokenURL = "https://oauth2.googleapis.com/token"
+
+// RefreshConfig configures RefreshAccessToken.
+type RefreshConfig struct {
+	ClientID     string
+	ClientSecret string
+	TokenURL     string
+	// HTTPClient performs the token request; nil uses a client with a 30s timeout.
+	HTTPClient interface {
+		Do(req *http.Request) (*http.Response, error)
+	}
+}
+
+// DefaultRefreshConfig returns the config for the built-in OAuth client.
+func DefaultRefreshConfig() RefreshConfig {
+	return RefreshConfig{
+		ClientID:     OAuthClientID,
+		ClientSecret: OAuthClientSecret,
+		TokenURL:     OAuthTokenURL,
+	}
+}
+
+// RefreshAccessToken exchanges a refresh token for a new access token.
+func RefreshAccessToken(refreshToken string, cfg RefreshConfig) (TokenRefreshResponse, error) {
+	if refreshToken == "" {
+		return TokenRefreshResponse{}, fmt.Errorf("no refresh token available")
+	}
+
+	form := url.Values{}
+	form.Add("client_id", cfg.ClientID)
+	form.Add("client_secret", cfg.ClientSecret)
+	form.Add("refresh_token", refreshToken)
+	form.Add("grant_type", "refresh_token")
+
+	req, err := http.NewRequestWithContext(context.Background(), "POST", cfg.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return TokenRefreshResponse{}, err
+	}
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+
+	client := cfg.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return TokenRefreshResponse{}, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return TokenRefreshResponse{}, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return TokenRefreshResponse{}, fmt.Errorf("token refresh failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var refreshResp TokenRefreshResponse
+	if err := json.Unmarshal(body, &refreshResp); err != nil {
+		return TokenRefreshResponse{}, err
+	}
+	return refreshResp, nil
+}
+
+// applyRefresh updates creds with a token refresh response.
+func applyRefresh(creds *OAuthCredentials, refreshResp TokenRefreshResponse) {
+	creds.AccessToken = refreshResp.AccessToken
+	creds.ExpiryDate = time.Now().Add(time.Duration(refreshResp.ExpiresIn)*time.Second).Unix() * 1000
+	creds.TokenType = refreshResp.TokenType
+
+	// Update scope if provided in refresh response
+	if refreshResp.Scope != "" {
+		creds.Scope = refreshResp.Scope
+	}
+}
@@ -0,0 +1,82 @@
+package credentials
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTokenServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("failed to parse form: %v", err)
+		}
+		if r.Form.Get("client_id") != "test-client" || r.Form.Get("client_secret") != "test-secret" {
+			t.Errorf("unexpected client credentials: %v", r.Form)
+		}
+		if r.Form.Get("refresh_token") != "1//refresh" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"access_token":"ya29.new","expires_in":3600,"token_type":"Bearer"}`))
+	}))
+}
+
+func TestRefreshAccessToken(t *testing.T) {
+	server := newTokenServer(t)
+	defer server.Close()
+	cfg := RefreshConfig{ClientID: "test-client", ClientSecret: "test-secret", TokenURL: server.URL}
+
+	resp, err := RefreshAccessToken("1//refresh", cfg)
+	if err != nil {
+		t.Fatalf("RefreshAccessToken() error = %v", err)
+	}
+	if resp.AccessToken != "ya29.new" || resp.ExpiresIn != 3600 {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+
+	if _, err := RefreshAccessToken("1//revoked", cfg); err == nil {
+		t.Error("expected an error for a rejected refresh token")
+	}
+	if _, err := RefreshAccessToken("", cfg); err == nil {
+		t.Error("expected an error for a missing refresh token")
+	}
+}
+
+func TestFileProviderRefreshTokenUsesRefreshConfig(t *testing.T) {
+	server := newTokenServer(t)
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "oauth_creds.json")
+	if err := os.WriteFile(path, []byte(`{"access_token":"ya29.old","refresh_token":"1//refresh","scope":"openid"}`), 0o600); err != nil {
+		t.Fatalf("failed to write creds: %v", err)
+	}
+	t.Setenv("CLOUDCODE_OAUTH_CREDS_PATH", path)
+
+	provider, err := NewFileProvider()
+	if err != nil {
+		t.Fatalf("NewFileProvider() error = %v", err)
+	}
+	provider.SetRefreshConfig(RefreshConfig{ClientID: "test-client", ClientSecret: "test-secret", TokenURL: server.URL})
+
+	if err := provider.RefreshToken(); err != nil {
+		t.Fatalf("RefreshToken() error = %v", err)
+	}
+
+	creds, err := provider.GetCredentials()
+	if err != nil {
+		t.Fatalf("GetCredentials() error = %v", err)
+	}
+	if creds.AccessToken != "ya29.new" || creds.RefreshToken != "1//refresh" || creds.Scope != "openid" {
+		t.Errorf("unexpected saved credentials: %+v", creds)
+	}
+	if time.UnixMilli(creds.ExpiryDate).Before(time.Now().Add(59 * time.Minute)) {
+		t.Errorf("expected expiry about an hour out, got %v", time.UnixMilli(creds.ExpiryDate))
+	}
+}
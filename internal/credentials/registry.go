@@ -0,0 +1,62 @@
+package credentials
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Registry holds named credential providers so a single proxy can route requests
+// to different Google accounts.
+type Registry struct {
+	mu             sync.RWMutex
+	providers      map[string]CredentialsProvider
+	defaultAccount string
+}
+
+// NewRegistry creates an empty registry. Requests that don't name an account are
+// served by defaultAccount.
+func NewRegistry(defaultAccount string) *Registry {
+	return &Registry{
+		providers:      map[string]CredentialsProvider{},
+		defaultAccount: defaultAccount,
+	}
+}
+
+// Register adds or replaces the provider for an account.
+func (r *Registry) Register(account string, provider CredentialsProvider) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.providers[account] = provider
+}
+
+// Get returns the provider for an account. An empty account selects the default.
+func (r *Registry) Get(account string) (CredentialsProvider, error) {
+	if account == "" {
+		account = r.defaultAccount
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	provider, ok := r.providers[account]
+	if !ok {
+		return nil, fmt.Errorf("unknown account %q", account)
+	}
+	return provider, nil
+}
+
+// DefaultAccount returns the account used when a request doesn't name one.
+func (r *Registry) DefaultAccount() string {
+	return r.defaultAccount
+}
+
+// Accounts returns the registered account names in sorted order.
+func (r *Registry) Accounts() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.providers))
+	for name := range r.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -8,6 +8,8 @@ type OAuthCredentials struct {
 	TokenType    string `json:"token_type"`
 	Scope        string `json:"scope,omitempty"`
 	IDToken      string `json:"id_token,omitempty"`
+	// Email is the account's email, resolved once at login so it needn't be looked up again
+	Email string `json:"email,omitempty"`
 }
 
 // TokenRefreshResponse represents the response from the token refresh endpoint
@@ -3,15 +3,61 @@
 package http
 
 import (
+	"fmt"
 	"net"
 	"net/http"
+	"net/url"
 	"time"
+
+	"github.com/dvcrn/antigravity-proxy/internal/env"
+	"github.com/dvcrn/antigravity-proxy/internal/logger"
 )
 
-// NewHTTPClient creates a new HTTP client for regular environments
+// NewHTTPClient creates a new HTTP client for regular environments.
+// Outbound requests honor HTTP_PROXY, HTTPS_PROXY and NO_PROXY.
 func NewHTTPClient() HTTPClient {
+	return newHTTPClient(http.ProxyFromEnvironment)
+}
+
+// NewUpstreamHTTPClient creates the HTTP client for CloudCode API calls. It is
+// NewHTTPClient, except CLOUDCODE_UPSTREAM_PROXY (http, https or socks5 URL) overrides
+// the environment proxy settings for these calls only.
+func NewUpstreamHTTPClient() HTTPClient {
+	raw, ok := env.Get("CLOUDCODE_UPSTREAM_PROXY")
+	if !ok {
+		return NewHTTPClient()
+	}
+
+	proxyURL, err := parseProxyURL(raw)
+	if err != nil {
+		logger.Get().Warn().Err(err).Msg("Ignoring CLOUDCODE_UPSTREAM_PROXY")
+		return NewHTTPClient()
+	}
+	logger.Get().Info().Str("proxy", proxyURL.Redacted()).Msg("Routing upstream requests through CLOUDCODE_UPSTREAM_PROXY")
+	return newHTTPClient(http.ProxyURL(proxyURL))
+}
+
+// parseProxyURL validates a proxy URL for http.Transport.
+func parseProxyURL(raw string) (*url.URL, error) {
+	proxyURL, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL: %w", err)
+	}
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q: use http, https or socks5", proxyURL.Scheme)
+	}
+	if proxyURL.Host == "" {
+		return nil, fmt.Errorf("proxy URL %q has no host", proxyURL.Redacted())
+	}
+	return proxyURL, nil
+}
+
+func newHTTPClient(proxy func(*http.Request) (*url.URL, error)) *http.Client {
 	return &http.Client{
 		Transport: &http.Transport{
+			Proxy: proxy,
 			DialContext: (&net.Dialer{
 				Timeout:   30 * time.Second,
 				KeepAlive: 30 * time.Second,
@@ -0,0 +1,45 @@
+//go:build !js || !wasm
+
+package http
+
+import (
+	"net/http"
+	"testing"
+)
+
+// http.ProxyFromEnvironment reads the environment once per process, so every case uses
+// the same HTTPS_PROXY.
+func TestNewUpstreamHTTPClientProxy(t *testing.T) {
+	testCases := []struct {
+		name          string
+		upstreamProxy string
+		expected      string
+	}{
+		{name: "environment proxy", expected: "http://corp-proxy:3128"},
+		{name: "upstream override", upstreamProxy: "socks5://127.0.0.1:1080", expected: "socks5://127.0.0.1:1080"},
+		{name: "invalid override falls back", upstreamProxy: "ftp://nope", expected: "http://corp-proxy:3128"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("CLOUDCODE_UPSTREAM_PROXY", tc.upstreamProxy)
+			t.Setenv("HTTPS_PROXY", "http://corp-proxy:3128")
+			t.Setenv("NO_PROXY", "")
+
+			transport := NewUpstreamHTTPClient().(*http.Client).Transport.(*http.Transport)
+			req, _ := http.NewRequest(http.MethodPost, "https://cloudcode-pa.googleapis.com/v1internal:generateContent", nil)
+			proxyURL, err := transport.Proxy(req)
+			if err != nil {
+				t.Fatalf("Proxy() error = %v", err)
+			}
+
+			got := ""
+			if proxyURL != nil {
+				got = proxyURL.String()
+			}
+			if got != tc.expected {
+				t.Errorf("proxy = %q, want %q", got, tc.expected)
+			}
+		})
+	}
+}
@@ -20,6 +20,12 @@ func NewHTTPClient() HTTPClient {
 	}
 }
 
+// NewUpstreamHTTPClient creates the HTTP client for CloudCode API calls. Outbound
+// proxies don't apply on Workers, so this is NewHTTPClient.
+func NewUpstreamHTTPClient() HTTPClient {
+	return NewHTTPClient()
+}
+
 // Do performs an HTTP request using Cloudflare Workers fetch
 func (c *WorkersHTTPClient) Do(req *http.Request) (*http.Response, error) {
 	// Create a new fetch request
@@ -36,5 +42,14 @@ func (c *WorkersHTTPClient) Do(req *http.Request) (*http.Response, error) {
 	}
 
 	// Perform the request
-	return c.client.Do(fetchReq, nil)
+	resp, err := c.client.Do(fetchReq, nil)
+	if err != nil {
+		return nil, err
+	}
+	// fetch decompresses bodies itself but keeps the Content-Encoding header
+	if resp.Header.Get("Content-Encoding") != "" {
+		resp.Header.Del("Content-Encoding")
+		resp.Uncompressed = true
+	}
+	return resp, nil
 }
@@ -40,7 +40,7 @@ func colorize(s interface{}, c int) string {
 	return fmt.Sprintf("\x1b[%dm%v\x1b[0m", c, s)
 }
 
-// new creates a logger based on the ENV environment variable
+// new creates a logger based on the ENV and LOG_FORMAT environment variables
 func newLogger() *zerolog.Logger {
 	env := os.Getenv("ENV")
 
@@ -56,12 +56,41 @@ func newLogger() *zerolog.Logger {
 
 	zerolog.SetGlobalLevel(logLevel)
 
-	if env == "development" || env == "dev" || env == "" {
+	if useConsole(env, os.Getenv("LOG_FORMAT")) {
 		return newDevelopment()
 	}
 	return newProduction()
 }
 
+// useConsole reports whether to log human-readable console output rather than JSON.
+// LOG_FORMAT (json or console) takes precedence; otherwise development environments get
+// the console.
+func useConsole(env, format string) bool {
+	switch strings.ToLower(format) {
+	case "console":
+		return true
+	case "json":
+		return false
+	case "":
+	default:
+		fmt.Fprintf(os.Stderr, "Invalid LOG_FORMAT \"%s\"; choosing the format from ENV\n", format)
+	}
+	return env == "development" || env == "dev" || env == ""
+}
+
+// SetLevel sets the minimum level logged (trace, debug, info, warn or error), overriding
+// LOG_LEVEL. Use it for command-line flags.
+func SetLevel(level string) error {
+	parsedLevel, err := zerolog.ParseLevel(strings.ToLower(level))
+	if err != nil {
+		return err
+	}
+	// Initialize first so LOG_LEVEL doesn't override this later
+	Get()
+	zerolog.SetGlobalLevel(parsedLevel)
+	return nil
+}
+
 // newDevelopment creates a development logger with console output and colors
 func newDevelopment() *zerolog.Logger {
 	output := zerolog.ConsoleWriter{
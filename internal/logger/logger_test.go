@@ -0,0 +1,46 @@
+package logger
+
+import (
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func TestUseConsole(t *testing.T) {
+	tests := []struct {
+		env    string
+		format string
+		want   bool
+	}{
+		{env: "", format: "", want: true},
+		{env: "development", format: "", want: true},
+		{env: "production", format: "", want: false},
+		{env: "production", format: "console", want: true},
+		{env: "", format: "JSON", want: false},
+		{env: "production", format: "pretty", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := useConsole(tt.env, tt.format); got != tt.want {
+			t.Errorf("useConsole(%q, %q) = %v, want %v", tt.env, tt.format, got, tt.want)
+		}
+	}
+}
+
+func TestSetLevel(t *testing.T) {
+	original := zerolog.GlobalLevel()
+	defer zerolog.SetGlobalLevel(original)
+
+	if err := SetLevel("DEBUG"); err != nil {
+		t.Fatalf("SetLevel returned error: %v", err)
+	}
+	if got := zerolog.GlobalLevel(); got != zerolog.DebugLevel {
+		t.Errorf("global level = %v, want debug", got)
+	}
+	if err := SetLevel("loud"); err == nil {
+		t.Error("expected an error for an invalid level")
+	}
+	if got := zerolog.GlobalLevel(); got != zerolog.DebugLevel {
+		t.Errorf("invalid level changed the global level to %v", got)
+	}
+}
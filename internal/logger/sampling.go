@@ -0,0 +1,76 @@
+package logger
+
+import (
+	"context"
+	"math/rand"
+	"strconv"
+	"sync"
+
+	"github.com/dvcrn/antigravity-proxy/internal/env"
+	"github.com/rs/zerolog"
+)
+
+var invalidSampleRateOnce sync.Once
+
+// sampledLoggerKey carries the logger WithRequestSampling chose for a request.
+type sampledLoggerKey struct{}
+
+// WithRequestSampling makes one LOG_SAMPLE_RATE decision for a request and stores it in
+// ctx, so Sampled(ctx) keeps or drops all of the request's info lines together instead
+// of leaving partial traces.
+func WithRequestSampling(ctx context.Context) context.Context {
+	l := Get()
+	if rate := sampleRate(); rate < 1 && !rateSampler(rate).Sample(zerolog.InfoLevel) {
+		dropped := Get().Sample(zerolog.LevelSampler{
+			TraceSampler: rateSampler(0),
+			DebugSampler: rateSampler(0),
+			InfoSampler:  rateSampler(0),
+		})
+		l = &dropped
+	}
+	return context.WithValue(ctx, sampledLoggerKey{}, l)
+}
+
+// Sampled returns the logger with info, debug and trace events kept at LOG_SAMPLE_RATE
+// (0 to 1, default 1 keeps everything). Warnings and errors always pass. Use it for
+// high-volume per-request info lines. Within a request (see WithRequestSampling) the
+// decision is the request's; elsewhere each event is sampled on its own.
+func Sampled(ctx context.Context) *zerolog.Logger {
+	if l, ok := ctx.Value(sampledLoggerKey{}).(*zerolog.Logger); ok {
+		return l
+	}
+	rate := sampleRate()
+	if rate >= 1 {
+		return Get()
+	}
+	sampler := rateSampler(rate)
+	l := Get().Sample(zerolog.LevelSampler{
+		TraceSampler: sampler,
+		DebugSampler: sampler,
+		InfoSampler:  sampler,
+	})
+	return &l
+}
+
+// sampleRate parses LOG_SAMPLE_RATE, falling back to 1 when unset or invalid.
+func sampleRate() float64 {
+	value, ok := env.Get("LOG_SAMPLE_RATE")
+	if !ok {
+		return 1
+	}
+	rate, err := strconv.ParseFloat(value, 64)
+	if err != nil || rate < 0 || rate > 1 {
+		invalidSampleRateOnce.Do(func() {
+			Get().Warn().Str("value", value).Msg("Invalid LOG_SAMPLE_RATE, logging every event")
+		})
+		return 1
+	}
+	return rate
+}
+
+// rateSampler keeps each event with probability equal to its value.
+type rateSampler float64
+
+func (r rateSampler) Sample(zerolog.Level) bool {
+	return rand.Float64() < float64(r)
+}
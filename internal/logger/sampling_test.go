@@ -0,0 +1,92 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func TestSampled(t *testing.T) {
+	var buf bytes.Buffer
+	original := *Get()
+	*Get() = zerolog.New(&buf)
+	defer func() { *Get() = original }()
+
+	t.Setenv("LOG_SAMPLE_RATE", "0.01")
+	for i := 0; i < 1000; i++ {
+		Sampled(context.Background()).Info().Msg("sampled info")
+	}
+	for i := 0; i < 50; i++ {
+		Sampled(context.Background()).Error().Msg("sampled error")
+	}
+
+	if infos := strings.Count(buf.String(), "sampled info"); infos > 100 {
+		t.Errorf("expected most info logs to be dropped, got %d of 1000", infos)
+	}
+	if errs := strings.Count(buf.String(), "sampled error"); errs != 50 {
+		t.Errorf("expected every error to be logged, got %d of 50", errs)
+	}
+}
+
+func TestSampledDefaultKeepsEverything(t *testing.T) {
+	var buf bytes.Buffer
+	original := *Get()
+	*Get() = zerolog.New(&buf)
+	defer func() { *Get() = original }()
+
+	t.Setenv("LOG_SAMPLE_RATE", "")
+	for i := 0; i < 100; i++ {
+		Sampled(context.Background()).Info().Msg("kept")
+	}
+	if infos := strings.Count(buf.String(), "kept"); infos != 100 {
+		t.Errorf("expected all 100 info logs, got %d", infos)
+	}
+}
+
+func TestWithRequestSamplingKeepsRequestsWhole(t *testing.T) {
+	var buf bytes.Buffer
+	original := *Get()
+	*Get() = zerolog.New(&buf)
+	defer func() { *Get() = original }()
+
+	t.Setenv("LOG_SAMPLE_RATE", "0.5")
+	const requests, linesPerRequest = 200, 5
+	for i := 0; i < requests; i++ {
+		ctx := WithRequestSampling(context.Background())
+		for j := 0; j < linesPerRequest; j++ {
+			Sampled(ctx).Info().Str("request", fmt.Sprintf("r%03d", i)).Msg("request line")
+		}
+		Sampled(ctx).Warn().Str("request", fmt.Sprintf("r%03d", i)).Msg("request warning")
+	}
+
+	kept := 0
+	for i := 0; i < requests; i++ {
+		id := fmt.Sprintf(`"request":"r%03d"`, i)
+		var infos, warns int
+		for _, line := range strings.Split(buf.String(), "\n") {
+			if strings.Contains(line, id) {
+				if strings.Contains(line, "request warning") {
+					warns++
+				} else {
+					infos++
+				}
+			}
+		}
+		if infos != 0 && infos != linesPerRequest {
+			t.Errorf("request %d kept %d of %d info lines, want all or none", i, infos, linesPerRequest)
+		}
+		if warns != 1 {
+			t.Errorf("request %d logged %d warnings, want 1", i, warns)
+		}
+		if infos > 0 {
+			kept++
+		}
+	}
+	if kept == 0 || kept == requests {
+		t.Errorf("expected some requests kept and some dropped at rate 0.5, kept %d of %d", kept, requests)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"time"
+	"unicode/utf8"
 
 	"github.com/dvcrn/antigravity-proxy/internal/logger"
 	"github.com/google/uuid"
@@ -23,14 +24,21 @@ type ReasoningData struct {
 
 // GeminiFunctionCall represents a function call from Gemini
 type GeminiFunctionCall struct {
-	Name string                 `json:"name"`
-	Args map[string]interface{} `json:"args"`
+	Name             string                 `json:"name"`
+	Args             map[string]interface{} `json:"args"`
+	ThoughtSignature string                 `json:"thoughtSignature,omitempty"`
+	// Incomplete marks a call whose arguments were cut off (e.g. truncated argsJson);
+	// it is reported as an error instead of being forwarded with broken arguments.
+	Incomplete bool `json:"incomplete,omitempty"`
 }
 
 // UsageData contains token usage information
 type UsageData struct {
 	InputTokens  int `json:"inputTokens"`
 	OutputTokens int `json:"outputTokens"`
+	// CachedTokens and ReasoningTokens are nil when upstream didn't report them
+	CachedTokens    *int `json:"cachedTokens,omitempty"`
+	ReasoningTokens *int `json:"reasoningTokens,omitempty"`
 }
 
 // NativeToolResponse represents a native tool response
@@ -39,17 +47,41 @@ type NativeToolResponse struct {
 	Data interface{} `json:"data"`
 }
 
-// OpenAIToolCall represents a tool call in OpenAI format
+// OpenAIToolCall represents a tool call in OpenAI format. In streamed deltas only the
+// first delta of a call carries ID, Type and Function.Name; later ones just add
+// argument fragments for the same Index.
 type OpenAIToolCall struct {
-	Index    int                `json:"index"`
-	ID       string             `json:"id"`
-	Type     string             `json:"type"`
-	Function OpenAIFunctionCall `json:"function"`
+	Index        int                `json:"index"`
+	ID           string             `json:"id,omitempty"`
+	Type         string             `json:"type,omitempty"`
+	Function     OpenAIFunctionCall `json:"function"`
+	ExtraContent *ExtraContent      `json:"extra_content,omitempty"`
+}
+
+// ExtraContent carries provider-specific tool call data, matching the shape used by
+// Google's OpenAI-compatible API. Clients echo it back on the assistant message.
+type ExtraContent struct {
+	Google *GoogleExtraContent `json:"google,omitempty"`
+}
+
+// GoogleExtraContent holds Gemini-specific tool call metadata.
+type GoogleExtraContent struct {
+	// ThoughtSignature is the opaque signature Gemini attaches to a functionCall part.
+	// Thinking models require it on the replayed call in follow-up turns.
+	ThoughtSignature string `json:"thought_signature,omitempty"`
+}
+
+// ThoughtSignature returns the Gemini thought signature attached to the tool call, if any.
+func (tc OpenAIToolCall) ThoughtSignature() string {
+	if tc.ExtraContent == nil || tc.ExtraContent.Google == nil {
+		return ""
+	}
+	return tc.ExtraContent.Google.ThoughtSignature
 }
 
 // OpenAIFunctionCall represents the function part of a tool call
 type OpenAIFunctionCall struct {
-	Name      string `json:"name"`
+	Name      string `json:"name,omitempty"`
 	Arguments string `json:"arguments"`
 }
 
@@ -85,9 +117,11 @@ type OpenAIChunk struct {
 
 // OpenAIUsage represents token usage in the final chunk
 type OpenAIUsage struct {
-	PromptTokens     int `json:"prompt_tokens"`
-	CompletionTokens int `json:"completion_tokens"`
-	TotalTokens      int `json:"total_tokens"`
+	PromptTokens            int                      `json:"prompt_tokens"`
+	CompletionTokens        int                      `json:"completion_tokens"`
+	TotalTokens             int                      `json:"total_tokens"`
+	PromptTokensDetails     *PromptTokensDetails     `json:"prompt_tokens_details,omitempty"`
+	CompletionTokensDetails *CompletionTokensDetails `json:"completion_tokens_details,omitempty"`
 }
 
 // OpenAIFinalChoice represents a choice in the final chunk
@@ -107,14 +141,45 @@ type OpenAIFinalChunk struct {
 	Usage   *OpenAIUsage        `json:"usage,omitempty"`
 }
 
+// OpenAIUsageChunk is the terminal chunk sent when stream_options.include_usage is set.
+// Choices is always an empty array, per the OpenAI streaming spec.
+type OpenAIUsageChunk struct {
+	ID      string              `json:"id"`
+	Object  string              `json:"object"`
+	Created int64               `json:"created"`
+	Model   string              `json:"model"`
+	Choices []OpenAIFinalChoice `json:"choices"`
+	Usage   OpenAIUsage         `json:"usage"`
+}
+
 const (
 	OpenAIChatCompletionChunkObject = "chat.completion.chunk"
 )
 
+// toolCallArgumentsFragmentSize is the maximum size of one streamed tool call
+// arguments fragment.
+const toolCallArgumentsFragmentSize = 256
+
+// StreamTransformerOptions configures optional behavior of the OpenAI stream transformer.
+type StreamTransformerOptions struct {
+	// DisableContentLogging suppresses per-chunk logs that contain message content.
+	DisableContentLogging bool
+
+	// IncludeUsage emits an extra chunk with empty choices and the final token usage
+	// before [DONE], matching OpenAI's stream_options.include_usage behavior.
+	IncludeUsage bool
+}
+
 // CreateOpenAIStreamTransformer creates a transformer that converts Gemini StreamChunks
 // into OpenAI-compatible SSE formatted strings.
 // It returns a function that accepts an input channel and returns an output channel.
 func CreateOpenAIStreamTransformer(model string) func(<-chan StreamChunk) <-chan string {
+	return CreateOpenAIStreamTransformerWithOptions(model, StreamTransformerOptions{})
+}
+
+// CreateOpenAIStreamTransformerWithOptions is like CreateOpenAIStreamTransformer but
+// allows callers to customize transformer behavior.
+func CreateOpenAIStreamTransformerWithOptions(model string, opts StreamTransformerOptions) func(<-chan StreamChunk) <-chan string {
 	return func(input <-chan StreamChunk) <-chan string {
 		output := make(chan string, 10)
 
@@ -124,12 +189,41 @@ func CreateOpenAIStreamTransformer(model string) func(<-chan StreamChunk) <-chan
 			chatID := fmt.Sprintf("chatcmpl-%s", uuid.New().String())
 			creationTime := time.Now().Unix()
 			firstChunk := true
-			var toolCallID *string
+			toolCalls := 0
 			var usageData *UsageData
 
+			send := func(delta OpenAIDelta) {
+				openAIChunk := OpenAIChunk{
+					ID:      chatID,
+					Object:  OpenAIChatCompletionChunkObject,
+					Created: creationTime,
+					Model:   model,
+					Choices: []OpenAIChoice{
+						{
+							Index:        0,
+							Delta:        delta,
+							FinishReason: nil,
+							Logprobs:     nil,
+							MatchedStop:  nil,
+						},
+					},
+					Usage: nil,
+				}
+
+				if jsonBytes, err := json.Marshal(openAIChunk); err == nil {
+					sse := fmt.Sprintf("data: %s\n\n", string(jsonBytes))
+					if !opts.DisableContentLogging {
+						logger.Get().Info().Str("sse", sse).Msg("Sending OpenAI SSE chunk")
+					}
+					output <- sse
+				}
+			}
+
 			// Process each chunk
 			for chunk := range input {
-				logger.Get().Info().Interface("chunk", chunk).Msg("Processing Gemini stream chunk")
+				if !opts.DisableContentLogging {
+					logger.Get().Info().Interface("chunk", chunk).Msg("Processing Gemini stream chunk")
+				}
 
 				delta := OpenAIDelta{}
 				shouldSend := false
@@ -159,22 +253,28 @@ func CreateOpenAIStreamTransformer(model string) func(<-chan StreamChunk) <-chan
 					}
 
 				case "tool_code":
-					if funcCall, ok := toGeminiFunctionCall(chunk.Data); ok {
-						callID := fmt.Sprintf("call_%s", uuid.New().String())
-						toolCallID = &callID
-
-						argsJSON, _ := json.Marshal(funcCall.Args)
-						delta.ToolCalls = []OpenAIToolCall{
-							{
-								Index: 0,
-								ID:    callID,
-								Type:  "function",
-								Function: OpenAIFunctionCall{
-									Name:      funcCall.Name,
-									Arguments: string(argsJSON),
-								},
-							},
+					if funcCall, ok := toGeminiFunctionCall(chunk.Data); ok && funcCall.Incomplete {
+						// Never forward a call whose arguments were cut off; flag it instead
+						logger.Get().Warn().Str("function", funcCall.Name).Msg("Dropping incomplete tool call from stream")
+						output <- incompleteToolCallEvent(funcCall.Name)
+					} else if ok {
+						// Each call gets the next index; the header delta names it and
+						// the arguments follow as fragments under the same index
+						index := toolCalls
+						toolCalls++
+
+						toolCall := OpenAIToolCall{
+							Index:    index,
+							ID:       fmt.Sprintf("call_%s", uuid.New().String()),
+							Type:     "function",
+							Function: OpenAIFunctionCall{Name: funcCall.Name},
 						}
+						if funcCall.ThoughtSignature != "" {
+							toolCall.ExtraContent = &ExtraContent{
+								Google: &GoogleExtraContent{ThoughtSignature: funcCall.ThoughtSignature},
+							}
+						}
+						delta.ToolCalls = []OpenAIToolCall{toolCall}
 
 						if firstChunk {
 							role := "assistant"
@@ -183,7 +283,15 @@ func CreateOpenAIStreamTransformer(model string) func(<-chan StreamChunk) <-chan
 							delta.Content = &nullContent
 							firstChunk = false
 						}
-						shouldSend = true
+						send(delta)
+
+						argsJSON, _ := json.Marshal(funcCall.Args)
+						for _, fragment := range splitArguments(string(argsJSON), toolCallArgumentsFragmentSize) {
+							send(OpenAIDelta{ToolCalls: []OpenAIToolCall{{
+								Index:    index,
+								Function: OpenAIFunctionCall{Arguments: fragment},
+							}}})
+						}
 					}
 
 				case "native_tool":
@@ -207,34 +315,13 @@ func CreateOpenAIStreamTransformer(model string) func(<-chan StreamChunk) <-chan
 				}
 
 				if shouldSend {
-					openAIChunk := OpenAIChunk{
-						ID:      chatID,
-						Object:  OpenAIChatCompletionChunkObject,
-						Created: creationTime,
-						Model:   model,
-						Choices: []OpenAIChoice{
-							{
-								Index:        0,
-								Delta:        delta,
-								FinishReason: nil,
-								Logprobs:     nil,
-								MatchedStop:  nil,
-							},
-						},
-						Usage: nil,
-					}
-
-					if jsonBytes, err := json.Marshal(openAIChunk); err == nil {
-						sse := fmt.Sprintf("data: %s\n\n", string(jsonBytes))
-						logger.Get().Info().Str("sse", sse).Msg("Sending OpenAI SSE chunk")
-						output <- sse
-					}
+					send(delta)
 				}
 			}
 
 			// Send final chunk
 			finishReason := "stop"
-			if toolCallID != nil {
+			if toolCalls > 0 {
 				finishReason = "tool_calls"
 			}
 
@@ -252,18 +339,46 @@ func CreateOpenAIStreamTransformer(model string) func(<-chan StreamChunk) <-chan
 				},
 			}
 
+			var usage *OpenAIUsage
 			if usageData != nil {
-				finalChunk.Usage = &OpenAIUsage{
+				usage = &OpenAIUsage{
 					PromptTokens:     usageData.InputTokens,
 					CompletionTokens: usageData.OutputTokens,
 					TotalTokens:      usageData.InputTokens + usageData.OutputTokens,
 				}
+				if usageData.CachedTokens != nil {
+					usage.PromptTokensDetails = &PromptTokensDetails{CachedTokens: *usageData.CachedTokens}
+				}
+				if usageData.ReasoningTokens != nil {
+					usage.CompletionTokensDetails = &CompletionTokensDetails{ReasoningTokens: *usageData.ReasoningTokens}
+				}
+			}
+			// With include_usage, usage goes only on the terminal usage chunk, as OpenAI
+			// does, so clients summing usage across chunks don't count it twice
+			if !opts.IncludeUsage {
+				finalChunk.Usage = usage
 			}
 
 			if jsonBytes, err := json.Marshal(finalChunk); err == nil {
 				output <- fmt.Sprintf("data: %s\n\n", string(jsonBytes))
 			}
 
+			if opts.IncludeUsage {
+				usageChunk := OpenAIUsageChunk{
+					ID:      chatID,
+					Object:  OpenAIChatCompletionChunkObject,
+					Created: creationTime,
+					Model:   model,
+					Choices: []OpenAIFinalChoice{},
+				}
+				if usage != nil {
+					usageChunk.Usage = *usage
+				}
+				if jsonBytes, err := json.Marshal(usageChunk); err == nil {
+					output <- fmt.Sprintf("data: %s\n\n", string(jsonBytes))
+				}
+			}
+
 			output <- "data: [DONE]\n\n"
 		}()
 
@@ -271,6 +386,39 @@ func CreateOpenAIStreamTransformer(model string) func(<-chan StreamChunk) <-chan
 	}
 }
 
+// incompleteToolCallEvent is the error event sent in place of a tool call whose
+// arguments were interrupted upstream.
+func incompleteToolCallEvent(name string) string {
+	event := map[string]interface{}{
+		"type": "error",
+		"error": map[string]interface{}{
+			"type":    "api_error",
+			"message": fmt.Sprintf("tool call %q was interrupted before its arguments were complete", name),
+			"code":    "INCOMPLETE_TOOL_CALL",
+		},
+	}
+	data, _ := json.Marshal(event)
+	return fmt.Sprintf("data: %s\n\n", data)
+}
+
+// splitArguments splits tool call arguments into fragments of at most size bytes,
+// without breaking UTF-8 sequences.
+func splitArguments(args string, size int) []string {
+	var fragments []string
+	for len(args) > size {
+		cut := size
+		for cut > 0 && !utf8.RuneStart(args[cut]) {
+			cut--
+		}
+		if cut == 0 {
+			cut = size
+		}
+		fragments = append(fragments, args[:cut])
+		args = args[cut:]
+	}
+	return append(fragments, args)
+}
+
 // Type conversion helpers
 
 func toReasoningData(data interface{}) (ReasoningData, bool) {
@@ -317,7 +465,13 @@ func toGeminiFunctionCall(data interface{}) (GeminiFunctionCall, bool) {
 		if args, ok := m["args"].(map[string]interface{}); ok {
 			fc.Args = args
 		}
-		return fc, fc.Name != "" && fc.Args != nil
+		if sig, ok := m["thoughtSignature"].(string); ok {
+			fc.ThoughtSignature = sig
+		}
+		if incomplete, ok := m["incomplete"].(bool); ok {
+			fc.Incomplete = incomplete
+		}
+		return fc, fc.Name != "" && (fc.Args != nil || fc.Incomplete)
 	}
 
 	return GeminiFunctionCall{}, false
@@ -346,12 +500,26 @@ func toUsageData(data interface{}) (UsageData, bool) {
 		} else if outputTokens, ok := m["outputTokens"].(float64); ok {
 			ud.OutputTokens = int(outputTokens)
 		}
+		ud.CachedTokens = optionalTokenCount(m["cachedTokens"])
+		ud.ReasoningTokens = optionalTokenCount(m["reasoningTokens"])
 		return ud, true
 	}
 
 	return UsageData{}, false
 }
 
+// optionalTokenCount reads an optional int or float64 token count.
+func optionalTokenCount(v interface{}) *int {
+	switch n := v.(type) {
+	case int:
+		return &n
+	case float64:
+		i := int(n)
+		return &i
+	}
+	return nil
+}
+
 func toNativeToolResponse(data interface{}) (NativeToolResponse, bool) {
 	if data == nil {
 		return NativeToolResponse{}, false
@@ -1,9 +1,14 @@
 package openai
 
 import (
+	"bytes"
 	"encoding/json"
 	"strings"
 	"testing"
+	"unicode/utf8"
+
+	"github.com/dvcrn/antigravity-proxy/internal/logger"
+	"github.com/rs/zerolog"
 )
 
 func TestCreateOpenAIStreamTransformer_BasicText(t *testing.T) {
@@ -201,7 +206,8 @@ func TestCreateOpenAIStreamTransformer_ToolCall(t *testing.T) {
 			continue
 		}
 
-		if len(parsed.Choices) > 0 && len(parsed.Choices[0].Delta.ToolCalls) > 0 {
+		// Only the header delta names the call; argument fragments follow it
+		if len(parsed.Choices) > 0 && len(parsed.Choices[0].Delta.ToolCalls) > 0 && parsed.Choices[0].Delta.ToolCalls[0].ID != "" {
 			foundToolCall = true
 
 			if len(parsed.Choices[0].Delta.ToolCalls) != 1 {
@@ -694,3 +700,154 @@ func TestTypeConversionHelpers(t *testing.T) {
 		}
 	})
 }
+
+func TestCreateOpenAIStreamTransformer_StoreFalseExcludedFromContentLogs(t *testing.T) {
+	var req ChatCompletionRequest
+	if err := json.Unmarshal([]byte(`{"model":"gemini-2.5-pro","store":false,"messages":[]}`), &req); err != nil {
+		t.Fatalf("failed to parse request: %v", err)
+	}
+	if req.RetentionAllowed() {
+		t.Fatal("expected store=false to disallow retention")
+	}
+
+	run := func(opts StreamTransformerOptions) string {
+		var buf bytes.Buffer
+		original := *logger.Get()
+		*logger.Get() = zerolog.New(&buf)
+		defer func() { *logger.Get() = original }()
+
+		input := make(chan StreamChunk, 1)
+		input <- StreamChunk{Type: "text", Data: "top secret transcript"}
+		close(input)
+
+		for range CreateOpenAIStreamTransformerWithOptions("gemini-2.5-pro", opts)(input) {
+		}
+		return buf.String()
+	}
+
+	if logs := run(StreamTransformerOptions{DisableContentLogging: !req.RetentionAllowed()}); strings.Contains(logs, "top secret transcript") {
+		t.Errorf("expected store=false content to be excluded from logs, got: %s", logs)
+	}
+	if logs := run(StreamTransformerOptions{}); !strings.Contains(logs, "top secret transcript") {
+		t.Errorf("expected content to be logged by default, got: %s", logs)
+	}
+}
+
+func TestCreateOpenAIStreamTransformer_ToolCallThoughtSignature(t *testing.T) {
+	transformer := CreateOpenAIStreamTransformer("gemini-3-pro")
+
+	input := make(chan StreamChunk, 1)
+	input <- StreamChunk{
+		Type: "tool_code",
+		Data: map[string]interface{}{
+			"name":             "get_weather",
+			"args":             map[string]interface{}{"location": "Tokyo"},
+			"thoughtSignature": "sig-abc",
+		},
+	}
+	close(input)
+
+	var found bool
+	for chunk := range transformer(input) {
+		if !strings.Contains(chunk, "get_weather") {
+			continue
+		}
+		var parsed OpenAIChunk
+		if err := json.Unmarshal([]byte(strings.TrimSpace(strings.TrimPrefix(chunk, "data: "))), &parsed); err != nil {
+			t.Fatalf("failed to parse chunk: %v", err)
+		}
+		toolCall := parsed.Choices[0].Delta.ToolCalls[0]
+		if toolCall.ThoughtSignature() != "sig-abc" {
+			t.Errorf("expected thought signature 'sig-abc', got %q", toolCall.ThoughtSignature())
+		}
+		if !strings.Contains(chunk, `"extra_content":{"google":{"thought_signature":"sig-abc"}}`) {
+			t.Errorf("expected extra_content.google.thought_signature in chunk, got %s", chunk)
+		}
+		found = true
+	}
+
+	if !found {
+		t.Error("tool call chunk not found")
+	}
+}
+
+func TestCreateOpenAIStreamTransformer_ToolCallDeltas(t *testing.T) {
+	longArg := strings.Repeat("ü", toolCallArgumentsFragmentSize)
+	input := make(chan StreamChunk, 2)
+	input <- StreamChunk{Type: "tool_code", Data: map[string]interface{}{"name": "read_file", "args": map[string]interface{}{"path": "a.go"}}}
+	input <- StreamChunk{Type: "tool_code", Data: map[string]interface{}{"name": "write_file", "args": map[string]interface{}{"content": longArg}}}
+	close(input)
+
+	type call struct {
+		id        string
+		name      string
+		arguments string
+		fragments int
+	}
+	calls := map[int]*call{}
+	for chunk := range CreateOpenAIStreamTransformerWithOptions("gemini-3-pro", StreamTransformerOptions{DisableContentLogging: true})(input) {
+		var parsed OpenAIChunk
+		if err := json.Unmarshal([]byte(strings.TrimSpace(strings.TrimPrefix(chunk, "data: "))), &parsed); err != nil || len(parsed.Choices) == 0 {
+			continue
+		}
+		for _, tc := range parsed.Choices[0].Delta.ToolCalls {
+			c, ok := calls[tc.Index]
+			if !ok {
+				if tc.ID == "" || tc.Function.Name == "" {
+					t.Fatalf("expected the first delta for index %d to carry id and name, got %+v", tc.Index, tc)
+				}
+				c = &call{id: tc.ID, name: tc.Function.Name}
+				calls[tc.Index] = c
+			} else if tc.ID != "" || tc.Function.Name != "" {
+				t.Errorf("expected later deltas for index %d to only carry arguments, got %+v", tc.Index, tc)
+			}
+			if tc.Function.Arguments != "" {
+				if !utf8.ValidString(tc.Function.Arguments) {
+					t.Errorf("fragment splits a UTF-8 sequence: %q", tc.Function.Arguments)
+				}
+				c.arguments += tc.Function.Arguments
+				c.fragments++
+			}
+		}
+	}
+
+	if len(calls) != 2 || calls[0] == nil || calls[1] == nil {
+		t.Fatalf("expected tool calls at indexes 0 and 1, got %v", calls)
+	}
+	if calls[0].name != "read_file" || calls[0].arguments != `{"path":"a.go"}` {
+		t.Errorf("unexpected first call: %+v", calls[0])
+	}
+	wantArgs, _ := json.Marshal(map[string]interface{}{"content": longArg})
+	if calls[1].name != "write_file" || calls[1].arguments != string(wantArgs) {
+		t.Errorf("unexpected second call: name %q, arguments %q", calls[1].name, calls[1].arguments)
+	}
+	if calls[1].fragments < 2 {
+		t.Errorf("expected long arguments to stream in several fragments, got %d", calls[1].fragments)
+	}
+	if calls[0].id == calls[1].id {
+		t.Errorf("expected distinct tool call ids, got %q twice", calls[0].id)
+	}
+}
+
+func TestCreateOpenAIStreamTransformer_IncompleteToolCall(t *testing.T) {
+	input := make(chan StreamChunk, 2)
+	input <- StreamChunk{Type: "tool_code", Data: map[string]interface{}{"name": "read_file", "incomplete": true}}
+	close(input)
+
+	var messages []string
+	for message := range CreateOpenAIStreamTransformerWithOptions("gemini-3-pro", StreamTransformerOptions{DisableContentLogging: true})(input) {
+		messages = append(messages, message)
+	}
+
+	if len(messages) == 0 || !strings.Contains(messages[0], `"code":"INCOMPLETE_TOOL_CALL"`) || !strings.Contains(messages[0], "read_file") {
+		t.Fatalf("expected an incomplete tool call error first, got %v", messages)
+	}
+	for _, message := range messages {
+		if strings.Contains(message, "tool_calls") && !strings.Contains(message, `"finish_reason"`) {
+			t.Errorf("incomplete tool call must not be forwarded, got %q", message)
+		}
+	}
+	if last := messages[len(messages)-2]; !strings.Contains(last, `"finish_reason":"stop"`) {
+		t.Errorf("expected finish_reason stop without completed tool calls, got %q", last)
+	}
+}
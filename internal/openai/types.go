@@ -1,13 +1,110 @@
 package openai
 
+import "encoding/json"
+
 // ChatCompletionRequest represents a request payload for OpenAI-compatible chat completion endpoints.
 type ChatCompletionRequest struct {
-	MaxTokens   int       `json:"max_tokens"`
-	Messages    []Message `json:"messages"`
-	Model       string    `json:"model"`
-	Stream      bool      `json:"stream"`
-	Temperature float64   `json:"temperature"`
-	Tools       []Tool    `json:"tools,omitempty"`
+	FrequencyPenalty float64 `json:"frequency_penalty,omitempty"`
+	MaxTokens        int     `json:"max_tokens"`
+	// MaxCompletionTokens replaces max_tokens in newer OpenAI SDKs; max_tokens wins if both are set
+	MaxCompletionTokens int            `json:"max_completion_tokens,omitempty"`
+	Messages            []Message      `json:"messages"`
+	Model               string         `json:"model"`
+	N                   int            `json:"n,omitempty"`
+	PresencePenalty     float64        `json:"presence_penalty,omitempty"`
+	Seed                *int           `json:"seed,omitempty"`
+	Stop                StopField      `json:"stop,omitempty"`
+	Store               *bool          `json:"store,omitempty"`
+	Stream              bool           `json:"stream"`
+	StreamOptions       *StreamOptions `json:"stream_options,omitempty"`
+	Temperature         float64        `json:"temperature"`
+	Tools               []Tool         `json:"tools,omitempty"`
+	// TopK is not part of the OpenAI API but is accepted by many compatible servers
+	TopK int     `json:"top_k,omitempty"`
+	TopP float64 `json:"top_p,omitempty"`
+	// ToolChoice is "none", "auto", "required" or {"type":"function","function":{"name":...}}
+	ToolChoice json.RawMessage `json:"tool_choice,omitempty"`
+	// User identifies the end user; it is sent upstream as the session id
+	User string `json:"user,omitempty"`
+
+	// Standard OpenAI fields with no Gemini equivalent. They are decoded only so that
+	// STRICT_REQUEST_DECODING does not reject requests from the official SDKs.
+	Audio             json.RawMessage `json:"audio,omitempty"`
+	FunctionCall      json.RawMessage `json:"function_call,omitempty"`
+	Functions         json.RawMessage `json:"functions,omitempty"`
+	LogitBias         json.RawMessage `json:"logit_bias,omitempty"`
+	Logprobs          json.RawMessage `json:"logprobs,omitempty"`
+	Metadata          json.RawMessage `json:"metadata,omitempty"`
+	Modalities        json.RawMessage `json:"modalities,omitempty"`
+	ParallelToolCalls json.RawMessage `json:"parallel_tool_calls,omitempty"`
+	Prediction        json.RawMessage `json:"prediction,omitempty"`
+	PromptCacheKey    json.RawMessage `json:"prompt_cache_key,omitempty"`
+	ReasoningEffort   json.RawMessage `json:"reasoning_effort,omitempty"`
+	ResponseFormat    json.RawMessage `json:"response_format,omitempty"`
+	SafetyIdentifier  json.RawMessage `json:"safety_identifier,omitempty"`
+	ServiceTier       json.RawMessage `json:"service_tier,omitempty"`
+	TopLogprobs       json.RawMessage `json:"top_logprobs,omitempty"`
+	Verbosity         json.RawMessage `json:"verbosity,omitempty"`
+	WebSearchOptions  json.RawMessage `json:"web_search_options,omitempty"`
+}
+
+// StreamOptions holds options for streaming responses.
+type StreamOptions struct {
+	// IncludeUsage requests a final chunk with empty choices carrying token usage.
+	IncludeUsage bool `json:"include_usage"`
+}
+
+// IncludeUsage reports whether the client asked for a terminal usage chunk.
+func (r *ChatCompletionRequest) IncludeUsage() bool {
+	return r.StreamOptions != nil && r.StreamOptions.IncludeUsage
+}
+
+// ForcedToolName returns the function named by an object-form tool_choice, or "".
+func (r *ChatCompletionRequest) ForcedToolName() string {
+	var choice struct {
+		Function struct {
+			Name string `json:"name"`
+		} `json:"function"`
+	}
+	if len(r.ToolChoice) == 0 || json.Unmarshal(r.ToolChoice, &choice) != nil {
+		return ""
+	}
+	return choice.Function.Name
+}
+
+// RetentionAllowed reports whether the client permits the proxy to retain request content.
+// Clients opt out by sending "store": false; when the field is omitted retention is allowed.
+func (r *ChatCompletionRequest) RetentionAllowed() bool {
+	return r.Store == nil || *r.Store
+}
+
+// StopField holds the OpenAI "stop" parameter, which may be sent either as a
+// single string or as an array of strings. It is always normalized to a slice.
+type StopField []string
+
+// UnmarshalJSON accepts both the string and array shapes of "stop".
+func (s *StopField) UnmarshalJSON(b []byte) error {
+	if string(b) == "null" {
+		*s = nil
+		return nil
+	}
+
+	var single string
+	if err := json.Unmarshal(b, &single); err == nil {
+		if single == "" {
+			*s = nil
+		} else {
+			*s = StopField{single}
+		}
+		return nil
+	}
+
+	var arr []string
+	if err := json.Unmarshal(b, &arr); err != nil {
+		return err
+	}
+	*s = StopField(arr)
+	return nil
 }
 
 // Message represents a message in the chat history, including tool calls/results.
@@ -26,12 +123,23 @@ type Message struct {
 
 	// Optional function name on tool messages (some clients include this)
 	Name string `json:"name,omitempty"`
+
+	// Refusal and Audio are echoed back on assistant messages by the OpenAI SDKs; they
+	// are accepted for STRICT_REQUEST_DECODING and otherwise ignored
+	Refusal json.RawMessage `json:"refusal,omitempty"`
+	Audio   json.RawMessage `json:"audio,omitempty"`
 }
 
 // ContentPart represents a part of a multi-modal message.
 type ContentPart struct {
-	Type string `json:"type"`
-	Text string `json:"text,omitempty"`
+	Type     string    `json:"type"`
+	Text     string    `json:"text,omitempty"`
+	ImageURL *ImageURL `json:"image_url,omitempty"`
+}
+
+// ImageURL is the image of an "image_url" content part, e.g. a base64 data URL.
+type ImageURL struct {
+	URL string `json:"url"`
 }
 
 // Tool represents a tool the model can call.
@@ -45,6 +153,8 @@ type Function struct {
 	Description string      `json:"description,omitempty"`
 	Name        string      `json:"name"`
 	Parameters  interface{} `json:"parameters"`
+	// Strict (OpenAI structured outputs) has no Gemini equivalent and is ignored
+	Strict *bool `json:"strict,omitempty"`
 }
 
 // ChatCompletionResponse represents a response payload for OpenAI-compatible chat completion endpoints.
@@ -67,7 +177,35 @@ type Choice struct {
 
 // Usage represents the token usage for a request.
 type Usage struct {
-	PromptTokens     int `json:"prompt_tokens"`
-	CompletionTokens int `json:"completion_tokens"`
-	TotalTokens      int `json:"total_tokens"`
+	PromptTokens            int                      `json:"prompt_tokens"`
+	CompletionTokens        int                      `json:"completion_tokens"`
+	TotalTokens             int                      `json:"total_tokens"`
+	PromptTokensDetails     *PromptTokensDetails     `json:"prompt_tokens_details,omitempty"`
+	CompletionTokensDetails *CompletionTokensDetails `json:"completion_tokens_details,omitempty"`
+}
+
+// PromptTokensDetails breaks down prompt tokens; CachedTokens maps Gemini's
+// cachedContentTokenCount.
+type PromptTokensDetails struct {
+	CachedTokens int `json:"cached_tokens"`
+}
+
+// CompletionTokensDetails breaks down completion tokens; ReasoningTokens maps Gemini's
+// thoughtsTokenCount.
+type CompletionTokensDetails struct {
+	ReasoningTokens int `json:"reasoning_tokens"`
+}
+
+// TokenDetailsFromUsageMetadata extracts the detailed usage sub-objects from a Gemini
+// usageMetadata object. Each is nil when Gemini didn't report the count.
+func TokenDetailsFromUsageMetadata(usageMetadata map[string]interface{}) (*PromptTokensDetails, *CompletionTokensDetails) {
+	var prompt *PromptTokensDetails
+	var completion *CompletionTokensDetails
+	if v, ok := usageMetadata["cachedContentTokenCount"].(float64); ok {
+		prompt = &PromptTokensDetails{CachedTokens: int(v)}
+	}
+	if v, ok := usageMetadata["thoughtsTokenCount"].(float64); ok {
+		completion = &CompletionTokensDetails{ReasoningTokens: int(v)}
+	}
+	return prompt, completion
 }
@@ -0,0 +1,140 @@
+package project
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dvcrn/antigravity-proxy/internal/antigravity"
+	"github.com/dvcrn/antigravity-proxy/internal/credentials"
+	"github.com/dvcrn/antigravity-proxy/internal/env"
+	"github.com/dvcrn/antigravity-proxy/internal/logger"
+)
+
+// defaultCacheTTL is how long a discovered project stays valid on disk.
+const defaultCacheTTL = 24 * time.Hour
+
+// filePathProvider is implemented by credential providers backed by a file on disk.
+// The discovery cache is stored next to that file.
+type filePathProvider interface {
+	FilePath() string
+}
+
+// cacheEntry is the on-disk discovery cache.
+type cacheEntry struct {
+	// Account fingerprints the credentials the entry was discovered with
+	Account    string           `json:"account"`
+	ProjectID  string           `json:"projectId"`
+	Tier       antigravity.Tier `json:"tier"`
+	GCPManaged bool             `json:"gcpManaged"`
+	CachedAt   time.Time        `json:"cachedAt"`
+}
+
+// discoveryCache reads and writes the cache file for one credentials provider.
+type discoveryCache struct {
+	path    string
+	account string
+	ttl     time.Duration
+}
+
+// cacheFor returns the discovery cache for the provider, or nil when caching is disabled
+// or the provider has no file (env or KV credentials) to store it next to.
+func cacheFor(provider credentials.CredentialsProvider) *discoveryCache {
+	ttl := defaultCacheTTL
+	if raw, ok := env.Get("PROJECT_CACHE_TTL"); ok && raw != "" {
+		parsed, err := time.ParseDuration(raw)
+		if err != nil {
+			logger.Get().Warn().Err(err).Str("value", raw).Msg("Invalid PROJECT_CACHE_TTL; using default")
+		} else {
+			ttl = parsed
+		}
+	}
+	if ttl <= 0 {
+		return nil
+	}
+
+	fp, ok := provider.(filePathProvider)
+	if !ok {
+		return nil
+	}
+
+	// Fingerprint first: loading credentials resolves whether the provider is file-backed
+	account, err := accountFingerprint(provider)
+	if err != nil || fp.FilePath() == "" {
+		return nil
+	}
+
+	credsPath := fp.FilePath()
+	name := strings.TrimSuffix(filepath.Base(credsPath), filepath.Ext(credsPath)) + "_project_cache.json"
+	return &discoveryCache{
+		path:    filepath.Join(filepath.Dir(credsPath), name),
+		account: account,
+		ttl:     ttl,
+	}
+}
+
+// accountFingerprint identifies the account behind the credentials. The refresh token is
+// stable across access token refreshes but changes when a different account logs in.
+func accountFingerprint(provider credentials.CredentialsProvider) (string, error) {
+	creds, err := provider.GetCredentials()
+	if err != nil {
+		return "", err
+	}
+	if creds.RefreshToken == "" {
+		return "", fmt.Errorf("credentials have no refresh token")
+	}
+	sum := sha256.Sum256([]byte(creds.RefreshToken))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// load returns the cached entry if it exists, belongs to the current account and hasn't expired.
+func (c *discoveryCache) load() (*cacheEntry, bool) {
+	if c == nil {
+		return nil, false
+	}
+	data, err := os.ReadFile(c.path)
+	if err != nil {
+		return nil, false
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		logger.Get().Debug().Err(err).Str("path", c.path).Msg("Ignoring unreadable project cache")
+		return nil, false
+	}
+	if entry.Account != c.account {
+		logger.Get().Info().Str("path", c.path).Msg("Credentials changed; ignoring cached project")
+		return nil, false
+	}
+	if entry.ProjectID == "" || time.Since(entry.CachedAt) > c.ttl {
+		return nil, false
+	}
+	return &entry, true
+}
+
+// store writes the discovery result. Failures are logged and otherwise ignored.
+func (c *discoveryCache) store(projectID string, loadAssist *antigravity.LoadCodeAssistResponse) {
+	if c == nil || projectID == "" {
+		return
+	}
+	entry := cacheEntry{
+		Account:    c.account,
+		ProjectID:  projectID,
+		Tier:       loadAssist.CurrentTier,
+		GCPManaged: loadAssist.GCPManaged,
+		CachedAt:   time.Now().UTC(),
+	}
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return
+	}
+	if err := os.WriteFile(c.path, data, 0o600); err != nil {
+		logger.Get().Warn().Err(err).Str("path", c.path).Msg("Failed to write project cache")
+		return
+	}
+	logger.Get().Debug().Str("path", c.path).Str("project_id", projectID).Msg("Cached discovered project")
+}
@@ -0,0 +1,116 @@
+package project
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dvcrn/antigravity-proxy/internal/antigravity"
+	"github.com/dvcrn/antigravity-proxy/internal/credentials"
+)
+
+type fileBackedProvider struct {
+	path  string
+	creds credentials.OAuthCredentials
+}
+
+func (p *fileBackedProvider) GetCredentials() (*credentials.OAuthCredentials, error) {
+	creds := p.creds
+	return &creds, nil
+}
+func (p *fileBackedProvider) SaveCredentials(*credentials.OAuthCredentials) error { return nil }
+func (p *fileBackedProvider) RefreshToken() error                                 { return nil }
+func (p *fileBackedProvider) Name() string                                        { return "test" }
+func (p *fileBackedProvider) FilePath() string                                    { return p.path }
+
+func countingLoadAssist(calls *int, projectID string) LoadAssistFunc {
+	return func(context.Context) (*antigravity.LoadCodeAssistResponse, error) {
+		*calls++
+		return &antigravity.LoadCodeAssistResponse{
+			CurrentTier:             antigravity.Tier{ID: "free-tier", Name: "Free"},
+			CloudAICompanionProject: projectID,
+		}, nil
+	}
+}
+
+func TestDiscoverUsesCache(t *testing.T) {
+	t.Setenv("PROJECT_CACHE_TTL", "")
+	dir := t.TempDir()
+	provider := &fileBackedProvider{
+		path:  filepath.Join(dir, "oauth_creds.json"),
+		creds: credentials.OAuthCredentials{RefreshToken: "refresh-a"},
+	}
+
+	calls := 0
+	for i := 0; i < 2; i++ {
+		projectID, err := Discover(context.Background(), provider, "", 0, countingLoadAssist(&calls, "proj-a"))
+		if err != nil {
+			t.Fatalf("Discover: %v", err)
+		}
+		if projectID != "proj-a" {
+			t.Errorf("projectID = %q, want proj-a", projectID)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("loadAssist called %d times, want 1", calls)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "oauth_creds_project_cache.json")); err != nil {
+		t.Errorf("expected cache file next to credentials: %v", err)
+	}
+
+	// Env override still wins over the cache
+	projectID, err := Discover(context.Background(), provider, "env-proj", 0, countingLoadAssist(&calls, "proj-a"))
+	if err != nil || projectID != "env-proj" {
+		t.Errorf("env override: got %q, %v; want env-proj", projectID, err)
+	}
+
+	// Different account invalidates the cached entry
+	provider.creds.RefreshToken = "refresh-b"
+	projectID, err = Discover(context.Background(), provider, "", 0, countingLoadAssist(&calls, "proj-b"))
+	if err != nil {
+		t.Fatalf("Discover: %v", err)
+	}
+	if projectID != "proj-b" || calls != 2 {
+		t.Errorf("after account change: projectID = %q, calls = %d; want proj-b, 2", projectID, calls)
+	}
+}
+
+func TestDiscoverCacheExpiry(t *testing.T) {
+	t.Setenv("PROJECT_CACHE_TTL", "1ms")
+	provider := &fileBackedProvider{
+		path:  filepath.Join(t.TempDir(), "oauth_creds.json"),
+		creds: credentials.OAuthCredentials{RefreshToken: "refresh-a"},
+	}
+
+	calls := 0
+	if _, err := Discover(context.Background(), provider, "", 0, countingLoadAssist(&calls, "proj-a")); err != nil {
+		t.Fatalf("Discover: %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if _, err := Discover(context.Background(), provider, "", 0, countingLoadAssist(&calls, "proj-a")); err != nil {
+		t.Fatalf("Discover: %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("loadAssist called %d times, want 2 after expiry", calls)
+	}
+}
+
+func TestDiscoverCacheDisabled(t *testing.T) {
+	t.Setenv("PROJECT_CACHE_TTL", "0")
+	provider := &fileBackedProvider{
+		path:  filepath.Join(t.TempDir(), "oauth_creds.json"),
+		creds: credentials.OAuthCredentials{RefreshToken: "refresh-a"},
+	}
+
+	calls := 0
+	for i := 0; i < 2; i++ {
+		if _, err := Discover(context.Background(), provider, "", 0, countingLoadAssist(&calls, "proj-a")); err != nil {
+			t.Fatalf("Discover: %v", err)
+		}
+	}
+	if calls != 2 {
+		t.Errorf("loadAssist called %d times, want 2 with cache disabled", calls)
+	}
+}
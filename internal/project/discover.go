@@ -2,10 +2,12 @@ package project
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"regexp"
 	"time"
 
 	"github.com/dvcrn/antigravity-proxy/internal/antigravity"
@@ -13,32 +15,92 @@ import (
 	"github.com/dvcrn/antigravity-proxy/internal/logger"
 )
 
-// Discover determines the GCP Project ID to use for the proxy.
-func Discover(provider credentials.CredentialsProvider, envProjectID string, loadAssist *antigravity.LoadCodeAssistResponse) (string, error) {
+// DefaultTimeout bounds the whole discovery flow, including onboarding polls.
+const DefaultTimeout = 2 * time.Minute
+
+// onboardingPollInterval is the delay between onboardUser polls.
+var onboardingPollInterval = 2 * time.Second
+
+// projectIDPattern is the GCP project ID format: 6-30 chars, lowercase letters, digits
+// and hyphens, starting with a letter and not ending with a hyphen. Legacy domain-scoped
+// projects prefix that with their domain, e.g. "example.com:my-project".
+var projectIDPattern = regexp.MustCompile(`^(?:[a-z0-9][a-z0-9.-]*\.[a-z]{2,}:)?[a-z][a-z0-9-]{4,28}[a-z0-9]$`)
+
+// ValidateID reports whether id is a well-formed GCP project ID.
+func ValidateID(id string) error {
+	if !projectIDPattern.MatchString(id) {
+		return fmt.Errorf("malformed project ID %q: must be 6-30 lowercase letters, digits or hyphens, start with a letter and not end with a hyphen, optionally prefixed with \"<domain>:\"", id)
+	}
+	return nil
+}
+
+// LoadAssistFunc fetches the loadCodeAssist response. It is only called when no cached
+// discovery result is available.
+type LoadAssistFunc func(ctx context.Context) (*antigravity.LoadCodeAssistResponse, error)
+
+// Discover determines the GCP Project ID to use for the proxy. The flow is bounded by
+// ctx and, when timeout is positive, an overall deadline of timeout.
+func Discover(ctx context.Context, provider credentials.CredentialsProvider, envProjectID string, timeout time.Duration, loadAssist LoadAssistFunc) (string, error) {
 	// 1. Check for environment variable override
 	if envProjectID != "" {
+		if err := ValidateID(envProjectID); err != nil {
+			return "", fmt.Errorf("invalid CLOUDCODE_GCP_PROJECT_ID: %w", err)
+		}
 		logger.Get().Info().Str("project_id", envProjectID).Msg("Using project ID from CLOUDCODE_GCP_PROJECT_ID environment variable")
 		return envProjectID, nil
 	}
 
-	// 2. Check the pre-fetched loadAssist response
+	// 2. Check the on-disk cache
+	cache := cacheFor(provider)
+	if entry, ok := cache.load(); ok {
+		logger.Get().Info().
+			Str("project_id", entry.ProjectID).
+			Str("tier", fmt.Sprintf("%s (%s)", entry.Tier.Name, entry.Tier.ID)).
+			Bool("gcp_managed", entry.GCPManaged).
+			Time("cached_at", entry.CachedAt).
+			Msg("Using cached project ID")
+		return entry.ProjectID, nil
+	}
+
+	// 3. Fetch the loadAssist response
 	if loadAssist == nil {
+		return "", fmt.Errorf("loadAssist is nil")
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	loadResponse, err := loadAssist(ctx)
+	if err != nil {
+		return "", fmt.Errorf("loadCodeAssist failed: %w", err)
+	}
+	if loadResponse == nil {
 		return "", fmt.Errorf("loadAssist response is nil")
 	}
 
-	// 3. If not GCP Managed, use the CloudAICompanionProject
+	projectID, err := discoverFromLoadAssist(ctx, provider, loadResponse)
+	if err != nil {
+		return "", err
+	}
+	cache.store(projectID, loadResponse)
+	return projectID, nil
+}
+
+func discoverFromLoadAssist(ctx context.Context, provider credentials.CredentialsProvider, loadAssist *antigravity.LoadCodeAssistResponse) (string, error) {
+	// If not GCP Managed, use the CloudAICompanionProject
 	if !loadAssist.GCPManaged {
 		projectID := loadAssist.CloudAICompanionProject
 		logger.Get().Info().Str("project_id", projectID).Msg("Using project ID from loadCodeAssist (gcpManaged=false)")
 		return projectID, nil
 	}
 
-	// 4. If GCP Managed, run the full discovery/onboarding flow
+	// If GCP Managed, run the full discovery/onboarding flow
 	logger.Get().Info().Msg("gcpManaged=true, starting full project discovery and onboarding flow")
-	return runOnboardingFlow(provider, loadAssist)
+	return runOnboardingFlow(ctx, provider, loadAssist)
 }
 
-func runOnboardingFlow(provider credentials.CredentialsProvider, loadResponse *antigravity.LoadCodeAssistResponse) (string, error) {
+func runOnboardingFlow(ctx context.Context, provider credentials.CredentialsProvider, loadResponse *antigravity.LoadCodeAssistResponse) (string, error) {
 	discoveryStartTime := time.Now()
 
 	// No need to get creds here anymore, callEndpoint will do it
@@ -85,7 +147,7 @@ func runOnboardingFlow(provider credentials.CredentialsProvider, loadResponse *a
 
 	// Initial onboarding call
 	onboardCallStart := time.Now()
-	lroResponse, err := callEndpoint(provider, "onboardUser", onboardRequest)
+	lroResponse, err := callEndpoint(ctx, provider, "onboardUser", onboardRequest)
 	if err != nil {
 		return "", fmt.Errorf("failed to call onboardUser: %w", err)
 	}
@@ -122,10 +184,16 @@ func runOnboardingFlow(provider credentials.CredentialsProvider, loadResponse *a
 			Dur("elapsed", time.Since(pollStart)).
 			Msg("Polling onboardUser status")
 
-		time.Sleep(2 * time.Second)
+		timer := time.NewTimer(onboardingPollInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return "", fmt.Errorf("onboarding cancelled after %d polls: %w", pollCount, ctx.Err())
+		case <-timer.C:
+		}
 
 		pollCallStart := time.Now()
-		lroResponse, err = callEndpoint(provider, "onboardUser", onboardRequest)
+		lroResponse, err = callEndpoint(ctx, provider, "onboardUser", onboardRequest)
 		if err != nil {
 			return "", fmt.Errorf("failed to poll onboardUser: %w", err)
 		}
@@ -136,7 +204,7 @@ func runOnboardingFlow(provider credentials.CredentialsProvider, loadResponse *a
 	}
 }
 
-func callEndpoint(provider credentials.CredentialsProvider, method string, body interface{}) (map[string]interface{}, error) {
+func callEndpoint(ctx context.Context, provider credentials.CredentialsProvider, method string, body interface{}) (map[string]interface{}, error) {
 	callStart := time.Now()
 	defer func() {
 		callDuration := time.Since(callStart)
@@ -162,7 +230,7 @@ func callEndpoint(provider credentials.CredentialsProvider, method string, body
 
 	for _, endpoint := range antigravity.Endpoints {
 		url := fmt.Sprintf("%s/%s:%s", endpoint, credentials.CodeAssistAPIVersion, method)
-		req, err := http.NewRequest("POST", url, bytes.NewReader(reqBody))
+		req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(reqBody))
 		if err != nil {
 			return nil, err
 		}
@@ -172,6 +240,9 @@ func callEndpoint(provider credentials.CredentialsProvider, method string, body
 		httpStart := time.Now()
 		resp, err := httpClient.Do(req)
 		if err != nil {
+			if ctx.Err() != nil {
+				return nil, fmt.Errorf("%s cancelled: %w", method, ctx.Err())
+			}
 			lastErr = err
 			logger.Get().Warn().Err(err).Str("endpoint", endpoint).Msg("Project discovery request failed")
 			continue
@@ -190,7 +261,7 @@ func callEndpoint(provider credentials.CredentialsProvider, method string, body
 			}
 			accessToken = refreshedCreds.AccessToken
 
-			req, err = http.NewRequest("POST", url, bytes.NewReader(reqBody))
+			req, err = http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(reqBody))
 			if err != nil {
 				return nil, err
 			}
@@ -0,0 +1,80 @@
+package project
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dvcrn/antigravity-proxy/internal/antigravity"
+	"github.com/dvcrn/antigravity-proxy/internal/credentials"
+)
+
+func TestOnboardingPollHonorsContextCancellation(t *testing.T) {
+	t.Setenv("PROJECT_CACHE_TTL", "0")
+
+	// onboardUser never completes
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"done":false}`))
+	}))
+	defer upstream.Close()
+
+	origEndpoints, origInterval := antigravity.Endpoints, onboardingPollInterval
+	antigravity.Endpoints = []string{upstream.URL}
+	onboardingPollInterval = time.Hour
+	defer func() { antigravity.Endpoints, onboardingPollInterval = origEndpoints, origInterval }()
+
+	provider := &fileBackedProvider{creds: credentials.OAuthCredentials{AccessToken: "token", RefreshToken: "refresh"}}
+	loadAssist := func(context.Context) (*antigravity.LoadCodeAssistResponse, error) {
+		return &antigravity.LoadCodeAssistResponse{GCPManaged: true}, nil
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := Discover(context.Background(), provider, "", 50*time.Millisecond, loadAssist)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected deadline exceeded error, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Discover did not return after the deadline")
+	}
+}
+
+func TestValidateID(t *testing.T) {
+	tests := []struct {
+		id      string
+		wantErr bool
+	}{
+		{id: "my-project-123", wantErr: false},
+		{id: "abcdef", wantErr: false},
+		{id: "example.com:my-project", wantErr: false},
+		{id: "example:my-project", wantErr: true},
+		{id: "My_Project", wantErr: true},
+		{id: "short", wantErr: true},
+		{id: "trailing-hyphen-", wantErr: true},
+		{id: "1starts-with-digit", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			err := ValidateID(tt.id)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateID(%q) error = %v, wantErr %v", tt.id, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDiscoverRejectsMalformedEnvProjectID(t *testing.T) {
+	_, err := Discover(context.Background(), &fileBackedProvider{}, "Bad_Project", 0, nil)
+	if err == nil {
+		t.Fatal("expected error for malformed CLOUDCODE_GCP_PROJECT_ID")
+	}
+}
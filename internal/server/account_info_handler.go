@@ -0,0 +1,78 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/dvcrn/antigravity-proxy/internal/antigravity"
+	"github.com/dvcrn/antigravity-proxy/internal/env"
+	"github.com/dvcrn/antigravity-proxy/internal/logger"
+)
+
+// loadCodeAssistClient is the subset of the upstream client used by the account endpoint.
+type loadCodeAssistClient interface {
+	LoadCodeAssist(ctx context.Context) (*antigravity.LoadCodeAssistResponse, error)
+	AccountEmail() string
+}
+
+type accountTier struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	IsDefault bool   `json:"is_default,omitempty"`
+}
+
+type accountInfoResponse struct {
+	Email                 string        `json:"email,omitempty"`
+	ProjectID             string        `json:"project_id"`
+	CurrentTier           accountTier   `json:"current_tier"`
+	AllowedTiers          []accountTier `json:"allowed_tiers"`
+	GCPManaged            bool          `json:"gcp_managed"`
+	ManageSubscriptionURI string        `json:"manage_subscription_uri,omitempty"`
+}
+
+// accountInfoHandler handles GET /debug/account, reporting the saved email and the plan
+// of the selected account from loadCodeAssist. Disabled (404) unless DEBUG_ACCOUNT_ENDPOINT=true.
+func (s *Server) accountInfoHandler(w http.ResponseWriter, r *http.Request) {
+	if env.GetOrDefault("DEBUG_ACCOUNT_ENDPOINT", "false") != "true" {
+		notFoundHandler(w, r)
+		return
+	}
+	if !allowMethods(w, r, http.MethodGet) {
+		return
+	}
+
+	client, projectID, ok := s.resolveAccount(w, r)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+	writeAccountInfo(ctx, w, client, projectID)
+}
+
+func writeAccountInfo(ctx context.Context, w http.ResponseWriter, client loadCodeAssistClient, projectID string) {
+	loadAssist, err := client.LoadCodeAssist(ctx)
+	if err != nil {
+		logger.Get().Error().Err(err).Int("upstream_status", upstreamStatus(err)).Msg("Failed to load account info")
+		writeUpstreamError(w, err)
+		return
+	}
+
+	resp := accountInfoResponse{
+		Email:                 client.AccountEmail(),
+		ProjectID:             projectID,
+		CurrentTier:           accountTier{ID: loadAssist.CurrentTier.ID, Name: loadAssist.CurrentTier.Name},
+		AllowedTiers:          make([]accountTier, 0, len(loadAssist.AllowedTiers)),
+		GCPManaged:            loadAssist.GCPManaged,
+		ManageSubscriptionURI: loadAssist.ManageSubscriptionURI,
+	}
+	for _, tier := range loadAssist.AllowedTiers {
+		resp.AllowedTiers = append(resp.AllowedTiers, accountTier{ID: tier.ID, Name: tier.Name, IsDefault: tier.IsDefault})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dvcrn/antigravity-proxy/internal/antigravity"
+)
+
+type fakeLoadCodeAssistClient struct {
+	resp  *antigravity.LoadCodeAssistResponse
+	email string
+}
+
+func (f fakeLoadCodeAssistClient) LoadCodeAssist(context.Context) (*antigravity.LoadCodeAssistResponse, error) {
+	return f.resp, nil
+}
+
+func (f fakeLoadCodeAssistClient) AccountEmail() string {
+	return f.email
+}
+
+func TestWriteAccountInfo(t *testing.T) {
+	client := fakeLoadCodeAssistClient{resp: &antigravity.LoadCodeAssistResponse{
+		CurrentTier: antigravity.Tier{ID: "standard-tier", Name: "Gemini Code Assist Standard"},
+		AllowedTiers: []antigravity.Tier{
+			{ID: "free-tier", Name: "Free"},
+			{ID: "standard-tier", Name: "Standard", IsDefault: true},
+		},
+		GCPManaged:            true,
+		ManageSubscriptionURI: "https://example.com/subscription",
+	}, email: "user@example.com"}
+
+	rec := httptest.NewRecorder()
+	writeAccountInfo(context.Background(), rec, client, "test-project")
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	var got accountInfoResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("invalid response %q: %v", rec.Body.String(), err)
+	}
+	if got.CurrentTier.ID != "standard-tier" || got.CurrentTier.Name != "Gemini Code Assist Standard" {
+		t.Errorf("current_tier = %+v", got.CurrentTier)
+	}
+	if got.ManageSubscriptionURI != "https://example.com/subscription" {
+		t.Errorf("manage_subscription_uri = %q", got.ManageSubscriptionURI)
+	}
+	if len(got.AllowedTiers) != 2 || !got.AllowedTiers[1].IsDefault {
+		t.Errorf("allowed_tiers = %+v", got.AllowedTiers)
+	}
+	if got.Email != "user@example.com" {
+		t.Errorf("email = %q", got.Email)
+	}
+	if !got.GCPManaged || got.ProjectID != "test-project" {
+		t.Errorf("gcp_managed = %v, project_id = %q", got.GCPManaged, got.ProjectID)
+	}
+}
+
+func TestAccountInfoHandlerDisabledByDefault(t *testing.T) {
+	t.Setenv("DEBUG_ACCOUNT_ENDPOINT", "")
+	s := &Server{}
+	rec := httptest.NewRecorder()
+	s.accountInfoHandler(rec, httptest.NewRequest(http.MethodGet, "/debug/account", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404 when disabled", rec.Code)
+	}
+}
@@ -0,0 +1,157 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/dvcrn/antigravity-proxy/internal/antigravity"
+	"github.com/dvcrn/antigravity-proxy/internal/credentials"
+	"github.com/dvcrn/antigravity-proxy/internal/env"
+	"github.com/dvcrn/antigravity-proxy/internal/logger"
+	"github.com/dvcrn/antigravity-proxy/internal/project"
+)
+
+// accountHeader selects which registered account serves a request.
+const accountHeader = "X-Antigravity-Account"
+
+// projectHeader overrides the GCP project for a single request. Only projects listed
+// in ALLOWED_PROJECT_OVERRIDES may be selected.
+const projectHeader = "X-Antigravity-Project"
+
+// accountClient is an upstream client bound to one account, with its discovered project.
+// Entries are cached before discovery finishes; ready is closed once client, projectID
+// and err are set.
+type accountClient struct {
+	ready     chan struct{}
+	client    *antigravity.Client
+	projectID string
+	err       error
+}
+
+// SetAccountRegistry enables multi-account routing. Requests naming an account via the
+// X-Antigravity-Account header are served with that account's credentials; requests
+// without the header use the registry's default account, which is served by the
+// provider and project the server was created with. Call it before serving requests.
+func (s *Server) SetAccountRegistry(registry *credentials.Registry) {
+	s.accountsMu.Lock()
+	defer s.accountsMu.Unlock()
+	s.registry = registry
+	s.accounts = map[string]*accountClient{}
+}
+
+// resolveAccount returns the upstream client and project ID for the request, writing an
+// error response and returning ok=false when the account or project override can't be used.
+func (s *Server) resolveAccount(w http.ResponseWriter, r *http.Request) (*antigravity.Client, string, bool) {
+	client, projectID, err := s.clientForRequest(r)
+	if err != nil {
+		logger.Get().Warn().Err(err).Str("account", r.Header.Get(accountHeader)).Msg("Failed to resolve account")
+		writeAPIError(w, http.StatusBadRequest, "invalid_request_error", err.Error(), "invalid_account")
+		return nil, "", false
+	}
+
+	if override := strings.TrimSpace(r.Header.Get(projectHeader)); override != "" {
+		if err := project.ValidateID(override); err != nil {
+			logger.Get().Warn().Err(err).Msg("Rejected project override")
+			writeAPIError(w, http.StatusBadRequest, "invalid_request_error", fmt.Sprintf("Invalid %s header: %v", projectHeader, err), "")
+			return nil, "", false
+		}
+		if !allowedProjectOverride(override) {
+			logger.Get().Warn().Str("project_id", override).Msg("Rejected project override not in ALLOWED_PROJECT_OVERRIDES")
+			writeAPIError(w, http.StatusForbidden, "permission_error",
+				fmt.Sprintf("Project %q is not allowed; list it in ALLOWED_PROJECT_OVERRIDES to use the %s header", override, projectHeader), "project_not_allowed")
+			return nil, "", false
+		}
+		projectID = override
+	}
+	return client, projectID, true
+}
+
+// allowedProjectOverride reports whether id is listed in the comma-separated
+// ALLOWED_PROJECT_OVERRIDES. Overrides are disabled while it is unset.
+func allowedProjectOverride(id string) bool {
+	for _, allowed := range strings.Split(env.GetOrDefault("ALLOWED_PROJECT_OVERRIDES", ""), ",") {
+		if strings.TrimSpace(allowed) == id {
+			return true
+		}
+	}
+	return false
+}
+
+// clientForRequest looks up the account named in the request header, constructing and
+// caching a client for it on first use. Concurrent first requests for an account share
+// one project discovery, which runs without holding accountsMu so other accounts aren't
+// blocked by it.
+func (s *Server) clientForRequest(r *http.Request) (*antigravity.Client, string, error) {
+	account := strings.TrimSpace(r.Header.Get(accountHeader))
+
+	if s.registry == nil {
+		if account != "" {
+			return nil, "", fmt.Errorf("multi-account routing is not configured; unset the %s header", accountHeader)
+		}
+		return s.antigravityClient, s.projectID, nil
+	}
+
+	if account == "" || account == s.registry.DefaultAccount() {
+		return s.antigravityClient, s.projectID, nil
+	}
+
+	s.accountsMu.Lock()
+	entry, cached := s.accounts[account]
+	if !cached {
+		entry = &accountClient{ready: make(chan struct{})}
+		s.accounts[account] = entry
+	}
+	s.accountsMu.Unlock()
+
+	if cached {
+		select {
+		case <-entry.ready:
+		case <-r.Context().Done():
+			return nil, "", r.Context().Err()
+		}
+		return entry.client, entry.projectID, entry.err
+	}
+
+	// Other requests wait on this discovery, so a disconnecting client mustn't cancel it
+	client, projectID, err := s.initAccountClient(context.WithoutCancel(r.Context()), account)
+	entry.client, entry.projectID, entry.err = client, projectID, err
+	if err != nil {
+		// Drop failed entries so the next request tries again
+		s.accountsMu.Lock()
+		delete(s.accounts, account)
+		s.accountsMu.Unlock()
+	}
+	close(entry.ready)
+	return client, projectID, err
+}
+
+// initAccountClient creates the client for a non-default account and discovers its project.
+func (s *Server) initAccountClient(ctx context.Context, account string) (*antigravity.Client, string, error) {
+	provider, err := s.registry.Get(account)
+	if err != nil {
+		return nil, "", err
+	}
+
+	client := antigravity.NewClientWithOptions(provider, clientOptionsFromEnv())
+	projectID, err := s.discoverAccountProject(ctx, client, provider)
+	if err != nil {
+		return nil, "", fmt.Errorf("project discovery failed for account %q: %w", account, err)
+	}
+
+	logger.Get().Info().
+		Str("account", account).
+		Str("provider", provider.Name()).
+		Str("project_id", projectID).
+		Msg("Initialized client for account")
+	return client, projectID, nil
+}
+
+// discoverAccountProject runs project discovery for a non-default account.
+func (s *Server) discoverAccountProject(ctx context.Context, client *antigravity.Client, provider credentials.CredentialsProvider) (string, error) {
+	if s.discoverProject != nil {
+		return s.discoverProject(ctx, client, provider)
+	}
+	return project.Discover(ctx, provider, "", project.DefaultTimeout, client.LoadCodeAssist)
+}
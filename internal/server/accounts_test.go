@@ -0,0 +1,229 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dvcrn/antigravity-proxy/internal/antigravity"
+	"github.com/dvcrn/antigravity-proxy/internal/credentials"
+)
+
+type fakeProvider struct{ name string }
+
+func (p *fakeProvider) GetCredentials() (*credentials.OAuthCredentials, error) {
+	return &credentials.OAuthCredentials{AccessToken: p.name, ExpiryDate: time.Now().Add(time.Hour).UnixMilli()}, nil
+}
+func (p *fakeProvider) SaveCredentials(*credentials.OAuthCredentials) error { return nil }
+func (p *fakeProvider) RefreshToken() error                                 { return nil }
+func (p *fakeProvider) Name() string                                        { return p.name }
+
+// newTestServer returns a Server for the default test account whose upstream calls
+// go to a test server running upstream. Both are torn down when the test ends.
+func newTestServer(t *testing.T, upstream http.Handler) *Server {
+	t.Helper()
+	srv := httptest.NewServer(upstream)
+	t.Cleanup(srv.Close)
+	origEndpoints := antigravity.Endpoints
+	antigravity.Endpoints = []string{srv.URL}
+	t.Cleanup(func() { antigravity.Endpoints = origEndpoints })
+
+	provider := &fakeProvider{name: "default"}
+	return &Server{provider: provider, projectID: "test-project", antigravityClient: antigravity.NewClient(provider)}
+}
+
+func newAccountTestServer() (*Server, *int) {
+	defaultProvider := &fakeProvider{name: "default"}
+	s := &Server{
+		provider:          defaultProvider,
+		projectID:         "default-project",
+		antigravityClient: antigravity.NewClient(defaultProvider),
+	}
+
+	registry := credentials.NewRegistry("default")
+	registry.Register("default", defaultProvider)
+	registry.Register("work", &fakeProvider{name: "work"})
+	s.SetAccountRegistry(registry)
+
+	discoveries := 0
+	s.discoverProject = func(_ context.Context, _ *antigravity.Client, p credentials.CredentialsProvider) (string, error) {
+		discoveries++
+		return p.Name() + "-project", nil
+	}
+	return s, &discoveries
+}
+
+func TestClientForRequestRoutesByAccountHeader(t *testing.T) {
+	s, discoveries := newAccountTestServer()
+
+	tests := []struct {
+		name        string
+		account     string
+		wantProject string
+		wantDefault bool
+		wantErr     bool
+	}{
+		{name: "no header uses default", account: "", wantProject: "default-project", wantDefault: true},
+		{name: "explicit default", account: "default", wantProject: "default-project", wantDefault: true},
+		{name: "named account", account: "work", wantProject: "work-project"},
+		{name: "unknown account", account: "nope", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+			if tt.account != "" {
+				r.Header.Set(accountHeader, tt.account)
+			}
+			client, projectID, err := s.clientForRequest(r)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected error for unknown account")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if projectID != tt.wantProject {
+				t.Errorf("project = %q, want %q", projectID, tt.wantProject)
+			}
+			if (client == s.antigravityClient) != tt.wantDefault {
+				t.Errorf("default client used = %v, want %v", client == s.antigravityClient, tt.wantDefault)
+			}
+		})
+	}
+
+	// A second request for the same account reuses the cached client
+	r := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	r.Header.Set(accountHeader, "work")
+	first, _, _ := s.clientForRequest(r)
+	second, _, _ := s.clientForRequest(r)
+	if first != second {
+		t.Error("expected cached client to be reused for the same account")
+	}
+	if *discoveries != 1 {
+		t.Errorf("project discovery ran %d times, want 1", *discoveries)
+	}
+}
+
+func TestResolveAccountRejectsUnknownAccount(t *testing.T) {
+	s, _ := newAccountTestServer()
+
+	r := httptest.NewRequest(http.MethodGet, "/v1/models", nil)
+	r.Header.Set(accountHeader, "nope")
+	rr := httptest.NewRecorder()
+	s.modelsHandler(rr, r)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", rr.Code, http.StatusBadRequest)
+	}
+}
+
+func TestAccountHeaderWithoutRegistry(t *testing.T) {
+	s := &Server{projectID: "p"}
+	r := httptest.NewRequest(http.MethodGet, "/v1/models", nil)
+	r.Header.Set(accountHeader, "work")
+	if _, _, err := s.clientForRequest(r); err == nil {
+		t.Error("expected error when an account is requested without a registry")
+	}
+}
+
+func TestResolveAccountProjectOverride(t *testing.T) {
+	s, _ := newAccountTestServer()
+
+	tests := []struct {
+		name        string
+		allowed     string
+		override    string
+		wantOK      bool
+		wantStatus  int
+		wantProject string
+	}{
+		{name: "no override", wantOK: true, wantProject: "default-project"},
+		{name: "allowed override", allowed: "my-other-project, example.com:legacy-proj", override: "my-other-project", wantOK: true, wantProject: "my-other-project"},
+		{name: "allowed domain-scoped override", allowed: "example.com:legacy-proj", override: "example.com:legacy-proj", wantOK: true, wantProject: "example.com:legacy-proj"},
+		{name: "overrides disabled by default", override: "my-other-project", wantStatus: http.StatusForbidden},
+		{name: "override not in allowlist", allowed: "my-other-project", override: "someone-elses", wantStatus: http.StatusForbidden},
+		{name: "malformed override", allowed: "Not_A_Project", override: "Not_A_Project", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("ALLOWED_PROJECT_OVERRIDES", tt.allowed)
+			r := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+			if tt.override != "" {
+				r.Header.Set(projectHeader, tt.override)
+			}
+			rr := httptest.NewRecorder()
+			_, projectID, ok := s.resolveAccount(rr, r)
+			if ok != tt.wantOK {
+				t.Fatalf("ok = %v, want %v", ok, tt.wantOK)
+			}
+			if !ok {
+				if rr.Code != tt.wantStatus {
+					t.Errorf("status = %d, want %d", rr.Code, tt.wantStatus)
+				}
+				return
+			}
+			if projectID != tt.wantProject {
+				t.Errorf("project = %q, want %q", projectID, tt.wantProject)
+			}
+		})
+	}
+}
+
+func TestAccountDiscoveryDoesNotBlockOtherRequests(t *testing.T) {
+	s, _ := newAccountTestServer()
+	started := make(chan struct{}, 2)
+	release := make(chan struct{})
+	var discoveries atomic.Int32
+	s.discoverProject = func(_ context.Context, _ *antigravity.Client, p credentials.CredentialsProvider) (string, error) {
+		discoveries.Add(1)
+		started <- struct{}{}
+		<-release
+		return p.Name() + "-project", nil
+	}
+
+	workRequest := func() *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+		r.Header.Set(accountHeader, "work")
+		return r
+	}
+	results := make(chan string, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, projectID, _ := s.clientForRequest(workRequest())
+			results <- projectID
+		}()
+	}
+
+	// The default account is served while discovery for "work" is still running
+	<-started
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, projectID, err := s.clientForRequest(httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil))
+		if err != nil || projectID != "default-project" {
+			t.Errorf("default account = %q, %v", projectID, err)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("default account request blocked by another account's project discovery")
+	}
+
+	close(release)
+	for i := 0; i < 2; i++ {
+		if projectID := <-results; projectID != "work-project" {
+			t.Errorf("work project = %q, want work-project", projectID)
+		}
+	}
+	if n := discoveries.Load(); n != 1 {
+		t.Errorf("project discovery ran %d times, want 1", n)
+	}
+}
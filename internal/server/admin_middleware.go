@@ -15,7 +15,7 @@ func (s *Server) adminMiddleware(next http.HandlerFunc) http.HandlerFunc {
 		adminKey, ok := env.Get("ADMIN_API_KEY")
 		if !ok || adminKey == "" {
 			logger.Get().Error().Msg("ADMIN_API_KEY environment variable not set")
-			http.Error(w, "Admin API not configured", http.StatusInternalServerError)
+			writeAPIError(w, http.StatusInternalServerError, "api_error", "Admin API not configured", "")
 			return
 		}
 
@@ -30,7 +30,7 @@ func (s *Server) adminMiddleware(next http.HandlerFunc) http.HandlerFunc {
 			if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") {
 				logger.Get().Warn().Msgf("Invalid Authorization header format for admin endpoint: %s %s from %s",
 					r.Method, r.RequestURI, r.RemoteAddr)
-				http.Error(w, "Invalid Authorization header format", http.StatusUnauthorized)
+				writeAPIError(w, http.StatusUnauthorized, "authentication_error", "Invalid Authorization header format", "invalid_api_key")
 				return
 			}
 			providedToken = parts[1]
@@ -43,7 +43,7 @@ func (s *Server) adminMiddleware(next http.HandlerFunc) http.HandlerFunc {
 		} else {
 			logger.Get().Warn().Msgf("Missing required Authorization header, X-Goog-Api-Key header, or key query parameter for admin endpoint: %s %s from %s",
 				r.Method, r.RequestURI, r.RemoteAddr)
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			writeAPIError(w, http.StatusUnauthorized, "authentication_error", "Unauthorized", "invalid_api_key")
 			return
 		}
 
@@ -51,7 +51,7 @@ func (s *Server) adminMiddleware(next http.HandlerFunc) http.HandlerFunc {
 		if providedToken != adminKey {
 			logger.Get().Warn().Msgf("Invalid admin API key provided: %s %s from %s",
 				r.Method, r.RequestURI, r.RemoteAddr)
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			writeAPIError(w, http.StatusUnauthorized, "authentication_error", "Unauthorized", "invalid_api_key")
 			return
 		}
 
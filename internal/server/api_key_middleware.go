@@ -0,0 +1,92 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/dvcrn/antigravity-proxy/internal/env"
+	"github.com/dvcrn/antigravity-proxy/internal/logger"
+)
+
+// apiKeyExemptPaths skip proxy API-key auth so health probes keep working.
+var apiKeyExemptPaths = map[string]bool{
+	"/readyz": true,
+}
+
+// proxyKeyAuthKey marks a request context as authenticated with a PROXY_API_KEYS key.
+type proxyKeyAuthKey struct{}
+
+// apiKeyMiddleware enforces the proxy's own API-key auth when PROXY_API_KEYS (a
+// comma-separated list) is set: requests need 'Authorization: Bearer <key>' with one of
+// the keys, or get a 401. Authenticated requests are marked so the API routes skip the
+// ADMIN_API_KEY check (see apiAuthMiddleware). This is independent of the upstream
+// Google credentials.
+func apiKeyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys := proxyAPIKeys()
+		if len(keys) == 0 || apiKeyExemptPaths[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token, ok := bearerToken(r.Header.Get("Authorization"))
+		if !ok || !validAPIKey(token, keys) {
+			logger.Get().Warn().Msgf("Missing or invalid proxy API key: %s %s from %s",
+				r.Method, r.URL.Path, r.RemoteAddr)
+			writeAPIError(w, http.StatusUnauthorized, "authentication_error", "Missing or invalid API key", "invalid_api_key")
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), proxyKeyAuthKey{}, true)))
+	})
+}
+
+// proxyAPIKeys returns the configured PROXY_API_KEYS, or nil when auth is disabled.
+func proxyAPIKeys() []string {
+	raw, ok := env.Get("PROXY_API_KEYS")
+	if !ok {
+		return nil
+	}
+	var keys []string
+	for _, key := range strings.Split(raw, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// bearerToken extracts the token from a 'Bearer <token>' Authorization header.
+func bearerToken(header string) (string, bool) {
+	parts := strings.Split(header, " ")
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") || parts[1] == "" {
+		return "", false
+	}
+	return parts[1], true
+}
+
+// validAPIKey compares token against every key in constant time.
+func validAPIKey(token string, keys []string) bool {
+	valid := false
+	for _, key := range keys {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(key)) == 1 {
+			valid = true
+		}
+	}
+	return valid
+}
+
+// apiAuthMiddleware guards the model API routes: requests already authenticated with a
+// PROXY_API_KEYS key pass, anything else needs the admin key (see adminMiddleware).
+func (s *Server) apiAuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	admin := s.adminMiddleware(next)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if authenticated, _ := r.Context().Value(proxyKeyAuthKey{}).(bool); authenticated {
+			next(w, r)
+			return
+		}
+		admin(w, r)
+	}
+}
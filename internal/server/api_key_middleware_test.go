@@ -0,0 +1,77 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAPIKeyMiddleware(t *testing.T) {
+	handler := apiKeyMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	testCases := []struct {
+		name       string
+		keys       string
+		path       string
+		auth       string
+		expectCode int
+	}{
+		{name: "disabled without keys", path: "/v1/models", expectCode: http.StatusOK},
+		{name: "missing header", keys: "k1,k2", path: "/v1/models", expectCode: http.StatusUnauthorized},
+		{name: "invalid key", keys: "k1,k2", path: "/v1/models", auth: "Bearer nope", expectCode: http.StatusUnauthorized},
+		{name: "malformed header", keys: "k1,k2", path: "/v1/models", auth: "k1", expectCode: http.StatusUnauthorized},
+		{name: "valid key", keys: "k1, k2", path: "/v1/models", auth: "Bearer k2", expectCode: http.StatusOK},
+		{name: "readiness exempt", keys: "k1", path: "/readyz", expectCode: http.StatusOK},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("PROXY_API_KEYS", tc.keys)
+
+			req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			if tc.auth != "" {
+				req.Header.Set("Authorization", tc.auth)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tc.expectCode {
+				t.Errorf("status = %d, want %d", rr.Code, tc.expectCode)
+			}
+		})
+	}
+}
+
+func TestProxyAPIKeyReachesAPIRoutes(t *testing.T) {
+	t.Setenv("PROXY_API_KEYS", "client-key")
+	t.Setenv("ADMIN_API_KEY", "admin-key")
+	s := NewServer(&fakeProvider{name: "default"}, "test-project")
+
+	testCases := []struct {
+		name       string
+		method     string
+		path       string
+		key        string
+		expectCode int
+	}{
+		// The empty body fails parsing, which happens only after auth
+		{name: "proxy key reaches chat completions", method: http.MethodPost, path: "/v1/chat/completions", key: "client-key", expectCode: http.StatusBadRequest},
+		{name: "proxy key does not open admin routes", method: http.MethodGet, path: "/admin/credentials/status", key: "client-key", expectCode: http.StatusUnauthorized},
+		{name: "unknown key rejected", method: http.MethodPost, path: "/v1/chat/completions", key: "nope", expectCode: http.StatusUnauthorized},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.path, nil)
+			req.Header.Set("Authorization", "Bearer "+tc.key)
+			rr := httptest.NewRecorder()
+			s.ServeHTTP(rr, req)
+
+			if rr.Code != tc.expectCode {
+				t.Errorf("status = %d, want %d: %s", rr.Code, tc.expectCode, rr.Body.String())
+			}
+		})
+	}
+}
@@ -3,14 +3,20 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
 	"strings"
 	"time"
 
+	"github.com/dvcrn/antigravity-proxy/internal/antigravity"
+	"github.com/dvcrn/antigravity-proxy/internal/env"
 	"github.com/dvcrn/antigravity-proxy/internal/logger"
 	"github.com/dvcrn/antigravity-proxy/internal/openai"
+	"github.com/dvcrn/antigravity-proxy/internal/timing"
 	"github.com/dvcrn/antigravity-proxy/internal/transform"
+	"github.com/dvcrn/antigravity-proxy/internal/warnings"
+	"github.com/rs/zerolog"
 )
 
 // openAIChatCompletionsHandler handles OpenAI-compatible chat completion requests.
@@ -18,37 +24,76 @@ import (
 // No client-specific normalization is applied; arguments are passed through as-is.
 func (s *Server) openAIChatCompletionsHandler(w http.ResponseWriter, r *http.Request) {
 	startTime := time.Now()
-	logger.Get().Info().
+	logger.Sampled(r.Context()).Info().
 		Str("method", r.Method).
 		Str("path", r.URL.Path).
 		Time("start_time", startTime).
 		Msg("OpenAI chat completions request received")
 
+	if !allowMethods(w, r, http.MethodPost) {
+		return
+	}
+
 	// Read body
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
 		logger.Get().Error().Err(err).Msg("Error reading request body")
-		http.Error(w, "Error reading request body", http.StatusBadRequest)
+		writeAPIError(w, http.StatusBadRequest, "invalid_request_error", "Error reading request body", "")
 		return
 	}
 	defer r.Body.Close()
 
 	// Parse request
 	var req openai.ChatCompletionRequest
-	if err := json.Unmarshal(body, &req); err != nil {
+	if err := decodeRequestBody(body, &req); err != nil {
 		logger.Get().Error().Err(err).Msg("Error parsing request body")
-		http.Error(w, "Error parsing request body", http.StatusBadRequest)
+		if isUnknownFieldError(err) {
+			writeAPIError(w, http.StatusBadRequest, "invalid_request_error", strings.TrimPrefix(err.Error(), "json: "), "unknown_field")
+			return
+		}
+		writeAPIError(w, http.StatusBadRequest, "invalid_request_error", "Error parsing request body", "")
+		return
+	}
+
+	// PROXY_WARNINGS=true reports request changes back to non-streaming clients
+	if env.GetOrDefault("PROXY_WARNINGS", "false") == "true" && !req.Stream {
+		r = r.WithContext(warnings.WithCollector(r.Context(), warnings.NewCollector()))
+	}
+	warns := warnings.FromContext(r.Context())
+
+	// Fall back to DEFAULT_MODEL and resolve aliases so the response echoes the model actually used
+	requestedModel := req.Model
+	req.Model = transform.ResolveModel(req.Model)
+	if requestedModel == "" && req.Model != "" {
+		warns.Addf("model omitted; defaulted to %q (DEFAULT_MODEL)", req.Model)
+	} else if requestedModel != req.Model {
+		warns.Addf("model alias %q resolved to %q (MODEL_ALIASES)", requestedModel, req.Model)
+	}
+
+	// Multiple candidates (candidateCount) can't be interleaved into one OpenAI stream
+	if req.Stream && req.N > 1 {
+		writeAPIError(w, http.StatusBadRequest, "invalid_request_error", "n > 1 is not supported with stream: true", "")
 		return
 	}
 
 	// Request overview
-	logger.Get().Info().
+	logger.Sampled(r.Context()).Info().
 		Str("requested_model", req.Model).
 		Bool("stream", req.Stream).
 		Int("messages", len(req.Messages)).
 		Int("tools", len(req.Tools)).
+		Bool("store", req.RetentionAllowed()).
 		Msg("Parsed OpenAI request")
 
+	// Clients sending "store": false opt out of content retention. CloudCode exposes no
+	// no-retention flag, so the best we can do is keep message content out of our logs.
+	logContent := req.RetentionAllowed()
+	if !logContent {
+		logger.Sampled(r.Context()).Info().Msg("Client requested store=false; suppressing content logging for this request")
+		r = r.WithContext(antigravity.WithoutContentLogging(r.Context()))
+		suppressBodyLogging(r)
+	}
+
 	// Log tool result messages present in the request (tool outputs from client)
 	toolMsgCount := 0
 	for i, m := range req.Messages {
@@ -81,16 +126,19 @@ func (s *Server) openAIChatCompletionsHandler(w http.ResponseWriter, r *http.Req
 			kind = "unknown"
 		}
 
-		if len(preview) > 300 {
+		contentLen := len(preview)
+		if !logContent {
+			preview = ""
+		} else if len(preview) > 300 {
 			preview = preview[:300] + "..."
 		}
 
-		logger.Get().Info().
+		logger.Sampled(r.Context()).Info().
 			Int("index", i).
 			Str("tool_call_id", m.ToolCallID).
 			Str("name", m.Name).
 			Str("content_kind", kind).
-			Int("content_len", len(preview)).
+			Int("content_len", contentLen).
 			Str("content_preview", preview).
 			Msg("Tool result message received")
 	}
@@ -100,245 +148,363 @@ func (s *Server) openAIChatCompletionsHandler(w http.ResponseWriter, r *http.Req
 
 	// Delegate to stream or non-stream handler
 	if req.Stream {
-		s.chatCompletionRequestStream(w, r, req, startTime)
+		s.chatCompletionRequestStream(w, r, req, startTime, logContent)
 		return
 	}
 	s.chatCompletionRequest(w, r, req, startTime)
 }
 
 // chatCompletionRequestStream handles the streaming variant (existing behavior).
-func (s *Server) chatCompletionRequestStream(w http.ResponseWriter, r *http.Request, req openai.ChatCompletionRequest, startTime time.Time) {
+func (s *Server) chatCompletionRequestStream(w http.ResponseWriter, r *http.Request, req openai.ChatCompletionRequest, startTime time.Time, logContent bool) {
+	client, projectID, ok := s.resolveAccount(w, r)
+	if !ok {
+		return
+	}
 	// Transform OpenAI -> Gemini
-	gemReq, err := transform.ToGeminiRequest(&req, s.projectID)
+	rec := timing.FromContext(r.Context())
+	transformStart := time.Now()
+	gemReq, err := transform.ToGeminiRequest(&req, projectID)
 	if err != nil {
-		logger.Get().Error().Err(err).Msg("Failed to transform OpenAI request to Gemini request")
-		http.Error(w, "Failed to transform request", http.StatusInternalServerError)
+		writeTransformError(w, err)
 		return
 	}
+	applySessionHeader(r, gemReq)
+	rec.Since(timing.PhaseTransform, timing.PhaseTransformDesc, transformStart)
 
 	// Normalize model name for CloudCode compatibility
 	normalizedModelName := normalizeModelName(gemReq.Model)
 	originalModel := gemReq.Model
 	gemReq.Model = normalizedModelName
 	if gemReq.Model != originalModel {
-		logger.Get().Info().
+		logger.Sampled(r.Context()).Info().
 			Str("original_model", originalModel).
 			Str("normalized_model", normalizedModelName).
 			Msg("Normalized model for CloudCode")
 	}
 
-	// Prepare SSE response
-	w.Header().Del("Content-Length")
-	w.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
-	w.Header().Set("Cache-Control", "no-cache")
-	w.Header().Set("Connection", "keep-alive")
-	w.WriteHeader(http.StatusOK)
-
-	// Flush headers if supported
-	var flusher http.Flusher
-	if f, ok := w.(http.Flusher); ok {
-		flusher = f
-		flusher.Flush()
-		logger.Get().Debug().Msg("SSE headers flushed (flusher available)")
-	} else {
-		logger.Get().Info().Msg("SSE flusher not available; relying on implicit streaming")
+	if writeDryRun(w, r, gemReq) {
+		return
 	}
 
+	// Map normalized tool names in model output back to the client's names
+	toolNames := transform.BuildToolNameMapping(&req)
+
+	// SSE headers are sent with the first ping or chunk, so an upstream failure before
+	// then can still be returned with its HTTP status
+	sw := newSSEWriter(w)
+
 	// Start upstream streaming from Gemini
 	upstream := make(chan string, 32)
-	logger.Get().Info().
+	logger.Sampled(r.Context()).Info().
 		Str("model", gemReq.Model).
 		Msg("Starting upstream StreamGenerateContent")
 
 	// Pinger to keep connection alive
 	pingerCtx, cancelPinger := context.WithCancel(r.Context())
 	defer cancelPinger()
+	pingerDone := make(chan struct{})
 
 	go func() {
+		defer close(pingerDone)
 		ticker := time.NewTicker(10 * time.Second)
 		defer ticker.Stop()
 		for {
 			select {
 			case <-ticker.C:
 				logger.Get().Debug().Msg("Sending SSE ping to keep connection alive")
-				if _, err := io.WriteString(w, ": ping\n\n"); err != nil {
+				if _, err := io.WriteString(sw, ": ping\n\n"); err != nil {
 					logger.Get().Warn().Err(err).Msg("Failed to write SSE ping")
 					return
 				}
-				if flusher, ok := w.(http.Flusher); ok {
-					flusher.Flush()
-				}
 			case <-pingerCtx.Done():
 				return
 			}
 		}
 	}()
 
-	if err := s.antigravityClient.StreamGenerateContent(r.Context(), gemReq, upstream); err != nil {
-		logger.Get().Error().Err(err).Msg("StreamGenerateContent call failed")
-		http.Error(w, "Upstream streaming error", http.StatusInternalServerError)
+	if err := client.StreamGenerateContent(r.Context(), gemReq, upstream); err != nil {
+		cancelPinger()
+		<-pingerDone
+		committed := sw.Committed()
+		logger.Get().Error().
+			Err(err).
+			Int("upstream_status", upstreamStatus(err)).
+			Bool("headers_sent", committed).
+			Msg("StreamGenerateContent call failed")
+		if !committed {
+			writeUpstreamError(sw, err)
+			return
+		}
+		// A ping already sent the 200 status, so the error is delivered as a stream event
+		writeUpstreamErrorEvent(sw, err)
 		return
 	}
-	logger.Get().Info().Msg("Upstream StreamGenerateContent started")
+	logger.Sampled(r.Context()).Info().Msg("Upstream StreamGenerateContent started")
+
+	// Transform CloudCode SSE into this endpoint's format (OpenAI chunks) and stream to client
+	transformStream := streamTransformForPath(r.URL.Path)
+	out := withEventIDs(transformStream(upstream, streamTransformOptions{
+		geminiStreamAdapterOptions: geminiStreamAdapterOptions{
+			logContent:  logContent,
+			toolNames:   toolNames,
+			startTime:   startTime,
+			onFirstLine: cancelPinger, // Stop pinger on first data
+			model:       req.Model,
+			log:         logger.Sampled(r.Context()),
+		},
+		includeUsage: req.IncludeUsage(),
+	}))
+	defer drainStream(out)
 
-	// Adapter: CloudCode SSE -> StreamChunk (model text, tool calls, usage, etc.)
-	chunkIn := make(chan openai.StreamChunk, 32)
-	go func() {
-		defer close(chunkIn)
-		firstUpstream := true
-		firstThoughtSeen := false
-		for line := range upstream {
-			if firstUpstream {
-				cancelPinger() // Stop pinger on first data
-			}
-			// Process only data lines
-			if !strings.HasPrefix(line, "data: ") {
-				continue
-			}
+	stop, done := s.trackStream()
+	defer done()
 
-			if firstUpstream {
-				logger.Get().Info().
-					Dur("time_to_first_upstream_line", time.Since(startTime)).
-					Msg("First upstream SSE line received")
-				firstUpstream = false
+	firstWrite := true
+	for {
+		var sse string
+		select {
+		case <-stop:
+			logger.Get().Warn().Str("model", gemReq.Model).Msg("Terminating OpenAI stream for shutdown")
+			writeShutdownErrorEvent(sw)
+			return
+		case chunk, ok := <-out:
+			if !ok {
+				logger.Sampled(r.Context()).Info().
+					Str("model", gemReq.Model).
+					Dur("total_duration", time.Since(startTime)).
+					Msg("OpenAI streaming response completed")
+				return
 			}
+			sse = chunk
+		}
 
-			// Transform CloudCode wrapper to standard Gemini-format event
-			transformed := TransformSSELine(line)
-			data := strings.TrimSpace(strings.TrimPrefix(transformed, "data: "))
+		if _, err := io.WriteString(sw, sse); err != nil {
+			logger.Get().Error().Err(err).Msg("Error writing SSE to client")
+			return
+		}
+		if firstWrite {
+			logger.Sampled(r.Context()).Info().
+				Dur("time_to_first_client_write", time.Since(startTime)).
+				Msg("First OpenAI SSE chunk written to client")
+			firstWrite = false
+		}
+	}
+}
 
-			// Handle upstream DONE
-			if data == "" || data == "[DONE]" || data == "\"[DONE]\"" {
-				logger.Get().Info().Msg("Received upstream DONE")
-				break
+// geminiStreamAdapterOptions configures adaptGeminiStream.
+type geminiStreamAdapterOptions struct {
+	// logContent enables logs that contain message content (tokens, tool args).
+	logContent bool
+	// toolNames maps normalized tool names in model output back to the client's names.
+	toolNames transform.ToolNameMapping
+	// startTime is the request start, used for time-to-first-line logging.
+	startTime time.Time
+	// onFirstLine is invoked once when the first upstream line arrives.
+	onFirstLine func()
+	// model is reported in the stream summary log line.
+	model string
+	// log is the request's sampled logger (see logger.WithRequestSampling); nil samples
+	// each line on its own.
+	log *zerolog.Logger
+}
+
+// adaptGeminiStream converts CloudCode SSE lines into StreamChunks (model text, tool calls,
+// usage, etc.) for the OpenAI stream transformer. It closes chunkIn when upstream is
+// exhausted or an upstream DONE is received.
+func adaptGeminiStream(upstream <-chan string, chunkIn chan<- openai.StreamChunk, opts geminiStreamAdapterOptions) {
+	defer close(chunkIn)
+	log := opts.log
+	if log == nil {
+		log = logger.Sampled(context.Background())
+	}
+	stats := newStreamStats(opts.model, opts.startTime)
+	// Registered after close so it runs first: the summary is logged before consumers see the stream end
+	defer stats.log()
+	firstLine := true
+	firstUpstream := true
+	firstThoughtSeen := false
+	for line := range sseEventLines(upstream) {
+		if firstLine {
+			firstLine = false
+			if opts.onFirstLine != nil {
+				opts.onFirstLine()
 			}
+		}
+		// Process only data lines
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+
+		if firstUpstream {
+			log.Info().
+				Dur("time_to_first_upstream_line", time.Since(opts.startTime)).
+				Msg("First upstream SSE line received")
+			firstUpstream = false
+		}
+
+		// Transform CloudCode wrapper to standard Gemini-format event
+		transformed := TransformSSELine(line)
+		data := strings.TrimSpace(antigravity.SSEFieldValue(transformed, "data:"))
+
+		// Handle upstream DONE
+		if data == "" || data == "[DONE]" || data == "\"[DONE]\"" {
+			log.Info().Msg("Received upstream DONE")
+			break
+		}
+
+		// Parse JSON payload
+		var obj map[string]interface{}
+		if err := json.Unmarshal([]byte(data), &obj); err != nil {
+			// Fallback: forward as plain text chunk
+			logger.Get().Debug().Err(err).Msg("Failed to parse SSE JSON; forwarding as text")
+			chunkIn <- openai.StreamChunk{Type: "text", Data: data}
+			continue
+		}
+		stats.observe(obj)
 
-			// Parse JSON payload
-			var obj map[string]interface{}
-			if err := json.Unmarshal([]byte(data), &obj); err != nil {
-				// Fallback: forward as plain text chunk
-				logger.Get().Debug().Err(err).Msg("Failed to parse SSE JSON; forwarding as text")
-				chunkIn <- openai.StreamChunk{Type: "text", Data: data}
-				continue
+		// Usage metadata (optional)
+		if um, ok := obj["usageMetadata"].(map[string]interface{}); ok {
+			payload := map[string]interface{}{}
+			if v, ok := um["promptTokenCount"]; ok {
+				payload["inputTokens"] = v
 			}
+			if v, ok := um["candidatesTokenCount"]; ok {
+				payload["outputTokens"] = v
+			}
+			if v, ok := um["cachedContentTokenCount"]; ok {
+				payload["cachedTokens"] = v
+			}
+			if v, ok := um["thoughtsTokenCount"]; ok {
+				payload["reasoningTokens"] = v
+			}
+			chunkIn <- openai.StreamChunk{Type: "usage", Data: payload}
+		}
 
-			// Usage metadata (optional)
-			if um, ok := obj["usageMetadata"].(map[string]interface{}); ok {
-				payload := map[string]interface{}{}
-				if v, ok := um["promptTokenCount"]; ok {
-					payload["inputTokens"] = v
+		// Extract candidate content parts
+		if cands, ok := obj["candidates"].([]interface{}); ok {
+			for _, c := range cands {
+				cand, ok := c.(map[string]interface{})
+				if !ok {
+					logger.Get().Warn().Interface("candidate", c).Msg("Skipping invalid candidate in Gemini stream")
+					continue
 				}
-				if v, ok := um["candidatesTokenCount"]; ok {
-					payload["outputTokens"] = v
+
+				// Optional grounding metadata passthrough
+				if gm, ok := cand["groundingMetadata"]; ok && gm != nil {
+					chunkIn <- openai.StreamChunk{Type: "grounding_metadata", Data: gm}
 				}
-				chunkIn <- openai.StreamChunk{Type: "usage", Data: payload}
-			}
 
-			// Extract candidate content parts
-			if cands, ok := obj["candidates"].([]interface{}); ok {
-				for _, c := range cands {
-					cand, ok := c.(map[string]interface{})
-					if !ok {
-						logger.Get().Warn().Interface("candidate", c).Msg("Skipping invalid candidate in Gemini stream")
-						continue
+				// Retrieve parts
+				var parts []interface{}
+				if content, ok := cand["content"].(map[string]interface{}); ok {
+					if ps, ok := content["parts"].([]interface{}); ok {
+						parts = ps
 					}
-
-					// Optional grounding metadata passthrough
-					if gm, ok := cand["groundingMetadata"]; ok && gm != nil {
-						chunkIn <- openai.StreamChunk{Type: "grounding_metadata", Data: gm}
+				}
+				if len(parts) == 0 {
+					if ps, ok := cand["parts"].([]interface{}); ok {
+						parts = ps
 					}
+				}
 
-					// Retrieve parts
-					var parts []interface{}
-					if content, ok := cand["content"].(map[string]interface{}); ok {
-						if ps, ok := content["parts"].([]interface{}); ok {
-							parts = ps
-						}
-					}
-					if len(parts) == 0 {
-						if ps, ok := cand["parts"].([]interface{}); ok {
-							parts = ps
-						}
+				// Process parts
+				for _, p := range parts {
+					part, ok := p.(map[string]interface{})
+					if !ok {
+						logger.Get().Warn().Interface("part", p).Msg("Skipping invalid part in Gemini stream")
+						continue
 					}
 
-					// Process parts
-					for _, p := range parts {
-						part, ok := p.(map[string]interface{})
-						if !ok {
-							logger.Get().Warn().Interface("part", p).Msg("Skipping invalid part in Gemini stream")
-							continue
-						}
-
-						// Thought tokens (reasoning) — map to OpenAI reasoning stream
-						if isThought, ok := part["thought"].(bool); ok && isThought {
-							if txt, ok := part["text"].(string); ok && txt != "" {
-								if !firstThoughtSeen {
-									preview := txt
-									if len(preview) > 300 {
-										preview = preview[:300] + "..."
-									}
-									logger.Get().Info().
-										Int("len", len(txt)).
-										Str("preview", preview).
-										Msg("Streaming thinking tokens detected")
-									firstThoughtSeen = true
+					// Thought tokens (reasoning) — map to OpenAI reasoning stream
+					if isThought, ok := part["thought"].(bool); ok && isThought {
+						if txt, ok := part["text"].(string); ok && txt != "" {
+							if !firstThoughtSeen {
+								preview := txt
+								if !opts.logContent {
+									preview = ""
+								} else if len(preview) > 300 {
+									preview = preview[:300] + "..."
 								}
+								log.Info().
+									Int("len", len(txt)).
+									Str("preview", preview).
+									Msg("Streaming thinking tokens detected")
+								firstThoughtSeen = true
+							}
+							if opts.logContent {
 								logger.Get().Debug().
 									Str("token", txt).
 									Msg("SSE thought token received")
-								chunkIn <- openai.StreamChunk{Type: "real_thinking", Data: txt}
 							}
-							// Skip normal text handling to avoid duplicating this token
-							continue
+							chunkIn <- openai.StreamChunk{Type: "real_thinking", Data: txt}
 						}
+						// Skip normal text handling to avoid duplicating this token
+						continue
+					}
 
-						// Text tokens — log per token at DEBUG
-						if txt, ok := part["text"].(string); ok && txt != "" {
+					// Text tokens — log per token at DEBUG
+					if txt, ok := part["text"].(string); ok && txt != "" {
+						if opts.logContent {
 							logger.Get().Debug().
 								Str("token", txt).
 								Msg("SSE text token received")
-							chunkIn <- openai.StreamChunk{Type: "text", Data: txt}
 						}
+						chunkIn <- openai.StreamChunk{Type: "text", Data: txt}
+					}
 
-						// Function call parts
-						if fc, ok := part["functionCall"].(map[string]interface{}); ok {
-							rawName, _ := fc["name"].(string)
-							name := strings.TrimSpace(rawName)
-
-							// Robust args extraction without client-specific normalization
-							var args map[string]interface{}
-							var source string
-							tryParse := func(val interface{}, key string) bool {
-								switch v := val.(type) {
-								case map[string]interface{}:
-									args = v
-									source = key
+					// Function call parts
+					if fc, ok := part["functionCall"].(map[string]interface{}); ok {
+						rawName, _ := fc["name"].(string)
+						name := opts.toolNames.Original(strings.TrimSpace(rawName))
+
+						// Robust args extraction without client-specific normalization
+						var args map[string]interface{}
+						var source string
+						truncated := false
+						tryParse := func(val interface{}, key string) bool {
+							switch v := val.(type) {
+							case map[string]interface{}:
+								args = v
+								source = key
+								return true
+							case string:
+								var m map[string]interface{}
+								if err := json.Unmarshal([]byte(v), &m); err == nil {
+									args = m
+									source = key + " (json)"
 									return true
-								case string:
-									var m map[string]interface{}
-									if err := json.Unmarshal([]byte(v), &m); err == nil {
-										args = m
-										source = key + " (json)"
-										return true
-									}
 								}
-								return false
+								// Arguments cut off mid-JSON must not reach the client as {}
+								truncated = truncated || strings.TrimSpace(v) != ""
 							}
-							if !tryParse(fc["args"], "args") &&
-								!tryParse(fc["argsJson"], "argsJson") &&
-								!tryParse(fc["arguments"], "arguments") &&
-								!tryParse(fc["parameters"], "parameters") {
-								args = map[string]interface{}{}
-								source = "default_empty"
+							return false
+						}
+						if !tryParse(fc["args"], "args") &&
+							!tryParse(fc["argsJson"], "argsJson") &&
+							!tryParse(fc["arguments"], "arguments") &&
+							!tryParse(fc["parameters"], "parameters") {
+							if truncated {
+								logger.Get().Warn().
+									Str("function", name).
+									Msg("Tool call arguments are incomplete JSON; flagging the call")
+								chunkIn <- openai.StreamChunk{
+									Type: "tool_code",
+									Data: map[string]interface{}{"name": name, "incomplete": true},
+								}
+								continue
 							}
+							args = map[string]interface{}{}
+							source = "default_empty"
+						}
 
-							// Log tool call inputs (preview at INFO, full JSON at DEBUG)
+						// Log tool call inputs (preview at INFO, full JSON at DEBUG)
+						if opts.logContent {
 							argsJSON, _ := json.Marshal(args)
 							argsPreview := string(argsJSON)
 							if len(argsPreview) > 300 {
 								argsPreview = argsPreview[:300] + "..."
 							}
-							logger.Get().Info().
+							log.Info().
 								Str("function", name).
 								Int("arg_keys", len(args)).
 								Str("args_preview", argsPreview).
@@ -348,135 +514,198 @@ func (s *Server) chatCompletionRequestStream(w http.ResponseWriter, r *http.Requ
 								RawJSON("args", argsJSON).
 								Str("args_source", source).
 								Msg("Tool call full args")
+						}
 
-							logger.Get().Info().
-								Str("function", name).
-								Str("args_source", source).
-								Int("arg_keys", len(args)).
-								Msg("Emitting tool call from model")
-
-							// Emit tool call to OpenAI transformer
-							chunkIn <- openai.StreamChunk{
-								Type: "tool_code",
-								Data: map[string]interface{}{
-									"name": name,
-									"args": args,
-								},
-							}
+						log.Info().
+							Str("function", name).
+							Str("args_source", source).
+							Int("arg_keys", len(args)).
+							Msg("Emitting tool call from model")
+
+						// Emit tool call to OpenAI transformer, carrying the thought
+						// signature so the client can echo it on the next turn
+						toolData := map[string]interface{}{
+							"name": name,
+							"args": args,
+						}
+						if sig, ok := part["thoughtSignature"].(string); ok && sig != "" {
+							toolData["thoughtSignature"] = sig
+						}
+						chunkIn <- openai.StreamChunk{
+							Type: "tool_code",
+							Data: toolData,
 						}
 					}
 				}
 			}
 		}
-	}()
+	}
+}
 
-	// Transform chunks into OpenAI-compatible SSE and stream to client
-	transformer := openai.CreateOpenAIStreamTransformer(req.Model)
-	out := transformer(chunkIn)
+// candidatesToChoices maps each Gemini candidate to an OpenAI choice. The choice index is
+// the candidate's own index when present, else its position. Always returns at least one
+// choice so clients get a well-formed response.
+func candidatesToChoices(resp *antigravity.GenerateContentResponse) []map[string]interface{} {
+	var cands []interface{}
+	if resp != nil && resp.Response != nil {
+		cands, _ = resp.Response["candidates"].([]interface{})
+	}
 
-	firstWrite := true
-	for sse := range out {
-		if _, err := io.WriteString(w, sse); err != nil {
-			logger.Get().Error().Err(err).Msg("Error writing SSE to client")
-			return
+	choices := make([]map[string]interface{}, 0, len(cands))
+	for i, c := range cands {
+		cand, ok := c.(map[string]interface{})
+		if !ok {
+			continue
 		}
-		if firstWrite {
-			logger.Get().Info().
-				Dur("time_to_first_client_write", time.Since(startTime)).
-				Msg("First OpenAI SSE chunk written to client")
-			firstWrite = false
+		index := i
+		if v, ok := cand["index"].(float64); ok {
+			index = int(v)
 		}
-		if flusher != nil {
-			flusher.Flush()
+
+		// parts may be under content.parts or parts
+		var parts []interface{}
+		if content, ok := cand["content"].(map[string]interface{}); ok {
+			if ps, ok := content["parts"].([]interface{}); ok {
+				parts = ps
+			}
+		}
+		if len(parts) == 0 {
+			if ps, ok := cand["parts"].([]interface{}); ok {
+				parts = ps
+			}
 		}
+
+		choices = append(choices, map[string]interface{}{
+			"index": index,
+			"message": map[string]interface{}{
+				"role":    "assistant",
+				"content": partsToMessageContent(parts),
+			},
+			"finish_reason": "stop",
+		})
 	}
 
-	logger.Get().Info().
-		Str("model", gemReq.Model).
-		Dur("total_duration", time.Since(startTime)).
-		Msg("OpenAI streaming response completed")
+	if len(choices) == 0 {
+		choices = append(choices, map[string]interface{}{
+			"index": 0,
+			"message": map[string]interface{}{
+				"role":    "assistant",
+				"content": "",
+			},
+			"finish_reason": "stop",
+		})
+	}
+	return choices
+}
+
+// partsToMessageContent joins the text parts of a candidate with newlines. When the model
+// returned images as inlineData parts, the content is instead a list of text and
+// image_url parts (base64 data URLs), in the order upstream sent them.
+func partsToMessageContent(parts []interface{}) interface{} {
+	var content []openai.ContentPart
+	var b strings.Builder
+	hasImage := false
+	flushText := func() {
+		if b.Len() > 0 {
+			content = append(content, openai.ContentPart{Type: "text", Text: b.String()})
+			b.Reset()
+		}
+	}
+	for _, p := range parts {
+		pm, ok := p.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if txt, ok := pm["text"].(string); ok && txt != "" {
+			if b.Len() > 0 {
+				b.WriteString("\n")
+			}
+			b.WriteString(txt)
+			continue
+		}
+		inline, ok := pm["inlineData"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		mimeType, _ := inline["mimeType"].(string)
+		data, _ := inline["data"].(string)
+		if data == "" || !strings.HasPrefix(mimeType, "image/") {
+			continue
+		}
+		flushText()
+		hasImage = true
+		content = append(content, openai.ContentPart{
+			Type:     "image_url",
+			ImageURL: &openai.ImageURL{URL: "data:" + mimeType + ";base64," + data},
+		})
+	}
+	if !hasImage {
+		return trimResponseText(b.String())
+	}
+	flushText()
+	return content
 }
 
 // chatCompletionRequest handles the non-streaming variant via GenerateContent and returns OpenAI-style JSON.
 func (s *Server) chatCompletionRequest(w http.ResponseWriter, r *http.Request, req openai.ChatCompletionRequest, startTime time.Time) {
+	client, projectID, ok := s.resolveAccount(w, r)
+	if !ok {
+		return
+	}
 	// Transform OpenAI -> Gemini
-	gemReq, err := transform.ToGeminiRequest(&req, s.projectID)
+	rec := timing.FromContext(r.Context())
+	warns := warnings.FromContext(r.Context())
+	transformStart := time.Now()
+	gemReq, err := transform.ToGeminiRequestWithWarnings(r.Context(), &req, projectID, warns)
 	if err != nil {
-		logger.Get().Error().Err(err).Msg("Failed to transform OpenAI request to Gemini request")
-		http.Error(w, "Failed to transform request", http.StatusInternalServerError)
+		writeTransformError(w, err)
 		return
 	}
+	applySessionHeader(r, gemReq)
+	rec.Since(timing.PhaseTransform, timing.PhaseTransformDesc, transformStart)
 
 	// Normalize model name
 	normalizedModelName := normalizeModelName(gemReq.Model)
 	originalModel := gemReq.Model
 	gemReq.Model = normalizedModelName
 	if gemReq.Model != originalModel {
-		logger.Get().Info().
+		logger.Sampled(r.Context()).Info().
 			Str("original_model", originalModel).
 			Str("normalized_model", normalizedModelName).
 			Msg("Normalized model for CloudCode")
+		warns.Addf("model %q sent to CloudCode as %q", originalModel, normalizedModelName)
+	}
+
+	if writeDryRun(w, r, gemReq) {
+		return
 	}
 
 	// Call non-streaming GenerateContent
 	apiStart := time.Now()
-	resp, err := s.antigravityClient.GenerateContent(gemReq)
+	stopUpstreamTiming := startUpstreamTiming(rec)
+	resp, err := client.GenerateContentWithFallback(r.Context(), gemReq)
+	stopUpstreamTiming()
 	if err != nil {
-		logger.Get().Error().Err(err).Dur("api_call_duration", time.Since(apiStart)).Msg("GenerateContent failed")
-		http.Error(w, "Error calling GenerateContent", http.StatusInternalServerError)
+		logger.Get().Error().Err(err).Int("upstream_status", upstreamStatus(err)).Dur("api_call_duration", time.Since(apiStart)).Msg("GenerateContent failed")
+		writeUpstreamError(w, err)
 		return
 	}
 
-	// Extract assistant text content from first candidate
-	var contentText string
-	if resp != nil && resp.Response != nil {
-		if cands, ok := resp.Response["candidates"].([]interface{}); ok && len(cands) > 0 {
-			if first, ok := cands[0].(map[string]interface{}); ok {
-				// parts may be under content.parts or parts
-				var parts []interface{}
-				if c, ok := first["content"].(map[string]interface{}); ok {
-					if ps, ok := c["parts"].([]interface{}); ok {
-						parts = ps
-					}
-				}
-				if len(parts) == 0 {
-					if ps, ok := first["parts"].([]interface{}); ok {
-						parts = ps
-					}
-				}
-				var b strings.Builder
-				for _, p := range parts {
-					if pm, ok := p.(map[string]interface{}); ok {
-						if txt, ok := pm["text"].(string); ok && txt != "" {
-							if b.Len() > 0 {
-								b.WriteString("\n")
-							}
-							b.WriteString(txt)
-						}
-					}
-				}
-				contentText = b.String()
-			}
-		}
-	}
-
-	// Build OpenAI-style response
+	// Build OpenAI-style response, one choice per candidate
+	responseStart := time.Now()
 	created := time.Now().Unix()
 	openAIResp := map[string]interface{}{
 		"id":      "chatcmpl",
 		"object":  "chat.completion",
 		"created": created,
 		"model":   req.Model,
-		"choices": []map[string]interface{}{
-			{
-				"index": 0,
-				"message": map[string]interface{}{
-					"role":    "assistant",
-					"content": contentText,
-				},
-				"finish_reason": "stop",
-			},
-		},
+		"choices": candidatesToChoices(resp),
+	}
+	if resp.Model != "" && resp.Model != gemReq.Model {
+		openAIResp["model"] = resp.Model
+	}
+	if warns != nil {
+		openAIResp["x_proxy_warnings"] = warns.List()
 	}
 
 	// Include usage if available
@@ -490,14 +719,24 @@ func (s *Server) chatCompletionRequest(w http.ResponseWriter, r *http.Request, r
 			if v, ok := um["candidatesTokenCount"].(float64); ok {
 				comp = int(v)
 			}
-			openAIResp["usage"] = map[string]interface{}{
+			usage := map[string]interface{}{
 				"prompt_tokens":     prompt,
 				"completion_tokens": comp,
 				"total_tokens":      prompt + comp,
 			}
+			promptDetails, completionDetails := openai.TokenDetailsFromUsageMetadata(um)
+			if promptDetails != nil {
+				usage["prompt_tokens_details"] = promptDetails
+			}
+			if completionDetails != nil {
+				usage["completion_tokens_details"] = completionDetails
+			}
+			openAIResp["usage"] = usage
 		}
 	}
 
+	rec.Since(timing.PhaseResponse, timing.PhaseResponseDesc, responseStart)
+
 	// Write response
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(openAIResp); err != nil {
@@ -505,9 +744,31 @@ func (s *Server) chatCompletionRequest(w http.ResponseWriter, r *http.Request, r
 		return
 	}
 
-	logger.Get().Info().
+	logger.Sampled(r.Context()).Info().
 		Str("model", gemReq.Model).
 		Dur("api_call_duration", time.Since(apiStart)).
 		Dur("total_duration", time.Since(startTime)).
 		Msg("OpenAI non-streaming response completed")
 }
+
+// writeTransformError responds to a request that failed conversion to Gemini. Requests
+// rejected by a configured limit get a 400; anything else is our fault.
+func writeTransformError(w http.ResponseWriter, err error) {
+	if errors.Is(err, transform.ErrToolSchemaTooLarge) {
+		logger.Get().Warn().Err(err).Msg("Rejected OpenAI request during transform")
+		writeAPIError(w, http.StatusBadRequest, "invalid_request_error", err.Error(), "tool_schema_too_large")
+		return
+	}
+	if errors.Is(err, transform.ErrToolNameCollision) {
+		logger.Get().Warn().Err(err).Msg("Rejected OpenAI request during transform")
+		writeAPIError(w, http.StatusBadRequest, "invalid_request_error", err.Error(), "tool_name_collision")
+		return
+	}
+	if errors.Is(err, transform.ErrFileMimeTypeUnknown) {
+		logger.Get().Warn().Err(err).Msg("Rejected OpenAI request during transform")
+		writeAPIError(w, http.StatusBadRequest, "invalid_request_error", err.Error(), "file_mime_type_unknown")
+		return
+	}
+	logger.Get().Error().Err(err).Msg("Failed to transform OpenAI request to Gemini request")
+	writeAPIError(w, http.StatusInternalServerError, "api_error", "Failed to transform request", "")
+}
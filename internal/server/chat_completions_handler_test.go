@@ -0,0 +1,430 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dvcrn/antigravity-proxy/internal/antigravity"
+	"github.com/dvcrn/antigravity-proxy/internal/logger"
+	"github.com/dvcrn/antigravity-proxy/internal/openai"
+	"github.com/rs/zerolog"
+)
+
+// runCannedStream pipes canned CloudCode SSE lines through the Gemini adapter and the
+// OpenAI stream transformer, returning the SSE events written to the client.
+func runCannedStream(t *testing.T, lines []string, opts openai.StreamTransformerOptions) []string {
+	t.Helper()
+
+	upstream := make(chan string, len(lines))
+	for _, l := range lines {
+		upstream <- l
+	}
+	close(upstream)
+
+	chunkIn := make(chan openai.StreamChunk, 32)
+	go adaptGeminiStream(upstream, chunkIn, geminiStreamAdapterOptions{logContent: true})
+
+	var events []string
+	for sse := range openai.CreateOpenAIStreamTransformerWithOptions("gemini-3-flash", opts)(chunkIn) {
+		events = append(events, sse)
+	}
+	return events
+}
+
+var cannedUsageStream = []string{
+	`data: {"response":{"candidates":[{"content":{"role":"model","parts":[{"text":"Hello"}]}}]}}`,
+	``,
+	`data: {"response":{"candidates":[{"content":{"role":"model","parts":[{"text":" there"}]},"finishReason":"STOP"}],"usageMetadata":{"promptTokenCount":12,"candidatesTokenCount":3,"totalTokenCount":15}}}`,
+	``,
+}
+
+func TestStreamIncludeUsageEmitsTerminalUsageChunk(t *testing.T) {
+	events := runCannedStream(t, cannedUsageStream, openai.StreamTransformerOptions{IncludeUsage: true})
+	if len(events) < 3 {
+		t.Fatalf("expected at least 3 events, got %d: %v", len(events), events)
+	}
+
+	if events[len(events)-1] != "data: [DONE]\n\n" {
+		t.Fatalf("expected last event to be [DONE], got %q", events[len(events)-1])
+	}
+
+	usageEvent := strings.TrimSpace(strings.TrimPrefix(events[len(events)-2], "data: "))
+	var parsed struct {
+		Choices []interface{}       `json:"choices"`
+		Usage   *openai.OpenAIUsage `json:"usage"`
+	}
+	if err := json.Unmarshal([]byte(usageEvent), &parsed); err != nil {
+		t.Fatalf("failed to parse usage chunk: %v", err)
+	}
+	if parsed.Choices == nil || len(parsed.Choices) != 0 {
+		t.Errorf("expected empty choices array in usage chunk, got %v", parsed.Choices)
+	}
+	if parsed.Usage == nil {
+		t.Fatal("expected usage in terminal chunk")
+	}
+	if parsed.Usage.PromptTokens != 12 || parsed.Usage.CompletionTokens != 3 || parsed.Usage.TotalTokens != 15 {
+		t.Errorf("unexpected usage: %+v", *parsed.Usage)
+	}
+
+	for _, e := range events[:len(events)-2] {
+		if strings.Contains(e, `"usage":{`) {
+			t.Errorf("expected usage only on the terminal chunk, got it on %q", e)
+		}
+	}
+}
+
+func TestStreamWithoutIncludeUsageOmitsUsageChunk(t *testing.T) {
+	events := runCannedStream(t, cannedUsageStream, openai.StreamTransformerOptions{})
+
+	for _, e := range events {
+		if strings.Contains(e, `"choices":[]`) {
+			t.Errorf("did not expect a usage-only chunk without include_usage, got %q", e)
+		}
+	}
+}
+
+func TestStreamTruncatedToolCallArgsFlagged(t *testing.T) {
+	events := runCannedStream(t, []string{
+		`data: {"response":{"candidates":[{"content":{"role":"model","parts":[{"functionCall":{"name":"read_file","argsJson":"{\"path\": \"a."}}]}}]}}`,
+		``,
+	}, openai.StreamTransformerOptions{DisableContentLogging: true})
+
+	flagged := false
+	for _, event := range events {
+		data := strings.TrimSpace(strings.TrimPrefix(event, "data: "))
+		if data == "[DONE]" {
+			continue
+		}
+		if !json.Valid([]byte(data)) {
+			t.Errorf("event is not valid JSON: %q", data)
+		}
+		if strings.Contains(data, `"tool_calls"`) {
+			t.Errorf("truncated tool call must not be forwarded, got %q", data)
+		}
+		if strings.Contains(data, `"INCOMPLETE_TOOL_CALL"`) {
+			flagged = true
+		}
+	}
+	if !flagged {
+		t.Errorf("expected the truncated tool call to be flagged, got %v", events)
+	}
+}
+
+func TestStreamSummaryLogged(t *testing.T) {
+	var buf bytes.Buffer
+	original := *logger.Get()
+	*logger.Get() = zerolog.New(&buf)
+	defer func() { *logger.Get() = original }()
+
+	runCannedStream(t, cannedUsageStream, openai.StreamTransformerOptions{})
+
+	var summary map[string]interface{}
+	for _, line := range strings.Split(buf.String(), "\n") {
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &entry); err == nil && entry["message"] == "Stream summary" {
+			summary = entry
+		}
+	}
+	if summary == nil {
+		t.Fatalf("expected a stream summary log line, got logs:\n%s", buf.String())
+	}
+
+	for _, field := range []string{"total_duration", "time_to_first_token", "total_tokens", "tokens_per_sec"} {
+		if _, ok := summary[field]; !ok {
+			t.Errorf("expected summary field %q, got %v", field, summary)
+		}
+	}
+	if got := summary["total_tokens"]; got != float64(15) {
+		t.Errorf("total_tokens = %v, want 15", got)
+	}
+	if got := summary["output_tokens"]; got != float64(3) {
+		t.Errorf("output_tokens = %v, want 3", got)
+	}
+}
+
+func TestCandidatesToChoices(t *testing.T) {
+	var resp antigravity.GenerateContentResponse
+	raw := `{"response":{"candidates":[
+		{"index":0,"content":{"role":"model","parts":[{"text":"first"}]}},
+		{"index":1,"content":{"role":"model","parts":[{"text":"second"}]}},
+		{"index":2,"content":{"role":"model","parts":[{"text":"third"}]}}
+	]}}`
+	if err := json.Unmarshal([]byte(raw), &resp); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+
+	choices := candidatesToChoices(&resp)
+	if len(choices) != 3 {
+		t.Fatalf("expected 3 choices, got %d", len(choices))
+	}
+	for i, want := range []string{"first", "second", "third"} {
+		if choices[i]["index"] != i {
+			t.Errorf("choice %d index = %v", i, choices[i]["index"])
+		}
+		msg := choices[i]["message"].(map[string]interface{})
+		if msg["content"] != want {
+			t.Errorf("choice %d content = %v, want %q", i, msg["content"], want)
+		}
+	}
+}
+
+func TestCandidatesToChoicesInlineImage(t *testing.T) {
+	var resp antigravity.GenerateContentResponse
+	raw := `{"response":{"candidates":[{"content":{"role":"model","parts":[
+		{"text":"Here is your image"},
+		{"inlineData":{"mimeType":"image/png","data":"iVBORw0KGgo="}},
+		{"text":"Enjoy"}
+	]}}]}}`
+	if err := json.Unmarshal([]byte(raw), &resp); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+
+	choices := candidatesToChoices(&resp)
+	msg := choices[0]["message"].(map[string]interface{})
+	out, err := json.Marshal(msg["content"])
+	if err != nil {
+		t.Fatalf("failed to marshal content: %v", err)
+	}
+	want := `[{"type":"text","text":"Here is your image"},{"type":"image_url","image_url":{"url":"data:image/png;base64,iVBORw0KGgo="}},{"type":"text","text":"Enjoy"}]`
+	if string(out) != want {
+		t.Errorf("content = %s, want %s", out, want)
+	}
+}
+
+func TestStreamWithMultipleCandidatesRejected(t *testing.T) {
+	s := &Server{}
+	body := `{"model":"gemini-3-flash","messages":[{"role":"user","content":"hi"}],"n":2,"stream":true}`
+	rr := httptest.NewRecorder()
+	s.openAIChatCompletionsHandler(rr, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body)))
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", rr.Code)
+	}
+}
+
+func TestNonStreamingResponseIncludesProxyWarnings(t *testing.T) {
+	t.Setenv("PROXY_WARNINGS", "true")
+	t.Setenv("DEFAULT_MODEL", "gemini-3-flash")
+
+	s := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"response":{"candidates":[{"content":{"role":"model","parts":[{"text":"ok"}]}}]}}`))
+	}))
+
+	// No model and a tool without parameters: both get defaulted
+	body := `{"messages":[{"role":"user","content":"hi"}],"tools":[{"type":"function","function":{"name":"ping"}}]}`
+	rr := httptest.NewRecorder()
+	s.openAIChatCompletionsHandler(rr, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rr.Code, rr.Body.String())
+	}
+
+	var resp struct {
+		Warnings []string `json:"x_proxy_warnings"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+
+	joined := strings.Join(resp.Warnings, "\n")
+	for _, want := range []string{"DEFAULT_MODEL", "defaulted missing parameters schema for 1 tools: ping"} {
+		if !strings.Contains(joined, want) {
+			t.Errorf("expected a warning containing %q, got %v", want, resp.Warnings)
+		}
+	}
+}
+
+func TestNonStreamingResponseOmitsProxyWarningsByDefault(t *testing.T) {
+	t.Setenv("PROXY_WARNINGS", "")
+
+	s := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"response":{"candidates":[{"content":{"role":"model","parts":[{"text":"ok"}]}}]}}`))
+	}))
+
+	body := `{"model":"gemini-3-flash","messages":[{"role":"user","content":"hi"}]}`
+	rr := httptest.NewRecorder()
+	s.openAIChatCompletionsHandler(rr, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body)))
+
+	if strings.Contains(rr.Body.String(), "x_proxy_warnings") {
+		t.Errorf("expected no x_proxy_warnings field, got %s", rr.Body.String())
+	}
+}
+
+func TestStrictRequestDecoding(t *testing.T) {
+	const (
+		openAIPath = "/v1/chat/completions"
+		geminiPath = "/v1beta/models/gemini-3-flash:generateContent"
+	)
+	testCases := []struct {
+		name        string
+		strict      string
+		path        string
+		body        string
+		expectCode  int
+		expectField string
+	}{
+		{
+			name:        "openai strict rejects unknown field",
+			strict:      "true",
+			path:        openAIPath,
+			body:        `{"model":"gemini-3-flash","messages":[{"role":"user","content":"hi"}],"temprature":0.2}`,
+			expectCode:  http.StatusBadRequest,
+			expectField: "temprature",
+		},
+		{
+			name:       "openai lenient ignores unknown field",
+			path:       openAIPath,
+			body:       `{"model":"gemini-3-flash","messages":[{"role":"user","content":"hi"}],"temprature":0.2}`,
+			expectCode: http.StatusOK,
+		},
+		{
+			name:   "openai strict accepts standard sdk fields",
+			strict: "true",
+			path:   openAIPath,
+			body: `{"model":"gemini-3-flash","messages":[{"role":"user","content":"hi"},{"role":"assistant","content":"hello","refusal":null}],` +
+				`"top_p":0.9,"max_completion_tokens":100,"parallel_tool_calls":true,"response_format":{"type":"text"},` +
+				`"logprobs":false,"metadata":{"k":"v"},"reasoning_effort":"low","service_tier":"auto",` +
+				`"tools":[{"type":"function","function":{"name":"f","parameters":{"type":"object"},"strict":true}}]}`,
+			expectCode: http.StatusOK,
+		},
+		{
+			name:        "gemini strict rejects unknown field",
+			strict:      "true",
+			path:        geminiPath,
+			body:        `{"contents":[{"role":"user","parts":[{"text":"hi"}]}],"generationConfg":{"temperature":0.2}}`,
+			expectCode:  http.StatusBadRequest,
+			expectField: "generationConfg",
+		},
+		{
+			name:        "gemini strict rejects unknown nested field",
+			strict:      "true",
+			path:        geminiPath,
+			body:        `{"contents":[{"role":"user","parts":[{"txt":"hi"}]}]}`,
+			expectCode:  http.StatusBadRequest,
+			expectField: "txt",
+		},
+		{
+			name:       "gemini lenient ignores unknown field",
+			path:       geminiPath,
+			body:       `{"contents":[{"role":"user","parts":[{"text":"hi"}]}],"generationConfg":{"temperature":0.2}}`,
+			expectCode: http.StatusOK,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("STRICT_REQUEST_DECODING", tc.strict)
+
+			s := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write([]byte(`{"response":{"candidates":[{"content":{"role":"model","parts":[{"text":"ok"}]}}]}}`))
+			}))
+
+			rr := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, tc.path, strings.NewReader(tc.body))
+			if tc.path == openAIPath {
+				s.openAIChatCompletionsHandler(rr, req)
+			} else {
+				s.streamGenerateContentHandler(rr, req)
+			}
+
+			if rr.Code != tc.expectCode {
+				t.Fatalf("status = %d, want %d (body = %s)", rr.Code, tc.expectCode, rr.Body.String())
+			}
+			if tc.expectField != "" && !strings.Contains(rr.Body.String(), tc.expectField) {
+				t.Errorf("expected error to name the unknown field, got %s", rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestUsageTokenDetails(t *testing.T) {
+	const usageMetadata = `{"promptTokenCount":120,"candidatesTokenCount":30,"cachedContentTokenCount":100,"thoughtsTokenCount":25,"totalTokenCount":175}`
+
+	assertDetails := func(t *testing.T, usage *openai.Usage) {
+		t.Helper()
+		if usage.PromptTokensDetails == nil || usage.PromptTokensDetails.CachedTokens != 100 {
+			t.Errorf("expected prompt_tokens_details.cached_tokens = 100, got %+v", usage.PromptTokensDetails)
+		}
+		if usage.CompletionTokensDetails == nil || usage.CompletionTokensDetails.ReasoningTokens != 25 {
+			t.Errorf("expected completion_tokens_details.reasoning_tokens = 25, got %+v", usage.CompletionTokensDetails)
+		}
+	}
+
+	t.Run("streaming", func(t *testing.T) {
+		events := runCannedStream(t, []string{
+			`data: {"response":{"candidates":[{"content":{"role":"model","parts":[{"text":"Hi"}]},"finishReason":"STOP"}],"usageMetadata":` + usageMetadata + `}}`,
+		}, openai.StreamTransformerOptions{IncludeUsage: true})
+		if len(events) < 2 {
+			t.Fatalf("expected a usage chunk, got %v", events)
+		}
+
+		var parsed struct {
+			Usage *openai.Usage `json:"usage"`
+		}
+		if err := json.Unmarshal([]byte(strings.TrimSpace(strings.TrimPrefix(events[len(events)-2], "data: "))), &parsed); err != nil {
+			t.Fatalf("failed to parse usage chunk: %v", err)
+		}
+		if parsed.Usage == nil {
+			t.Fatal("expected usage in terminal chunk")
+		}
+		assertDetails(t, parsed.Usage)
+	})
+
+	t.Run("non-streaming", func(t *testing.T) {
+		s := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(`{"response":{"candidates":[{"content":{"role":"model","parts":[{"text":"Hi"}]}}],"usageMetadata":` + usageMetadata + `}}`))
+		}))
+
+		body := `{"model":"gemini-3-flash","messages":[{"role":"user","content":"hi"}]}`
+		rr := httptest.NewRecorder()
+		s.openAIChatCompletionsHandler(rr, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body)))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("status = %d, body = %s", rr.Code, rr.Body.String())
+		}
+
+		var parsed struct {
+			Usage openai.Usage `json:"usage"`
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &parsed); err != nil {
+			t.Fatalf("failed to parse response: %v", err)
+		}
+		assertDetails(t, &parsed.Usage)
+	})
+}
+
+func TestStoreFalseKeepsRequestContentOutOfUpstreamErrorLogs(t *testing.T) {
+	s := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"error":{"code":400,"message":"bad request","status":"INVALID_ARGUMENT"}}`))
+	}))
+
+	for _, tc := range []struct {
+		store       string
+		wantContent bool
+	}{
+		{store: "true", wantContent: true},
+		{store: "false", wantContent: false},
+	} {
+		t.Run("store="+tc.store, func(t *testing.T) {
+			var buf bytes.Buffer
+			original := *logger.Get()
+			*logger.Get() = zerolog.New(&buf)
+			defer func() { *logger.Get() = original }()
+
+			body := `{"model":"gemini-3-flash","stream":true,"store":` + tc.store + `,"messages":[{"role":"user","content":"top secret transcript"}]}`
+			rr := httptest.NewRecorder()
+			s.openAIChatCompletionsHandler(rr, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body)))
+
+			if !strings.Contains(buf.String(), "Upstream error on streamGenerateContent") {
+				t.Fatalf("expected the upstream error to be logged, got:\n%s", buf.String())
+			}
+			if got := strings.Contains(buf.String(), "top secret transcript"); got != tc.wantContent {
+				t.Errorf("request content in logs = %v, want %v:\n%s", got, tc.wantContent, buf.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/dvcrn/antigravity-proxy/internal/env"
+)
+
+// Defaults for the preflight response when CORS_ALLOW_METHODS and CORS_ALLOW_HEADERS
+// are unset. The headers cover auth, account and session selection, and stream resumption.
+const (
+	defaultCORSAllowMethods = "GET, POST, OPTIONS"
+	defaultCORSAllowHeaders = "Authorization, Content-Type, X-Goog-Api-Key, X-Antigravity-Account, X-Antigravity-Project, X-Session-Id, Last-Event-ID"
+)
+
+// corsMiddleware adds Access-Control-* headers for browser clients whose Origin is in
+// CORS_ALLOW_ORIGINS (comma-separated, or "*" for any origin) and answers their
+// preflight OPTIONS requests with a 204. Preflights are answered before API-key auth,
+// since browsers send them without credentials. Disabled unless CORS_ALLOW_ORIGINS is set.
+func corsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origins := corsOrigins()
+		if len(origins) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		origin := r.Header.Get("Origin")
+		allowed, ok := allowedOrigin(origins, origin)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		h := w.Header()
+		h.Add("Vary", "Origin")
+		h.Set("Access-Control-Allow-Origin", allowed)
+
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			h.Add("Vary", "Access-Control-Request-Method")
+			h.Add("Vary", "Access-Control-Request-Headers")
+			h.Set("Access-Control-Allow-Methods", env.GetOrDefault("CORS_ALLOW_METHODS", defaultCORSAllowMethods))
+			h.Set("Access-Control-Allow-Headers", env.GetOrDefault("CORS_ALLOW_HEADERS", defaultCORSAllowHeaders))
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// allowedOrigin returns the Access-Control-Allow-Origin value for origin: "*" when any
+// origin is allowed, the origin itself when it is listed, and false otherwise.
+func allowedOrigin(origins []string, origin string) (string, bool) {
+	if origin == "" {
+		return "", false
+	}
+	for _, o := range origins {
+		if o == "*" {
+			return "*", true
+		}
+		if strings.EqualFold(strings.TrimSuffix(o, "/"), origin) {
+			return origin, true
+		}
+	}
+	return "", false
+}
+
+// corsOrigins returns the configured CORS_ALLOW_ORIGINS, or nil when CORS is disabled.
+func corsOrigins() []string {
+	var origins []string
+	for _, origin := range strings.Split(env.GetOrDefault("CORS_ALLOW_ORIGINS", ""), ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+	return origins
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCORSMiddleware(t *testing.T) {
+	// Requests go through the full middleware chain; unknown paths answer 404 once
+	// they get past auth.
+	s := NewServer(&fakeProvider{name: "default"}, "test-project")
+
+	testCases := []struct {
+		name          string
+		origins       string
+		method        string
+		origin        string
+		preflight     bool
+		expectCode    int
+		expectOrigin  string
+		expectMethods string
+	}{
+		{name: "disabled by default", method: http.MethodGet, origin: "https://app.example", expectCode: http.StatusNotFound},
+		{
+			name: "preflight", origins: "https://app.example", method: http.MethodOptions, origin: "https://app.example", preflight: true,
+			expectCode: http.StatusNoContent, expectOrigin: "https://app.example", expectMethods: defaultCORSAllowMethods,
+		},
+		{
+			name: "actual request", origins: "https://other.example, https://app.example", method: http.MethodPost, origin: "https://app.example",
+			expectCode: http.StatusNotFound, expectOrigin: "https://app.example",
+		},
+		{name: "wildcard", origins: "*", method: http.MethodGet, origin: "https://app.example", expectCode: http.StatusNotFound, expectOrigin: "*"},
+		{name: "origin not allowed", origins: "https://app.example", method: http.MethodGet, origin: "https://evil.example", expectCode: http.StatusNotFound},
+		{
+			name: "preflight from disallowed origin reaches auth", origins: "https://app.example", method: http.MethodOptions, origin: "https://evil.example", preflight: true,
+			expectCode: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("CORS_ALLOW_ORIGINS", tc.origins)
+			t.Setenv("PROXY_API_KEYS", "k1")
+
+			req := httptest.NewRequest(tc.method, "/v1/unknown", nil)
+			req.Header.Set("Origin", tc.origin)
+			if tc.preflight {
+				req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+			} else {
+				req.Header.Set("Authorization", "Bearer k1")
+			}
+			rr := httptest.NewRecorder()
+			s.ServeHTTP(rr, req)
+
+			if rr.Code != tc.expectCode {
+				t.Errorf("status = %d, want %d", rr.Code, tc.expectCode)
+			}
+			if got := rr.Header().Get("Access-Control-Allow-Origin"); got != tc.expectOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tc.expectOrigin)
+			}
+			if got := rr.Header().Get("Access-Control-Allow-Methods"); got != tc.expectMethods {
+				t.Errorf("Access-Control-Allow-Methods = %q, want %q", got, tc.expectMethods)
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/dvcrn/antigravity-proxy/internal/antigravity"
+	"github.com/dvcrn/antigravity-proxy/internal/logger"
+)
+
+// dryRunHeader asks the proxy to return the request it would send upstream instead of sending it.
+const dryRunHeader = "X-Antigravity-Dry-Run"
+
+// writeDryRun answers a request carrying 'X-Antigravity-Dry-Run: true' with the final
+// JSON body that would be POSTed to CloudCode for req, after the same preparation the
+// client applies, and reports true. Nothing is sent upstream.
+func writeDryRun(w http.ResponseWriter, r *http.Request, req *antigravity.GenerateContentRequest) bool {
+	if !strings.EqualFold(strings.TrimSpace(r.Header.Get(dryRunHeader)), "true") {
+		return false
+	}
+
+	body, err := antigravity.RequestBody(r.Context(), req)
+	if err != nil {
+		logger.Get().Error().Err(err).Msg("Failed to build dry-run request body")
+		writeAPIError(w, http.StatusInternalServerError, "api_error", "Failed to build upstream request", "")
+		return true
+	}
+
+	logger.Sampled(r.Context()).Info().
+		Str("model", req.Model).
+		Int("body_size", len(body)).
+		Msg("Dry run; returning upstream request without sending it")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(append(body, '\n'))
+	return true
+}
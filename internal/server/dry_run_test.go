@@ -0,0 +1,73 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/dvcrn/antigravity-proxy/internal/antigravity"
+)
+
+func TestDryRunReturnsUpstreamRequest(t *testing.T) {
+	var calls atomic.Int32
+	s := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+
+	testCases := []struct {
+		name    string
+		path    string
+		body    string
+		handler http.HandlerFunc
+	}{
+		{
+			name:    "chat completion",
+			path:    "/v1/chat/completions",
+			body:    `{"model":"gemini-3-flash","messages":[{"role":"user","content":"hi"}],"tools":[{"type":"function","function":{"name":"read","parameters":{"type":"object"}}}]}`,
+			handler: s.openAIChatCompletionsHandler,
+		},
+		{
+			name:    "streaming chat completion",
+			path:    "/v1/chat/completions",
+			body:    `{"model":"gemini-3-flash","stream":true,"messages":[{"role":"user","content":"hi"}],"tools":[{"type":"function","function":{"name":"read","parameters":{"type":"object"}}}]}`,
+			handler: s.openAIChatCompletionsHandler,
+		},
+		{
+			name:    "gemini generateContent",
+			path:    "/v1beta/models/gemini-3-flash:generateContent",
+			body:    `{"contents":[{"role":"user","parts":[{"text":"hi"}]}],"tools":[{"functionDeclarations":[{"name":"read"}]}]}`,
+			handler: s.streamGenerateContentHandler,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tc.path, strings.NewReader(tc.body))
+			req.Header.Set(dryRunHeader, "true")
+			rr := httptest.NewRecorder()
+			tc.handler(rr, req)
+
+			if rr.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200: %s", rr.Code, rr.Body.String())
+			}
+			var got antigravity.GenerateContentRequest
+			if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+				t.Fatalf("response is not a CloudCode request: %v: %s", err, rr.Body.String())
+			}
+			if got.Project != "test-project" || got.Model != "gemini-3-flash" || got.RequestID == "" {
+				t.Errorf("unexpected envelope: %+v", got)
+			}
+			if len(got.Request.Tools) != 1 || len(got.Request.Tools[0].FunctionDeclarations) != 1 {
+				t.Errorf("expected the read tool in the request, got %+v", got.Request.Tools)
+			}
+		})
+	}
+
+	if n := calls.Load(); n != 0 {
+		t.Errorf("upstream calls = %d, want 0", n)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"regexp"
 	"strings"
 
+	"github.com/dvcrn/antigravity-proxy/internal/antigravity"
 	"github.com/dvcrn/antigravity-proxy/internal/env"
 	"github.com/dvcrn/antigravity-proxy/internal/logger"
 )
@@ -27,21 +28,48 @@ func normalizeModelName(model string) string {
 	return model
 }
 
+// defaultResponseWrapperKeys are the fields CloudCode wraps the Gemini response in.
+const defaultResponseWrapperKeys = "response"
+
+// responseWrapperKeys returns the wrapper fields to unwrap, in order of preference, from
+// CLOUDCODE_RESPONSE_WRAPPER_KEYS (comma-separated, default "response").
+func responseWrapperKeys() []string {
+	var keys []string
+	for _, key := range strings.Split(env.GetOrDefault("CLOUDCODE_RESPONSE_WRAPPER_KEYS", defaultResponseWrapperKeys), ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
 // unwrapCloudCodeResponse extracts the standard Gemini response from CloudCode's wrapped format
-// CloudCode wraps responses in a "response" field which needs to be unwrapped
+// CloudCode wraps responses in a "response" field which needs to be unwrapped.
+// The daily endpoint has been seen to double-wrap the payload or send "response" as an
+// encoded JSON string; both are unwrapped to the same shape as prod. Responses that already
+// carry top-level candidates are not unwrapped.
 func unwrapCloudCodeResponse(cloudCodeResp map[string]interface{}) map[string]interface{} {
-	// If there's no "response" field, return as-is
-	response, ok := cloudCodeResp["response"].(map[string]interface{})
+	if _, ok := cloudCodeResp["candidates"]; ok {
+		return cloudCodeResp
+	}
+
+	// If there's no wrapper field, return as-is
+	wrapperKey, response, ok := cloudCodeResponseField(cloudCodeResp)
 	if !ok {
 		return cloudCodeResp
 	}
 
+	// Unwrap any further nesting before merging
+	if _, _, nested := cloudCodeResponseField(response); nested {
+		response = unwrapCloudCodeResponse(response)
+	}
+
 	// Build the standard Gemini response by merging fields
 	geminiResp := make(map[string]interface{})
 
-	// Copy top-level fields first (except "response")
+	// Copy top-level fields first (except the wrapper)
 	for k, v := range cloudCodeResp {
-		if k != "response" {
+		if k != wrapperKey {
 			geminiResp[k] = v
 		}
 	}
@@ -55,13 +83,31 @@ func unwrapCloudCodeResponse(cloudCodeResp map[string]interface{}) map[string]in
 	return geminiResp
 }
 
-// TransformSSELine transforms a CloudCode SSE data line to standard Gemini format
+// cloudCodeResponseField returns the first wrapper field present (see responseWrapperKeys)
+// and its value as an object, decoding it if it was sent as a JSON string.
+func cloudCodeResponseField(resp map[string]interface{}) (string, map[string]interface{}, bool) {
+	for _, key := range responseWrapperKeys() {
+		switch v := resp[key].(type) {
+		case map[string]interface{}:
+			return key, v, true
+		case string:
+			var decoded map[string]interface{}
+			if err := json.Unmarshal([]byte(v), &decoded); err == nil {
+				return key, decoded, true
+			}
+		}
+	}
+	return "", nil, false
+}
+
+// TransformSSELine transforms a CloudCode SSE data line to standard Gemini format.
+// Other lines, and data that isn't JSON such as the [DONE] sentinel, are returned unchanged.
 func TransformSSELine(line string) string {
-	if !strings.HasPrefix(line, "data: ") {
+	if !strings.HasPrefix(line, "data:") {
 		return line
 	}
 
-	jsonData := strings.TrimPrefix(line, "data: ")
+	jsonData := antigravity.SSEFieldValue(line, "data:")
 
 	// Parse the JSON
 	var cloudCodeResp map[string]interface{}
@@ -1,6 +1,9 @@
 package server
 
-import "testing"
+import (
+	"encoding/json"
+	"testing"
+)
 
 func TestNormalizeModelName(t *testing.T) {
 	testCases := []struct {
@@ -59,3 +62,62 @@ func TestNormalizeModelName(t *testing.T) {
 		})
 	}
 }
+
+func TestUnwrapCloudCodeResponseShapes(t *testing.T) {
+	testCases := []struct {
+		name        string
+		wrapperKeys string
+		raw         string
+	}{
+		{
+			name: "prod shape",
+			raw:  `{"response":{"candidates":[{"content":{"role":"model","parts":[{"text":"hi"}]}}],"usageMetadata":{"totalTokenCount":3}},"traceId":"abc"}`,
+		},
+		{
+			name: "daily shape with experimental fields",
+			raw:  `{"response":{"candidates":[{"content":{"role":"model","parts":[{"text":"hi"}]},"experimentalScore":0.5}],"usageMetadata":{"totalTokenCount":3},"experimental":{"flag":true}},"traceId":"abc","metadata":{"build":"daily"}}`,
+		},
+		{
+			name: "daily shape double-wrapped",
+			raw:  `{"response":{"response":{"candidates":[{"content":{"role":"model","parts":[{"text":"hi"}]}}],"usageMetadata":{"totalTokenCount":3}}},"traceId":"abc"}`,
+		},
+		{
+			name: "wrapperless response",
+			raw:  `{"candidates":[{"content":{"role":"model","parts":[{"text":"hi"}]}}],"usageMetadata":{"totalTokenCount":3}}`,
+		},
+		{
+			name:        "alternate wrapper key",
+			wrapperKeys: "response,result",
+			raw:         `{"result":{"candidates":[{"content":{"role":"model","parts":[{"text":"hi"}]}}],"usageMetadata":{"totalTokenCount":3}},"traceId":"abc"}`,
+		},
+		{
+			name: "daily shape with string-encoded response",
+			raw:  `{"response":"{\"candidates\":[{\"content\":{\"role\":\"model\",\"parts\":[{\"text\":\"hi\"}]}}],\"usageMetadata\":{\"totalTokenCount\":3}}","traceId":"abc"}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("CLOUDCODE_RESPONSE_WRAPPER_KEYS", tc.wrapperKeys)
+
+			var cloudCodeResp map[string]interface{}
+			if err := json.Unmarshal([]byte(tc.raw), &cloudCodeResp); err != nil {
+				t.Fatalf("invalid fixture: %v", err)
+			}
+
+			geminiResp := unwrapCloudCodeResponse(cloudCodeResp)
+			for _, key := range []string{"response", "result"} {
+				if _, wrapped := geminiResp[key]; wrapped {
+					t.Errorf("expected %s wrapper to be removed, got %v", key, geminiResp)
+				}
+			}
+			cands, ok := geminiResp["candidates"].([]interface{})
+			if !ok || len(cands) != 1 {
+				t.Fatalf("expected one candidate, got %v", geminiResp["candidates"])
+			}
+			if _, ok := geminiResp["usageMetadata"].(map[string]interface{}); !ok {
+				t.Errorf("expected usageMetadata, got %v", geminiResp["usageMetadata"])
+			}
+		})
+	}
+}
@@ -11,6 +11,8 @@ import (
 func loggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
+		// One LOG_SAMPLE_RATE decision covers all of the request's sampled lines
+		r = r.WithContext(logger.WithRequestSampling(r.Context()))
 
 		// Log the request
 		logger.Get().Info().
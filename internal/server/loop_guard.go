@@ -0,0 +1,107 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dvcrn/antigravity-proxy/internal/logger"
+)
+
+// defaultLoopGuardWindow is how long after an identical request the next one still
+// counts as consecutive, when LOOP_GUARD_WINDOW is unset.
+const defaultLoopGuardWindow = time.Minute
+
+// loopGuard tracks the last request body per session to detect clients stuck sending
+// the same request in a loop. The zero value is ready to use.
+type loopGuard struct {
+	mu       sync.Mutex
+	sessions map[string]*loopGuardEntry
+}
+
+type loopGuardEntry struct {
+	hash  [sha256.Size]byte
+	count int
+	last  time.Time
+}
+
+// observe records a request and reports how many identical requests in a row the
+// session has sent, counting this one. Requests further apart than window restart the count.
+func (g *loopGuard) observe(session string, body []byte, window time.Duration, now time.Time) int {
+	hash := sha256.Sum256(body)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.sessions == nil {
+		g.sessions = make(map[string]*loopGuardEntry)
+	}
+	for key, entry := range g.sessions {
+		if now.Sub(entry.last) > window {
+			delete(g.sessions, key)
+		}
+	}
+
+	entry, ok := g.sessions[session]
+	if !ok || entry.hash != hash {
+		entry = &loopGuardEntry{hash: hash}
+		g.sessions[session] = entry
+	}
+	entry.count++
+	entry.last = now
+	return entry.count
+}
+
+// loopGuardMiddleware rejects requests with a 429 once a session has sent more than
+// LOOP_GUARD_THRESHOLD identical bodies in a row, each within LOOP_GUARD_WINDOW of the
+// previous one. Sessions are the X-Session-Id header, falling back to the client IP,
+// scoped to the account and path. Disabled unless LOOP_GUARD_THRESHOLD is set.
+func (s *Server) loopGuardMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		threshold := intFromEnv("LOOP_GUARD_THRESHOLD", 0)
+		if threshold == 0 || r.Method != http.MethodPost {
+			next(w, r)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			logger.Get().Error().Err(err).Msg("Failed to read request body")
+			writeAPIError(w, http.StatusBadRequest, "invalid_request_error", "Error reading request body", "")
+			return
+		}
+		r.Body.Close()
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		session := loopGuardSession(r)
+		window := durationFromEnv("LOOP_GUARD_WINDOW", defaultLoopGuardWindow)
+		if count := s.loops.observe(session, body, window, time.Now()); count > threshold {
+			logger.Get().Warn().
+				Str("session", session).
+				Int("identical_requests", count).
+				Int("threshold", threshold).
+				Msg("Rejecting repeated identical request, likely a client loop")
+			writeAPIError(w, http.StatusTooManyRequests, "rate_limit_error",
+				"The same request was sent repeatedly; the client is likely stuck in a loop", "request_loop_detected")
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// loopGuardSession identifies the client session a request belongs to.
+func loopGuardSession(r *http.Request) string {
+	session := strings.TrimSpace(r.Header.Get(sessionHeader))
+	if session == "" {
+		session = r.RemoteAddr
+		if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+			session = host
+		}
+	}
+	return strings.TrimSpace(r.Header.Get(accountHeader)) + "|" + r.URL.Path + "|" + session
+}
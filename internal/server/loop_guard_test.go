@@ -0,0 +1,89 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoopGuardMiddleware(t *testing.T) {
+	t.Setenv("LOOP_GUARD_THRESHOLD", "3")
+
+	s := &Server{}
+	var served []string
+	handler := s.loopGuardMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		served = append(served, string(body))
+	})
+	send := func(session, body string) int {
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+		req.Header.Set(sessionHeader, session)
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		return rr.Code
+	}
+
+	body := `{"model":"gemini-3-flash","messages":[{"role":"user","content":"hi"}]}`
+	for i := 1; i <= 3; i++ {
+		if code := send("agent", body); code != http.StatusOK {
+			t.Fatalf("request %d: status = %d, want 200", i, code)
+		}
+	}
+	if len(served) != 3 || served[0] != body {
+		t.Fatalf("expected 3 requests with the original body to reach the handler, got %q", served)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+	req.Header.Set(sessionHeader, "agent")
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want 429 after the threshold", rr.Code)
+	}
+	var resp apiErrorResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid error JSON: %v", err)
+	}
+	if resp.Error.Code != "request_loop_detected" {
+		t.Errorf("code = %q, want request_loop_detected", resp.Error.Code)
+	}
+
+	// Other sessions and a changed body are not affected
+	if code := send("other", body); code != http.StatusOK {
+		t.Errorf("other session: status = %d, want 200", code)
+	}
+	if code := send("agent", `{"messages":[{"role":"user","content":"something else"}]}`); code != http.StatusOK {
+		t.Errorf("changed body: status = %d, want 200", code)
+	}
+}
+
+func TestLoopGuardDisabledByDefault(t *testing.T) {
+	t.Setenv("LOOP_GUARD_THRESHOLD", "")
+
+	s := &Server{}
+	handler := s.loopGuardMiddleware(func(w http.ResponseWriter, r *http.Request) {})
+	for i := 0; i < 10; i++ {
+		rr := httptest.NewRecorder()
+		handler(rr, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{}`)))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("request %d: status = %d, want 200", i, rr.Code)
+		}
+	}
+}
+
+func TestLoopGuardWindowResetsCount(t *testing.T) {
+	var g loopGuard
+	now := time.Now()
+	for i := 1; i <= 2; i++ {
+		if got := g.observe("s", []byte("x"), defaultLoopGuardWindow, now); got != i {
+			t.Fatalf("count = %d, want %d", got, i)
+		}
+	}
+	if got := g.observe("s", []byte("x"), defaultLoopGuardWindow, now.Add(2*defaultLoopGuardWindow)); got != 1 {
+		t.Errorf("count after window = %d, want 1", got)
+	}
+}
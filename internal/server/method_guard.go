@@ -0,0 +1,32 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+)
+
+// allowMethods reports whether r uses one of methods. Otherwise it responds with an
+// OpenAI-style 405 whose Allow header lists methods, and the handler should return.
+func allowMethods(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	for _, m := range methods {
+		if r.Method == m {
+			return true
+		}
+	}
+	writeMethodNotAllowed(w, r, methods...)
+	return false
+}
+
+// writeMethodNotAllowed writes an OpenAI-style 405 listing the allowed methods in the
+// Allow header.
+func writeMethodNotAllowed(w http.ResponseWriter, r *http.Request, methods ...string) {
+	allow := strings.Join(methods, ", ")
+	w.Header().Set("Allow", allow)
+	writeAPIError(w, http.StatusMethodNotAllowed, "invalid_request_error",
+		"Method "+r.Method+" is not allowed on "+r.URL.Path+"; use "+allow, "method_not_allowed")
+}
+
+// notFoundHandler answers requests to unknown routes with an OpenAI-style 404.
+func notFoundHandler(w http.ResponseWriter, r *http.Request) {
+	writeAPIError(w, http.StatusNotFound, "invalid_request_error", "Unknown route "+r.URL.Path, "not_found")
+}
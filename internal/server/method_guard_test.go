@@ -0,0 +1,54 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMethodNotAllowedAndUnknownRoutes(t *testing.T) {
+	t.Setenv("ADMIN_API_KEY", "admin-key")
+	s := NewServer(&fakeProvider{name: "default"}, "test-project")
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		wantStatus int
+		wantAllow  string
+		wantCode   string
+	}{
+		{name: "models is GET only", method: http.MethodPost, path: "/v1/models", wantStatus: http.StatusMethodNotAllowed, wantAllow: "GET", wantCode: "method_not_allowed"},
+		{name: "chat completions is POST only", method: http.MethodGet, path: "/v1/chat/completions", wantStatus: http.StatusMethodNotAllowed, wantAllow: "POST", wantCode: "method_not_allowed"},
+		{name: "gemini is POST only", method: http.MethodGet, path: "/v1beta/models/gemini-3-flash:generateContent", wantStatus: http.StatusMethodNotAllowed, wantAllow: "POST", wantCode: "method_not_allowed"},
+		{name: "model endpoints lists every method", method: http.MethodPatch, path: "/admin/model-endpoints", wantStatus: http.StatusMethodNotAllowed, wantAllow: "GET, PUT, POST, DELETE", wantCode: "method_not_allowed"},
+		{name: "unknown route", method: http.MethodGet, path: "/v2/unknown", wantStatus: http.StatusNotFound, wantCode: "not_found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.Header.Set("Authorization", "Bearer admin-key")
+			s.mux.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rr.Code, tt.wantStatus)
+			}
+			if got := rr.Header().Get("Allow"); got != tt.wantAllow {
+				t.Errorf("Allow = %q, want %q", got, tt.wantAllow)
+			}
+			if ct := rr.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("Content-Type = %q, want application/json", ct)
+			}
+			var resp apiErrorResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("invalid error JSON: %v (body %q)", err, rr.Body.String())
+			}
+			if resp.Error.Type != "invalid_request_error" || resp.Error.Code != tt.wantCode {
+				t.Errorf("unexpected error body: %+v", resp.Error)
+			}
+		})
+	}
+}
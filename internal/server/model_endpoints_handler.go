@@ -0,0 +1,64 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/dvcrn/antigravity-proxy/internal/antigravity"
+	"github.com/dvcrn/antigravity-proxy/internal/logger"
+)
+
+type modelEndpointRequest struct {
+	Model    string `json:"model"`
+	Endpoint string `json:"endpoint"`
+}
+
+type modelEndpointsResponse struct {
+	ModelEndpoints map[string]string `json:"model_endpoints"`
+}
+
+// modelEndpointsHandler handles /admin/model-endpoints, runtime per-model endpoint pins:
+//   - GET lists the current pins
+//   - PUT or POST {"model": "...", "endpoint": "prod"} pins a model ("prod", "daily" or an endpoint URL)
+//   - DELETE ?model=... removes a pin
+//
+// Pins are kept in memory and reset on restart.
+func (s *Server) modelEndpointsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+
+	case http.MethodPut, http.MethodPost:
+		var req modelEndpointRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeAPIError(w, http.StatusBadRequest, "invalid_request_error", "Invalid request body", "")
+			return
+		}
+		req.Model = strings.TrimSpace(req.Model)
+		if req.Model == "" {
+			writeAPIError(w, http.StatusBadRequest, "invalid_request_error", "model is required", "")
+			return
+		}
+		if err := antigravity.SetModelEndpoint(req.Model, req.Endpoint); err != nil {
+			writeAPIError(w, http.StatusBadRequest, "invalid_request_error", err.Error(), "")
+			return
+		}
+		logger.Get().Info().Str("model", req.Model).Str("endpoint", req.Endpoint).Msg("Pinned model to endpoint")
+
+	case http.MethodDelete:
+		model := strings.TrimSpace(r.URL.Query().Get("model"))
+		if model == "" {
+			writeAPIError(w, http.StatusBadRequest, "invalid_request_error", "model query parameter is required", "")
+			return
+		}
+		antigravity.ClearModelEndpoint(model)
+		logger.Get().Info().Str("model", model).Msg("Cleared model endpoint pin")
+
+	default:
+		writeMethodNotAllowed(w, r, http.MethodGet, http.MethodPut, http.MethodPost, http.MethodDelete)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(modelEndpointsResponse{ModelEndpoints: antigravity.ModelEndpoints()})
+}
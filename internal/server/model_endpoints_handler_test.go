@@ -0,0 +1,42 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dvcrn/antigravity-proxy/internal/antigravity"
+)
+
+func TestModelEndpointsHandler(t *testing.T) {
+	s := &Server{}
+	defer antigravity.ClearModelEndpoint("gemini-3-pro")
+
+	do := func(method, target, body string) (int, modelEndpointsResponse) {
+		rec := httptest.NewRecorder()
+		s.modelEndpointsHandler(rec, httptest.NewRequest(method, target, strings.NewReader(body)))
+		var resp modelEndpointsResponse
+		_ = json.Unmarshal(rec.Body.Bytes(), &resp)
+		return rec.Code, resp
+	}
+
+	code, resp := do(http.MethodPut, "/admin/model-endpoints", `{"model":"gemini-3-pro","endpoint":"prod"}`)
+	if code != http.StatusOK || resp.ModelEndpoints["gemini-3-pro"] != "https://cloudcode-pa.googleapis.com" {
+		t.Fatalf("PUT = %d %+v, want the model pinned to prod", code, resp)
+	}
+
+	if code, _ := do(http.MethodPut, "/admin/model-endpoints", `{"model":"gemini-3-pro","endpoint":"nowhere"}`); code != http.StatusBadRequest {
+		t.Errorf("PUT with unknown endpoint = %d, want 400", code)
+	}
+
+	if _, resp := do(http.MethodGet, "/admin/model-endpoints", ""); len(resp.ModelEndpoints) != 1 {
+		t.Errorf("GET = %+v, want one pin", resp)
+	}
+
+	code, resp = do(http.MethodDelete, "/admin/model-endpoints?model=gemini-3-pro", "")
+	if code != http.StatusOK || len(resp.ModelEndpoints) != 0 {
+		t.Errorf("DELETE = %d %+v, want no pins", code, resp)
+	}
+}
@@ -3,11 +3,15 @@ package server
 import (
 	"encoding/json"
 	"net/http"
+	"path"
 	"sort"
 	"strings"
 	"time"
 
+	"github.com/dvcrn/antigravity-proxy/internal/antigravity"
+	"github.com/dvcrn/antigravity-proxy/internal/env"
 	"github.com/dvcrn/antigravity-proxy/internal/logger"
+	"github.com/dvcrn/antigravity-proxy/internal/transform"
 )
 
 type openAIModel struct {
@@ -16,6 +20,24 @@ type openAIModel struct {
 	Created     int64  `json:"created"`
 	OwnedBy     string `json:"owned_by"`
 	Description string `json:"description,omitempty"`
+	// ContextWindow and MaxOutputTokens are token limits; LimitsSource says whether
+	// they were reported by upstream or taken from family defaults (see setModelLimits).
+	ContextWindow   int    `json:"context_window,omitempty"`
+	MaxOutputTokens int    `json:"max_output_tokens,omitempty"`
+	LimitsSource    string `json:"limits_source,omitempty"`
+}
+
+// modelLimits are token limits for a model.
+type modelLimits struct {
+	contextWindow   int
+	maxOutputTokens int
+}
+
+// defaultModelLimits are the documented token limits per model family, used when
+// upstream doesn't report limits for a model.
+var defaultModelLimits = map[string]modelLimits{
+	"gemini": {contextWindow: 1048576, maxOutputTokens: 65536},
+	"claude": {contextWindow: 200000, maxOutputTokens: 64000},
 }
 
 type openAIModelsListResponse struct {
@@ -28,19 +50,26 @@ type apiErrorResponse struct {
 	Error struct {
 		Type    string `json:"type"`
 		Message string `json:"message"`
+		Code    string `json:"code,omitempty"`
+		// StatusCode is the upstream HTTP status, set on stream error events
+		StatusCode int `json:"status_code,omitempty"`
 	} `json:"error"`
 }
 
 func (s *Server) modelsHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	if !allowMethods(w, r, http.MethodGet) {
+		return
+	}
+
+	client, _, ok := s.resolveAccount(w, r)
+	if !ok {
 		return
 	}
 
-	data, err := s.antigravityClient.FetchAvailableModels(r.Context())
+	data, err := client.FetchAvailableModels(r.Context())
 	if err != nil {
-		logger.Get().Error().Err(err).Msg("Failed to fetch available models")
-		writeAPIError(w, http.StatusInternalServerError, err.Error())
+		logger.Get().Error().Err(err).Int("upstream_status", upstreamStatus(err)).Msg("Failed to fetch available models")
+		writeUpstreamError(w, err)
 		return
 	}
 
@@ -54,15 +83,21 @@ func (s *Server) modelsHandler(w http.ResponseWriter, r *http.Request) {
 		if description == "" {
 			description = modelID
 		}
-		models = append(models, openAIModel{
+		m := openAIModel{
 			ID:          modelID,
 			Object:      "model",
 			Created:     created,
-			OwnedBy:     "anthropic",
+			OwnedBy:     modelOwner(modelID),
 			Description: description,
-		})
+		}
+		setModelLimits(&m, modelData)
+		models = append(models, m)
 	}
 
+	// Expose MODEL_ALIASES so clients can discover them
+	models = append(models, aliasModels(models, created)...)
+	models = filterVisibleModels(models)
+
 	sort.Slice(models, func(i, j int) bool {
 		return models[i].ID < models[j].ID
 	})
@@ -78,7 +113,7 @@ func (s *Server) modelsHandler(w http.ResponseWriter, r *http.Request) {
 				return
 			}
 		}
-		http.NotFound(w, r)
+		writeAPIError(w, http.StatusNotFound, "invalid_request_error", "The model '"+requestedModelID+"' does not exist", "model_not_found")
 		return
 	}
 
@@ -91,13 +126,122 @@ func (s *Server) modelsHandler(w http.ResponseWriter, r *http.Request) {
 	_ = json.NewEncoder(w).Encode(resp)
 }
 
-func writeAPIError(w http.ResponseWriter, status int, message string) {
+// aliasModels lists the configured model aliases, copying ownership from the target
+// model when it is in models.
+func aliasModels(models []openAIModel, created int64) []openAIModel {
+	aliases := transform.ModelAliases()
+	if len(aliases) == 0 {
+		return nil
+	}
+
+	byID := make(map[string]openAIModel, len(models))
+	for _, m := range models {
+		byID[m.ID] = m
+	}
+
+	out := make([]openAIModel, 0, len(aliases))
+	for alias, target := range aliases {
+		if _, exists := byID[alias]; exists || target == "" {
+			continue
+		}
+		m := openAIModel{
+			ID:          alias,
+			Object:      "model",
+			Created:     created,
+			OwnedBy:     modelOwner(target),
+			Description: "Alias for " + target,
+		}
+		if targetModel, ok := byID[target]; ok {
+			m.OwnedBy = targetModel.OwnedBy
+			m.ContextWindow = targetModel.ContextWindow
+			m.MaxOutputTokens = targetModel.MaxOutputTokens
+			m.LimitsSource = targetModel.LimitsSource
+		}
+		out = append(out, m)
+	}
+	return out
+}
+
+// setModelLimits fills the model's token limits from upstream data, falling back to
+// the family defaults for each limit upstream leaves out. LimitsSource is "upstream" or
+// "default" when every limit came from one place and "mixed" otherwise.
+func setModelLimits(m *openAIModel, data antigravity.AvailableModel) {
+	defaults := defaultModelLimits[modelFamily(m.ID)]
+	fromUpstream, fromDefault := 0, 0
+	pick := func(upstream, def int) int {
+		switch {
+		case upstream > 0:
+			fromUpstream++
+			return upstream
+		case def > 0:
+			fromDefault++
+			return def
+		}
+		return 0
+	}
+	m.ContextWindow = pick(data.MaxTokens, defaults.contextWindow)
+	m.MaxOutputTokens = pick(data.MaxOutputTokens, defaults.maxOutputTokens)
+
+	switch {
+	case fromUpstream > 0 && fromDefault > 0:
+		m.LimitsSource = "mixed"
+	case fromUpstream > 0:
+		m.LimitsSource = "upstream"
+	case fromDefault > 0:
+		m.LimitsSource = "default"
+	}
+}
+
+// filterVisibleModels drops models hidden by MODELS_ALLOWLIST and MODELS_DENYLIST.
+func filterVisibleModels(models []openAIModel) []openAIModel {
+	allow := modelPatterns("MODELS_ALLOWLIST")
+	deny := modelPatterns("MODELS_DENYLIST")
+	if len(allow) == 0 && len(deny) == 0 {
+		return models
+	}
+
+	visible := models[:0]
+	for _, m := range models {
+		if len(allow) > 0 && !matchesModelPattern(allow, m.ID) {
+			continue
+		}
+		if matchesModelPattern(deny, m.ID) {
+			continue
+		}
+		visible = append(visible, m)
+	}
+	return visible
+}
+
+// modelPatterns reads a comma-separated list of model ID globs from key.
+func modelPatterns(key string) []string {
+	var patterns []string
+	for _, p := range strings.Split(env.GetOrDefault(key, ""), ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			patterns = append(patterns, p)
+		}
+	}
+	return patterns
+}
+
+// matchesModelPattern reports whether modelID matches any of the globs (see path.Match).
+func matchesModelPattern(patterns []string, modelID string) bool {
+	for _, p := range patterns {
+		if ok, err := path.Match(p, modelID); err == nil && ok {
+			return true
+		}
+	}
+	return false
+}
+
+func writeAPIError(w http.ResponseWriter, status int, errType, message, code string) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
 	var resp apiErrorResponse
 	resp.Type = "error"
-	resp.Error.Type = "api_error"
+	resp.Error.Type = errType
 	resp.Error.Message = message
+	resp.Error.Code = code
 	_ = json.NewEncoder(w).Encode(resp)
 }
 
@@ -106,6 +250,18 @@ func isSupportedModel(modelID string) bool {
 	return family == "claude" || family == "gemini"
 }
 
+// modelOwner reports the provider of a model for the owned_by field.
+func modelOwner(modelID string) string {
+	switch modelFamily(modelID) {
+	case "gemini":
+		return "google"
+	case "claude":
+		return "anthropic"
+	default:
+		return "unknown"
+	}
+}
+
 func modelFamily(modelID string) string {
 	lower := strings.ToLower(modelID)
 	if strings.Contains(lower, "claude") {
@@ -0,0 +1,152 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dvcrn/antigravity-proxy/internal/antigravity"
+)
+
+func TestModelsHandlerListsAliases(t *testing.T) {
+	t.Setenv("MODEL_ALIASES", `{"gpt-4o":"gemini-3-pro","claude-3-5-sonnet":"claude-sonnet-4-5"}`)
+
+	s := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"models":{"gemini-3-pro":{"displayName":"Gemini 3 Pro"}}}`))
+	}))
+
+	rr := httptest.NewRecorder()
+	s.modelsHandler(rr, httptest.NewRequest(http.MethodGet, "/v1/models", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rr.Code, rr.Body.String())
+	}
+
+	var resp openAIModelsListResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+
+	var ids []string
+	for _, m := range resp.Data {
+		ids = append(ids, m.ID)
+	}
+	expected := []string{"claude-3-5-sonnet", "gemini-3-pro", "gpt-4o"}
+	if len(ids) != len(expected) {
+		t.Fatalf("model IDs = %v, want %v", ids, expected)
+	}
+	for i := range expected {
+		if ids[i] != expected[i] {
+			t.Errorf("model IDs = %v, want %v", ids, expected)
+			break
+		}
+	}
+
+	expectedOwners := map[string]string{"claude-3-5-sonnet": "anthropic", "gemini-3-pro": "google", "gpt-4o": "google"}
+	for _, m := range resp.Data {
+		if m.OwnedBy != expectedOwners[m.ID] {
+			t.Errorf("owned_by for %s = %q, want %q", m.ID, m.OwnedBy, expectedOwners[m.ID])
+		}
+	}
+}
+
+func TestModelOwner(t *testing.T) {
+	tests := map[string]string{
+		"gemini-3-pro":      "google",
+		"claude-sonnet-4-5": "anthropic",
+		"gpt-oss-120b":      "unknown",
+	}
+	for modelID, want := range tests {
+		if got := modelOwner(modelID); got != want {
+			t.Errorf("modelOwner(%q) = %q, want %q", modelID, got, want)
+		}
+	}
+}
+
+func TestModelsHandlerAllowDenyLists(t *testing.T) {
+	upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"models":{"gemini-3-pro":{},"gemini-3-flash":{},"gemini-3-pro-daily-exp":{},"claude-sonnet-4-5":{}}}`))
+	})
+
+	testCases := []struct {
+		name     string
+		allow    string
+		deny     string
+		expected []string
+	}{
+		{name: "no lists", expected: []string{"claude-sonnet-4-5", "gemini-3-flash", "gemini-3-pro", "gemini-3-pro-daily-exp"}},
+		{name: "exact allowlist", allow: "gemini-3-pro, gemini-3-flash", expected: []string{"gemini-3-flash", "gemini-3-pro"}},
+		{name: "glob allowlist with denylist", allow: "gemini-*", deny: "*-exp", expected: []string{"gemini-3-flash", "gemini-3-pro"}},
+		{name: "denylist only", deny: "claude-*", expected: []string{"gemini-3-flash", "gemini-3-pro", "gemini-3-pro-daily-exp"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("MODELS_ALLOWLIST", tc.allow)
+			t.Setenv("MODELS_DENYLIST", tc.deny)
+
+			s := newTestServer(t, upstream)
+
+			rr := httptest.NewRecorder()
+			s.modelsHandler(rr, httptest.NewRequest(http.MethodGet, "/v1/models", nil))
+			var resp openAIModelsListResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("failed to parse response: %v", err)
+			}
+			var ids []string
+			for _, m := range resp.Data {
+				ids = append(ids, m.ID)
+			}
+			if strings.Join(ids, ",") != strings.Join(tc.expected, ",") {
+				t.Errorf("model IDs = %v, want %v", ids, tc.expected)
+			}
+
+			// Hidden models are not found by ID either
+			rr = httptest.NewRecorder()
+			s.modelsHandler(rr, httptest.NewRequest(http.MethodGet, "/v1/models/gemini-3-pro-daily-exp", nil))
+			wantStatus := http.StatusNotFound
+			for _, id := range tc.expected {
+				if id == "gemini-3-pro-daily-exp" {
+					wantStatus = http.StatusOK
+				}
+			}
+			if rr.Code != wantStatus {
+				t.Errorf("single model status = %d, want %d", rr.Code, wantStatus)
+			}
+			if wantStatus == http.StatusNotFound {
+				var errResp apiErrorResponse
+				if err := json.Unmarshal(rr.Body.Bytes(), &errResp); err != nil || errResp.Error.Code != "model_not_found" {
+					t.Errorf("expected a model_not_found JSON error, got %q", rr.Body.String())
+				}
+			}
+		})
+	}
+}
+
+func TestSetModelLimits(t *testing.T) {
+	testCases := []struct {
+		name          string
+		id            string
+		data          antigravity.AvailableModel
+		wantContext   int
+		wantMaxOutput int
+		wantSource    string
+	}{
+		{name: "upstream limits", id: "gemini-3-pro", data: antigravity.AvailableModel{MaxTokens: 500000, MaxOutputTokens: 32000}, wantContext: 500000, wantMaxOutput: 32000, wantSource: "upstream"},
+		{name: "gemini defaults", id: "gemini-3-flash", wantContext: 1048576, wantMaxOutput: 65536, wantSource: "default"},
+		{name: "claude defaults", id: "claude-sonnet-4-5", wantContext: 200000, wantMaxOutput: 64000, wantSource: "default"},
+		{name: "partial upstream", id: "claude-opus-4-5", data: antigravity.AvailableModel{MaxTokens: 1000000}, wantContext: 1000000, wantMaxOutput: 64000, wantSource: "mixed"},
+		{name: "unknown family", id: "custom-model", wantSource: ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := openAIModel{ID: tc.id}
+			setModelLimits(&m, tc.data)
+			if m.ContextWindow != tc.wantContext || m.MaxOutputTokens != tc.wantMaxOutput || m.LimitsSource != tc.wantSource {
+				t.Errorf("limits = (%d, %d, %q), want (%d, %d, %q)", m.ContextWindow, m.MaxOutputTokens, m.LimitsSource, tc.wantContext, tc.wantMaxOutput, tc.wantSource)
+			}
+		})
+	}
+}
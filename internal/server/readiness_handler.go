@@ -0,0 +1,157 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/dvcrn/antigravity-proxy/internal/antigravity"
+	"github.com/dvcrn/antigravity-proxy/internal/env"
+	"github.com/dvcrn/antigravity-proxy/internal/logger"
+)
+
+// readinessClient is the subset of the upstream client used by readiness probes.
+type readinessClient interface {
+	LoadCodeAssist(ctx context.Context) (*antigravity.LoadCodeAssistResponse, error)
+	GenerateContent(ctx context.Context, req *antigravity.GenerateContentRequest) (*antigravity.GenerateContentResponse, error)
+}
+
+// readinessOptions configures the readiness probe.
+type readinessOptions struct {
+	// deepReadiness additionally issues a tiny generateContent call. It consumes quota,
+	// so it is opt-in via READINESS_DEEP_PROBE=true.
+	deepReadiness bool
+	// probeModel is the model used for the deep probe.
+	probeModel string
+	// deepProbeInterval is how long a deep probe result is reused. /readyz is
+	// unauthenticated, so this bounds how much quota polling it can spend.
+	deepProbeInterval time.Duration
+	// authProbeInterval is how long a loadCodeAssist result is reused, so polling
+	// /readyz can't turn into a stream of upstream calls.
+	authProbeInterval time.Duration
+}
+
+// defaultDeepProbeInterval is used when READINESS_DEEP_PROBE_INTERVAL is unset.
+const defaultDeepProbeInterval = time.Minute
+
+// defaultAuthProbeInterval is used when READINESS_AUTH_PROBE_INTERVAL is unset.
+const defaultAuthProbeInterval = 10 * time.Second
+
+func readinessOptionsFromEnv() readinessOptions {
+	return readinessOptions{
+		deepReadiness:     env.GetOrDefault("READINESS_DEEP_PROBE", "false") == "true",
+		probeModel:        env.GetOrDefault("READINESS_PROBE_MODEL", "gemini-3-flash"),
+		deepProbeInterval: durationFromEnv("READINESS_DEEP_PROBE_INTERVAL", defaultDeepProbeInterval),
+		authProbeInterval: durationFromEnv("READINESS_AUTH_PROBE_INTERVAL", defaultAuthProbeInterval),
+	}
+}
+
+// readinessCache holds the last result of each readiness probe. The zero value is
+// ready to use.
+type readinessCache struct {
+	auth probeCache
+	deep probeCache
+}
+
+// probeCache holds the last result of one readiness probe.
+type probeCache struct {
+	mu      sync.Mutex
+	checked time.Time
+	ok      bool
+}
+
+// result returns the cached result, running probe first if it is older than interval.
+// Concurrent callers wait for one probe instead of each making their own.
+func (c *probeCache) result(interval time.Duration, probe func() bool) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.checked.IsZero() || time.Since(c.checked) >= interval {
+		c.ok = probe()
+		c.checked = time.Now()
+	}
+	return c.ok
+}
+
+type readinessResponse struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+// readinessHandler handles GET /readyz. It verifies auth via loadCodeAssist and, with the
+// deep probe enabled, that generation works end-to-end. Responds 503 when any check fails.
+func (s *Server) readinessHandler(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	resp := checkReadiness(ctx, s.antigravityClient, s.projectID, readinessOptionsFromEnv(), &s.readiness)
+
+	status := http.StatusOK
+	if resp.Status != "ok" {
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// checkReadiness runs the configured probes. Results are reused from cache for
+// opts.authProbeInterval and opts.deepProbeInterval respectively. Failure details are
+// logged, not returned, since the endpoint is unauthenticated.
+func checkReadiness(ctx context.Context, client readinessClient, projectID string, opts readinessOptions, cache *readinessCache) readinessResponse {
+	resp := readinessResponse{Status: "ok", Checks: map[string]string{}}
+
+	authOK := cache.auth.result(opts.authProbeInterval, func() bool {
+		if _, err := client.LoadCodeAssist(ctx); err != nil {
+			logger.Get().Warn().Err(err).Int("upstream_status", upstreamStatus(err)).Msg("Readiness check failed: loadCodeAssist")
+			return false
+		}
+		return true
+	})
+	if !authOK {
+		resp.Status = "unavailable"
+		resp.Checks["auth"] = "failed"
+		return resp
+	}
+	resp.Checks["auth"] = "ok"
+
+	if !opts.deepReadiness {
+		return resp
+	}
+
+	deepOK := cache.deep.result(opts.deepProbeInterval, func() bool {
+		return deepProbe(ctx, client, projectID, opts.probeModel)
+	})
+	if !deepOK {
+		resp.Status = "unavailable"
+		resp.Checks["generate"] = "failed"
+		return resp
+	}
+	resp.Checks["generate"] = "ok"
+	return resp
+}
+
+// deepProbe sends a one-token generateContent and reports whether it succeeded.
+func deepProbe(ctx context.Context, client readinessClient, projectID, model string) bool {
+	_, err := client.GenerateContent(ctx, &antigravity.GenerateContentRequest{
+		Model:   model,
+		Project: projectID,
+		Request: antigravity.GeminiInternalRequest{
+			Contents: []antigravity.Content{{
+				Role:  "user",
+				Parts: []antigravity.ContentPart{{Text: "ping"}},
+			}},
+			GenerationConfig: &antigravity.GeminiGenerationConfig{MaxOutputTokens: 1},
+		},
+	})
+	if err != nil {
+		logger.Get().Warn().Err(err).Int("upstream_status", upstreamStatus(err)).Str("model", model).Msg("Readiness check failed: generateContent")
+		return false
+	}
+	return true
+}
@@ -0,0 +1,149 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dvcrn/antigravity-proxy/internal/antigravity"
+)
+
+type fakeReadinessClient struct {
+	loadErr       error
+	generateErr   error
+	generateCalls int
+	loadCalls     int
+	lastRequest   *antigravity.GenerateContentRequest
+}
+
+func (f *fakeReadinessClient) LoadCodeAssist(context.Context) (*antigravity.LoadCodeAssistResponse, error) {
+	f.loadCalls++
+	if f.loadErr != nil {
+		return nil, f.loadErr
+	}
+	return &antigravity.LoadCodeAssistResponse{}, nil
+}
+
+func (f *fakeReadinessClient) GenerateContent(_ context.Context, req *antigravity.GenerateContentRequest) (*antigravity.GenerateContentResponse, error) {
+	f.generateCalls++
+	f.lastRequest = req
+	if f.generateErr != nil {
+		return nil, f.generateErr
+	}
+	return &antigravity.GenerateContentResponse{}, nil
+}
+
+func TestCheckReadiness(t *testing.T) {
+	tests := []struct {
+		name          string
+		client        *fakeReadinessClient
+		opts          readinessOptions
+		wantStatus    string
+		wantGenerate  int
+		wantGenCheck  string
+		wantAuthCheck string
+	}{
+		{
+			name:          "shallow probe skips generateContent",
+			client:        &fakeReadinessClient{},
+			opts:          readinessOptions{},
+			wantStatus:    "ok",
+			wantAuthCheck: "ok",
+		},
+		{
+			name:          "deep probe calls generateContent",
+			client:        &fakeReadinessClient{},
+			opts:          readinessOptions{deepReadiness: true, probeModel: "gemini-3-flash"},
+			wantStatus:    "ok",
+			wantGenerate:  1,
+			wantGenCheck:  "ok",
+			wantAuthCheck: "ok",
+		},
+		{
+			name:          "deep probe reports generation failure",
+			client:        &fakeReadinessClient{generateErr: errors.New("model unavailable")},
+			opts:          readinessOptions{deepReadiness: true, probeModel: "gemini-3-flash"},
+			wantStatus:    "unavailable",
+			wantGenerate:  1,
+			wantGenCheck:  "failed",
+			wantAuthCheck: "ok",
+		},
+		{
+			name:          "auth failure short-circuits",
+			client:        &fakeReadinessClient{loadErr: errors.New("unauthorized")},
+			opts:          readinessOptions{deepReadiness: true},
+			wantStatus:    "unavailable",
+			wantAuthCheck: "failed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := checkReadiness(context.Background(), tt.client, "test-project", tt.opts, &readinessCache{})
+			if resp.Status != tt.wantStatus {
+				t.Errorf("status = %q, want %q", resp.Status, tt.wantStatus)
+			}
+			if tt.client.generateCalls != tt.wantGenerate {
+				t.Errorf("generateContent calls = %d, want %d", tt.client.generateCalls, tt.wantGenerate)
+			}
+			if got := resp.Checks["generate"]; got != tt.wantGenCheck {
+				t.Errorf("generate check = %q, want %q", got, tt.wantGenCheck)
+			}
+			if got := resp.Checks["auth"]; got != tt.wantAuthCheck {
+				t.Errorf("auth check = %q, want %q", got, tt.wantAuthCheck)
+			}
+			if tt.client.lastRequest != nil && tt.client.lastRequest.Model != tt.opts.probeModel {
+				t.Errorf("probe model = %q, want %q", tt.client.lastRequest.Model, tt.opts.probeModel)
+			}
+		})
+	}
+}
+
+func TestCheckReadinessCachesDeepProbe(t *testing.T) {
+	client := &fakeReadinessClient{}
+	cache := &readinessCache{}
+	opts := readinessOptions{deepReadiness: true, probeModel: "gemini-3-flash", deepProbeInterval: time.Minute}
+
+	for i := 0; i < 2; i++ {
+		if resp := checkReadiness(context.Background(), client, "test-project", opts, cache); resp.Checks["generate"] != "ok" {
+			t.Fatalf("probe %d: generate check = %q, want ok", i, resp.Checks["generate"])
+		}
+	}
+	if client.generateCalls != 1 {
+		t.Errorf("generateContent calls = %d, want 1 within the probe interval", client.generateCalls)
+	}
+
+	// An expired result is probed again
+	cache.deep.checked = time.Now().Add(-2 * time.Minute)
+	checkReadiness(context.Background(), client, "test-project", opts, cache)
+	if client.generateCalls != 2 {
+		t.Errorf("generateContent calls = %d, want 2 after the interval", client.generateCalls)
+	}
+}
+
+func TestCheckReadinessCachesAuthProbe(t *testing.T) {
+	client := &fakeReadinessClient{}
+	cache := &readinessCache{}
+	opts := readinessOptions{authProbeInterval: 10 * time.Second}
+
+	for i := 0; i < 3; i++ {
+		if resp := checkReadiness(context.Background(), client, "test-project", opts, cache); resp.Checks["auth"] != "ok" {
+			t.Fatalf("probe %d: auth check = %q, want ok", i, resp.Checks["auth"])
+		}
+	}
+	if client.loadCalls != 1 {
+		t.Errorf("loadCodeAssist calls = %d, want 1 within the probe interval", client.loadCalls)
+	}
+
+	// A cached failure is reported until the interval passes
+	client.loadErr = errors.New("unauthorized")
+	cache.auth.checked = time.Now().Add(-time.Minute)
+	checkReadiness(context.Background(), client, "test-project", opts, cache)
+	if resp := checkReadiness(context.Background(), client, "test-project", opts, cache); resp.Checks["auth"] != "failed" {
+		t.Errorf("auth check = %q, want failed", resp.Checks["auth"])
+	}
+	if client.loadCalls != 2 {
+		t.Errorf("loadCodeAssist calls = %d, want 2 after the interval", client.loadCalls)
+	}
+}
@@ -0,0 +1,36 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/dvcrn/antigravity-proxy/internal/env"
+)
+
+// strictUnmarshaler is implemented by request types with a custom UnmarshalJSON, which
+// would otherwise ignore DisallowUnknownFields.
+type strictUnmarshaler interface {
+	UnmarshalJSONStrict([]byte) error
+}
+
+// decodeRequestBody parses a client request body. With STRICT_REQUEST_DECODING=true
+// unknown fields are rejected instead of silently dropped, to surface client bugs.
+func decodeRequestBody(body []byte, v interface{}) error {
+	if env.GetOrDefault("STRICT_REQUEST_DECODING", "false") != "true" {
+		return json.Unmarshal(body, v)
+	}
+	if s, ok := v.(strictUnmarshaler); ok {
+		return s.UnmarshalJSONStrict(body)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+// isUnknownFieldError reports whether err came from a strict decode hitting an unknown
+// field. encoding/json has no typed error for this, so match its message.
+func isUnknownFieldError(err error) bool {
+	return err != nil && strings.HasPrefix(err.Error(), "json: unknown field ")
+}
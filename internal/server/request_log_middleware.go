@@ -0,0 +1,169 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/dvcrn/antigravity-proxy/internal/env"
+	"github.com/dvcrn/antigravity-proxy/internal/logger"
+)
+
+// maxLoggedBodyBytes caps how much of each request/response body LOG_BODIES logs.
+const maxLoggedBodyBytes = 4096
+
+const redacted = "[REDACTED]"
+
+// redactedHeaders are replaced with redacted in logged request headers.
+var redactedHeaders = []string{"Authorization", "Proxy-Authorization", "X-Goog-Api-Key", "Cookie"}
+
+// tokenFieldRegex matches OAuth token fields in JSON bodies. A regex rather than a JSON
+// walk so truncated bodies and SSE streams are redacted too.
+var tokenFieldRegex = regexp.MustCompile(`("(?:access_token|refresh_token|id_token)"\s*:\s*)"[^"]*"`)
+
+// bodyLogOptOutKey carries the flag handlers set, via suppressBodyLogging, to keep
+// LOG_BODIES from logging a request's bodies.
+type bodyLogOptOutKey struct{}
+
+// suppressBodyLogging keeps the request's bodies out of the LOG_BODIES log line, for
+// requests that opted out of content retention (OpenAI "store": false).
+func suppressBodyLogging(r *http.Request) {
+	if optOut, ok := r.Context().Value(bodyLogOptOutKey{}).(*atomic.Bool); ok {
+		optOut.Store(true)
+	}
+}
+
+// requestLogMiddleware logs method, path, status, duration and body sizes of every call
+// when LOG_REQUESTS=true; LOG_BODIES=true also logs truncated, redacted bodies unless
+// the handler called suppressBodyLogging.
+// It logs once the handler returns, so streams are reported with their total size and
+// duration after they end.
+func requestLogMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if env.GetOrDefault("LOG_REQUESTS", "false") != "true" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		logBodies := env.GetOrDefault("LOG_BODIES", "false") == "true"
+		optOut := new(atomic.Bool)
+		if logBodies {
+			r = r.WithContext(context.WithValue(r.Context(), bodyLogOptOutKey{}, optOut))
+		}
+
+		start := time.Now()
+		reqBody := &countingReadCloser{ReadCloser: r.Body, capture: logBodies}
+		if r.Body != nil {
+			r.Body = reqBody
+		}
+		lw := &loggingResponseWriter{ResponseWriter: w, status: http.StatusOK, capture: logBodies}
+
+		next.ServeHTTP(lw, r)
+
+		event := logger.Get().Info().
+			Str("method", r.Method).
+			Str("path", r.URL.Path).
+			Int("status", lw.status).
+			Dur("duration", time.Since(start)).
+			Int64("request_bytes", reqBody.n).
+			Int64("response_bytes", lw.n).
+			Bool("streaming", strings.HasPrefix(lw.Header().Get("Content-Type"), "text/event-stream")).
+			Interface("request_headers", redactHeaders(r.Header))
+		if logBodies && optOut.Load() {
+			event = event.Bool("bodies_suppressed", true)
+		} else if logBodies {
+			event = event.
+				Str("request_body", redactBody(reqBody.body.Bytes(), reqBody.n)).
+				Str("response_body", redactBody(lw.body.Bytes(), lw.n))
+		}
+		event.Msg("Proxy request")
+	})
+}
+
+// redactHeaders returns a copy of h with credential headers redacted.
+func redactHeaders(h http.Header) http.Header {
+	clone := h.Clone()
+	for _, name := range redactedHeaders {
+		if clone.Get(name) != "" {
+			clone.Set(name, redacted)
+		}
+	}
+	return clone
+}
+
+// redactBody redacts token fields in a captured body prefix and marks truncation.
+func redactBody(captured []byte, total int64) string {
+	body := tokenFieldRegex.ReplaceAllString(string(captured), `${1}"`+redacted+`"`)
+	if total > int64(len(captured)) {
+		body += "...(truncated)"
+	}
+	return body
+}
+
+// countingReadCloser counts request body bytes, keeping the first maxLoggedBodyBytes
+// when capture is set.
+type countingReadCloser struct {
+	io.ReadCloser
+	n       int64
+	capture bool
+	body    bytes.Buffer
+}
+
+func (c *countingReadCloser) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.n += int64(n)
+	if c.capture {
+		captureBody(&c.body, p[:n])
+	}
+	return n, err
+}
+
+// loggingResponseWriter records the status, response size and, when capture is set,
+// the first maxLoggedBodyBytes of the body.
+type loggingResponseWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	n           int64
+	capture     bool
+	body        bytes.Buffer
+}
+
+func (lw *loggingResponseWriter) WriteHeader(status int) {
+	if !lw.wroteHeader {
+		lw.wroteHeader = true
+		lw.status = status
+	}
+	lw.ResponseWriter.WriteHeader(status)
+}
+
+func (lw *loggingResponseWriter) Write(b []byte) (int, error) {
+	lw.wroteHeader = true
+	n, err := lw.ResponseWriter.Write(b)
+	lw.n += int64(n)
+	if lw.capture {
+		captureBody(&lw.body, b[:n])
+	}
+	return n, err
+}
+
+// Flush preserves streaming support for the wrapped writer.
+func (lw *loggingResponseWriter) Flush() {
+	if f, ok := lw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// captureBody appends b to buf up to maxLoggedBodyBytes.
+func captureBody(buf *bytes.Buffer, b []byte) {
+	if remaining := maxLoggedBodyBytes - buf.Len(); remaining > 0 {
+		if len(b) > remaining {
+			b = b[:remaining]
+		}
+		buf.Write(b)
+	}
+}
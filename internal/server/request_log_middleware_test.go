@@ -0,0 +1,130 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+
+	"github.com/dvcrn/antigravity-proxy/internal/logger"
+)
+
+func TestRequestLogMiddleware(t *testing.T) {
+	var buf bytes.Buffer
+	original := *logger.Get()
+	*logger.Get() = zerolog.New(&buf)
+	defer func() { *logger.Get() = original }()
+
+	handler := requestLogMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = io.WriteString(w, `data: {"access_token":"ya29.secret"}`+"\n\n")
+		w.(http.Flusher).Flush()
+		_, _ = io.WriteString(w, "data: [DONE]\n\n")
+	}))
+
+	body := `{"refresh_token":"1//secret","token_type":"Bearer"}`
+	send := func() {
+		req := httptest.NewRequest(http.MethodPost, "/admin/credentials", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer admin-secret")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	t.Run("disabled by default", func(t *testing.T) {
+		buf.Reset()
+		t.Setenv("LOG_REQUESTS", "")
+		send()
+		if buf.Len() != 0 {
+			t.Errorf("expected no log output, got %s", buf.String())
+		}
+	})
+
+	t.Run("sizes and status without bodies", func(t *testing.T) {
+		buf.Reset()
+		t.Setenv("LOG_REQUESTS", "true")
+		t.Setenv("LOG_BODIES", "")
+		send()
+
+		out := buf.String()
+		for _, want := range []string{`"status":202`, fmt.Sprintf(`"request_bytes":%d`, len(body)), `"response_bytes":52`, `"streaming":true`, `"Authorization":["[REDACTED]"]`} {
+			if !strings.Contains(out, want) {
+				t.Errorf("expected log to contain %s, got %s", want, out)
+			}
+		}
+		if strings.Contains(out, "request_body") || strings.Contains(out, "admin-secret") {
+			t.Errorf("expected no bodies or secrets in log, got %s", out)
+		}
+	})
+
+	t.Run("bodies are redacted", func(t *testing.T) {
+		buf.Reset()
+		t.Setenv("LOG_REQUESTS", "true")
+		t.Setenv("LOG_BODIES", "true")
+		send()
+
+		out := buf.String()
+		if !strings.Contains(out, "request_body") || !strings.Contains(out, "token_type") {
+			t.Errorf("expected request body in log, got %s", out)
+		}
+		for _, secret := range []string{"1//secret", "ya29.secret", "admin-secret"} {
+			if strings.Contains(out, secret) {
+				t.Errorf("expected %q to be redacted, got %s", secret, out)
+			}
+		}
+	})
+}
+
+func TestRedactBodyTruncates(t *testing.T) {
+	if got := redactBody([]byte(`{"a":1`), 100); got != `{"a":1...(truncated)` {
+		t.Errorf("redactBody() = %q", got)
+	}
+}
+
+func TestRequestLogMiddlewareHonorsStoreFalse(t *testing.T) {
+	var buf bytes.Buffer
+	original := *logger.Get()
+	*logger.Get() = zerolog.New(&buf)
+	defer func() { *logger.Get() = original }()
+	t.Setenv("LOG_REQUESTS", "true")
+	t.Setenv("LOG_BODIES", "true")
+
+	provider := &fakeProvider{name: "default"}
+	s := &Server{provider: provider, projectID: "test-project"}
+	handler := requestLogMiddleware(http.HandlerFunc(s.openAIChatCompletionsHandler))
+
+	for _, tc := range []struct {
+		store      string
+		wantBodies bool
+	}{
+		{store: "true", wantBodies: true},
+		{store: "false", wantBodies: false},
+	} {
+		t.Run("store="+tc.store, func(t *testing.T) {
+			buf.Reset()
+			body := `{"model":"gemini-3-flash","store":` + tc.store + `,"messages":[{"role":"user","content":"top secret transcript"}]}`
+			// Dry runs echo the content in the response without calling upstream
+			req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+			req.Header.Set(dryRunHeader, "true")
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			var line string
+			for _, l := range strings.Split(buf.String(), "\n") {
+				if strings.Contains(l, `"message":"Proxy request"`) {
+					line = l
+				}
+			}
+			if line == "" {
+				t.Fatalf("expected a request log line, got %s", buf.String())
+			}
+			if got := strings.Contains(line, "top secret transcript"); got != tc.wantBodies {
+				t.Errorf("bodies logged = %v, want %v: %s", got, tc.wantBodies, line)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/dvcrn/antigravity-proxy/internal/env"
+)
+
+// trimResponseText trims leading and trailing whitespace from non-streaming response
+// text when TRIM_RESPONSE_WHITESPACE=true (see trimOutsideFences).
+func trimResponseText(text string) string {
+	if env.GetOrDefault("TRIM_RESPONSE_WHITESPACE", "false") != "true" {
+		return text
+	}
+	return trimOutsideFences(text)
+}
+
+// trimOutsideFences trims leading and trailing whitespace, except trailing whitespace
+// inside a fenced code block (``` or ~~~) the text leaves unclosed, since it belongs
+// to the code. Whitespace inside closed fences is never at either end, so it is kept.
+func trimOutsideFences(text string) string {
+	text = strings.TrimLeftFunc(text, unicode.IsSpace)
+	if endsInsideFence(text) {
+		return text
+	}
+	return strings.TrimRightFunc(text, unicode.IsSpace)
+}
+
+// endsInsideFence reports whether text opens a fenced code block it doesn't close.
+func endsInsideFence(text string) bool {
+	open := ""
+	for _, line := range strings.Split(text, "\n") {
+		marker := fenceMarker(line)
+		switch {
+		case marker == "":
+		case open == "":
+			open = marker
+		case strings.HasPrefix(marker, open):
+			open = ""
+		}
+	}
+	return open != ""
+}
+
+// fenceMarker returns the run of backticks or tildes opening line when it is a fence
+// line (indented at most three spaces), or "".
+func fenceMarker(line string) string {
+	trimmed := strings.TrimLeft(line, " ")
+	if len(line)-len(trimmed) > 3 {
+		return ""
+	}
+	for _, fence := range []byte{'`', '~'} {
+		n := 0
+		for n < len(trimmed) && trimmed[n] == fence {
+			n++
+		}
+		if n >= 3 {
+			return trimmed[:n]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,48 @@
+package server
+
+import "testing"
+
+func TestTrimOutsideFences(t *testing.T) {
+	testCases := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{name: "plain text", in: "\n\n  Hello world \n\n", want: "Hello world"},
+		{
+			name: "closed fence keeps inner whitespace",
+			in:   "\n\n```go\n\tfunc main() {}  \n\n```\n\n",
+			want: "```go\n\tfunc main() {}  \n\n```",
+		},
+		{
+			name: "unclosed fence keeps trailing whitespace",
+			in:   "\nCode:\n```\nindented  \n  ",
+			want: "Code:\n```\nindented  \n  ",
+		},
+		{
+			name: "tilde fence not closed by backticks",
+			in:   "~~~\ncode\n```\n  ",
+			want: "~~~\ncode\n```\n  ",
+		},
+		{name: "indented code is not a fence", in: "text\n    ```\n  ", want: "text\n    ```"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := trimOutsideFences(tc.in); got != tc.want {
+				t.Errorf("trimOutsideFences(%q) = %q, want %q", tc.in, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestTrimResponseTextDisabledByDefault(t *testing.T) {
+	t.Setenv("TRIM_RESPONSE_WHITESPACE", "")
+	if got := trimResponseText("\nhi\n"); got != "\nhi\n" {
+		t.Errorf("trimResponseText = %q, want text unchanged", got)
+	}
+	t.Setenv("TRIM_RESPONSE_WHITESPACE", "true")
+	if got := trimResponseText("\nhi\n"); got != "hi" {
+		t.Errorf("trimResponseText = %q, want %q", got, "hi")
+	}
+}
@@ -1,8 +1,15 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
 	"net/http"
+	"strconv"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/dvcrn/antigravity-proxy/internal/antigravity"
@@ -19,7 +26,26 @@ type Server struct {
 	oauthCreds        *credentials.OAuthCredentials
 	projectID         string
 	mux               *http.ServeMux
+	handler           http.Handler
 	antigravityClient *antigravity.Client
+
+	// Multi-account routing (see SetAccountRegistry)
+	accountsMu      sync.Mutex
+	registry        *credentials.Registry
+	accounts        map[string]*accountClient
+	discoverProject func(context.Context, *antigravity.Client, credentials.CredentialsProvider) (string, error)
+
+	// Graceful shutdown (see Shutdown)
+	shutdownMu    sync.Mutex
+	httpServer    *http.Server
+	stopStreams   chan struct{}
+	activeStreams sync.WaitGroup
+
+	// Repeated identical request detection (see loopGuardMiddleware)
+	loops loopGuard
+
+	// Last readiness probe results (see checkReadiness)
+	readiness readinessCache
 }
 
 // NewServer creates a new server instance with the given credentials provider
@@ -29,15 +55,71 @@ func NewServer(provider credentials.CredentialsProvider, projectID string) *Serv
 		provider:          provider,
 		projectID:         projectID,
 		mux:               http.NewServeMux(),
-		antigravityClient: antigravity.NewClient(provider),
+		antigravityClient: antigravity.NewClientWithOptions(provider, clientOptionsFromEnv()),
 	}
 	s.setupRoutes()
+	s.handler = s.buildHandler()
 
 	return s
 }
 
+// clientOptionsFromEnv builds upstream client options, allowing the defaults to be
+// overridden via UPSTREAM_REQUEST_TIMEOUT, UPSTREAM_STREAM_IDLE_TIMEOUT, MODELS_CACHE_TTL,
+// UPSTREAM_GZIP_THRESHOLD and RETRY_EMPTY_STREAMS.
+func clientOptionsFromEnv() antigravity.ClientOptions {
+	opts := antigravity.DefaultClientOptions()
+	opts.RequestTimeout = durationFromEnv("UPSTREAM_REQUEST_TIMEOUT", opts.RequestTimeout)
+	opts.StreamIdleTimeout = durationFromEnv("UPSTREAM_STREAM_IDLE_TIMEOUT", opts.StreamIdleTimeout)
+	opts.ModelsCacheTTL = durationFromEnv("MODELS_CACHE_TTL", opts.ModelsCacheTTL)
+	opts.GzipRequestThreshold = intFromEnv("UPSTREAM_GZIP_THRESHOLD", opts.GzipRequestThreshold)
+	opts.SkipDailyEndpoint = env.GetOrDefault("SKIP_DAILY_ENDPOINT", "false") == "true"
+	opts.RetryEmptyStream = env.GetOrDefault("RETRY_EMPTY_STREAMS", "false") == "true"
+	return opts
+}
+
+// durationFromEnv parses a duration env var, falling back to def when unset or invalid.
+func durationFromEnv(key string, def time.Duration) time.Duration {
+	value, ok := env.Get(key)
+	if !ok {
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		logger.Get().Warn().Err(err).Str("key", key).Str("value", value).Dur("default", def).Msg("Invalid duration, using default")
+		return def
+	}
+	return d
+}
+
+// intFromEnv parses a non-negative integer env var, falling back to def when unset or invalid.
+func intFromEnv(key string, def int) int {
+	value, ok := env.Get(key)
+	if !ok {
+		return def
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		logger.Get().Warn().Str("key", key).Str("value", value).Int("default", def).Msg("Invalid integer, using default")
+		return def
+	}
+	return n
+}
+
 // Start launches the proxy server with the configured provider
 func (s *Server) Start(addr string) error {
+	if err := ValidateListenAddr(addr); err != nil {
+		return err
+	}
+
+	// Bind before anything else so a taken port fails fast with a clear error
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		if errors.Is(err, syscall.EADDRINUSE) {
+			return fmt.Errorf("listen address %s is already in use; pick another with --listen or PROXY_LISTEN_ADDR: %w", addr, err)
+		}
+		return fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+
 	// Load OAuth credentials on startup
 	if err := s.LoadCredentials(false); err != nil {
 		logger.Get().Error().Err(err).Msg("Failed to load OAuth credentials")
@@ -47,8 +129,30 @@ func (s *Server) Start(addr string) error {
 	// Start periodic token refresh
 	s.startTokenRefreshLoop()
 
-	logger.Get().Info().Msgf("Starting proxy server on %s", addr)
-	return http.ListenAndServe(addr, loggingMiddleware(s.mux))
+	httpServer := &http.Server{Handler: s.handler}
+	s.shutdownMu.Lock()
+	s.httpServer = httpServer
+	s.shutdownMu.Unlock()
+
+	logger.Get().Info().Msgf("Starting proxy server on %s", listener.Addr())
+	if err := httpServer.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// ValidateListenAddr checks that addr is a host:port pair with a valid port, e.g.
+// "127.0.0.1:8080" or ":9878".
+func ValidateListenAddr(addr string) error {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid listen address %q: %w", addr, err)
+	}
+	n, err := strconv.Atoi(port)
+	if err != nil || n < 0 || n > 65535 {
+		return fmt.Errorf("invalid listen address %q: port must be a number between 0 and 65535", addr)
+	}
+	return nil
 }
 
 // LoadCredentials loads OAuth credentials using the configured provider
@@ -121,21 +225,31 @@ func (s *Server) startTokenRefreshLoop() {
 func (s *Server) setupRoutes() {
 	s.mux.HandleFunc("/admin/credentials", s.adminMiddleware(s.credentialsHandler))
 	s.mux.HandleFunc("/admin/credentials/status", s.adminMiddleware(s.credentialsStatusHandler))
-	s.mux.HandleFunc("/v1beta/models/", s.adminMiddleware(s.streamGenerateContentHandler))
+	s.mux.HandleFunc("/admin/model-endpoints", s.adminMiddleware(s.modelEndpointsHandler))
+	s.mux.HandleFunc("/v1beta/models/", s.apiAuthMiddleware(s.loopGuardMiddleware(s.serverTimingMiddleware(s.streamGenerateContentHandler))))
 	s.mux.HandleFunc("/v1/models/", s.modelsHandler)
 	s.mux.HandleFunc("/v1/models", s.modelsHandler)
-	s.mux.HandleFunc("/v1/chat/completions", s.adminMiddleware(s.openAIChatCompletionsHandler))
+	s.mux.HandleFunc("/v1/chat/completions", s.apiAuthMiddleware(s.loopGuardMiddleware(s.serverTimingMiddleware(s.openAIChatCompletionsHandler))))
+	s.mux.HandleFunc("/readyz", s.readinessHandler)
+	s.mux.HandleFunc("/debug/account", s.adminMiddleware(s.accountInfoHandler))
+	s.mux.HandleFunc("/debug/version", s.adminMiddleware(s.versionHandler))
+	s.mux.HandleFunc("/", notFoundHandler)
+}
+
+// buildHandler wraps the routes in the middleware shared by Start and ServeHTTP, so the
+// CLI proxy and the Workers build handle requests the same way.
+func (s *Server) buildHandler() http.Handler {
+	return loggingMiddleware(requestLogMiddleware(corsMiddleware(apiKeyMiddleware(s.mux))))
 }
 
 // ServeHTTP implements http.Handler interface
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	s.mux.ServeHTTP(w, r)
+	s.handler.ServeHTTP(w, r)
 }
 
 // credentialsHandler handles POST /admin/credentials for setting OAuth credentials
 func (s *Server) credentialsHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		w.WriteHeader(http.StatusMethodNotAllowed)
+	if !allowMethods(w, r, http.MethodPost) {
 		return
 	}
 
@@ -143,14 +257,14 @@ func (s *Server) credentialsHandler(w http.ResponseWriter, r *http.Request) {
 	var creds credentials.OAuthCredentials
 	if err := json.NewDecoder(r.Body).Decode(&creds); err != nil {
 		logger.Get().Error().Err(err).Msg("Failed to decode credentials request")
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeAPIError(w, http.StatusBadRequest, "invalid_request_error", "Invalid request body", "")
 		return
 	}
 
 	// Save credentials
 	if err := s.provider.SaveCredentials(&creds); err != nil {
 		logger.Get().Error().Err(err).Msg("Failed to save credentials")
-		http.Error(w, "Failed to save credentials", http.StatusInternalServerError)
+		writeAPIError(w, http.StatusInternalServerError, "api_error", "Failed to save credentials", "")
 		return
 	}
 
@@ -168,8 +282,7 @@ func (s *Server) credentialsHandler(w http.ResponseWriter, r *http.Request) {
 
 // credentialsStatusHandler handles GET /admin/credentials/status
 func (s *Server) credentialsStatusHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		w.WriteHeader(http.StatusMethodNotAllowed)
+	if !allowMethods(w, r, http.MethodGet) {
 		return
 	}
 
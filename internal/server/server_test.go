@@ -0,0 +1,96 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateListenAddr(t *testing.T) {
+	tests := []struct {
+		addr    string
+		wantErr bool
+	}{
+		{addr: "127.0.0.1:8080"},
+		{addr: ":9878"},
+		{addr: "localhost:0"},
+		{addr: "8080", wantErr: true},
+		{addr: "127.0.0.1:http", wantErr: true},
+		{addr: "127.0.0.1:70000", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			err := ValidateListenAddr(tt.addr)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateListenAddr(%q) error = %v, wantErr %v", tt.addr, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestStartFailsWhenPortInUse(t *testing.T) {
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to reserve a port: %v", err)
+	}
+	defer taken.Close()
+
+	s := &Server{}
+	err = s.Start(taken.Addr().String())
+	if err == nil || !strings.Contains(err.Error(), "already in use") {
+		t.Fatalf("expected an address-in-use error, got %v", err)
+	}
+}
+
+func TestShutdownTerminatesStreamsWithErrorEvent(t *testing.T) {
+	// Upstream sends one event and then hangs until the proxy cancels the request
+	s := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = io.WriteString(w, `data: {"response":{"candidates":[{"content":{"parts":[{"text":"hi"}]}}]}}`+"\n\n")
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	s.httpServer = &http.Server{Handler: http.HandlerFunc(s.streamGenerateContentHandler)}
+	go func() { _ = s.httpServer.Serve(listener) }()
+
+	body := `{"contents":[{"role":"user","parts":[{"text":"hi"}]}]}`
+	resp, err := http.Post("http://"+listener.Addr().String()+"/v1beta/models/gemini-3-flash:streamGenerateContent", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	reader := bufio.NewReader(resp.Body)
+	if line, err := reader.ReadString('\n'); err != nil || line != "id: 1\n" {
+		t.Fatalf("expected the first event id, got %q (err %v)", line, err)
+	}
+	if line, err := reader.ReadString('\n'); err != nil || !strings.Contains(line, "hi") {
+		t.Fatalf("expected the first upstream event, got %q (err %v)", line, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	shutdownErr := make(chan error, 1)
+	go func() { shutdownErr <- s.Shutdown(ctx) }()
+
+	rest, _ := io.ReadAll(reader)
+	if !strings.Contains(string(rest), "UNAVAILABLE") {
+		t.Errorf("expected a shutdown error event, got %q", rest)
+	}
+
+	select {
+	case <-shutdownErr:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Shutdown did not return")
+	}
+}
@@ -0,0 +1,23 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/dvcrn/antigravity-proxy/internal/antigravity"
+	"github.com/dvcrn/antigravity-proxy/internal/logger"
+)
+
+// sessionHeader pins the upstream session id for clients that manage their own sessions.
+const sessionHeader = "X-Session-Id"
+
+// applySessionHeader copies the X-Session-Id header onto the upstream request verbatim,
+// overriding any session id from the body (or OpenAI "user") and the derived default.
+func applySessionHeader(r *http.Request, req *antigravity.GenerateContentRequest) {
+	sessionID := strings.TrimSpace(r.Header.Get(sessionHeader))
+	if sessionID == "" {
+		return
+	}
+	logger.Get().Debug().Str("session_id", sessionID).Msg("Using client-provided session id")
+	req.Request.SessionID = sessionID
+}
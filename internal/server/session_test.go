@@ -0,0 +1,57 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dvcrn/antigravity-proxy/internal/antigravity"
+)
+
+func TestSessionHeaderOverridesSessionID(t *testing.T) {
+	var gotSessionID string
+	s := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body antigravity.GenerateContentRequest
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		gotSessionID = body.Request.SessionID
+		_, _ = w.Write([]byte(`{"response":{"candidates":[{"content":{"parts":[{"text":"ok"}]}}]}}`))
+	}))
+
+	testCases := []struct {
+		name     string
+		header   string
+		body     string
+		expected string
+	}{
+		{
+			name:     "header overrides body session id",
+			header:   "Client-Session/42 ",
+			body:     `{"contents":[{"role":"user","parts":[{"text":"hi"}]}],"sessionId":"body-session"}`,
+			expected: "Client-Session/42",
+		},
+		{
+			name:     "body session id kept without header",
+			body:     `{"contents":[{"role":"user","parts":[{"text":"hi"}]}],"sessionId":"body-session"}`,
+			expected: "body-session",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/v1beta/models/gemini-3-flash:generateContent", strings.NewReader(tc.body))
+			if tc.header != "" {
+				req.Header.Set(sessionHeader, tc.header)
+			}
+			rr := httptest.NewRecorder()
+			s.handleGenerateContent(rr, req, "gemini-3-flash")
+			if rr.Code != http.StatusOK {
+				t.Fatalf("status = %d, body = %s", rr.Code, rr.Body.String())
+			}
+			if gotSessionID != tc.expected {
+				t.Errorf("upstream sessionId = %q, want %q", gotSessionID, tc.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/dvcrn/antigravity-proxy/internal/logger"
+)
+
+// streamStopGrace is how long Shutdown waits for streams to write their closing error
+// event after the shutdown timeout expires, before connections are force-closed.
+const streamStopGrace = 2 * time.Second
+
+const shutdownMessage = "Proxy is shutting down; retry the request"
+
+// shutdownSignal returns a channel that is closed once in-flight streams must stop.
+func (s *Server) shutdownSignal() <-chan struct{} {
+	s.shutdownMu.Lock()
+	defer s.shutdownMu.Unlock()
+	if s.stopStreams == nil {
+		s.stopStreams = make(chan struct{})
+	}
+	return s.stopStreams
+}
+
+// terminateStreams closes the shutdown signal; safe to call more than once.
+func (s *Server) terminateStreams() {
+	stop := s.shutdownSignal()
+	s.shutdownMu.Lock()
+	defer s.shutdownMu.Unlock()
+	select {
+	case <-stop:
+	default:
+		close(s.stopStreams)
+	}
+}
+
+// trackStream registers an in-flight streaming response. The returned channel is closed
+// when the stream must terminate; done must be called when the handler returns.
+func (s *Server) trackStream() (stop <-chan struct{}, done func()) {
+	s.activeStreams.Add(1)
+	return s.shutdownSignal(), s.activeStreams.Done
+}
+
+// Shutdown stops accepting new connections and waits until in-flight requests,
+// including streams, finish or ctx expires. Streams still running at that point end
+// with an SSE error event before remaining connections are closed.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.shutdownMu.Lock()
+	httpServer := s.httpServer
+	s.shutdownMu.Unlock()
+	if httpServer == nil {
+		return nil
+	}
+
+	logger.Get().Info().Msg("Shutting down; waiting for in-flight requests to finish")
+	err := httpServer.Shutdown(ctx)
+	if err == nil {
+		logger.Get().Info().Msg("Shutdown complete")
+		return nil
+	}
+
+	logger.Get().Warn().Err(err).Msg("Shutdown timeout reached; terminating remaining streams")
+	s.terminateStreams()
+
+	drained := make(chan struct{})
+	go func() {
+		s.activeStreams.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-time.After(streamStopGrace):
+		logger.Get().Warn().Msg("Streams did not stop in time; forcing close")
+	}
+
+	return httpServer.Close()
+}
+
+// writeShutdownErrorEvent ends an OpenAI SSE stream that was interrupted by shutdown.
+func writeShutdownErrorEvent(w http.ResponseWriter) {
+	var resp apiErrorResponse
+	resp.Type = "error"
+	resp.Error.Type = openAIErrorType(http.StatusServiceUnavailable)
+	resp.Error.Message = shutdownMessage
+	resp.Error.Code = "UNAVAILABLE"
+	data, _ := json.Marshal(resp)
+	_, _ = fmt.Fprintf(w, "data: %s\n\ndata: [DONE]\n\n", data)
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// writeGeminiShutdownErrorEvent ends a Gemini SSE stream that was interrupted by shutdown.
+func writeGeminiShutdownErrorEvent(w http.ResponseWriter) {
+	var body googleErrorBody
+	body.Error.Code = http.StatusServiceUnavailable
+	body.Error.Message = shutdownMessage
+	body.Error.Status = "UNAVAILABLE"
+	data, _ := json.Marshal(body)
+	_, _ = fmt.Fprintf(w, "data: %s\n\n", data)
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"net/http"
+	"sync"
+)
+
+// sseWriter wraps a ResponseWriter for event streams. The 200 status and SSE headers
+// are sent on the first Write, so a failure before any bytes reach the client can
+// still return a real HTTP status via WriteHeader. Writes are serialized so the
+// keepalive pinger and the stream loop can share it.
+type sseWriter struct {
+	http.ResponseWriter
+	mu        sync.Mutex
+	committed bool
+}
+
+func newSSEWriter(w http.ResponseWriter) *sseWriter {
+	return &sseWriter{ResponseWriter: w}
+}
+
+// Committed reports whether the response status has been sent.
+func (sw *sseWriter) Committed() bool {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	return sw.committed
+}
+
+// WriteHeader sends status as-is when nothing has been written yet, for errors
+// returned instead of a stream. It is a no-op once the stream has started.
+func (sw *sseWriter) WriteHeader(status int) {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	if sw.committed {
+		return
+	}
+	sw.committed = true
+	sw.ResponseWriter.WriteHeader(status)
+}
+
+// Write sends the SSE headers on first use, then writes and flushes b.
+func (sw *sseWriter) Write(b []byte) (int, error) {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	if !sw.committed {
+		sw.committed = true
+		h := sw.Header()
+		h.Del("Content-Length")
+		h.Set("Content-Type", "text/event-stream; charset=utf-8")
+		h.Set("Cache-Control", "no-cache")
+		h.Set("Connection", "keep-alive")
+		sw.ResponseWriter.WriteHeader(http.StatusOK)
+	}
+	n, err := sw.ResponseWriter.Write(b)
+	if f, ok := sw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+	return n, err
+}
+
+// Flush is a no-op because Write already flushes; it keeps the http.Flusher checks in
+// the shared error writers working.
+func (sw *sseWriter) Flush() {}
@@ -0,0 +1,48 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSSEWriter(t *testing.T) {
+	t.Run("first write sends SSE headers", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		sw := newSSEWriter(rr)
+		if sw.Committed() {
+			t.Fatal("expected nothing committed before the first write")
+		}
+		_, _ = io.WriteString(sw, ": ping\n\n")
+		sw.WriteHeader(http.StatusTooManyRequests)
+
+		if !sw.Committed() {
+			t.Error("expected the response to be committed")
+		}
+		if rr.Code != http.StatusOK {
+			t.Errorf("status = %d, want 200", rr.Code)
+		}
+		if ct := rr.Header().Get("Content-Type"); ct != "text/event-stream; charset=utf-8" {
+			t.Errorf("Content-Type = %q", ct)
+		}
+		if !rr.Flushed {
+			t.Error("expected the write to be flushed")
+		}
+	})
+
+	t.Run("status before first write is kept", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		sw := newSSEWriter(rr)
+		sw.Header().Set("Content-Type", "application/json")
+		sw.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = io.WriteString(sw, "{}")
+
+		if rr.Code != http.StatusServiceUnavailable {
+			t.Errorf("status = %d, want 503", rr.Code)
+		}
+		if ct := rr.Header().Get("Content-Type"); ct != "application/json" {
+			t.Errorf("Content-Type = %q, want application/json", ct)
+		}
+	})
+}
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dvcrn/antigravity-proxy/internal/antigravity"
+	"github.com/dvcrn/antigravity-proxy/internal/openai"
+)
+
+// streamFormat identifies the client-facing wire format of a streaming endpoint.
+type streamFormat string
+
+const (
+	streamFormatGemini streamFormat = "gemini"
+	streamFormatOpenAI streamFormat = "openai"
+)
+
+// streamTransform converts raw CloudCode SSE lines into client-ready SSE output. Each
+// string written to the returned channel is sent to the client as-is; the channel is
+// closed once upstream is exhausted.
+type streamTransform func(upstream <-chan string, opts streamTransformOptions) <-chan string
+
+// streamTransformOptions configures a streamTransform. Formats ignore options they
+// don't use.
+type streamTransformOptions struct {
+	geminiStreamAdapterOptions
+	// includeUsage adds the OpenAI usage chunk (stream_options.include_usage).
+	includeUsage bool
+}
+
+// streamTransforms is the registry of stream transforms keyed by format.
+var streamTransforms = map[streamFormat]streamTransform{
+	streamFormatGemini: geminiStreamTransform,
+	streamFormatOpenAI: openAIStreamTransform,
+}
+
+// streamFormatForPath maps an inbound request path to its native stream format.
+// Unknown paths get the Gemini format, which is closest to the upstream shape.
+func streamFormatForPath(path string) streamFormat {
+	if strings.HasPrefix(path, "/v1/chat/completions") {
+		return streamFormatOpenAI
+	}
+	return streamFormatGemini
+}
+
+// streamTransformForPath returns the stream transform for an inbound request path.
+func streamTransformForPath(path string) streamTransform {
+	return streamTransforms[streamFormatForPath(path)]
+}
+
+// geminiStreamTransform unwraps CloudCode SSE lines into standard Gemini SSE lines.
+func geminiStreamTransform(upstream <-chan string, _ streamTransformOptions) <-chan string {
+	out := make(chan string, 16)
+	go func() {
+		defer close(out)
+		for line := range sseEventLines(upstream) {
+			transformed := TransformSSELine(line)
+			// Data that wasn't JSON is left merged; split it back into one field per line
+			if strings.HasPrefix(transformed, "data:") && strings.Contains(transformed, "\n") {
+				transformed = "data: " + strings.ReplaceAll(antigravity.SSEFieldValue(transformed, "data:"), "\n", "\ndata: ")
+			}
+			// Blank lines pass through too, keeping the SSE event framing
+			out <- transformed + "\n"
+		}
+	}()
+	return out
+}
+
+// sseEventLines groups raw SSE lines into events at blank lines and re-emits each event
+// with its data: lines merged into one, as the SSE spec concatenates them, so a JSON
+// payload split across lines is parsed as a whole. Other fields (event:, id:, comments)
+// keep their place, and each event is followed by its blank line.
+func sseEventLines(upstream <-chan string) <-chan string {
+	out := make(chan string, 16)
+	go func() {
+		defer close(out)
+		var event []string
+		for line := range upstream {
+			if line != "" {
+				event = append(event, line)
+				continue
+			}
+			for _, l := range antigravity.MergeSSEData(event) {
+				out <- l
+			}
+			out <- ""
+			event = event[:0]
+		}
+		// A final event upstream didn't terminate
+		for _, l := range antigravity.MergeSSEData(event) {
+			out <- l
+		}
+	}()
+	return out
+}
+
+// openAIStreamTransform converts CloudCode SSE lines into OpenAI chat.completion.chunk events.
+func openAIStreamTransform(upstream <-chan string, opts streamTransformOptions) <-chan string {
+	chunkIn := make(chan openai.StreamChunk, 32)
+	go adaptGeminiStream(upstream, chunkIn, opts.geminiStreamAdapterOptions)
+
+	transformer := openai.CreateOpenAIStreamTransformerWithOptions(opts.model, openai.StreamTransformerOptions{
+		DisableContentLogging: !opts.logContent,
+		IncludeUsage:          opts.includeUsage,
+	})
+	return transformer(chunkIn)
+}
+
+// withEventIDs prefixes every data event of a transformed stream with an SSE "id:" field,
+// counting up from 1. The ids only number events within one response: upstream can't
+// resume a generation, so Last-Event-ID is ignored and a reconnect gets a new response.
+func withEventIDs(in <-chan string) <-chan string {
+	out := make(chan string, 16)
+	go func() {
+		defer close(out)
+		var id int64
+		for s := range in {
+			if strings.HasPrefix(s, "data: ") {
+				id++
+				s = fmt.Sprintf("id: %d\n%s", id, s)
+			}
+			out <- s
+		}
+	}()
+	return out
+}
+
+// drainStream discards the rest of a transformed stream so its goroutines can exit after
+// a handler stops reading early (client gone or shutdown).
+func drainStream(out <-chan string) {
+	go func() {
+		for range out {
+		}
+	}()
+}
@@ -0,0 +1,158 @@
+package server
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStreamTransformForPath(t *testing.T) {
+	line := `data: {"response":{"candidates":[{"content":{"role":"model","parts":[{"text":"hello"}]}}]}}`
+
+	collect := func(path string) []string {
+		upstream := make(chan string, 2)
+		upstream <- line
+		upstream <- ""
+		close(upstream)
+
+		var out []string
+		for s := range streamTransformForPath(path)(upstream, streamTransformOptions{}) {
+			out = append(out, s)
+		}
+		return out
+	}
+
+	t.Run("gemini path uses TransformSSELine", func(t *testing.T) {
+		path := "/v1beta/models/gemini-3-flash:streamGenerateContent"
+		if got := streamFormatForPath(path); got != streamFormatGemini {
+			t.Fatalf("streamFormatForPath(%q) = %q, want %q", path, got, streamFormatGemini)
+		}
+
+		out := collect(path)
+		if len(out) != 2 || out[0] != TransformSSELine(line)+"\n" || out[1] != "\n" {
+			t.Errorf("unexpected Gemini stream output: %q", out)
+		}
+	})
+
+	t.Run("openai path uses the chunk transform", func(t *testing.T) {
+		path := "/v1/chat/completions"
+		if got := streamFormatForPath(path); got != streamFormatOpenAI {
+			t.Fatalf("streamFormatForPath(%q) = %q, want %q", path, got, streamFormatOpenAI)
+		}
+
+		joined := strings.Join(collect(path), "")
+		for _, want := range []string{`"object":"chat.completion.chunk"`, `"content":"hello"`, "data: [DONE]"} {
+			if !strings.Contains(joined, want) {
+				t.Errorf("expected OpenAI stream output to contain %s, got %s", want, joined)
+			}
+		}
+	})
+}
+
+func TestGeminiStreamTransformEvents(t *testing.T) {
+	wrapped := `{"response":{"candidates":[{"content":{"parts":[{"text":"hi"}]}}]}}`
+	unwrapped := `data: {"candidates":[{"content":{"parts":[{"text":"hi"}]}}]}` + "\n"
+
+	testCases := []struct {
+		name     string
+		upstream []string
+		expected []string
+	}{
+		{
+			name:     "single data line",
+			upstream: []string{"data: " + wrapped, ""},
+			expected: []string{unwrapped, "\n"},
+		},
+		{
+			name:     "data without a space after the colon",
+			upstream: []string{"data:" + wrapped, ""},
+			expected: []string{unwrapped, "\n"},
+		},
+		{
+			name:     "event field keeps its place",
+			upstream: []string{"event: message", "data: " + wrapped, ""},
+			expected: []string{"event: message\n", unwrapped, "\n"},
+		},
+		{
+			name:     "JSON split across data lines",
+			upstream: []string{`data: {"response":`, `data: {"candidates":[{"content":{"parts":[{"text":"hi"}]}}]}}`, ""},
+			expected: []string{unwrapped, "\n"},
+		},
+		{
+			name:     "non-JSON data lines stay separate fields",
+			upstream: []string{"data: first", "data:second", ""},
+			expected: []string{"data: first\ndata: second\n", "\n"},
+		},
+		{
+			name:     "DONE sentinel passes through",
+			upstream: []string{"data: " + wrapped, "", "data: [DONE]", ""},
+			expected: []string{unwrapped, "\n", "data: [DONE]\n", "\n"},
+		},
+		{
+			name:     "unterminated final event is flushed",
+			upstream: []string{": keepalive", "data: " + wrapped},
+			expected: []string{": keepalive\n", unwrapped},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			upstream := make(chan string, len(tc.upstream))
+			for _, l := range tc.upstream {
+				upstream <- l
+			}
+			close(upstream)
+
+			var out []string
+			for s := range geminiStreamTransform(upstream, streamTransformOptions{}) {
+				out = append(out, s)
+			}
+			if strings.Join(out, "|") != strings.Join(tc.expected, "|") {
+				t.Errorf("output = %q, want %q", out, tc.expected)
+			}
+		})
+	}
+}
+
+func TestOpenAIStreamTransformMultiLineData(t *testing.T) {
+	upstream := make(chan string, 3)
+	upstream <- `data: {"response":{"candidates":[{"content":{"parts":`
+	upstream <- `data: [{"text":"hello"}]}}]}}`
+	upstream <- ""
+	close(upstream)
+
+	var out []string
+	for s := range openAIStreamTransform(upstream, streamTransformOptions{}) {
+		out = append(out, s)
+	}
+	joined := strings.Join(out, "")
+	if !strings.Contains(joined, `"content":"hello"`) {
+		t.Errorf("expected the split event to be parsed as one payload, got %s", joined)
+	}
+	if strings.Contains(joined, `{\"response\"`) {
+		t.Errorf("expected no JSON fragments forwarded as text, got %s", joined)
+	}
+}
+
+func TestWithEventIDs(t *testing.T) {
+	in := make(chan string, 4)
+	in <- "data: {\"a\":1}\n\n"
+	in <- "data: {\"a\":2}\n\n"
+	in <- "\n"
+	in <- "data: [DONE]\n\n"
+	close(in)
+
+	var ids []string
+	for s := range withEventIDs(in) {
+		if s == "\n" {
+			continue
+		}
+		id, rest, _ := strings.Cut(s, "\n")
+		if !strings.HasPrefix(rest, "data: ") {
+			t.Errorf("expected the id line to precede the data line, got %q", s)
+		}
+		ids = append(ids, id)
+	}
+	if want := []string{"id: 1", "id: 2", "id: 3"}; strings.Join(ids, ",") != strings.Join(want, ",") {
+		t.Errorf("event ids = %v, want %v", ids, want)
+	}
+}
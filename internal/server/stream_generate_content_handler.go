@@ -2,14 +2,15 @@ package server
 
 import (
 	"encoding/json"
-	"errors"
-	"fmt"
 	"io"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/dvcrn/antigravity-proxy/internal/antigravity"
 	"github.com/dvcrn/antigravity-proxy/internal/logger"
+	"github.com/dvcrn/antigravity-proxy/internal/timing"
+	"github.com/dvcrn/antigravity-proxy/internal/transform"
 )
 
 func (s *Server) streamGenerateContentHandler(w http.ResponseWriter, r *http.Request) {
@@ -17,9 +18,9 @@ func (s *Server) streamGenerateContentHandler(w http.ResponseWriter, r *http.Req
 
 	model, action := parseGeminiPath(r.URL.Path)
 
-	normalizedModel := normalizeModelName(model)
+	normalizedModel := normalizeModelName(transform.ResolveModelAlias(model))
 
-	logger.Get().Info().
+	logger.Sampled(r.Context()).Info().
 		Str("method", r.Method).
 		Str("path", r.URL.Path).
 		Str("query", r.URL.RawQuery).
@@ -35,11 +36,15 @@ func (s *Server) streamGenerateContentHandler(w http.ResponseWriter, r *http.Req
 		Int64("content_length", r.ContentLength).
 		Msg("Request headers")
 
+	if !allowMethods(w, r, http.MethodPost) {
+		return
+	}
+
 	if model == "" || action == "" {
 		logger.Get().Error().
 			Str("path", r.URL.Path).
 			Msg("Invalid path format")
-		http.Error(w, "Invalid path format", http.StatusBadRequest)
+		writeGeminiError(w, http.StatusBadRequest, "INVALID_ARGUMENT", "Invalid path format")
 		return
 	}
 
@@ -54,11 +59,11 @@ func (s *Server) streamGenerateContentHandler(w http.ResponseWriter, r *http.Req
 		logger.Get().Warn().
 			Str("action", action).
 			Msg("Unknown action")
-		http.Error(w, "Unknown action: "+action, http.StatusBadRequest)
+		writeGeminiError(w, http.StatusBadRequest, "INVALID_ARGUMENT", "Unknown action: "+action)
 		return
 	}
 
-	logger.Get().Info().
+	logger.Sampled(r.Context()).Info().
 		Dur("duration", time.Since(startTime)).
 		Str("action", action).
 		Msg("Gemini API request completed")
@@ -67,24 +72,36 @@ func (s *Server) streamGenerateContentHandler(w http.ResponseWriter, r *http.Req
 func (s *Server) handleGenerateContent(w http.ResponseWriter, r *http.Request, model string) {
 	startTime := time.Now()
 
-	logger.Get().Info().
+	logger.Sampled(r.Context()).Info().
 		Str("model", model).
 		Msg("Handling generateContent")
 
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
 		logger.Get().Error().Err(err).Msg("Failed to read request body")
-		http.Error(w, "Error reading request body", http.StatusBadRequest)
+		writeGeminiError(w, http.StatusBadRequest, "INVALID_ARGUMENT", "Error reading request body")
 		return
 	}
 	defer r.Body.Close()
 
+	client, projectID, ok := s.resolveAccount(w, r)
+	if !ok {
+		return
+	}
+
+	rec := timing.FromContext(r.Context())
+	transformStart := time.Now()
 	var requestBody antigravity.GeminiInternalRequest
-	if err := json.Unmarshal(body, &requestBody); err != nil {
+	if err := decodeRequestBody(body, &requestBody); err != nil {
 		logger.Get().Error().Err(err).Msg("Failed to parse request body")
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		if isUnknownFieldError(err) {
+			writeGeminiError(w, http.StatusBadRequest, "INVALID_ARGUMENT", strings.TrimPrefix(err.Error(), "json: "))
+			return
+		}
+		writeGeminiError(w, http.StatusBadRequest, "INVALID_ARGUMENT", "Invalid JSON")
 		return
 	}
+	rec.Since(timing.PhaseTransform, timing.PhaseTransformDesc, transformStart)
 
 	logger.Get().Debug().
 		Str("model", model).
@@ -93,30 +110,27 @@ func (s *Server) handleGenerateContent(w http.ResponseWriter, r *http.Request, m
 
 	genReq := &antigravity.GenerateContentRequest{
 		Model:   model,
-		Project: s.projectID,
+		Project: projectID,
 		Request: requestBody,
 	}
+	applySessionHeader(r, genReq)
+	if writeDryRun(w, r, genReq) {
+		return
+	}
 
 	apiCallStart := time.Now()
-	resp, err := s.antigravityClient.GenerateContent(genReq)
+	stopUpstreamTiming := startUpstreamTiming(rec)
+	resp, err := client.GenerateContentWithFallback(r.Context(), genReq)
+	stopUpstreamTiming()
 	if err != nil {
 		logger.Get().Error().
 			Err(err).
+			Int("upstream_status", upstreamStatus(err)).
 			Str("model", model).
 			Dur("api_call_duration", time.Since(apiCallStart)).
 			Msg("GenerateContent failed")
 
-		var upstreamErr *antigravity.UpstreamError
-		if ok := errors.As(err, &upstreamErr); ok {
-			if upstreamErr.ContentType != "" {
-				w.Header().Set("Content-Type", upstreamErr.ContentType)
-			}
-			w.WriteHeader(upstreamErr.StatusCode)
-			_, _ = w.Write(upstreamErr.Body)
-			return
-		}
-
-		http.Error(w, fmt.Sprintf("Error calling GenerateContent: %v", err), http.StatusInternalServerError)
+		writeGeminiUpstreamError(w, err)
 		return
 	}
 
@@ -124,15 +138,24 @@ func (s *Server) handleGenerateContent(w http.ResponseWriter, r *http.Request, m
 		Dur("api_call_duration", time.Since(apiCallStart)).
 		Msg("GenerateContent successful")
 
+	responseStart := time.Now()
+	respBody, err := json.Marshal(resp.Response)
+	if err != nil {
+		logger.Get().Error().Err(err).Msg("Failed to encode response")
+		writeGeminiError(w, http.StatusInternalServerError, "INTERNAL", "Failed to encode response")
+		return
+	}
+	rec.Since(timing.PhaseResponse, timing.PhaseResponseDesc, responseStart)
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 
-	if err := json.NewEncoder(w).Encode(resp.Response); err != nil {
-		logger.Get().Error().Err(err).Msg("Failed to encode response")
+	if _, err := w.Write(append(respBody, '\n')); err != nil {
+		logger.Get().Error().Err(err).Msg("Failed to write response")
 		return
 	}
 
-	logger.Get().Info().
+	logger.Sampled(r.Context()).Info().
 		Str("model", model).
 		Dur("total_duration", time.Since(startTime)).
 		Dur("api_call_duration", time.Since(apiCallStart)).
@@ -141,7 +164,7 @@ func (s *Server) handleGenerateContent(w http.ResponseWriter, r *http.Request, m
 
 func (s *Server) handleStreamGenerateContent(w http.ResponseWriter, r *http.Request, model string) {
 	startTime := time.Now()
-	logger.Get().Info().
+	logger.Sampled(r.Context()).Info().
 		Str("model", model).
 		Msg("Handling streamGenerateContent")
 
@@ -149,31 +172,51 @@ func (s *Server) handleStreamGenerateContent(w http.ResponseWriter, r *http.Requ
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
 		logger.Get().Error().Err(err).Msg("Failed to read request body")
-		http.Error(w, "Error reading request body", http.StatusBadRequest)
+		writeGeminiError(w, http.StatusBadRequest, "INVALID_ARGUMENT", "Error reading request body")
 		return
 	}
 	defer r.Body.Close()
 
+	client, projectID, ok := s.resolveAccount(w, r)
+	if !ok {
+		return
+	}
+
+	rec := timing.FromContext(r.Context())
+	transformStart := time.Now()
 	var requestBody antigravity.GeminiInternalRequest
-	if err := json.Unmarshal(body, &requestBody); err != nil {
+	if err := decodeRequestBody(body, &requestBody); err != nil {
 		logger.Get().Error().Err(err).Msg("Failed to parse request body")
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		if isUnknownFieldError(err) {
+			writeGeminiError(w, http.StatusBadRequest, "INVALID_ARGUMENT", strings.TrimPrefix(err.Error(), "json: "))
+			return
+		}
+		writeGeminiError(w, http.StatusBadRequest, "INVALID_ARGUMENT", "Invalid JSON")
 		return
 	}
+	rec.Since(timing.PhaseTransform, timing.PhaseTransformDesc, transformStart)
 
 	// Build CloudCode request wrapper
 	genReq := &antigravity.GenerateContentRequest{
 		Model:   model,
-		Project: s.projectID,
+		Project: projectID,
 		Request: requestBody,
 	}
+	applySessionHeader(r, genReq)
+	if writeDryRun(w, r, genReq) {
+		return
+	}
 
 	// Start upstream streaming and pipe raw lines
 	lines := make(chan string, 16)
 	apiCallStart := time.Now()
-	if err := s.antigravityClient.StreamGenerateContent(r.Context(), genReq, lines); err != nil {
+	stopUpstreamTiming := startUpstreamTiming(rec)
+	err = client.StreamGenerateContent(r.Context(), genReq, lines)
+	stopUpstreamTiming()
+	if err != nil {
 		logger.Get().Error().
 			Err(err).
+			Int("upstream_status", upstreamStatus(err)).
 			Str("model", model).
 			Dur("api_call_duration", time.Since(apiCallStart)).
 			Msg("StreamGenerateContent failed")
@@ -233,17 +276,7 @@ func (s *Server) handleStreamGenerateContent(w http.ResponseWriter, r *http.Requ
 			Int("max_output_tokens", maxTok).
 			Msg("Upstream request summary (on error)")
 
-		var upstreamErr *antigravity.UpstreamError
-		if ok := errors.As(err, &upstreamErr); ok {
-			if upstreamErr.ContentType != "" {
-				w.Header().Set("Content-Type", upstreamErr.ContentType)
-			}
-			w.WriteHeader(upstreamErr.StatusCode)
-			_, _ = w.Write(upstreamErr.Body)
-			return
-		}
-
-		http.Error(w, fmt.Sprintf("Error calling StreamGenerateContent: %v", err), http.StatusInternalServerError)
+		writeGeminiUpstreamError(w, err)
 		return
 	}
 
@@ -261,7 +294,15 @@ func (s *Server) handleStreamGenerateContent(w http.ResponseWriter, r *http.Requ
 		flusher.Flush()
 	}
 
-	// Stream loop: transform data lines and forward to client
+	// Transform CloudCode SSE into this endpoint's format (standard Gemini)
+	transformStream := streamTransformForPath(r.URL.Path)
+	out := withEventIDs(transformStream(lines, streamTransformOptions{}))
+	defer drainStream(out)
+
+	// Stream loop: forward transformed lines to client
+	stop, done := s.trackStream()
+	defer done()
+	stats := newStreamStats(model, startTime)
 	firstWrite := true
 	// Send SSE keepalives until first upstream byte to avoid idle timeouts
 	ticker := time.NewTicker(15 * time.Second)
@@ -270,26 +311,30 @@ streamLoop:
 	for {
 		select {
 		case <-r.Context().Done():
-			logger.Get().Info().Msg("Client canceled SSE stream")
+			logger.Sampled(r.Context()).Info().Msg("Client canceled SSE stream")
+			return
+
+		case <-stop:
+			// Returning cancels the upstream request, which closes lines
+			logger.Get().Warn().Str("model", model).Msg("Terminating Gemini stream for shutdown")
+			writeGeminiShutdownErrorEvent(w)
 			return
 
-		case line, ok := <-lines:
+		case transformed, ok := <-out:
 			if !ok {
-				logger.Get().Info().Msg("Upstream stream ended")
+				logger.Sampled(r.Context()).Info().Msg("Upstream stream ended")
 				break streamLoop
 			}
 			if firstWrite {
-				logger.Get().Info().
+				logger.Sampled(r.Context()).Info().
 					Dur("time_to_first_write", time.Since(startTime)).
 					Msg("First SSE data written to client (direct stream)")
 				firstWrite = false
 			}
 
-			// Transform CloudCode SSE line into standard Gemini format
-			transformed := TransformSSELine(line)
+			stats.observeLine(transformed)
 
-			// Write transformed line and a newline; upstream blank lines will pass through too
-			if _, err := fmt.Fprintf(w, "%s\n", transformed); err != nil {
+			if _, err := io.WriteString(w, transformed); err != nil {
 				logger.Get().Error().Err(err).Msg("Error writing SSE line to client")
 				return
 			}
@@ -314,9 +359,10 @@ streamLoop:
 		}
 	}
 
-	logger.Get().Info().
+	logger.Sampled(r.Context()).Info().
 		Str("model", model).
 		Dur("total_duration", time.Since(startTime)).
 		Dur("api_call_duration", time.Since(apiCallStart)).
 		Msg("streamGenerateContent completed")
+	stats.log()
 }
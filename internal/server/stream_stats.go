@@ -0,0 +1,120 @@
+package server
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/dvcrn/antigravity-proxy/internal/logger"
+)
+
+// streamStats tracks timing and token usage across a streamed response so a single
+// summary line can be logged when the stream completes.
+type streamStats struct {
+	model      string
+	start      time.Time
+	firstToken time.Time
+
+	promptTokens int
+	outputTokens int
+	totalTokens  int
+}
+
+func newStreamStats(model string, start time.Time) *streamStats {
+	if start.IsZero() {
+		start = time.Now()
+	}
+	return &streamStats{model: model, start: start}
+}
+
+// observeLine inspects a Gemini-format SSE line ("data: {...}").
+func (s *streamStats) observeLine(line string) {
+	// Skip the SSE id field added by withEventIDs
+	if strings.HasPrefix(line, "id: ") {
+		_, line, _ = strings.Cut(line, "\n")
+	}
+	data := strings.TrimSpace(strings.TrimPrefix(line, "data: "))
+	if data == "" || !strings.HasPrefix(data, "{") {
+		return
+	}
+	var obj map[string]interface{}
+	if err := json.Unmarshal([]byte(data), &obj); err != nil {
+		return
+	}
+	s.observe(obj)
+}
+
+// observe inspects a parsed Gemini stream event, recording the first content token
+// and the latest usageMetadata (the final event carries the totals).
+func (s *streamStats) observe(obj map[string]interface{}) {
+	if s.firstToken.IsZero() && eventHasContent(obj) {
+		s.firstToken = time.Now()
+	}
+
+	um, ok := obj["usageMetadata"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	if v, ok := um["promptTokenCount"].(float64); ok {
+		s.promptTokens = int(v)
+	}
+	if v, ok := um["candidatesTokenCount"].(float64); ok {
+		s.outputTokens = int(v)
+	}
+	if v, ok := um["totalTokenCount"].(float64); ok {
+		s.totalTokens = int(v)
+	} else {
+		s.totalTokens = s.promptTokens + s.outputTokens
+	}
+}
+
+// eventHasContent reports whether any candidate part carries text or a function call.
+func eventHasContent(obj map[string]interface{}) bool {
+	cands, _ := obj["candidates"].([]interface{})
+	for _, c := range cands {
+		cand, _ := c.(map[string]interface{})
+		content, _ := cand["content"].(map[string]interface{})
+		parts, _ := content["parts"].([]interface{})
+		for _, p := range parts {
+			part, _ := p.(map[string]interface{})
+			if txt, ok := part["text"].(string); ok && txt != "" {
+				return true
+			}
+			if _, ok := part["functionCall"]; ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// tokensPerSecond returns the output token rate over the generation window (first token
+// to now), falling back to the whole request duration when no token was seen.
+func (s *streamStats) tokensPerSecond(now time.Time) float64 {
+	from := s.firstToken
+	if from.IsZero() {
+		from = s.start
+	}
+	elapsed := now.Sub(from).Seconds()
+	if elapsed <= 0 || s.outputTokens == 0 {
+		return 0
+	}
+	return float64(s.outputTokens) / elapsed
+}
+
+// log emits the stream summary line.
+func (s *streamStats) log() {
+	now := time.Now()
+	event := logger.Get().Info().
+		Str("model", s.model).
+		Dur("total_duration", now.Sub(s.start))
+	if !s.firstToken.IsZero() {
+		event = event.Dur("time_to_first_token", s.firstToken.Sub(s.start))
+	}
+	event.
+		Int("prompt_tokens", s.promptTokens).
+		Int("output_tokens", s.outputTokens).
+		Int("total_tokens", s.totalTokens).
+		Float64("tokens_per_sec", s.tokensPerSecond(now)).
+		Msg("Stream summary")
+}
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/dvcrn/antigravity-proxy/internal/env"
+	"github.com/dvcrn/antigravity-proxy/internal/timing"
+)
+
+// serverTimingMiddleware attaches a timing recorder to the request context and emits the
+// recorded phases as a Server-Timing header when SERVER_TIMING=true.
+// The header is written with the response headers, so streaming responses only include the
+// phases completed before the first byte was sent.
+func (s *Server) serverTimingMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if env.GetOrDefault("SERVER_TIMING", "false") != "true" {
+			next(w, r)
+			return
+		}
+
+		rec := timing.NewRecorder()
+		tw := &timingResponseWriter{ResponseWriter: w, rec: rec}
+		next(tw, r.WithContext(timing.WithRecorder(r.Context(), rec)))
+	}
+}
+
+// timingResponseWriter sets the Server-Timing header right before headers are sent.
+type timingResponseWriter struct {
+	http.ResponseWriter
+	rec         *timing.Recorder
+	wroteHeader bool
+}
+
+func (tw *timingResponseWriter) WriteHeader(status int) {
+	if !tw.wroteHeader {
+		tw.wroteHeader = true
+		if h := tw.rec.Header(); h != "" {
+			tw.Header().Set("Server-Timing", h)
+		}
+	}
+	tw.ResponseWriter.WriteHeader(status)
+}
+
+func (tw *timingResponseWriter) Write(b []byte) (int, error) {
+	if !tw.wroteHeader {
+		tw.WriteHeader(http.StatusOK)
+	}
+	return tw.ResponseWriter.Write(b)
+}
+
+// Flush preserves streaming support for the wrapped writer.
+func (tw *timingResponseWriter) Flush() {
+	if !tw.wroteHeader {
+		tw.WriteHeader(http.StatusOK)
+	}
+	if f, ok := tw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// startUpstreamTiming begins timing an upstream call. The returned func records the
+// upstream phase, excluding any credential load/refresh time recorded during the call.
+func startUpstreamTiming(rec *timing.Recorder) func() {
+	start := time.Now()
+	credBefore := rec.Duration(timing.PhaseCredentials)
+	return func() {
+		credDuring := rec.Duration(timing.PhaseCredentials) - credBefore
+		rec.Add(timing.PhaseUpstream, timing.PhaseUpstreamDesc, time.Since(start)-credDuring)
+	}
+}
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dvcrn/antigravity-proxy/internal/timing"
+)
+
+func TestServerTimingHeaderContainsPhases(t *testing.T) {
+	t.Setenv("SERVER_TIMING", "true")
+
+	s := &Server{}
+	handler := s.serverTimingMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		rec := timing.FromContext(r.Context())
+		if rec == nil {
+			t.Fatal("expected a timing recorder on the request context")
+		}
+		rec.Add(timing.PhaseTransform, timing.PhaseTransformDesc, time.Millisecond)
+		stop := startUpstreamTiming(rec)
+		// Credential time recorded during the upstream call is reported separately
+		rec.Add(timing.PhaseCredentials, timing.PhaseCredentialsDesc, 2*time.Millisecond)
+		stop()
+		rec.Add(timing.PhaseResponse, timing.PhaseResponseDesc, time.Millisecond)
+		_, _ = w.Write([]byte("{}"))
+	})
+
+	rr := httptest.NewRecorder()
+	handler(rr, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil))
+
+	header := rr.Header().Get("Server-Timing")
+	for _, phase := range []string{"transform;", "cred;", "upstream;", "response;"} {
+		if !strings.Contains(header, phase) {
+			t.Errorf("expected Server-Timing header to contain %q, got %q", phase, header)
+		}
+	}
+}
+
+func TestServerTimingHeaderDisabledByDefault(t *testing.T) {
+	t.Setenv("SERVER_TIMING", "")
+
+	s := &Server{}
+	handler := s.serverTimingMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		timing.FromContext(r.Context()).Add(timing.PhaseTransform, "", time.Millisecond)
+		_, _ = w.Write([]byte("{}"))
+	})
+
+	rr := httptest.NewRecorder()
+	handler(rr, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil))
+
+	if header := rr.Header().Get("Server-Timing"); header != "" {
+		t.Errorf("expected no Server-Timing header, got %q", header)
+	}
+}
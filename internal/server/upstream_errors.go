@@ -0,0 +1,210 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/dvcrn/antigravity-proxy/internal/antigravity"
+	"github.com/dvcrn/antigravity-proxy/internal/logger"
+)
+
+// googleErrorBody is Google's API error shape: {"error":{"code","message","status"}}.
+type googleErrorBody struct {
+	Error struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Status  string `json:"status"`
+	} `json:"error"`
+}
+
+// upstreamErrorDetails is the client-safe view of an upstream failure.
+type upstreamErrorDetails struct {
+	StatusCode int
+	Message    string
+	// Status is Google's status string, e.g. RESOURCE_EXHAUSTED
+	Status string
+	// RetryAfter is upstream's RetryInfo delay, or 0 when it sent none
+	RetryAfter time.Duration
+	// QuotaMetric is the first QuotaFailure metric, for logging
+	QuotaMetric string
+}
+
+// upstreamStatus returns the HTTP status of the UpstreamError wrapped in err, or 0 when
+// the call failed before upstream answered. Use it when logging upstream failures.
+func upstreamStatus(err error) int {
+	var upstreamErr *antigravity.UpstreamError
+	if errors.As(err, &upstreamErr) {
+		return upstreamErr.StatusCode
+	}
+	return 0
+}
+
+// parseUpstreamError classifies err into the status and message returned to the client:
+//   - missing or unrefreshable credentials are a 401
+//   - upstream 4xx responses keep their status and Google error message
+//   - upstream 5xx responses, as the last of all endpoints failing, are a 502
+//   - network errors are a 502, or a 504 when the request timed out
+//
+// The endpoint URL and raw body are left out; callers log err for the full details.
+func parseUpstreamError(err error) upstreamErrorDetails {
+	status := upstreamStatus(err)
+	if status == 0 {
+		return classifyRequestError(err)
+	}
+
+	details := upstreamErrorDetails{
+		StatusCode: status,
+		Message:    "Upstream request failed with status " + http.StatusText(status),
+	}
+
+	var upstreamErr *antigravity.UpstreamError
+	errors.As(err, &upstreamErr)
+
+	var body googleErrorBody
+	if json.Unmarshal(upstreamErr.Body, &body) == nil && body.Error.Message != "" {
+		details.Message = body.Error.Message
+		details.Status = body.Error.Status
+	}
+
+	// Endpoints are tried in turn, so a 5xx here means every one of them failed
+	if status >= http.StatusInternalServerError {
+		details.StatusCode = http.StatusBadGateway
+		if body.Error.Message != "" {
+			details.Message = "All upstream endpoints failed: " + body.Error.Message
+		} else {
+			details.Message = "All upstream endpoints failed with status " + http.StatusText(status)
+		}
+	}
+
+	errDetails := upstreamErr.Details()
+	details.RetryAfter = errDetails.RetryDelay
+	if len(errDetails.QuotaViolations) > 0 {
+		details.QuotaMetric = errDetails.QuotaViolations[0].QuotaMetric
+	}
+	return details
+}
+
+// classifyRequestError handles failures where no upstream response was received.
+func classifyRequestError(err error) upstreamErrorDetails {
+	var urlErr *url.Error
+	switch {
+	case errors.Is(err, antigravity.ErrCredentials):
+		return upstreamErrorDetails{
+			StatusCode: http.StatusUnauthorized,
+			Message:    "No valid upstream credentials; log in again or check the configured account",
+		}
+	case errors.Is(err, context.DeadlineExceeded):
+		return upstreamErrorDetails{
+			StatusCode: http.StatusGatewayTimeout,
+			Message:    "Upstream request timed out",
+		}
+	case errors.As(err, &urlErr):
+		return upstreamErrorDetails{
+			StatusCode: http.StatusBadGateway,
+			Message:    "Could not reach upstream",
+		}
+	}
+	return upstreamErrorDetails{
+		StatusCode: http.StatusInternalServerError,
+		Message:    "Upstream request failed",
+	}
+}
+
+// setRetryAfter sets the Retry-After header, in whole seconds rounded up, when upstream
+// said how long to back off.
+func setRetryAfter(w http.ResponseWriter, delay time.Duration) {
+	if delay <= 0 {
+		return
+	}
+	seconds := int64((delay + time.Second - 1) / time.Second)
+	w.Header().Set("Retry-After", strconv.FormatInt(seconds, 10))
+}
+
+// openAIErrorType maps an HTTP status to the closest OpenAI error type.
+func openAIErrorType(status int) string {
+	switch status {
+	case http.StatusBadRequest, http.StatusNotFound, http.StatusRequestEntityTooLarge:
+		return "invalid_request_error"
+	case http.StatusUnauthorized:
+		return "authentication_error"
+	case http.StatusForbidden:
+		return "permission_error"
+	case http.StatusTooManyRequests:
+		return "rate_limit_error"
+	default:
+		return "api_error"
+	}
+}
+
+// writeUpstreamError writes an OpenAI-style error for a failed upstream call, preserving
+// the upstream status code.
+func writeUpstreamError(w http.ResponseWriter, err error) {
+	details := parseUpstreamError(err)
+	logger.Get().Debug().
+		Err(err).
+		Int("status", details.StatusCode).
+		Dur("retry_after", details.RetryAfter).
+		Str("quota_metric", details.QuotaMetric).
+		Msg("Returning upstream error to client")
+	setRetryAfter(w, details.RetryAfter)
+	writeAPIError(w, details.StatusCode, openAIErrorType(details.StatusCode), details.Message, details.Status)
+}
+
+// writeUpstreamErrorEvent writes an OpenAI-style error as an SSE "error" event followed
+// by [DONE], for streams whose 200 status was already sent. The upstream HTTP status is
+// carried in error.status_code since it can no longer be set on the response.
+func writeUpstreamErrorEvent(w http.ResponseWriter, err error) {
+	details := parseUpstreamError(err)
+	var resp apiErrorResponse
+	resp.Type = "error"
+	resp.Error.Type = openAIErrorType(details.StatusCode)
+	resp.Error.Message = details.Message
+	resp.Error.Code = details.Status
+	resp.Error.StatusCode = details.StatusCode
+	data, _ := json.Marshal(resp)
+	_, _ = fmt.Fprintf(w, "event: error\ndata: %s\n\ndata: [DONE]\n\n", data)
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// writeGeminiError writes a proxy-side failure in Google's error format, for the
+// Gemini-native routes. status is Google's status string, e.g. INVALID_ARGUMENT.
+func writeGeminiError(w http.ResponseWriter, code int, status, message string) {
+	var body googleErrorBody
+	body.Error.Code = code
+	body.Error.Message = message
+	body.Error.Status = status
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+// writeGeminiUpstreamError writes a Gemini-style error for a failed upstream call,
+// preserving the upstream status code.
+func writeGeminiUpstreamError(w http.ResponseWriter, err error) {
+	details := parseUpstreamError(err)
+	logger.Get().Debug().
+		Err(err).
+		Int("status", details.StatusCode).
+		Dur("retry_after", details.RetryAfter).
+		Str("quota_metric", details.QuotaMetric).
+		Msg("Returning upstream error to client")
+	setRetryAfter(w, details.RetryAfter)
+
+	var body googleErrorBody
+	body.Error.Code = details.StatusCode
+	body.Error.Message = details.Message
+	body.Error.Status = details.Status
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(details.StatusCode)
+	_ = json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,263 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/dvcrn/antigravity-proxy/internal/antigravity"
+	"github.com/dvcrn/antigravity-proxy/internal/logger"
+	"github.com/rs/zerolog"
+)
+
+func TestWriteUpstreamError(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		wantStatus  int
+		wantType    string
+		wantMessage string
+		wantCode    string
+		wantRetry   string
+	}{
+		{
+			name: "google rate limit keeps 429",
+			err: &antigravity.UpstreamError{
+				StatusCode: http.StatusTooManyRequests,
+				Body:       []byte(`{"error":{"code":429,"message":"Resource has been exhausted","status":"RESOURCE_EXHAUSTED"}}`),
+				Endpoint:   "https://internal.example.com",
+			},
+			wantStatus:  http.StatusTooManyRequests,
+			wantType:    "rate_limit_error",
+			wantMessage: "Resource has been exhausted",
+			wantCode:    "RESOURCE_EXHAUSTED",
+		},
+		{
+			name: "google bad request keeps 400",
+			err: &antigravity.UpstreamError{
+				StatusCode: http.StatusBadRequest,
+				Body:       []byte(`{"error":{"code":400,"message":"Invalid argument","status":"INVALID_ARGUMENT"}}`),
+			},
+			wantStatus:  http.StatusBadRequest,
+			wantType:    "invalid_request_error",
+			wantMessage: "Invalid argument",
+			wantCode:    "INVALID_ARGUMENT",
+		},
+		{
+			name: "retry info sets Retry-After",
+			err: &antigravity.UpstreamError{
+				StatusCode: http.StatusTooManyRequests,
+				Body:       []byte(`{"error":{"code":429,"message":"Quota exceeded","status":"RESOURCE_EXHAUSTED","details":[{"@type":"type.googleapis.com/google.rpc.RetryInfo","retryDelay":"2.5s"}]}}`),
+			},
+			wantStatus:  http.StatusTooManyRequests,
+			wantType:    "rate_limit_error",
+			wantMessage: "Quota exceeded",
+			wantCode:    "RESOURCE_EXHAUSTED",
+			wantRetry:   "3",
+		},
+		{
+			name: "non-JSON body falls back to generic message",
+			err: &antigravity.UpstreamError{
+				StatusCode: http.StatusBadGateway,
+				Body:       []byte("<html>bad gateway</html>"),
+			},
+			wantStatus:  http.StatusBadGateway,
+			wantType:    "api_error",
+			wantMessage: "All upstream endpoints failed with status Bad Gateway",
+		},
+		{
+			name: "upstream 5xx is a 502",
+			err: &antigravity.UpstreamError{
+				StatusCode: http.StatusServiceUnavailable,
+				Body:       []byte(`{"error":{"code":503,"message":"The service is currently unavailable","status":"UNAVAILABLE"}}`),
+			},
+			wantStatus:  http.StatusBadGateway,
+			wantType:    "api_error",
+			wantMessage: "All upstream endpoints failed: The service is currently unavailable",
+			wantCode:    "UNAVAILABLE",
+		},
+		{
+			name:        "missing credentials are a 401",
+			err:         fmt.Errorf("%w: unable to get credentials: %w", antigravity.ErrCredentials, errors.New("no credentials found in KV storage")),
+			wantStatus:  http.StatusUnauthorized,
+			wantType:    "authentication_error",
+			wantMessage: "No valid upstream credentials; log in again or check the configured account",
+		},
+		{
+			name:        "network error is a 502",
+			err:         fmt.Errorf("request execution error: %w", &url.Error{Op: "Post", URL: "https://internal.example.com", Err: errors.New("connection refused")}),
+			wantStatus:  http.StatusBadGateway,
+			wantType:    "api_error",
+			wantMessage: "Could not reach upstream",
+		},
+		{
+			name:        "timeout is a 504",
+			err:         fmt.Errorf("request execution error: %w", &url.Error{Op: "Post", URL: "https://internal.example.com", Err: context.DeadlineExceeded}),
+			wantStatus:  http.StatusGatewayTimeout,
+			wantType:    "api_error",
+			wantMessage: "Upstream request timed out",
+		},
+		{
+			name:        "unclassified error is a 500",
+			err:         errors.New("generateContent failed with no endpoints available"),
+			wantStatus:  http.StatusInternalServerError,
+			wantType:    "api_error",
+			wantMessage: "Upstream request failed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			writeUpstreamError(rr, tt.err)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rr.Code, tt.wantStatus)
+			}
+			if strings.Contains(rr.Body.String(), "example.com") || strings.Contains(rr.Body.String(), "<html>") {
+				t.Errorf("response leaks upstream details: %s", rr.Body.String())
+			}
+
+			var resp apiErrorResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("invalid error JSON: %v", err)
+			}
+			if resp.Error.Type != tt.wantType {
+				t.Errorf("type = %q, want %q", resp.Error.Type, tt.wantType)
+			}
+			if resp.Error.Message != tt.wantMessage {
+				t.Errorf("message = %q, want %q", resp.Error.Message, tt.wantMessage)
+			}
+			if resp.Error.Code != tt.wantCode {
+				t.Errorf("code = %q, want %q", resp.Error.Code, tt.wantCode)
+			}
+			if got := rr.Header().Get("Retry-After"); got != tt.wantRetry {
+				t.Errorf("Retry-After = %q, want %q", got, tt.wantRetry)
+			}
+		})
+	}
+}
+
+func TestWriteGeminiUpstreamError(t *testing.T) {
+	rr := httptest.NewRecorder()
+	writeGeminiUpstreamError(rr, &antigravity.UpstreamError{
+		StatusCode: http.StatusTooManyRequests,
+		Body:       []byte(`{"error":{"code":429,"message":"Quota exceeded","status":"RESOURCE_EXHAUSTED","details":[{"@type":"internal"}]}}`),
+	})
+
+	if rr.Code != http.StatusTooManyRequests {
+		t.Errorf("status = %d, want 429", rr.Code)
+	}
+	var body googleErrorBody
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatalf("invalid error JSON: %v", err)
+	}
+	if body.Error.Code != 429 || body.Error.Message != "Quota exceeded" || body.Error.Status != "RESOURCE_EXHAUSTED" {
+		t.Errorf("unexpected error body: %+v", body.Error)
+	}
+	if strings.Contains(rr.Body.String(), "details") {
+		t.Errorf("expected upstream details to be dropped: %s", rr.Body.String())
+	}
+}
+
+func TestWriteUpstreamErrorEvent(t *testing.T) {
+	rr := httptest.NewRecorder()
+	writeUpstreamErrorEvent(rr, &antigravity.UpstreamError{
+		StatusCode: http.StatusTooManyRequests,
+		Body:       []byte(`{"error":{"code":429,"message":"Resource has been exhausted","status":"RESOURCE_EXHAUSTED"}}`),
+	})
+
+	events := strings.Split(strings.TrimSpace(rr.Body.String()), "\n\n")
+	if len(events) != 2 || events[1] != "data: [DONE]" {
+		t.Fatalf("expected error event followed by [DONE], got %q", rr.Body.String())
+	}
+	if !strings.HasPrefix(events[0], "event: error\ndata: ") {
+		t.Fatalf("expected an SSE error event, got %q", events[0])
+	}
+	var resp apiErrorResponse
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(events[0], "event: error\ndata: ")), &resp); err != nil {
+		t.Fatalf("invalid error event JSON: %v", err)
+	}
+	if resp.Error.Type != "rate_limit_error" || resp.Error.Message != "Resource has been exhausted" {
+		t.Errorf("unexpected error event: %+v", resp.Error)
+	}
+	if resp.Error.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("status_code = %d, want 429", resp.Error.StatusCode)
+	}
+}
+
+func TestStreamingChatCompletionReturnsUpstreamStatusBeforeFirstByte(t *testing.T) {
+	s := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		_, _ = w.Write([]byte(`{"error":{"code":429,"message":"Resource has been exhausted","status":"RESOURCE_EXHAUSTED"}}`))
+	}))
+
+	body := `{"model":"gemini-3-flash","stream":true,"messages":[{"role":"user","content":"hi"}]}`
+	rr := httptest.NewRecorder()
+	s.openAIChatCompletionsHandler(rr, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body)))
+
+	if rr.Code != http.StatusTooManyRequests {
+		t.Errorf("status = %d, want 429", rr.Code)
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", ct)
+	}
+	var resp apiErrorResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid error JSON: %v (body %q)", err, rr.Body.String())
+	}
+	if resp.Error.Type != "rate_limit_error" || resp.Error.Code != "RESOURCE_EXHAUSTED" {
+		t.Errorf("unexpected error body: %+v", resp.Error)
+	}
+}
+
+func TestUpstreamStatus(t *testing.T) {
+	upstreamErr := &antigravity.UpstreamError{StatusCode: http.StatusServiceUnavailable}
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{name: "direct", err: upstreamErr, want: http.StatusServiceUnavailable},
+		{name: "wrapped", err: fmt.Errorf("generate: %w", upstreamErr), want: http.StatusServiceUnavailable},
+		{name: "double wrapped", err: fmt.Errorf("outer: %w", fmt.Errorf("inner: %w", upstreamErr)), want: http.StatusServiceUnavailable},
+		{name: "not an upstream error", err: errors.New("dial tcp: connection refused"), want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := upstreamStatus(tt.err); got != tt.want {
+				t.Errorf("upstreamStatus = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestModelsHandlerLogsUpstreamStatus(t *testing.T) {
+	s := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		_, _ = w.Write([]byte(`{"error":{"code":429,"message":"Quota exceeded","status":"RESOURCE_EXHAUSTED"}}`))
+	}))
+
+	var buf bytes.Buffer
+	original := *logger.Get()
+	*logger.Get() = zerolog.New(&buf)
+	defer func() { *logger.Get() = original }()
+
+	rr := httptest.NewRecorder()
+	s.modelsHandler(rr, httptest.NewRequest(http.MethodGet, "/v1/models", nil))
+
+	if rr.Code != http.StatusTooManyRequests {
+		t.Errorf("status = %d, want %d", rr.Code, http.StatusTooManyRequests)
+	}
+	if !strings.Contains(buf.String(), `"upstream_status":429`) {
+		t.Errorf("expected upstream_status in logs, got %s", buf.String())
+	}
+}
@@ -0,0 +1,31 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/dvcrn/antigravity-proxy/internal/antigravity"
+	"github.com/dvcrn/antigravity-proxy/internal/version"
+)
+
+type versionResponse struct {
+	version.Info
+	// UserAgentVersion and RequestUserAgent are what the proxy reports to CloudCode
+	UserAgentVersion string `json:"user_agent_version"`
+	RequestUserAgent string `json:"request_user_agent"`
+}
+
+// versionHandler handles GET /debug/version, reporting the proxy build and the client
+// identity it presents upstream.
+func (s *Server) versionHandler(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(versionResponse{
+		Info:             version.Get(),
+		UserAgentVersion: antigravity.UserAgentVersion(),
+		RequestUserAgent: antigravity.RequestUserAgent,
+	})
+}
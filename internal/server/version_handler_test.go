@@ -0,0 +1,43 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+
+	"github.com/dvcrn/antigravity-proxy/internal/antigravity"
+	"github.com/dvcrn/antigravity-proxy/internal/version"
+)
+
+func TestVersionHandler(t *testing.T) {
+	origVersion, origCommit, origBuildTime := version.Version, version.Commit, version.BuildTime
+	version.Version, version.Commit, version.BuildTime = "v1.2.3", "abc123", "2026-01-02T03:04:05Z"
+	defer func() { version.Version, version.Commit, version.BuildTime = origVersion, origCommit, origBuildTime }()
+
+	s := &Server{}
+	rr := httptest.NewRecorder()
+	s.versionHandler(rr, httptest.NewRequest(http.MethodGet, "/debug/version", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rr.Code, rr.Body.String())
+	}
+	var got map[string]string
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	want := map[string]string{
+		"version":            "v1.2.3",
+		"commit":             "abc123",
+		"build_time":         "2026-01-02T03:04:05Z",
+		"go_version":         runtime.Version(),
+		"user_agent_version": antigravity.UserAgentVersion(),
+		"request_user_agent": antigravity.RequestUserAgent,
+	}
+	for key, value := range want {
+		if got[key] != value {
+			t.Errorf("%s = %q, want %q", key, got[key], value)
+		}
+	}
+}
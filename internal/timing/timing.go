@@ -0,0 +1,104 @@
+package timing
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Phase names and descriptions recorded across the request lifecycle.
+const (
+	PhaseCredentials     = "cred"
+	PhaseCredentialsDesc = "Credential load/refresh"
+	PhaseTransform       = "transform"
+	PhaseTransformDesc   = "Request transform"
+	PhaseUpstream        = "upstream"
+	PhaseUpstreamDesc    = "Upstream call"
+	PhaseResponse        = "response"
+	PhaseResponseDesc    = "Response transform"
+)
+
+type contextKey struct{}
+
+// Recorder accumulates named phase durations for a single request.
+// A nil *Recorder is valid and ignores all calls, so callers don't need to check
+// whether timing is enabled.
+type Recorder struct {
+	mu     sync.Mutex
+	order  []string
+	phases map[string]time.Duration
+	descs  map[string]string
+}
+
+// NewRecorder creates an empty Recorder.
+func NewRecorder() *Recorder {
+	return &Recorder{
+		phases: map[string]time.Duration{},
+		descs:  map[string]string{},
+	}
+}
+
+// WithRecorder returns a context carrying the recorder.
+func WithRecorder(ctx context.Context, r *Recorder) context.Context {
+	return context.WithValue(ctx, contextKey{}, r)
+}
+
+// FromContext returns the recorder carried by ctx, or nil if there is none.
+func FromContext(ctx context.Context) *Recorder {
+	if ctx == nil {
+		return nil
+	}
+	r, _ := ctx.Value(contextKey{}).(*Recorder)
+	return r
+}
+
+// Add accumulates d into the named phase. Repeated calls for the same phase are summed.
+func (r *Recorder) Add(name string, desc string, d time.Duration) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.phases[name]; !ok {
+		r.order = append(r.order, name)
+		r.descs[name] = desc
+	}
+	r.phases[name] += d
+}
+
+// Since is shorthand for Add(name, desc, time.Since(start)).
+func (r *Recorder) Since(name string, desc string, start time.Time) {
+	r.Add(name, desc, time.Since(start))
+}
+
+// Duration returns the accumulated duration for the named phase.
+func (r *Recorder) Duration(name string) time.Duration {
+	if r == nil {
+		return 0
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.phases[name]
+}
+
+// Header formats the recorded phases as a Server-Timing header value, in the order
+// they were first recorded. Durations are in milliseconds.
+func (r *Recorder) Header() string {
+	if r == nil {
+		return ""
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entries := make([]string, 0, len(r.order))
+	for _, name := range r.order {
+		dur := float64(r.phases[name].Microseconds()) / 1000
+		if desc := r.descs[name]; desc != "" {
+			entries = append(entries, fmt.Sprintf("%s;desc=%q;dur=%.3f", name, desc, dur))
+		} else {
+			entries = append(entries, fmt.Sprintf("%s;dur=%.3f", name, dur))
+		}
+	}
+	return strings.Join(entries, ", ")
+}
@@ -0,0 +1,30 @@
+package transform
+
+import (
+	"github.com/dvcrn/antigravity-proxy/internal/anthropic"
+	"github.com/dvcrn/antigravity-proxy/internal/antigravity"
+)
+
+// AnthropicSystemToGemini converts an Anthropic system prompt into a Gemini system
+// instruction with one part per text block, in order. Blocks are not merged so
+// cache_control boundaries survive: cachedParts is the number of leading parts up to and
+// including the last block marked with cache_control (0 when none is marked), i.e. the
+// prefix to cache. Returns nil when the prompt has no text.
+func AnthropicSystemToGemini(system anthropic.SystemPrompt) (instruction *antigravity.SystemInstruction, cachedParts int) {
+	var parts []antigravity.ContentPart
+	for _, block := range system {
+		// Only text blocks are valid in "system"; empty parts are rejected upstream
+		if (block.Type != "" && block.Type != "text") || block.Text == "" {
+			continue
+		}
+		parts = append(parts, antigravity.ContentPart{Text: block.Text})
+		if block.CacheControl != nil {
+			cachedParts = len(parts)
+		}
+	}
+
+	if len(parts) == 0 {
+		return nil, 0
+	}
+	return &antigravity.SystemInstruction{Role: "user", Parts: parts}, cachedParts
+}
@@ -0,0 +1,68 @@
+package transform
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/dvcrn/antigravity-proxy/internal/anthropic"
+	"github.com/dvcrn/antigravity-proxy/internal/antigravity"
+)
+
+func TestAnthropicSystemToGemini(t *testing.T) {
+	testCases := []struct {
+		name         string
+		system       string
+		expected     *antigravity.SystemInstruction
+		expectCached int
+	}{
+		{
+			name:   "string form",
+			system: `"You are a helpful assistant."`,
+			expected: &antigravity.SystemInstruction{
+				Role:  "user",
+				Parts: []antigravity.ContentPart{{Text: "You are a helpful assistant."}},
+			},
+		},
+		{
+			name: "block-array form with cache_control",
+			system: `[
+				{"type":"text","text":"You are a coding agent."},
+				{"type":"text","text":"<large repository context>","cache_control":{"type":"ephemeral"}},
+				{"type":"text","text":""},
+				{"type":"text","text":"Today is Tuesday."}
+			]`,
+			expected: &antigravity.SystemInstruction{
+				Role: "user",
+				Parts: []antigravity.ContentPart{
+					{Text: "You are a coding agent."},
+					{Text: "<large repository context>"},
+					{Text: "Today is Tuesday."},
+				},
+			},
+			expectCached: 2,
+		},
+		{
+			name:     "empty string",
+			system:   `""`,
+			expected: nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var system anthropic.SystemPrompt
+			if err := json.Unmarshal([]byte(tc.system), &system); err != nil {
+				t.Fatalf("failed to unmarshal system: %v", err)
+			}
+
+			got, cached := AnthropicSystemToGemini(system)
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("AnthropicSystemToGemini() = %+v, want %+v", got, tc.expected)
+			}
+			if cached != tc.expectCached {
+				t.Errorf("cachedParts = %d, want %d", cached, tc.expectCached)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package transform
+
+import (
+	"strings"
+
+	"github.com/dvcrn/antigravity-proxy/internal/antigravity"
+	"github.com/dvcrn/antigravity-proxy/internal/logger"
+	"github.com/dvcrn/antigravity-proxy/internal/warnings"
+)
+
+// audioMimeTypes maps OpenAI input_audio formats to the audio MIME types Gemini accepts.
+var audioMimeTypes = map[string]string{
+	"wav":  "audio/wav",
+	"mp3":  "audio/mp3",
+	"aiff": "audio/aiff",
+	"aac":  "audio/aac",
+	"ogg":  "audio/ogg",
+	"flac": "audio/flac",
+}
+
+// convertInputAudio converts an OpenAI input_audio content part,
+// {"type":"input_audio","input_audio":{"data":"<base64>","format":"wav"}}, into Gemini
+// inline data. Parts without data or with an unsupported format are skipped with a warning.
+func convertInputAudio(part map[string]interface{}, warns *warnings.Collector) *antigravity.InlineData {
+	audio, _ := part["input_audio"].(map[string]interface{})
+	data, _ := audio["data"].(string)
+	format, _ := audio["format"].(string)
+	format = strings.ToLower(strings.TrimSpace(format))
+
+	if data == "" {
+		logger.Get().Warn().Msg("Skipping input_audio part without data")
+		warns.Addf("skipped input_audio part without data")
+		return nil
+	}
+	mimeType, ok := audioMimeTypes[format]
+	if !ok {
+		logger.Get().Warn().Str("format", format).Msg("Skipping input_audio part with unsupported format")
+		warns.Addf("skipped input_audio part with unsupported format %q", format)
+		return nil
+	}
+	return &antigravity.InlineData{MimeType: mimeType, Data: data}
+}
@@ -0,0 +1,69 @@
+package transform
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/dvcrn/antigravity-proxy/internal/antigravity"
+	"github.com/dvcrn/antigravity-proxy/internal/openai"
+)
+
+func TestInputAudioParts(t *testing.T) {
+	testCases := []struct {
+		name     string
+		audio    string
+		expected []antigravity.ContentPart
+	}{
+		{
+			name:  "wav becomes inline data",
+			audio: `{"data":"UklGRg==","format":"wav"}`,
+			expected: []antigravity.ContentPart{
+				{Text: "Transcribe this"},
+				{InlineData: &antigravity.InlineData{MimeType: "audio/wav", Data: "UklGRg=="}},
+			},
+		},
+		{
+			name:  "mp3 becomes inline data",
+			audio: `{"data":"SUQz","format":"MP3"}`,
+			expected: []antigravity.ContentPart{
+				{Text: "Transcribe this"},
+				{InlineData: &antigravity.InlineData{MimeType: "audio/mp3", Data: "SUQz"}},
+			},
+		},
+		{
+			name:     "unsupported format is skipped",
+			audio:    `{"data":"AAAA","format":"midi"}`,
+			expected: []antigravity.ContentPart{{Text: "Transcribe this"}},
+		},
+		{
+			name:     "missing data is skipped",
+			audio:    `{"format":"wav"}`,
+			expected: []antigravity.ContentPart{{Text: "Transcribe this"}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			body := `{"model":"gemini-3-flash","messages":[{"role":"user","content":[
+				{"type":"text","text":"Transcribe this"},
+				{"type":"input_audio","input_audio":` + tc.audio + `}
+			]}]}`
+			var req openai.ChatCompletionRequest
+			if err := json.Unmarshal([]byte(body), &req); err != nil {
+				t.Fatalf("failed to unmarshal request: %v", err)
+			}
+
+			got, err := ToGeminiRequest(&req, "test-project")
+			if err != nil {
+				t.Fatalf("ToGeminiRequest returned error: %v", err)
+			}
+			if len(got.Request.Contents) != 1 {
+				t.Fatalf("expected 1 content, got %+v", got.Request.Contents)
+			}
+			if parts := got.Request.Contents[0].Parts; !reflect.DeepEqual(parts, tc.expected) {
+				t.Errorf("parts = %+v, want %+v", parts, tc.expected)
+			}
+		})
+	}
+}
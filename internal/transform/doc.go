@@ -0,0 +1,12 @@
+// Package transform converts between the OpenAI, Anthropic and Gemini request and
+// response formats and the CloudCode wire format.
+//
+// The exported functions are the supported entry points for using the conversions
+// without the HTTP server: ToGeminiRequest and ToGeminiRequestWithWarnings convert a
+// whole chat completion request, ConvertMessages and ConvertTools convert messages and
+// tools on their own with the same behavior, and ToOpenAIChatCompletionResponse
+// converts the result back. Everything unexported may change between releases.
+//
+// Conversions read their env configuration (MODEL_ALIASES, DEFAULT_MODEL, tool limits,
+// ...) the same way the proxy does.
+package transform
@@ -0,0 +1,144 @@
+package transform
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/dvcrn/antigravity-proxy/internal/antigravity"
+	"github.com/dvcrn/antigravity-proxy/internal/logger"
+	"github.com/dvcrn/antigravity-proxy/internal/warnings"
+)
+
+// documentMimeTypes are the document types accepted as inline file_data, keyed by the
+// file extension used when the data isn't a data URL.
+var documentMimeTypes = map[string]string{
+	".pdf":  "application/pdf",
+	".txt":  "text/plain",
+	".md":   "text/markdown",
+	".csv":  "text/csv",
+	".html": "text/html",
+	".xml":  "text/xml",
+	".rtf":  "text/rtf",
+}
+
+// mediaMimeTypes type file_uri parts that don't declare a mime_type, keyed by the
+// extension of the URI's path. Documents fall back to documentMimeTypes.
+var mediaMimeTypes = map[string]string{
+	".mp4":  "video/mp4",
+	".mpeg": "video/mpeg",
+	".mov":  "video/mov",
+	".avi":  "video/avi",
+	".webm": "video/webm",
+	".wmv":  "video/wmv",
+	".flv":  "video/x-flv",
+	".3gp":  "video/3gpp",
+	".mp3":  "audio/mp3",
+	".wav":  "audio/wav",
+	".aac":  "audio/aac",
+	".ogg":  "audio/ogg",
+	".flac": "audio/flac",
+	".png":  "image/png",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".webp": "image/webp",
+	".heic": "image/heic",
+	".heif": "image/heif",
+}
+
+// ErrFileMimeTypeUnknown is returned when a file_uri part has no mime_type and
+// none can be inferred from the URI's extension; Gemini rejects fileData without one.
+var ErrFileMimeTypeUnknown = errors.New("file part mime type unknown")
+
+// convertFilePart converts a file content part into a Gemini part. Parts referencing
+// uploaded media, {"type":"file","file":{"file_uri":"gs://...","mime_type":"video/mp4"}},
+// become fileData so large media isn't inlined. Inline documents,
+// {"type":"file","file":{"filename":"doc.pdf","file_data":"data:application/pdf;base64,..."}},
+// become inlineData. Anything else (e.g. an OpenAI file_id) is skipped with a warning.
+// A file_uri without mime_type is typed by its extension, or rejected with
+// ErrFileMimeTypeUnknown.
+func convertFilePart(part map[string]interface{}, warns *warnings.Collector) (antigravity.ContentPart, bool, error) {
+	file, _ := part["file"].(map[string]interface{})
+	uri, _ := file["file_uri"].(string)
+	mimeType, _ := file["mime_type"].(string)
+
+	if uri = strings.TrimSpace(uri); uri != "" {
+		mimeType = strings.TrimSpace(mimeType)
+		if mimeType == "" {
+			mimeType = mimeTypeFromURI(uri)
+		}
+		if mimeType == "" {
+			return antigravity.ContentPart{}, false, fmt.Errorf("%w: set mime_type for file_uri %q", ErrFileMimeTypeUnknown, uri)
+		}
+		return antigravity.ContentPart{
+			FileData: &antigravity.FileData{MimeType: mimeType, FileURI: uri},
+		}, true, nil
+	}
+
+	if data, _ := file["file_data"].(string); data != "" {
+		filename, _ := file["filename"].(string)
+		inline, reason := convertFileData(data, filename)
+		if inline == nil {
+			logger.Get().Warn().Str("filename", filename).Str("reason", reason).Msg("Skipping file part")
+			warns.Addf("skipped file part %q: %s", filename, reason)
+			return antigravity.ContentPart{}, false, nil
+		}
+		return antigravity.ContentPart{InlineData: inline}, true, nil
+	}
+
+	logger.Get().Warn().Msg("Skipping file part without file_uri or file_data")
+	warns.Addf("skipped file part without file_uri or file_data")
+	return antigravity.ContentPart{}, false, nil
+}
+
+// mimeTypeFromURI infers a mime type from the extension of uri's path, ignoring any
+// query string. It returns "" when the extension is missing or unknown.
+func mimeTypeFromURI(uri string) string {
+	p := uri
+	if u, err := url.Parse(uri); err == nil {
+		p = u.Path
+	}
+	ext := strings.ToLower(path.Ext(p))
+	if mimeType, ok := mediaMimeTypes[ext]; ok {
+		return mimeType
+	}
+	return documentMimeTypes[ext]
+}
+
+// convertFileData decodes file_data, a base64 data URL or raw base64 typed by the
+// filename's extension, into inline data. It returns the reason when the data is
+// rejected.
+func convertFileData(data, filename string) (*antigravity.InlineData, string) {
+	mimeType := documentMimeTypes[strings.ToLower(path.Ext(filename))]
+	if rest, ok := strings.CutPrefix(data, "data:"); ok {
+		header, encoded, found := strings.Cut(rest, ",")
+		declared, isBase64 := strings.CutSuffix(header, ";base64")
+		if !found || !isBase64 {
+			return nil, "file_data is not a base64 data URL"
+		}
+		mimeType, data = declared, encoded
+	}
+
+	if !isDocumentMimeType(mimeType) {
+		if mimeType == "" {
+			return nil, "unknown document type"
+		}
+		return nil, "unsupported document type " + mimeType
+	}
+	if _, err := base64.StdEncoding.DecodeString(data); err != nil {
+		return nil, "file_data is not valid base64"
+	}
+	return &antigravity.InlineData{MimeType: mimeType, Data: data}, ""
+}
+
+func isDocumentMimeType(mimeType string) bool {
+	for _, allowed := range documentMimeTypes {
+		if mimeType == allowed {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,103 @@
+package transform
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/dvcrn/antigravity-proxy/internal/antigravity"
+	"github.com/dvcrn/antigravity-proxy/internal/openai"
+)
+
+func TestFileParts(t *testing.T) {
+	testCases := []struct {
+		name     string
+		file     string
+		expected []antigravity.ContentPart
+		err      error
+	}{
+		{
+			name: "gs uri becomes file data",
+			file: `{"file_uri":"gs://bucket/talk.mp4","mime_type":"video/mp4"}`,
+			expected: []antigravity.ContentPart{
+				{Text: "Summarize this"},
+				{FileData: &antigravity.FileData{MimeType: "video/mp4", FileURI: "gs://bucket/talk.mp4"}},
+			},
+		},
+		{
+			name: "mime type inferred from uri extension",
+			file: `{"file_uri":"https://storage.googleapis.com/bucket/Talk.MP4?alt=media"}`,
+			expected: []antigravity.ContentPart{
+				{Text: "Summarize this"},
+				{FileData: &antigravity.FileData{MimeType: "video/mp4", FileURI: "https://storage.googleapis.com/bucket/Talk.MP4?alt=media"}},
+			},
+		},
+		{
+			name: "uri without mime type or extension is rejected",
+			file: `{"file_uri":"https://generativelanguage.googleapis.com/v1beta/files/abc"}`,
+			err:  ErrFileMimeTypeUnknown,
+		},
+		{
+			name: "pdf data url becomes inline data",
+			file: `{"filename":"doc.pdf","file_data":"data:application/pdf;base64,JVBERi0xLjQ="}`,
+			expected: []antigravity.ContentPart{
+				{Text: "Summarize this"},
+				{InlineData: &antigravity.InlineData{MimeType: "application/pdf", Data: "JVBERi0xLjQ="}},
+			},
+		},
+		{
+			name: "raw base64 typed by filename",
+			file: `{"filename":"Report.PDF","file_data":"JVBERi0xLjQ="}`,
+			expected: []antigravity.ContentPart{
+				{Text: "Summarize this"},
+				{InlineData: &antigravity.InlineData{MimeType: "application/pdf", Data: "JVBERi0xLjQ="}},
+			},
+		},
+		{
+			name:     "invalid base64 is skipped",
+			file:     `{"filename":"doc.pdf","file_data":"data:application/pdf;base64,not base64!"}`,
+			expected: []antigravity.ContentPart{{Text: "Summarize this"}},
+		},
+		{
+			name:     "disallowed mime type is skipped",
+			file:     `{"filename":"run.exe","file_data":"data:application/x-msdownload;base64,TVqQAA=="}`,
+			expected: []antigravity.ContentPart{{Text: "Summarize this"}},
+		},
+		{
+			name:     "file_id without uri is skipped",
+			file:     `{"file_id":"file-123"}`,
+			expected: []antigravity.ContentPart{{Text: "Summarize this"}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			body := `{"model":"gemini-3-flash","messages":[{"role":"user","content":[
+				{"type":"text","text":"Summarize this"},
+				{"type":"file","file":` + tc.file + `}
+			]}]}`
+			var req openai.ChatCompletionRequest
+			if err := json.Unmarshal([]byte(body), &req); err != nil {
+				t.Fatalf("failed to unmarshal request: %v", err)
+			}
+
+			got, err := ToGeminiRequest(&req, "test-project")
+			if tc.err != nil {
+				if !errors.Is(err, tc.err) {
+					t.Fatalf("expected error %v, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ToGeminiRequest returned error: %v", err)
+			}
+			if len(got.Request.Contents) != 1 {
+				t.Fatalf("expected 1 content, got %+v", got.Request.Contents)
+			}
+			if parts := got.Request.Contents[0].Parts; !reflect.DeepEqual(parts, tc.expected) {
+				t.Errorf("parts = %+v, want %+v", parts, tc.expected)
+			}
+		})
+	}
+}
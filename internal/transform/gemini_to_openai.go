@@ -39,8 +39,13 @@ func ToOpenAIChatCompletionResponse(geminiResp *antigravity.GenerateContentRespo
 			}
 		}
 
+		index := i
+		if v, ok := candidateMap["index"].(float64); ok {
+			index = int(v)
+		}
+
 		choices = append(choices, openai.Choice{
-			Index: i,
+			Index: index,
 			Message: openai.Message{
 				Role:    "assistant",
 				Content: contentText,
@@ -50,7 +55,10 @@ func ToOpenAIChatCompletionResponse(geminiResp *antigravity.GenerateContentRespo
 	}
 
 	var promptTokens, completionTokens, totalTokens int
+	var promptDetails *openai.PromptTokensDetails
+	var completionDetails *openai.CompletionTokensDetails
 	if usage, ok := geminiResp.Response["usageMetadata"].(map[string]interface{}); ok {
+		promptDetails, completionDetails = openai.TokenDetailsFromUsageMetadata(usage)
 		if pt, ok := usage["promptTokenCount"].(float64); ok {
 			promptTokens = int(pt)
 		}
@@ -74,6 +82,9 @@ func ToOpenAIChatCompletionResponse(geminiResp *antigravity.GenerateContentRespo
 			PromptTokens:     promptTokens,
 			CompletionTokens: completionTokens,
 			TotalTokens:      totalTokens,
+
+			PromptTokensDetails:     promptDetails,
+			CompletionTokensDetails: completionDetails,
 		},
 	}, nil
 }
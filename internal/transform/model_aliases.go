@@ -0,0 +1,34 @@
+package transform
+
+import (
+	"encoding/json"
+
+	"github.com/dvcrn/antigravity-proxy/internal/env"
+	"github.com/dvcrn/antigravity-proxy/internal/logger"
+)
+
+// ModelAliases returns the alias -> upstream model table from MODEL_ALIASES, a JSON
+// object such as {"gpt-4o":"gemini-3-pro","claude-3-5-sonnet":"claude-sonnet-4-5"}.
+// Returns nil when unset or invalid.
+func ModelAliases() map[string]string {
+	raw, ok := env.Get("MODEL_ALIASES")
+	if !ok {
+		return nil
+	}
+	var aliases map[string]string
+	if err := json.Unmarshal([]byte(raw), &aliases); err != nil {
+		logger.Get().Warn().Err(err).Msg("Ignoring invalid MODEL_ALIASES; expected a JSON object of alias to model")
+		return nil
+	}
+	return aliases
+}
+
+// ResolveModelAlias maps a model alias to its upstream model. Models without an alias
+// pass through unchanged.
+func ResolveModelAlias(model string) string {
+	if target, ok := ModelAliases()[model]; ok && target != "" {
+		logger.Get().Debug().Str("alias", model).Str("model", target).Msg("Resolved model alias")
+		return target
+	}
+	return model
+}
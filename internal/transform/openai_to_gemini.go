@@ -1,35 +1,70 @@
 package transform
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/dvcrn/antigravity-proxy/internal/antigravity"
+	"github.com/dvcrn/antigravity-proxy/internal/env"
 	"github.com/dvcrn/antigravity-proxy/internal/logger"
 	"github.com/dvcrn/antigravity-proxy/internal/openai"
+	"github.com/dvcrn/antigravity-proxy/internal/warnings"
 	"github.com/google/uuid"
 )
 
 // ToGeminiRequest converts an OpenAI chat completion request to a Gemini generateContent request.
 func ToGeminiRequest(openAIReq *openai.ChatCompletionRequest, projectID string) (*antigravity.GenerateContentRequest, error) {
+	return ToGeminiRequestWithWarnings(context.Background(), openAIReq, projectID, nil)
+}
+
+// ToGeminiRequestWithWarnings is ToGeminiRequest, additionally reporting changes made to the
+// request (truncated stop sequences, dropped system messages, renamed tools) to warns.
+// Sampled log lines follow the request's sampling decision in ctx.
+func ToGeminiRequestWithWarnings(ctx context.Context, openAIReq *openai.ChatCompletionRequest, projectID string, warns *warnings.Collector) (*antigravity.GenerateContentRequest, error) {
 	var internalReq antigravity.GeminiInternalRequest
 
 	// Handle messages and system instructions
-	geminiContents, systemInstruction, err := convertMessagesToGeminiContents(openAIReq.Messages)
+	geminiContents, systemInstruction, err := ConvertMessages(ctx, openAIReq.Messages, openAIReq.RetentionAllowed(), warns)
 	if err != nil {
 		return nil, fmt.Errorf("failed to convert messages: %w", err)
 	}
 
 	// Handle tools
-	geminiTools := convertToolsToGeminiTools(openAIReq.Tools)
+	geminiTools, err := ConvertTools(openAIReq.Tools, openAIReq.ForcedToolName(), warns)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert tools: %w", err)
+	}
 
 	// Handle generation config
+	stopSequences := normalizeStopSequences(openAIReq.Stop, warns)
+	candidateCount := 0
+	if openAIReq.N > 1 {
+		candidateCount = openAIReq.N
+	}
 	var genCfg *antigravity.GeminiGenerationConfig
-	if openAIReq.Temperature > 0 || openAIReq.MaxTokens > 0 {
+	hasPenalty := openAIReq.FrequencyPenalty != 0 || openAIReq.PresencePenalty != 0
+	topK := 0
+	if openAIReq.TopK > 0 {
+		topK = openAIReq.TopK
+	}
+	maxTokens := openAIReq.MaxTokens
+	if maxTokens == 0 {
+		maxTokens = openAIReq.MaxCompletionTokens
+	}
+	if openAIReq.Temperature > 0 || maxTokens > 0 || len(stopSequences) > 0 || candidateCount > 0 || hasPenalty || topK > 0 || openAIReq.TopP > 0 || openAIReq.Seed != nil {
 		genCfg = &antigravity.GeminiGenerationConfig{
-			Temperature:     openAIReq.Temperature,
-			MaxOutputTokens: openAIReq.MaxTokens,
+			Temperature:      openAIReq.Temperature,
+			TopP:             openAIReq.TopP,
+			MaxOutputTokens:  maxTokens,
+			StopSequences:    stopSequences,
+			CandidateCount:   candidateCount,
+			FrequencyPenalty: openAIReq.FrequencyPenalty,
+			PresencePenalty:  openAIReq.PresencePenalty,
+			TopK:             topK,
+			Seed:             openAIReq.Seed,
 		}
 	}
 
@@ -38,10 +73,12 @@ func ToGeminiRequest(openAIReq *openai.ChatCompletionRequest, projectID string)
 		SystemInstruction: systemInstruction,
 		Tools:             geminiTools,
 		GenerationConfig:  genCfg,
+		// Pins the session; prepareAntigravityRequest derives one when empty
+		SessionID: openAIReq.User,
 	}
 
 	geminiReq := &antigravity.GenerateContentRequest{
-		Model:   openAIReq.Model,
+		Model:   ResolveModel(openAIReq.Model),
 		Project: projectID,
 		Request: internalReq,
 	}
@@ -49,13 +86,58 @@ func ToGeminiRequest(openAIReq *openai.ChatCompletionRequest, projectID string)
 	return geminiReq, nil
 }
 
-// convertMessagesToGeminiContents converts OpenAI messages to Gemini's content format.
-// It also extracts the system message as a separate systemInstruction.
-func convertMessagesToGeminiContents(messages []openai.Message) (geminiContents []antigravity.Content, systemInstruction *antigravity.SystemInstruction, err error) {
+// ResolveModel returns the upstream model for a request: the requested model, falling
+// back to DEFAULT_MODEL when the client omitted it, with MODEL_ALIASES applied. An empty
+// string is returned if neither is set.
+func ResolveModel(model string) string {
+	if strings.TrimSpace(model) != "" {
+		return ResolveModelAlias(model)
+	}
+	if defaultModel, ok := env.Get("DEFAULT_MODEL"); ok {
+		logger.Get().Debug().Str("default_model", defaultModel).Msg("Request omitted model; using DEFAULT_MODEL")
+		return ResolveModelAlias(defaultModel)
+	}
+	return model
+}
+
+// maxStopSequences is the maximum number of stop sequences Gemini accepts.
+const maxStopSequences = 5
+
+// normalizeStopSequences drops empty entries and truncates the list to the Gemini limit.
+func normalizeStopSequences(stop openai.StopField, warns *warnings.Collector) []string {
+	if len(stop) == 0 {
+		return nil
+	}
+
+	var sequences []string
+	for _, seq := range stop {
+		if seq != "" {
+			sequences = append(sequences, seq)
+		}
+	}
+
+	if len(sequences) > maxStopSequences {
+		logger.Get().Warn().
+			Int("provided", len(sequences)).
+			Int("limit", maxStopSequences).
+			Msg("Truncating stop sequences to Gemini limit")
+		warns.Addf("truncated stop sequences from %d to the Gemini limit of %d", len(sequences), maxStopSequences)
+		sequences = sequences[:maxStopSequences]
+	}
+
+	return sequences
+}
+
+// ConvertMessages converts OpenAI messages to Gemini's content format, as done by
+// ToGeminiRequest. It also extracts the system message as a separate systemInstruction.
+// When logContent is false, tool call and tool response previews are omitted from logs.
+func ConvertMessages(ctx context.Context, messages []openai.Message, logContent bool, warns *warnings.Collector) (geminiContents []antigravity.Content, systemInstruction *antigravity.SystemInstruction, err error) {
 	// Build tool_call_id -> function name map from assistant tool calls
 	toolCallNameByID := map[string]string{}
-	toolCallIDByName := map[string]string{}
+	var openCalls openToolCalls
 	var pendingToolParts []antigravity.ContentPart
+	toolRole := toolResultRole()
+	var systemMessages [][]antigravity.ContentPart
 	for _, m := range messages {
 		if m.Role == "assistant" && len(m.ToolCalls) > 0 {
 			for _, tc := range m.ToolCalls {
@@ -70,40 +152,38 @@ func convertMessagesToGeminiContents(messages []openai.Message) (geminiContents
 		roleLower := strings.ToLower(msg.Role)
 		isTool := roleLower == "tool"
 
+		// Tool results are emitted as one content right after the model turn that called
+		// them, ahead of whatever message comes next
 		if !isTool && len(pendingToolParts) > 0 {
 			geminiContents = append(geminiContents, antigravity.Content{
-				Role:  "user",
-				Parts: pendingToolParts,
+				Role:  toolRole,
+				Parts: orderFunctionResponses(pendingToolParts, geminiContents),
 			})
 			pendingToolParts = nil
 		}
 
 		if roleLower == "system" {
-			// Allow multiple system messages by concatenating their parts
-			if systemInstruction == nil {
-				systemInstruction = &antigravity.SystemInstruction{
-					Role:  "system",
-					Parts: []antigravity.ContentPart{},
-				}
-			}
-
+			// Collect each system message separately; they are merged according to
+			// SYSTEM_MESSAGE_MODE once all messages have been seen.
+			var sysParts []antigravity.ContentPart
 			switch content := msg.Content.(type) {
 			case string:
 				if content != "" {
-					systemInstruction.Parts = append(systemInstruction.Parts, antigravity.ContentPart{Text: content})
+					sysParts = append(sysParts, antigravity.ContentPart{Text: content})
 				}
 			case []interface{}:
 				// Support array content for system messages (e.g., [{"type":"text","text":"..."}])
 				for _, part := range content {
 					if p, ok := part.(map[string]interface{}); ok && p["type"] == "text" {
 						if txt, ok2 := p["text"].(string); ok2 && txt != "" {
-							systemInstruction.Parts = append(systemInstruction.Parts, antigravity.ContentPart{Text: txt})
+							sysParts = append(sysParts, antigravity.ContentPart{Text: txt})
 						}
 					}
 				}
 			default:
 				// Ignore unsupported content types for system messages
 			}
+			systemMessages = append(systemMessages, sysParts)
 			continue // System message is not part of contents
 		}
 
@@ -135,28 +215,25 @@ func convertMessagesToGeminiContents(messages []openai.Message) (geminiContents
 
 				// Log forwarding of tool response (string content) with preview
 				preview := content
-				if len(preview) > 300 {
+				if !logContent {
+					preview = ""
+				} else if len(preview) > 300 {
 					preview = preview[:300] + "..."
 				}
-				logger.Get().Info().
+				logger.Sampled(ctx).Info().
 					Str("function", resolvedName).
 					Str("tool_call_id", msg.ToolCallID).
 					Int("response_len", len(content)).
 					Str("response_preview", preview).
 					Msg("Forwarding tool response to Gemini")
 
-				resolvedID := strings.TrimSpace(msg.ToolCallID)
-				if resolvedID == "" && resolvedName != "" {
-					if id, ok := toolCallIDByName[resolvedName]; ok {
-						resolvedID = id
-					}
-				}
+				resolvedID := openCalls.claim(strings.TrimSpace(msg.ToolCallID), resolvedName)
 
 				resp := map[string]interface{}{"output": content}
 				parts = append(parts, antigravity.ContentPart{
 					FunctionResponse: &antigravity.FunctionResponse{
 						ID:       resolvedID,
-						Name:     resolvedName,
+						Name:     normalizeToolName(resolvedName),
 						Response: resp,
 					},
 				})
@@ -191,37 +268,51 @@ func convertMessagesToGeminiContents(messages []openai.Message) (geminiContents
 				// Log forwarding of tool response (aggregated text parts) with preview
 				full := buf.String()
 				preview := full
-				if len(preview) > 300 {
+				if !logContent {
+					preview = ""
+				} else if len(preview) > 300 {
 					preview = preview[:300] + "..."
 				}
-				logger.Get().Info().
+				logger.Sampled(ctx).Info().
 					Str("function", resolvedName).
 					Str("tool_call_id", msg.ToolCallID).
 					Int("response_len", len(full)).
 					Str("response_preview", preview).
 					Msg("Forwarding tool response to Gemini")
 
-				resolvedID := strings.TrimSpace(msg.ToolCallID)
-				if resolvedID == "" && resolvedName != "" {
-					if id, ok := toolCallIDByName[resolvedName]; ok {
-						resolvedID = id
-					}
-				}
+				resolvedID := openCalls.claim(strings.TrimSpace(msg.ToolCallID), resolvedName)
 
 				resp := map[string]interface{}{"output": full}
 				parts = append(parts, antigravity.ContentPart{
 					FunctionResponse: &antigravity.FunctionResponse{
 						ID:       resolvedID,
-						Name:     resolvedName,
+						Name:     normalizeToolName(resolvedName),
 						Response: resp,
 					},
 				})
 			} else {
 				for _, part := range content {
-					if p, ok := part.(map[string]interface{}); ok && p["type"] == "text" {
-						if txt, ok2 := p["text"].(string); ok2 {
+					p, ok := part.(map[string]interface{})
+					if !ok {
+						continue
+					}
+					switch p["type"] {
+					case "text":
+						if txt, ok2 := p["text"].(string); ok2 && txt != "" {
 							parts = append(parts, antigravity.ContentPart{Text: txt})
 						}
+					case "input_audio":
+						if inline := convertInputAudio(p, warns); inline != nil {
+							parts = append(parts, antigravity.ContentPart{InlineData: inline})
+						}
+					case "file":
+						filePart, ok, err := convertFilePart(p, warns)
+						if err != nil {
+							return nil, nil, err
+						}
+						if ok {
+							parts = append(parts, filePart)
+						}
 					}
 					// TODO: Handle other part types like images
 				}
@@ -243,12 +334,15 @@ func convertMessagesToGeminiContents(messages []openai.Message) (geminiContents
 				}
 				if tc.Function.Name != "" {
 					toolCallNameByID[id] = tc.Function.Name
-					toolCallIDByName[tc.Function.Name] = id
 				}
+				openCalls = append(openCalls, openToolCall{id: id, name: tc.Function.Name})
+				logToolCall(ctx, tc.Function.Name, id, args, logContent)
 				parts = append(parts, antigravity.ContentPart{
+					// Replay the signature so thinking models keep their reasoning context
+					ThoughtSignature: tc.ThoughtSignature(),
 					FunctionCall: &antigravity.FunctionCall{
 						ID:   id,
-						Name: tc.Function.Name,
+						Name: normalizeToolName(tc.Function.Name),
 						Args: args,
 					},
 				})
@@ -271,18 +365,163 @@ func convertMessagesToGeminiContents(messages []openai.Message) (geminiContents
 
 	if len(pendingToolParts) > 0 {
 		geminiContents = append(geminiContents, antigravity.Content{
-			Role:  "user",
-			Parts: pendingToolParts,
+			Role:  toolRole,
+			Parts: orderFunctionResponses(pendingToolParts, geminiContents),
 		})
 	}
-	return geminiContents, systemInstruction, nil
+	return geminiContents, mergeSystemMessages(systemMessages, warns), nil
 }
 
-func convertToolsToGeminiTools(tools []openai.Tool) []antigravity.Tool {
-	if len(tools) == 0 {
+// openToolCall is an assistant tool call that has no tool result yet.
+type openToolCall struct {
+	id   string
+	name string
+}
+
+// openToolCalls pairs tool results with the tool calls they answer, in call order.
+type openToolCalls []openToolCall
+
+// claim returns the ID of the call a tool result answers and marks it answered: the
+// result's tool_call_id when set, else the earliest open call with the same function
+// name, else the earliest open call. Earliest-first keeps parallel calls to the same
+// function paired in order.
+func (calls *openToolCalls) claim(id, name string) string {
+	match := -1
+	for i, call := range *calls {
+		if (id != "" && call.id == id) || (id == "" && name != "" && call.name == name) {
+			match = i
+			break
+		}
+	}
+	if match < 0 {
+		if id != "" || len(*calls) == 0 {
+			return id
+		}
+		match = 0
+	}
+	claimed := (*calls)[match].id
+	*calls = append((*calls)[:match], (*calls)[match+1:]...)
+	return claimed
+}
+
+// orderFunctionResponses sorts batched tool results into the order of the functionCall
+// parts in the last model turn of contents, since Gemini matches responses to calls
+// positionally. Results whose call isn't in that turn keep their order, after the rest.
+func orderFunctionResponses(parts []antigravity.ContentPart, contents []antigravity.Content) []antigravity.ContentPart {
+	callIndex := map[string]int{}
+	for i := len(contents) - 1; i >= 0; i-- {
+		if contents[i].Role != "model" {
+			continue
+		}
+		for _, part := range contents[i].Parts {
+			if part.FunctionCall != nil && part.FunctionCall.ID != "" {
+				callIndex[part.FunctionCall.ID] = len(callIndex)
+			}
+		}
+		break
+	}
+	if len(callIndex) < 2 {
+		return parts
+	}
+
+	position := func(part antigravity.ContentPart) int {
+		if part.FunctionResponse != nil {
+			if idx, ok := callIndex[part.FunctionResponse.ID]; ok {
+				return idx
+			}
+		}
+		return len(callIndex)
+	}
+	ordered := make([]antigravity.ContentPart, len(parts))
+	copy(ordered, parts)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return position(ordered[i]) < position(ordered[j])
+	})
+	for i := range ordered {
+		if ordered[i].FunctionResponse != parts[i].FunctionResponse {
+			logger.Get().Debug().Int("tool_results", len(parts)).Msg("Reordered tool results to match function call order")
+			break
+		}
+	}
+	return ordered
+}
+
+// toolResultRole returns the role for contents carrying tool results, from
+// TOOL_RESULT_ROLE: "user" (default), "function" or "tool".
+func toolResultRole() string {
+	role := strings.ToLower(strings.TrimSpace(env.GetOrDefault("TOOL_RESULT_ROLE", "user")))
+	switch role {
+	case "user", "function", "tool":
+		return role
+	default:
+		logger.Get().Warn().Str("role", role).Msg("Unknown TOOL_RESULT_ROLE; using user")
+		return "user"
+	}
+}
+
+// mergeSystemMessages combines the parts of each system message into a single
+// system instruction according to SYSTEM_MESSAGE_MODE:
+//   - "all" (default): concatenate every system message
+//   - "first": keep only the first system message
+//   - "last": keep only the last system message
+//
+// Returns nil when the request contains no system messages.
+func mergeSystemMessages(systemMessages [][]antigravity.ContentPart, warns *warnings.Collector) *antigravity.SystemInstruction {
+	if len(systemMessages) == 0 {
 		return nil
 	}
 
+	selected := systemMessages
+	mode := strings.ToLower(env.GetOrDefault("SYSTEM_MESSAGE_MODE", "all"))
+	switch mode {
+	case "first":
+		selected = systemMessages[:1]
+	case "last":
+		selected = systemMessages[len(systemMessages)-1:]
+	case "all":
+	default:
+		logger.Get().Warn().Str("mode", mode).Msg("Unknown SYSTEM_MESSAGE_MODE; concatenating all system messages")
+	}
+
+	if len(selected) < len(systemMessages) {
+		logger.Get().Debug().
+			Str("mode", mode).
+			Int("system_messages", len(systemMessages)).
+			Int("kept", len(selected)).
+			Msg("Dropped extra system messages")
+		warns.Addf("kept %d of %d system messages (SYSTEM_MESSAGE_MODE=%s)", len(selected), len(systemMessages), mode)
+	}
+
+	systemInstruction := &antigravity.SystemInstruction{
+		Role:  "system",
+		Parts: []antigravity.ContentPart{},
+	}
+	for _, parts := range selected {
+		systemInstruction.Parts = append(systemInstruction.Parts, parts...)
+	}
+	return systemInstruction
+}
+
+// ConvertTools converts OpenAI tool definitions to Gemini function declarations, as done
+// by ToGeminiRequest: names are normalized, schemas converted and size-capped, and the
+// declarations deduplicated and cut to the upstream limit, keeping forcedToolName (the
+// tool_choice function, if any).
+func ConvertTools(tools []openai.Tool, forcedToolName string, warns *warnings.Collector) ([]antigravity.Tool, error) {
+	if err := checkToolNameCollisions(tools); err != nil {
+		return nil, err
+	}
+	geminiTools, err := convertToolsToGeminiTools(tools, warns)
+	if err != nil {
+		return nil, err
+	}
+	return limitFunctionDeclarations(geminiTools, normalizeToolName(forcedToolName), warns), nil
+}
+
+func convertToolsToGeminiTools(tools []openai.Tool, warns *warnings.Collector) ([]antigravity.Tool, error) {
+	if len(tools) == 0 {
+		return nil, nil
+	}
+
 	var fns []antigravity.FunctionDeclaration
 	for _, t := range tools {
 		if strings.ToLower(t.Type) != "function" {
@@ -291,14 +530,22 @@ func convertToolsToGeminiTools(tools []openai.Tool) []antigravity.Tool {
 
 		var geminiSchema *antigravity.GeminiParameterSchema
 		if m, ok := t.Function.Parameters.(map[string]interface{}); ok {
-			geminiSchema = convertToGeminiSchema(m)
+			geminiSchema = convertToGeminiSchema(m, warns)
+		}
+
+		name := normalizeToolName(t.Function.Name)
+		if name != t.Function.Name {
+			warns.Addf("renamed tool %q to %q for the model", t.Function.Name, name)
 		}
 
 		convertedFn := antigravity.FunctionDeclaration{
-			Name:        t.Function.Name,
+			Name:        name,
 			Description: t.Function.Description,
 			Parameters:  geminiSchema,
 		}
+		if err := limitToolSchemaSize(&convertedFn, warns); err != nil {
+			return nil, err
+		}
 
 		// For specific tools, log the before and after transformation for debugging
 		// if t.Function.Name == "TodoWrite" {
@@ -315,16 +562,16 @@ func convertToolsToGeminiTools(tools []openai.Tool) []antigravity.Tool {
 	}
 
 	if len(fns) == 0 {
-		return nil
+		return nil, nil
 	}
 
 	return []antigravity.Tool{
 		{FunctionDeclarations: fns},
-	}
+	}, nil
 }
 
 // convertToGeminiSchema recursively converts a generic map representing a JSON schema
 // into the strongly-typed GeminiParameterSchema struct, only mapping supported fields.
-func convertToGeminiSchema(input map[string]interface{}) *antigravity.GeminiParameterSchema {
-	return antigravity.ConvertSchema(input)
+func convertToGeminiSchema(input map[string]interface{}, warns *warnings.Collector) *antigravity.GeminiParameterSchema {
+	return antigravity.ConvertSchemaWithWarnings(input, warns)
 }
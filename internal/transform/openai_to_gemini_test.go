@@ -2,10 +2,13 @@ package transform
 
 import (
 	"encoding/json"
+	"fmt"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/dvcrn/antigravity-proxy/internal/antigravity"
+	"github.com/dvcrn/antigravity-proxy/internal/openai"
 )
 
 func TestConvertToGeminiSchema(t *testing.T) {
@@ -69,6 +72,7 @@ func TestConvertToGeminiSchema(t *testing.T) {
 			expectedSchema: &antigravity.GeminiParameterSchema{
 				Type:        "ARRAY",
 				Description: "The updated todo list",
+				MaxItems:    intPtr(50),
 				Items: &antigravity.GeminiParameterSchema{
 					Type:     "OBJECT",
 					Required: []string{"content", "status"},
@@ -84,6 +88,52 @@ func TestConvertToGeminiSchema(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "anyOf branch descriptions used when parent has none",
+			inputSchema: map[string]interface{}{
+				"anyOf": []interface{}{
+					map[string]interface{}{"type": "string", "description": "A glob pattern"},
+					map[string]interface{}{"type": "null"},
+				},
+			},
+			expectedSchema: &antigravity.GeminiParameterSchema{
+				Description: "A glob pattern",
+			},
+		},
+		{
+			name: "parent description wins over anyOf branches",
+			inputSchema: map[string]interface{}{
+				"description": "Files to search",
+				"anyOf": []interface{}{
+					map[string]interface{}{"type": "string", "description": "A glob pattern"},
+					map[string]interface{}{"type": "integer", "description": "A file descriptor"},
+				},
+			},
+			expectedSchema: &antigravity.GeminiParameterSchema{
+				Description: "Files to search",
+			},
+		},
+		{
+			name: "Top-level type wins over anyOf",
+			inputSchema: map[string]interface{}{
+				"type":        "object",
+				"description": "Either a path or a list of paths",
+				"properties": map[string]interface{}{
+					"path": map[string]interface{}{"type": "string"},
+				},
+				"anyOf": []interface{}{
+					map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+					map[string]interface{}{"required": []interface{}{"path"}},
+				},
+			},
+			expectedSchema: &antigravity.GeminiParameterSchema{
+				Type:        "OBJECT",
+				Description: "Either a path or a list of paths",
+				Properties: map[string]*antigravity.GeminiParameterSchema{
+					"path": {Type: "STRING"},
+				},
+			},
+		},
 		{
 			name: "Schema with oneOf",
 			inputSchema: map[string]interface{}{
@@ -132,11 +182,160 @@ func TestConvertToGeminiSchema(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "Nullable Type Array",
+			inputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"nickname": map[string]interface{}{
+						"type":        []interface{}{"string", "null"},
+						"description": "Optional nickname.",
+					},
+				},
+			},
+			expectedSchema: &antigravity.GeminiParameterSchema{
+				Type: "OBJECT",
+				Properties: map[string]*antigravity.GeminiParameterSchema{
+					"nickname": {
+						Type:        "STRING",
+						Description: "Optional nickname.",
+						Nullable:    true,
+					},
+				},
+			},
+		},
+		{
+			name: "Nullable type arrays",
+			inputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"name":  map[string]interface{}{"type": []interface{}{"string", "null"}},
+					"count": map[string]interface{}{"type": []interface{}{"null", "integer"}},
+					"id":    map[string]interface{}{"type": []interface{}{"integer", "string"}},
+					"flag":  map[string]interface{}{"type": []interface{}{"boolean", "number", "null"}},
+				},
+			},
+			expectedSchema: &antigravity.GeminiParameterSchema{
+				Type: "OBJECT",
+				Properties: map[string]*antigravity.GeminiParameterSchema{
+					"name":  {Type: "STRING", Nullable: true},
+					"count": {Type: "INTEGER", Nullable: true},
+					"id":    {Type: "STRING"},
+					"flag":  {Type: "BOOLEAN", Nullable: true},
+				},
+			},
+		},
+		{
+			name: "Supported formats and constraints",
+			inputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"when": map[string]interface{}{
+						"type":   "string",
+						"format": "date-time",
+					},
+					"count": map[string]interface{}{
+						"type":    "integer",
+						"format":  "int64",
+						"minimum": 1.0,
+						"maximum": 100.0,
+					},
+					"ratio": map[string]interface{}{
+						"type":    "number",
+						"format":  "double",
+						"minimum": 0.0,
+					},
+					"code": map[string]interface{}{
+						"type":      "string",
+						"minLength": 2.0,
+						"maxLength": 8.0,
+						"pattern":   "^[A-Z]+$",
+					},
+				},
+			},
+			expectedSchema: &antigravity.GeminiParameterSchema{
+				Type: "OBJECT",
+				Properties: map[string]*antigravity.GeminiParameterSchema{
+					"when":  {Type: "STRING", Format: "date-time"},
+					"count": {Type: "INTEGER", Format: "int64", Minimum: floatPtr(1), Maximum: floatPtr(100)},
+					"ratio": {Type: "NUMBER", Format: "double", Minimum: floatPtr(0)},
+					"code":  {Type: "STRING", MinLength: intPtr(2), MaxLength: intPtr(8), Pattern: "^[A-Z]+$"},
+				},
+			},
+		},
+		{
+			name: "Unsupported formats and misplaced constraints are dropped",
+			inputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"site": map[string]interface{}{
+						"type":    "string",
+						"format":  "uri",
+						"minimum": 1.0,
+					},
+					"id": map[string]interface{}{
+						"type":      "integer",
+						"format":    "date-time",
+						"maxLength": 4.0,
+						"pattern":   "^[0-9]+$",
+					},
+				},
+			},
+			expectedSchema: &antigravity.GeminiParameterSchema{
+				Type: "OBJECT",
+				Properties: map[string]*antigravity.GeminiParameterSchema{
+					"site": {Type: "STRING"},
+					"id":   {Type: "INTEGER"},
+				},
+			},
+		},
+		{
+			name: "No ordering is invented without an explicit propertyOrdering",
+			inputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"answer":    map[string]interface{}{"type": "string"},
+					"reasoning": map[string]interface{}{"type": "string"},
+					"notes":     map[string]interface{}{"type": "string"},
+				},
+				"required": []interface{}{"reasoning", "answer"},
+			},
+			expectedSchema: &antigravity.GeminiParameterSchema{
+				Type: "OBJECT",
+				Properties: map[string]*antigravity.GeminiParameterSchema{
+					"answer":    {Type: "STRING"},
+					"reasoning": {Type: "STRING"},
+					"notes":     {Type: "STRING"},
+				},
+				Required: []string{"reasoning", "answer"},
+			},
+		},
+		{
+			name: "Explicit propertyOrdering is limited to declared properties",
+			inputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"b": map[string]interface{}{"type": "string"},
+					"a": map[string]interface{}{"type": "string"},
+				},
+				"required":         []interface{}{"a"},
+				"propertyOrdering": []interface{}{"b", "missing", "a", "b"},
+			},
+			expectedSchema: &antigravity.GeminiParameterSchema{
+				Type: "OBJECT",
+				Properties: map[string]*antigravity.GeminiParameterSchema{
+					"b": {Type: "STRING"},
+					"a": {Type: "STRING"},
+				},
+				Required:         []string{"a"},
+				PropertyOrdering: []string{"b", "a"},
+			},
+		},
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			actualSchema := convertToGeminiSchema(tc.inputSchema)
+			actualSchema := convertToGeminiSchema(tc.inputSchema, nil)
 
 			if !reflect.DeepEqual(actualSchema, tc.expectedSchema) {
 				actualJSON, _ := json.MarshalIndent(actualSchema, "", "  ")
@@ -146,3 +345,422 @@ func TestConvertToGeminiSchema(t *testing.T) {
 		})
 	}
 }
+
+func TestStopSequencesPassthrough(t *testing.T) {
+	testCases := []struct {
+		name     string
+		body     string
+		expected []string
+	}{
+		{
+			name:     "string stop",
+			body:     `{"model":"gemini-2.5-pro","messages":[{"role":"user","content":"hi"}],"stop":"###"}`,
+			expected: []string{"###"},
+		},
+		{
+			name:     "array stop",
+			body:     `{"model":"gemini-2.5-pro","messages":[{"role":"user","content":"hi"}],"stop":["\n\n","END"]}`,
+			expected: []string{"\n\n", "END"},
+		},
+		{
+			name:     "array stop truncated to limit",
+			body:     `{"model":"gemini-2.5-pro","messages":[{"role":"user","content":"hi"}],"stop":["a","b","c","d","e","f","g"]}`,
+			expected: []string{"a", "b", "c", "d", "e"},
+		},
+		{
+			name:     "no stop",
+			body:     `{"model":"gemini-2.5-pro","messages":[{"role":"user","content":"hi"}]}`,
+			expected: nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var req openai.ChatCompletionRequest
+			if err := json.Unmarshal([]byte(tc.body), &req); err != nil {
+				t.Fatalf("failed to unmarshal request: %v", err)
+			}
+
+			got, err := ToGeminiRequest(&req, "test-project")
+			if err != nil {
+				t.Fatalf("ToGeminiRequest returned error: %v", err)
+			}
+
+			var actual []string
+			if got.Request.GenerationConfig != nil {
+				actual = got.Request.GenerationConfig.StopSequences
+			}
+			if !reflect.DeepEqual(actual, tc.expected) {
+				t.Errorf("expected stop sequences %q, got %q", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestSystemMessageMode(t *testing.T) {
+	messages := []openai.Message{
+		{Role: "system", Content: "first system"},
+		{Role: "user", Content: "hello"},
+		{Role: "system", Content: "second system"},
+		{Role: "assistant", Content: "hi"},
+		{Role: "system", Content: []interface{}{map[string]interface{}{"type": "text", "text": "third system"}}},
+		{Role: "user", Content: "bye"},
+	}
+
+	testCases := []struct {
+		mode     string
+		expected []string
+	}{
+		{mode: "all", expected: []string{"first system", "second system", "third system"}},
+		{mode: "", expected: []string{"first system", "second system", "third system"}},
+		{mode: "first", expected: []string{"first system"}},
+		{mode: "last", expected: []string{"third system"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run("mode="+tc.mode, func(t *testing.T) {
+			t.Setenv("SYSTEM_MESSAGE_MODE", tc.mode)
+
+			got, err := ToGeminiRequest(&openai.ChatCompletionRequest{Model: "gemini-2.5-pro", Messages: messages}, "test-project")
+			if err != nil {
+				t.Fatalf("ToGeminiRequest returned error: %v", err)
+			}
+			if got.Request.SystemInstruction == nil {
+				t.Fatal("expected a system instruction")
+			}
+
+			var texts []string
+			for _, p := range got.Request.SystemInstruction.Parts {
+				texts = append(texts, p.Text)
+			}
+			if !reflect.DeepEqual(texts, tc.expected) {
+				t.Errorf("expected system parts %q, got %q", tc.expected, texts)
+			}
+			if len(got.Request.Contents) != 3 {
+				t.Errorf("expected 3 non-system contents, got %d", len(got.Request.Contents))
+			}
+		})
+	}
+}
+
+func TestDefaultModelFallback(t *testing.T) {
+	t.Setenv("DEFAULT_MODEL", "gemini-3-flash")
+
+	messages := []openai.Message{{Role: "user", Content: "hi"}}
+
+	got, err := ToGeminiRequest(&openai.ChatCompletionRequest{Messages: messages}, "test-project")
+	if err != nil {
+		t.Fatalf("ToGeminiRequest returned error: %v", err)
+	}
+	if got.Model != "gemini-3-flash" {
+		t.Errorf("expected default model to be used when model is empty, got %q", got.Model)
+	}
+
+	got, err = ToGeminiRequest(&openai.ChatCompletionRequest{Model: "claude-sonnet-4-5", Messages: messages}, "test-project")
+	if err != nil {
+		t.Fatalf("ToGeminiRequest returned error: %v", err)
+	}
+	if got.Model != "claude-sonnet-4-5" {
+		t.Errorf("expected client model to be honored, got %q", got.Model)
+	}
+}
+
+func TestModelAliases(t *testing.T) {
+	t.Setenv("MODEL_ALIASES", `{"gpt-4o":"gemini-3-pro","claude-3-5-sonnet":"claude-sonnet-4-5"}`)
+	t.Setenv("DEFAULT_MODEL", "gpt-4o")
+
+	testCases := []struct {
+		model    string
+		expected string
+	}{
+		{model: "gpt-4o", expected: "gemini-3-pro"},
+		{model: "claude-3-5-sonnet", expected: "claude-sonnet-4-5"},
+		{model: "gemini-3-flash", expected: "gemini-3-flash"},
+		{model: "", expected: "gemini-3-pro"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.model, func(t *testing.T) {
+			got, err := ToGeminiRequest(&openai.ChatCompletionRequest{Model: tc.model, Messages: []openai.Message{{Role: "user", Content: "hi"}}}, "test-project")
+			if err != nil {
+				t.Fatalf("ToGeminiRequest returned error: %v", err)
+			}
+			if got.Model != tc.expected {
+				t.Errorf("model = %q, want %q", got.Model, tc.expected)
+			}
+		})
+	}
+}
+
+func TestCandidateCountFromN(t *testing.T) {
+	testCases := []struct {
+		name     string
+		body     string
+		expected int
+	}{
+		{
+			name:     "n=3 sets candidateCount",
+			body:     `{"model":"gemini-2.5-pro","messages":[{"role":"user","content":"hi"}],"n":3}`,
+			expected: 3,
+		},
+		{
+			name:     "n=1 leaves candidateCount unset",
+			body:     `{"model":"gemini-2.5-pro","messages":[{"role":"user","content":"hi"}],"n":1}`,
+			expected: 0,
+		},
+		{
+			name:     "no n",
+			body:     `{"model":"gemini-2.5-pro","messages":[{"role":"user","content":"hi"}]}`,
+			expected: 0,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var req openai.ChatCompletionRequest
+			if err := json.Unmarshal([]byte(tc.body), &req); err != nil {
+				t.Fatalf("failed to unmarshal request: %v", err)
+			}
+
+			got, err := ToGeminiRequest(&req, "test-project")
+			if err != nil {
+				t.Fatalf("ToGeminiRequest returned error: %v", err)
+			}
+
+			actual := 0
+			if got.Request.GenerationConfig != nil {
+				actual = got.Request.GenerationConfig.CandidateCount
+			}
+			if actual != tc.expected {
+				t.Errorf("expected candidateCount %d, got %d", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestPenaltyPassthrough(t *testing.T) {
+	testCases := []struct {
+		name          string
+		body          string
+		wantFrequency float64
+		wantPresence  float64
+	}{
+		{
+			name:          "penalties forwarded",
+			body:          `{"model":"gemini-2.5-pro","messages":[{"role":"user","content":"hi"}],"frequency_penalty":0.5,"presence_penalty":-0.25}`,
+			wantFrequency: 0.5,
+			wantPresence:  -0.25,
+		},
+		{
+			name: "penalties omitted when unset",
+			body: `{"model":"gemini-2.5-pro","messages":[{"role":"user","content":"hi"}],"max_tokens":10}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var req openai.ChatCompletionRequest
+			if err := json.Unmarshal([]byte(tc.body), &req); err != nil {
+				t.Fatalf("failed to unmarshal request: %v", err)
+			}
+
+			got, err := ToGeminiRequest(&req, "test-project")
+			if err != nil {
+				t.Fatalf("ToGeminiRequest returned error: %v", err)
+			}
+			cfg := got.Request.GenerationConfig
+			if cfg == nil {
+				t.Fatal("expected generationConfig")
+			}
+			if cfg.FrequencyPenalty != tc.wantFrequency || cfg.PresencePenalty != tc.wantPresence {
+				t.Errorf("penalties = (%v, %v), want (%v, %v)", cfg.FrequencyPenalty, cfg.PresencePenalty, tc.wantFrequency, tc.wantPresence)
+			}
+
+			raw, err := json.Marshal(cfg)
+			if err != nil {
+				t.Fatalf("failed to marshal generationConfig: %v", err)
+			}
+			hasKeys := strings.Contains(string(raw), "frequencyPenalty") || strings.Contains(string(raw), "presencePenalty")
+			if want := tc.wantFrequency != 0 || tc.wantPresence != 0; hasKeys != want {
+				t.Errorf("penalty keys present = %v, want %v: %s", hasKeys, want, raw)
+			}
+		})
+	}
+}
+
+func TestTopKPassthrough(t *testing.T) {
+	testCases := []struct {
+		name     string
+		body     string
+		expected int
+	}{
+		{
+			name:     "top_k forwarded",
+			body:     `{"model":"gemini-2.5-pro","messages":[{"role":"user","content":"hi"}],"top_k":40}`,
+			expected: 40,
+		},
+		{
+			name:     "non-positive top_k dropped",
+			body:     `{"model":"gemini-2.5-pro","messages":[{"role":"user","content":"hi"}],"top_k":-1}`,
+			expected: 0,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var req openai.ChatCompletionRequest
+			if err := json.Unmarshal([]byte(tc.body), &req); err != nil {
+				t.Fatalf("failed to unmarshal request: %v", err)
+			}
+
+			got, err := ToGeminiRequest(&req, "test-project")
+			if err != nil {
+				t.Fatalf("ToGeminiRequest returned error: %v", err)
+			}
+
+			actual := 0
+			if got.Request.GenerationConfig != nil {
+				actual = got.Request.GenerationConfig.TopK
+			}
+			if actual != tc.expected {
+				t.Errorf("expected topK %d, got %d", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestTopPAndMaxCompletionTokens(t *testing.T) {
+	testCases := []struct {
+		name          string
+		body          string
+		wantTopP      float64
+		wantMaxOutput int
+	}{
+		{
+			name:          "top_p and max_completion_tokens forwarded",
+			body:          `{"model":"gemini-2.5-pro","messages":[{"role":"user","content":"hi"}],"top_p":0.9,"max_completion_tokens":256}`,
+			wantTopP:      0.9,
+			wantMaxOutput: 256,
+		},
+		{
+			name:          "max_tokens wins over max_completion_tokens",
+			body:          `{"model":"gemini-2.5-pro","messages":[{"role":"user","content":"hi"}],"max_tokens":128,"max_completion_tokens":256}`,
+			wantMaxOutput: 128,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var req openai.ChatCompletionRequest
+			if err := json.Unmarshal([]byte(tc.body), &req); err != nil {
+				t.Fatalf("failed to unmarshal request: %v", err)
+			}
+
+			got, err := ToGeminiRequest(&req, "test-project")
+			if err != nil {
+				t.Fatalf("ToGeminiRequest returned error: %v", err)
+			}
+
+			cfg := got.Request.GenerationConfig
+			if cfg == nil {
+				t.Fatal("expected a generation config")
+			}
+			if cfg.TopP != tc.wantTopP {
+				t.Errorf("expected topP %v, got %v", tc.wantTopP, cfg.TopP)
+			}
+			if cfg.MaxOutputTokens != tc.wantMaxOutput {
+				t.Errorf("expected maxOutputTokens %d, got %d", tc.wantMaxOutput, cfg.MaxOutputTokens)
+			}
+		})
+	}
+}
+
+func TestSeedPassthrough(t *testing.T) {
+	testCases := []struct {
+		name     string
+		body     string
+		expected *int
+	}{
+		{
+			name:     "seed forwarded",
+			body:     `{"model":"gemini-2.5-pro","messages":[{"role":"user","content":"hi"}],"seed":42}`,
+			expected: intPtr(42),
+		},
+		{
+			name:     "zero seed forwarded",
+			body:     `{"model":"gemini-2.5-pro","messages":[{"role":"user","content":"hi"}],"seed":0}`,
+			expected: intPtr(0),
+		},
+		{
+			name: "absent seed omitted",
+			body: `{"model":"gemini-2.5-pro","messages":[{"role":"user","content":"hi"}]}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var req openai.ChatCompletionRequest
+			if err := json.Unmarshal([]byte(tc.body), &req); err != nil {
+				t.Fatalf("failed to unmarshal request: %v", err)
+			}
+
+			got, err := ToGeminiRequest(&req, "test-project")
+			if err != nil {
+				t.Fatalf("ToGeminiRequest returned error: %v", err)
+			}
+
+			out, err := json.Marshal(got.Request)
+			if err != nil {
+				t.Fatalf("failed to marshal request: %v", err)
+			}
+			if tc.expected == nil {
+				if strings.Contains(string(out), `"seed"`) {
+					t.Errorf("expected no seed, got %s", out)
+				}
+				return
+			}
+			want := fmt.Sprintf(`"seed":%d`, *tc.expected)
+			if !strings.Contains(string(out), want) {
+				t.Errorf("expected %s in request, got %s", want, out)
+			}
+		})
+	}
+}
+
+func TestGeminiPassthroughKeepsTopK(t *testing.T) {
+	var req antigravity.GeminiInternalRequest
+	raw := `{"contents":[{"role":"user","parts":[{"text":"hi"}]}],"generationConfig":{"topK":32,"topP":0.9}}`
+	if err := json.Unmarshal([]byte(raw), &req); err != nil {
+		t.Fatalf("failed to unmarshal request: %v", err)
+	}
+
+	out, err := json.Marshal(req)
+	if err != nil {
+		t.Fatalf("failed to marshal request: %v", err)
+	}
+	if !strings.Contains(string(out), `"topK":32`) {
+		t.Errorf("expected topK to survive passthrough, got %s", out)
+	}
+}
+
+func intPtr(n int) *int {
+	return &n
+}
+
+func floatPtr(n float64) *float64 {
+	return &n
+}
+
+func TestUserPinsSessionID(t *testing.T) {
+	got, err := ToGeminiRequest(&openai.ChatCompletionRequest{
+		Model:    "gemini-3-flash",
+		Messages: []openai.Message{{Role: "user", Content: "hi"}},
+		User:     "user-1234",
+	}, "test-project")
+	if err != nil {
+		t.Fatalf("ToGeminiRequest returned error: %v", err)
+	}
+	if got.Request.SessionID != "user-1234" {
+		t.Errorf("expected user to be sent as the session id, got %q", got.Request.SessionID)
+	}
+}
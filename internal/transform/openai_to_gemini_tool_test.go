@@ -1,6 +1,7 @@
 package transform
 
 import (
+	"encoding/json"
 	"testing"
 
 	"github.com/dvcrn/antigravity-proxy/internal/openai"
@@ -125,3 +126,236 @@ func TestToolResponsesInsertedBeforeAssistantText(t *testing.T) {
 	require.Len(t, finalMsg.Parts, 1)
 	assert.Equal(t, "All done", finalMsg.Parts[0].Text)
 }
+
+func TestToolResponsesFollowTheirCallingTurn(t *testing.T) {
+	call := func(id, name string) openai.OpenAIToolCall {
+		return openai.OpenAIToolCall{ID: id, Type: "function", Function: openai.OpenAIFunctionCall{Name: name, Arguments: `{}`}}
+	}
+	req := &openai.ChatCompletionRequest{
+		Model: "gemini-2.5-pro",
+		Messages: []openai.Message{
+			{Role: "user", Content: "Read both files"},
+			{Role: "assistant", ToolCalls: []openai.OpenAIToolCall{call("call_a", "read"), call("call_b", "grep")}},
+			// Results arrive in a different order than the calls
+			{Role: "tool", ToolCallID: "call_b", Content: "grep output"},
+			{Role: "tool", ToolCallID: "call_a", Content: "read output"},
+			{Role: "assistant", Content: "Now listing", ToolCalls: []openai.OpenAIToolCall{call("call_c", "ls")}},
+			{Role: "tool", ToolCallID: "call_c", Content: "ls output"},
+			{Role: "user", Content: "Thanks"},
+		},
+	}
+
+	got, err := ToGeminiRequest(req, "test-project")
+	require.NoError(t, err)
+
+	type turn struct {
+		role  string
+		parts []string
+	}
+	var turns []turn
+	for _, c := range got.Request.Contents {
+		tr := turn{role: c.Role}
+		for _, p := range c.Parts {
+			switch {
+			case p.FunctionCall != nil:
+				tr.parts = append(tr.parts, "call:"+p.FunctionCall.ID)
+			case p.FunctionResponse != nil:
+				tr.parts = append(tr.parts, "result:"+p.FunctionResponse.ID)
+			default:
+				tr.parts = append(tr.parts, "text:"+p.Text)
+			}
+		}
+		turns = append(turns, tr)
+	}
+
+	assert.Equal(t, []turn{
+		{role: "user", parts: []string{"text:Read both files"}},
+		{role: "model", parts: []string{"call:call_a", "call:call_b"}},
+		{role: "user", parts: []string{"result:call_a", "result:call_b"}},
+		{role: "model", parts: []string{"text:Now listing", "call:call_c"}},
+		{role: "user", parts: []string{"result:call_c"}},
+		{role: "user", parts: []string{"text:Thanks"}},
+	}, turns)
+}
+
+func TestParallelToolResponsesPairedWithCalls(t *testing.T) {
+	call := func(id, name string) openai.OpenAIToolCall {
+		return openai.OpenAIToolCall{ID: id, Type: "function", Function: openai.OpenAIFunctionCall{Name: name, Arguments: `{}`}}
+	}
+	calls := []openai.OpenAIToolCall{call("call_1", "read"), call("call_2", "grep"), call("call_3", "read")}
+
+	tests := []struct {
+		name    string
+		results []openai.Message
+	}{
+		{
+			name: "reversed with tool_call_id",
+			results: []openai.Message{
+				{Role: "tool", ToolCallID: "call_3", Content: "third"},
+				{Role: "tool", ToolCallID: "call_2", Content: "second"},
+				{Role: "tool", ToolCallID: "call_1", Content: "first"},
+			},
+		},
+		{
+			name: "reversed, paired by name when tool_call_id is missing",
+			results: []openai.Message{
+				{Role: "tool", ToolCallID: "call_3", Content: "third"},
+				{Role: "tool", Name: "grep", Content: "second"},
+				{Role: "tool", Name: "read", Content: "first"},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			messages := []openai.Message{
+				{Role: "user", Content: "Look around"},
+				{Role: "assistant", ToolCalls: calls},
+			}
+			messages = append(messages, tc.results...)
+			messages = append(messages, openai.Message{Role: "user", Content: "Continue"})
+
+			got, err := ToGeminiRequest(&openai.ChatCompletionRequest{Model: "gemini-2.5-pro", Messages: messages}, "test-project")
+			require.NoError(t, err)
+			require.Len(t, got.Request.Contents, 4)
+
+			results := got.Request.Contents[2].Parts
+			require.Len(t, results, 3)
+			for i, want := range []struct{ id, name, output string }{
+				{"call_1", "read", "first"},
+				{"call_2", "grep", "second"},
+				{"call_3", "read", "third"},
+			} {
+				require.NotNil(t, results[i].FunctionResponse)
+				assert.Equal(t, want.id, results[i].FunctionResponse.ID)
+				assert.Equal(t, want.name, results[i].FunctionResponse.Name)
+				assert.Equal(t, want.output, results[i].FunctionResponse.Response["output"])
+			}
+		})
+	}
+}
+
+func TestAssistantContentWithToolCalls(t *testing.T) {
+	tests := []struct {
+		name    string
+		content interface{}
+		want    []string
+	}{
+		{name: "text before call", content: "Let me check", want: []string{"text:Let me check", "call:read"}},
+		{name: "null content", content: nil, want: []string{"call:read"}},
+		{name: "empty string content", content: "", want: []string{"call:read"}},
+		{name: "empty text part", content: []interface{}{map[string]interface{}{"type": "text", "text": ""}}, want: []string{"call:read"}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := &openai.ChatCompletionRequest{
+				Model: "gemini-2.5-pro",
+				Messages: []openai.Message{
+					{Role: "user", Content: "Read README"},
+					{
+						Role:    "assistant",
+						Content: tc.content,
+						ToolCalls: []openai.OpenAIToolCall{{
+							ID:       "call_1",
+							Type:     "function",
+							Function: openai.OpenAIFunctionCall{Name: "read", Arguments: `{"file_path":"README.md"}`},
+						}},
+					},
+				},
+			}
+
+			got, err := ToGeminiRequest(req, "test-project")
+			require.NoError(t, err)
+			require.Len(t, got.Request.Contents, 2)
+
+			assistant := got.Request.Contents[1]
+			assert.Equal(t, "model", assistant.Role)
+			var parts []string
+			for _, p := range assistant.Parts {
+				if p.FunctionCall != nil {
+					parts = append(parts, "call:"+p.FunctionCall.Name)
+				} else {
+					parts = append(parts, "text:"+p.Text)
+				}
+			}
+			assert.Equal(t, tc.want, parts)
+		})
+	}
+}
+
+func TestToolResultRole(t *testing.T) {
+	tests := []struct {
+		name string
+		env  string
+		want string
+	}{
+		{name: "default", env: "", want: "user"},
+		{name: "function", env: "function", want: "function"},
+		{name: "tool", env: "Tool", want: "tool"},
+		{name: "unknown falls back to user", env: "assistant", want: "user"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("TOOL_RESULT_ROLE", tc.env)
+			req := &openai.ChatCompletionRequest{
+				Model: "gemini-2.5-pro",
+				Messages: []openai.Message{
+					{Role: "user", Content: "Read README"},
+					{
+						Role: "assistant",
+						ToolCalls: []openai.OpenAIToolCall{{
+							ID:       "call_1",
+							Type:     "function",
+							Function: openai.OpenAIFunctionCall{Name: "read", Arguments: `{}`},
+						}},
+					},
+					{Role: "tool", ToolCallID: "call_1", Content: "README contents"},
+				},
+			}
+
+			got, err := ToGeminiRequest(req, "test-project")
+			require.NoError(t, err)
+			require.Len(t, got.Request.Contents, 3)
+
+			assert.Equal(t, "user", got.Request.Contents[0].Role, "plain user turns keep the user role")
+			toolResp := got.Request.Contents[2]
+			assert.Equal(t, tc.want, toolResp.Role)
+			require.Len(t, toolResp.Parts, 1)
+			require.NotNil(t, toolResp.Parts[0].FunctionResponse)
+		})
+	}
+}
+
+// Ensures a thought signature echoed back by the client on an assistant tool call
+// is replayed on the corresponding functionCall part.
+func TestThoughtSignatureRoundTrip(t *testing.T) {
+	body := `{
+		"model": "gemini-3-pro",
+		"messages": [
+			{"role": "user", "content": "What's the weather?"},
+			{"role": "assistant", "content": null, "tool_calls": [{
+				"id": "call_1",
+				"type": "function",
+				"function": {"name": "get_weather", "arguments": "{\"location\":\"Tokyo\"}"},
+				"extra_content": {"google": {"thought_signature": "sig-abc"}}
+			}]},
+			{"role": "tool", "tool_call_id": "call_1", "content": "sunny"}
+		]
+	}`
+
+	var req openai.ChatCompletionRequest
+	require.NoError(t, json.Unmarshal([]byte(body), &req))
+
+	got, err := ToGeminiRequest(&req, "test-project")
+	require.NoError(t, err)
+	require.Len(t, got.Request.Contents, 3)
+
+	callPart := got.Request.Contents[1].Parts[0]
+	require.NotNil(t, callPart.FunctionCall)
+	assert.Equal(t, "sig-abc", callPart.ThoughtSignature)
+
+	respPart := got.Request.Contents[2].Parts[0]
+	assert.Empty(t, respPart.ThoughtSignature, "signatures belong on the functionCall part only")
+}
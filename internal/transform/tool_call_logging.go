@@ -0,0 +1,82 @@
+package transform
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/dvcrn/antigravity-proxy/internal/env"
+	"github.com/dvcrn/antigravity-proxy/internal/logger"
+)
+
+// maxToolArgsPreview is the length of logged tool call argument previews.
+const maxToolArgsPreview = 300
+
+// redactedArg replaces the values of sensitive tool call arguments in logs.
+const redactedArg = "[REDACTED]"
+
+// sensitiveArgKeys are substrings of argument names whose values are redacted from
+// tool call previews, matched case-insensitively.
+var sensitiveArgKeys = []string{"password", "passwd", "secret", "token", "api_key", "apikey", "authorization", "credential", "private_key", "cookie"}
+
+// logToolCall logs a tool call forwarded to Gemini when LOG_TOOL_CALLS=true, with a
+// preview of its arguments that has sensitive values redacted. When logContent is false
+// the preview is omitted, as for tool responses.
+func logToolCall(ctx context.Context, name, id string, args map[string]interface{}, logContent bool) {
+	if env.GetOrDefault("LOG_TOOL_CALLS", "false") != "true" {
+		return
+	}
+
+	var raw []byte
+	if args != nil {
+		raw, _ = json.Marshal(args)
+	}
+	preview := ""
+	if logContent {
+		redactedJSON, _ := json.Marshal(redactArgs(args))
+		preview = string(redactedJSON)
+		if len(preview) > maxToolArgsPreview {
+			preview = preview[:maxToolArgsPreview] + "..."
+		}
+	}
+	logger.Sampled(ctx).Info().
+		Str("function", name).
+		Str("tool_call_id", id).
+		Int("args_len", len(raw)).
+		Str("args_preview", preview).
+		Msg("Forwarding tool call to Gemini")
+}
+
+// redactArgs returns a copy of v with the values of sensitive keys replaced, at any depth.
+func redactArgs(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(value))
+		for k, child := range value {
+			if isSensitiveArgKey(k) {
+				out[k] = redactedArg
+				continue
+			}
+			out[k] = redactArgs(child)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(value))
+		for i, child := range value {
+			out[i] = redactArgs(child)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+func isSensitiveArgKey(key string) bool {
+	lower := strings.ToLower(key)
+	for _, s := range sensitiveArgKeys {
+		if strings.Contains(lower, s) {
+			return true
+		}
+	}
+	return false
+}
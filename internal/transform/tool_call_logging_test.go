@@ -0,0 +1,92 @@
+package transform
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/dvcrn/antigravity-proxy/internal/logger"
+	"github.com/dvcrn/antigravity-proxy/internal/openai"
+	"github.com/rs/zerolog"
+)
+
+func TestLogToolCalls(t *testing.T) {
+	store := false
+	testCases := []struct {
+		name        string
+		flag        string
+		store       *bool
+		expectLog   bool
+		expectParts []string
+		rejectParts []string
+	}{
+		{
+			name:        "previews args with sensitive values redacted",
+			flag:        "true",
+			expectLog:   true,
+			expectParts: []string{`"function":"deploy"`, `"tool_call_id":"call_1"`, `\"region\":\"eu\"`, `\"api_key\":\"[REDACTED]\"`, `\"password\":\"[REDACTED]\"`},
+			rejectParts: []string{"sk-live-123", "hunter2"},
+		},
+		{
+			name:        "store false omits the preview",
+			flag:        "true",
+			store:       &store,
+			expectLog:   true,
+			expectParts: []string{`"args_preview":""`},
+			rejectParts: []string{"region"},
+		},
+		{name: "disabled by default"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("LOG_TOOL_CALLS", tc.flag)
+			var buf bytes.Buffer
+			original := *logger.Get()
+			*logger.Get() = zerolog.New(&buf)
+			defer func() { *logger.Get() = original }()
+
+			req := &openai.ChatCompletionRequest{
+				Model: "gemini-2.5-pro",
+				Store: tc.store,
+				Messages: []openai.Message{
+					{Role: "user", Content: "Deploy it"},
+					{
+						Role: "assistant",
+						ToolCalls: []openai.OpenAIToolCall{{
+							ID:   "call_1",
+							Type: "function",
+							Function: openai.OpenAIFunctionCall{
+								Name:      "deploy",
+								Arguments: `{"region":"eu","api_key":"sk-live-123","auth":{"password":"hunter2"}}`,
+							},
+						}},
+					},
+				},
+			}
+			if _, err := ToGeminiRequest(req, "test-project"); err != nil {
+				t.Fatalf("ToGeminiRequest returned error: %v", err)
+			}
+
+			var line string
+			for _, l := range strings.Split(buf.String(), "\n") {
+				if strings.Contains(l, "Forwarding tool call to Gemini") {
+					line = l
+				}
+			}
+			if (line != "") != tc.expectLog {
+				t.Fatalf("tool call logged = %v, want %v; logs: %s", line != "", tc.expectLog, buf.String())
+			}
+			for _, want := range tc.expectParts {
+				if !strings.Contains(line, want) {
+					t.Errorf("expected log to contain %s, got %s", want, line)
+				}
+			}
+			for _, reject := range tc.rejectParts {
+				if strings.Contains(line, reject) {
+					t.Errorf("expected log not to contain %s, got %s", reject, line)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,259 @@
+package transform
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/dvcrn/antigravity-proxy/internal/antigravity"
+	"github.com/dvcrn/antigravity-proxy/internal/env"
+	"github.com/dvcrn/antigravity-proxy/internal/logger"
+	"github.com/dvcrn/antigravity-proxy/internal/warnings"
+)
+
+// defaultMaxFunctionDeclarations is Gemini's documented cap on function declarations
+// per request.
+const defaultMaxFunctionDeclarations = 512
+
+// maxFunctionDeclarations returns MAX_FUNCTION_DECLARATIONS (default
+// defaultMaxFunctionDeclarations); 0 disables the limit.
+func maxFunctionDeclarations() int {
+	value := env.GetOrDefault("MAX_FUNCTION_DECLARATIONS", strconv.Itoa(defaultMaxFunctionDeclarations))
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		logger.Get().Warn().Str("value", value).Int("default", defaultMaxFunctionDeclarations).Msg("Invalid MAX_FUNCTION_DECLARATIONS, using default")
+		return defaultMaxFunctionDeclarations
+	}
+	return n
+}
+
+// limitFunctionDeclarations drops duplicate function names, keeping the last definition,
+// and truncates the list to maxFunctionDeclarations. The forced tool (tool_choice) is
+// kept when truncating. Dropped tools are logged and reported to warns.
+func limitFunctionDeclarations(tools []antigravity.Tool, forced string, warns *warnings.Collector) []antigravity.Tool {
+	if len(tools) == 0 {
+		return tools
+	}
+
+	var fns []antigravity.FunctionDeclaration
+	for _, tool := range tools {
+		fns = append(fns, tool.FunctionDeclarations...)
+	}
+
+	// Later definitions win: keep each name only at its last occurrence
+	lastIndex := make(map[string]int, len(fns))
+	for i, fn := range fns {
+		lastIndex[fn.Name] = i
+	}
+	var duplicates []string
+	deduped := make([]antigravity.FunctionDeclaration, 0, len(fns))
+	for i, fn := range fns {
+		if lastIndex[fn.Name] != i {
+			duplicates = append(duplicates, fn.Name)
+			continue
+		}
+		deduped = append(deduped, fn)
+	}
+	if len(duplicates) > 0 {
+		logger.Get().Warn().
+			Strs("duplicate_tools", duplicates).
+			Msg("Dropped duplicate function declarations, keeping the last definition")
+		warns.Addf("dropped %d duplicate tool definitions: %v", len(duplicates), duplicates)
+	}
+
+	limit := maxFunctionDeclarations()
+	var dropped []string
+	if limit > 0 && len(deduped) > limit {
+		kept := make([]antigravity.FunctionDeclaration, 0, limit)
+		forcedIndex := -1
+		for i, fn := range deduped {
+			if fn.Name == forced {
+				forcedIndex = i
+			}
+		}
+		// Reserve a slot for the forced tool when it falls past the limit
+		slots := limit
+		if forcedIndex >= limit {
+			slots--
+		}
+		for i, fn := range deduped {
+			if len(kept) < slots || i == forcedIndex {
+				kept = append(kept, fn)
+				continue
+			}
+			dropped = append(dropped, fn.Name)
+		}
+		deduped = kept
+
+		logger.Get().Warn().
+			Int("max_function_declarations", limit).
+			Strs("dropped_tools", dropped).
+			Msg("Truncated function declarations to the configured maximum")
+		warns.Addf("dropped %d tools over the limit of %d: %v", len(dropped), limit, dropped)
+	}
+
+	if len(duplicates) == 0 && len(dropped) == 0 {
+		return tools
+	}
+	return []antigravity.Tool{{FunctionDeclarations: deduped}}
+}
+
+// ErrToolSchemaTooLarge is returned when a tool's parameter schema exceeds
+// MAX_TOOL_SCHEMA_BYTES and STRICT_TOOL_SCHEMA_LIMIT is enabled.
+var ErrToolSchemaTooLarge = errors.New("tool parameter schema too large")
+
+// maxToolSchemaBytes returns MAX_TOOL_SCHEMA_BYTES, the largest serialized parameter
+// schema allowed per tool; 0 (the default) disables the limit.
+func maxToolSchemaBytes() int {
+	value := env.GetOrDefault("MAX_TOOL_SCHEMA_BYTES", "0")
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		logger.Get().Warn().Str("value", value).Msg("Invalid MAX_TOOL_SCHEMA_BYTES, disabling the limit")
+		return 0
+	}
+	return n
+}
+
+// limitToolSchemaSize enforces maxToolSchemaBytes on fn's parameters. Oversized schemas
+// are rejected with ErrToolSchemaTooLarge when STRICT_TOOL_SCHEMA_LIMIT=true; otherwise
+// top-level properties are dropped, optional ones first and from the end of the
+// property order, until the schema fits. Dropping a required property is warned about
+// separately, since the model can then no longer produce a valid call.
+func limitToolSchemaSize(fn *antigravity.FunctionDeclaration, warns *warnings.Collector) error {
+	limit := maxToolSchemaBytes()
+	if limit == 0 || fn.Parameters == nil {
+		return nil
+	}
+	size := schemaSize(fn.Parameters)
+	if size <= limit {
+		return nil
+	}
+
+	if env.GetOrDefault("STRICT_TOOL_SCHEMA_LIMIT", "false") == "true" {
+		logger.Get().Warn().
+			Str("tool", fn.Name).
+			Int("schema_bytes", size).
+			Int("max_tool_schema_bytes", limit).
+			Msg("Rejecting tool with oversized parameter schema")
+		return fmt.Errorf("%w: tool %q parameters are %d bytes, limit is %d", ErrToolSchemaTooLarge, fn.Name, size, limit)
+	}
+
+	schema := *fn.Parameters
+	schema.Properties = make(map[string]*antigravity.GeminiParameterSchema, len(fn.Parameters.Properties))
+	for name, prop := range fn.Parameters.Properties {
+		schema.Properties[name] = prop
+	}
+	required := make(map[string]bool, len(schema.Required))
+	for _, name := range schema.Required {
+		required[name] = true
+	}
+	listed := make(map[string]int, len(schema.Properties))
+	for _, name := range schema.Required {
+		listed[name]++
+	}
+	for _, name := range schema.PropertyOrdering {
+		listed[name]++
+	}
+
+	// Sizes are estimated by subtracting each dropped property's share and only
+	// re-measured once the estimate fits, so large schemas aren't re-marshaled per drop
+	estimate := size
+	removed := map[string]bool{}
+	var dropped, droppedRequired []string
+	for _, name := range truncationOrder(&schema) {
+		if estimate <= limit {
+			schema.Required = withoutAll(fn.Parameters.Required, removed)
+			schema.PropertyOrdering = withoutAll(fn.Parameters.PropertyOrdering, removed)
+			if estimate = schemaSize(&schema); estimate <= limit {
+				break
+			}
+		}
+		estimate -= propertySize(name, schema.Properties[name], listed[name])
+		delete(schema.Properties, name)
+		removed[name] = true
+		dropped = append(dropped, name)
+		if required[name] {
+			droppedRequired = append(droppedRequired, name)
+		}
+	}
+	schema.Required = withoutAll(fn.Parameters.Required, removed)
+	schema.PropertyOrdering = withoutAll(fn.Parameters.PropertyOrdering, removed)
+	fn.Parameters = &schema
+
+	logger.Get().Warn().
+		Str("tool", fn.Name).
+		Int("schema_bytes", size).
+		Int("truncated_bytes", schemaSize(&schema)).
+		Int("max_tool_schema_bytes", limit).
+		Strs("dropped_properties", dropped).
+		Msg("Truncated oversized tool parameter schema")
+	warns.Addf("dropped %d parameters from tool %q to fit the schema size limit of %d bytes: %v", len(dropped), fn.Name, limit, dropped)
+	if len(droppedRequired) > 0 {
+		logger.Get().Warn().
+			Str("tool", fn.Name).
+			Strs("dropped_required_properties", droppedRequired).
+			Msg("Dropped required properties from oversized tool parameter schema")
+		warns.Addf("tool %q no longer fits the schema size limit without dropping required parameters: %v", fn.Name, droppedRequired)
+	}
+	return nil
+}
+
+// propertySize estimates how many bytes dropping a top-level property saves: its
+// `"name":schema,` entry, plus its `"name",` entry in each of the listed lists
+// (required, propertyOrdering) that name it.
+func propertySize(name string, prop *antigravity.GeminiParameterSchema, listed int) int {
+	key, _ := json.Marshal(name)
+	n := len(key) + len(":,") + listed*(len(key)+len(","))
+	if prop == nil {
+		return n + len("null")
+	}
+	return n + schemaSize(prop)
+}
+
+// truncationOrder lists schema's top-level properties in the order they are dropped:
+// optional before required, each from the end of the property order.
+func truncationOrder(schema *antigravity.GeminiParameterSchema) []string {
+	order := schema.PropertyOrdering
+	if len(order) != len(schema.Properties) {
+		order = make([]string, 0, len(schema.Properties))
+		for name := range schema.Properties {
+			order = append(order, name)
+		}
+		sort.Strings(order)
+	}
+
+	required := make(map[string]bool, len(schema.Required))
+	for _, name := range schema.Required {
+		required[name] = true
+	}
+	var optional, mandatory []string
+	for i := len(order) - 1; i >= 0; i-- {
+		if required[order[i]] {
+			mandatory = append(mandatory, order[i])
+		} else {
+			optional = append(optional, order[i])
+		}
+	}
+	return append(optional, mandatory...)
+}
+
+func schemaSize(schema *antigravity.GeminiParameterSchema) int {
+	b, err := json.Marshal(schema)
+	if err != nil {
+		return 0
+	}
+	return len(b)
+}
+
+// withoutAll returns names minus those in removed, leaving names itself unmodified.
+func withoutAll(names []string, removed map[string]bool) []string {
+	var out []string
+	for _, n := range names {
+		if !removed[n] {
+			out = append(out, n)
+		}
+	}
+	return out
+}
@@ -0,0 +1,238 @@
+package transform
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/dvcrn/antigravity-proxy/internal/openai"
+	"github.com/dvcrn/antigravity-proxy/internal/warnings"
+)
+
+func TestLimitFunctionDeclarations(t *testing.T) {
+	tool := func(name, description string) openai.Tool {
+		return openai.Tool{Type: "function", Function: openai.Function{Name: name, Description: description}}
+	}
+	many := func(n int) []openai.Tool {
+		var tools []openai.Tool
+		for i := 0; i < n; i++ {
+			tools = append(tools, tool(fmt.Sprintf("tool_%d", i), ""))
+		}
+		return tools
+	}
+
+	testCases := []struct {
+		name          string
+		max           string
+		tools         []openai.Tool
+		toolChoice    string
+		expectedNames []string
+		expectedDescs map[string]string
+	}{
+		{
+			name:          "duplicates keep the last definition",
+			tools:         []openai.Tool{tool("read", "old"), tool("grep", ""), tool("read", "new")},
+			expectedNames: []string{"grep", "read"},
+			expectedDescs: map[string]string{"read": "new"},
+		},
+		{
+			name:          "truncates to the maximum",
+			max:           "3",
+			tools:         many(5),
+			expectedNames: []string{"tool_0", "tool_1", "tool_2"},
+		},
+		{
+			name:          "keeps the tool_choice tool when truncating",
+			max:           "3",
+			tools:         many(5),
+			toolChoice:    `{"type":"function","function":{"name":"tool_4"}}`,
+			expectedNames: []string{"tool_0", "tool_1", "tool_4"},
+		},
+		{
+			name:          "zero disables the limit",
+			max:           "0",
+			tools:         many(5),
+			expectedNames: []string{"tool_0", "tool_1", "tool_2", "tool_3", "tool_4"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("MAX_FUNCTION_DECLARATIONS", tc.max)
+			req := &openai.ChatCompletionRequest{
+				Model:    "gemini-3-pro",
+				Messages: []openai.Message{{Role: "user", Content: "hi"}},
+				Tools:    tc.tools,
+			}
+			if tc.toolChoice != "" {
+				req.ToolChoice = json.RawMessage(tc.toolChoice)
+			}
+
+			got, err := ToGeminiRequest(req, "test-project")
+			if err != nil {
+				t.Fatalf("ToGeminiRequest returned error: %v", err)
+			}
+			if len(got.Request.Tools) != 1 {
+				t.Fatalf("expected one tool group, got %d", len(got.Request.Tools))
+			}
+			var names []string
+			for _, fn := range got.Request.Tools[0].FunctionDeclarations {
+				names = append(names, fn.Name)
+				if want, ok := tc.expectedDescs[fn.Name]; ok && fn.Description != want {
+					t.Errorf("description of %s = %q, want %q", fn.Name, fn.Description, want)
+				}
+			}
+			if strings.Join(names, ",") != strings.Join(tc.expectedNames, ",") {
+				t.Errorf("function names = %v, want %v", names, tc.expectedNames)
+			}
+		})
+	}
+}
+
+func TestLimitToolSchemaSize(t *testing.T) {
+	properties := map[string]interface{}{}
+	for i := 0; i < 200; i++ {
+		properties[fmt.Sprintf("field_%03d", i)] = map[string]interface{}{"type": "string", "description": "an optional field"}
+	}
+	properties["path"] = map[string]interface{}{"type": "string"}
+	oversized := openai.Tool{Type: "function", Function: openai.Function{
+		Name:       "big",
+		Parameters: map[string]interface{}{"type": "object", "properties": properties, "required": []interface{}{"path"}},
+	}}
+	small := openai.Tool{Type: "function", Function: openai.Function{
+		Name:       "small",
+		Parameters: map[string]interface{}{"type": "object", "properties": map[string]interface{}{"q": map[string]interface{}{"type": "string"}}},
+	}}
+
+	testCases := []struct {
+		name         string
+		max          string
+		strict       string
+		expectErr    bool
+		expectFields int
+	}{
+		{name: "disabled by default", expectFields: 201},
+		{name: "truncates optional properties", max: "1024", expectFields: -1},
+		{name: "strict mode rejects", max: "1024", strict: "true", expectErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("MAX_TOOL_SCHEMA_BYTES", tc.max)
+			t.Setenv("STRICT_TOOL_SCHEMA_LIMIT", tc.strict)
+			req := &openai.ChatCompletionRequest{
+				Model:    "gemini-3-pro",
+				Messages: []openai.Message{{Role: "user", Content: "hi"}},
+				Tools:    []openai.Tool{oversized, small},
+			}
+
+			got, err := ToGeminiRequest(req, "test-project")
+			if tc.expectErr {
+				if !errors.Is(err, ErrToolSchemaTooLarge) {
+					t.Fatalf("expected ErrToolSchemaTooLarge, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ToGeminiRequest returned error: %v", err)
+			}
+
+			fns := got.Request.Tools[0].FunctionDeclarations
+			params := fns[0].Parameters
+			if tc.expectFields >= 0 {
+				if len(params.Properties) != tc.expectFields {
+					t.Errorf("properties = %d, want %d", len(params.Properties), tc.expectFields)
+				}
+				return
+			}
+			b, _ := json.Marshal(params)
+			if len(b) > 1024 {
+				t.Errorf("truncated schema is %d bytes, want at most 1024", len(b))
+			}
+			if _, ok := params.Properties["path"]; !ok {
+				t.Errorf("required property was dropped")
+			}
+			if len(params.Properties) < 2 {
+				t.Errorf("expected some optional properties to survive, got %d", len(params.Properties))
+			}
+			if want := []string{"path"}; strings.Join(params.Required, ",") != strings.Join(want, ",") {
+				t.Errorf("required = %v, want %v", params.Required, want)
+			}
+			if len(fns[1].Parameters.Properties) != 1 {
+				t.Errorf("small tool was modified: %+v", fns[1].Parameters)
+			}
+		})
+	}
+}
+
+func TestLimitToolSchemaSizeWarnsOnRequiredDrop(t *testing.T) {
+	t.Setenv("MAX_TOOL_SCHEMA_BYTES", "512")
+	properties := map[string]interface{}{}
+	var required []interface{}
+	for i := 0; i < 50; i++ {
+		name := fmt.Sprintf("field_%03d", i)
+		properties[name] = map[string]interface{}{"type": "string", "description": "a required field"}
+		required = append(required, name)
+	}
+	properties["extra"] = map[string]interface{}{"type": "string"}
+	req := &openai.ChatCompletionRequest{
+		Model:    "gemini-3-pro",
+		Messages: []openai.Message{{Role: "user", Content: "hi"}},
+		Tools: []openai.Tool{{Type: "function", Function: openai.Function{
+			Name:       "big",
+			Parameters: map[string]interface{}{"type": "object", "properties": properties, "required": required},
+		}}},
+	}
+
+	warns := warnings.NewCollector()
+	got, err := ToGeminiRequestWithWarnings(context.Background(), req, "test-project", warns)
+	if err != nil {
+		t.Fatalf("ToGeminiRequestWithWarnings returned error: %v", err)
+	}
+
+	params := got.Request.Tools[0].FunctionDeclarations[0].Parameters
+	if b, _ := json.Marshal(params); len(b) > 512 {
+		t.Errorf("truncated schema is %d bytes, want at most 512", len(b))
+	}
+	if _, ok := params.Properties["extra"]; ok {
+		t.Errorf("optional property survived while required ones were dropped")
+	}
+	if len(params.Required) != len(params.Properties) {
+		t.Errorf("required = %v does not match the remaining properties", params.Required)
+	}
+	if list := strings.Join(warns.List(), "\n"); !strings.Contains(list, "without dropping required parameters") {
+		t.Errorf("expected a warning about dropped required parameters, got %q", list)
+	}
+}
+
+func TestConvertToolsMatchesToGeminiRequest(t *testing.T) {
+	t.Setenv("MAX_FUNCTION_DECLARATIONS", "2")
+	var tools []openai.Tool
+	for _, name := range []string{"read", "grep", "write.file"} {
+		tools = append(tools, openai.Tool{Type: "function", Function: openai.Function{Name: name}})
+	}
+	req := &openai.ChatCompletionRequest{
+		Model:      "gemini-3-pro",
+		Messages:   []openai.Message{{Role: "user", Content: "hi"}},
+		Tools:      tools,
+		ToolChoice: json.RawMessage(`{"type":"function","function":{"name":"write.file"}}`),
+	}
+
+	full, err := ToGeminiRequest(req, "test-project")
+	if err != nil {
+		t.Fatalf("ToGeminiRequest returned error: %v", err)
+	}
+	got, err := ConvertTools(req.Tools, req.ForcedToolName(), nil)
+	if err != nil {
+		t.Fatalf("ConvertTools returned error: %v", err)
+	}
+
+	gotJSON, _ := json.Marshal(got)
+	wantJSON, _ := json.Marshal(full.Request.Tools)
+	if string(gotJSON) != string(wantJSON) {
+		t.Errorf("ConvertTools = %s, want %s", gotJSON, wantJSON)
+	}
+}
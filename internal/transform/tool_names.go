@@ -0,0 +1,100 @@
+package transform
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/dvcrn/antigravity-proxy/internal/env"
+	"github.com/dvcrn/antigravity-proxy/internal/openai"
+)
+
+// ToolNameMapping maps tool names sent upstream back to the names the client declared.
+// It is only populated when tool name normalization is enabled.
+type ToolNameMapping map[string]string
+
+// Original returns the client-facing name for a tool name emitted by the model.
+// Names without a mapping are returned unchanged.
+func (m ToolNameMapping) Original(name string) string {
+	if original, ok := m[name]; ok {
+		return original
+	}
+	return name
+}
+
+// BuildToolNameMapping returns the reverse mapping for every tool name in the request
+// that is rewritten by normalization, including names only referenced by prior tool calls.
+func BuildToolNameMapping(req *openai.ChatCompletionRequest) ToolNameMapping {
+	mapping := ToolNameMapping{}
+	add := func(name string) {
+		if normalized := normalizeToolName(name); normalized != name {
+			mapping[normalized] = name
+		}
+	}
+
+	for _, t := range req.Tools {
+		add(t.Function.Name)
+	}
+	for _, m := range req.Messages {
+		for _, tc := range m.ToolCalls {
+			add(tc.Function.Name)
+		}
+		if m.Name != "" {
+			add(m.Name)
+		}
+	}
+	return mapping
+}
+
+// ErrToolNameCollision is returned when NORMALIZE_TOOL_NAMES maps two declared tools,
+// e.g. "TodoWrite" and "todo_write", to the same name, which would make the model's
+// calls impossible to route back.
+var ErrToolNameCollision = errors.New("tool names collide after normalization")
+
+// checkToolNameCollisions rejects tool declarations whose names normalize to the same name.
+func checkToolNameCollisions(tools []openai.Tool) error {
+	seen := make(map[string]string, len(tools))
+	for _, t := range tools {
+		name := t.Function.Name
+		normalized := normalizeToolName(name)
+		if other, ok := seen[normalized]; ok && other != name {
+			return fmt.Errorf("%w: %q and %q both become %q", ErrToolNameCollision, other, name, normalized)
+		}
+		seen[normalized] = name
+	}
+	return nil
+}
+
+// normalizeToolName rewrites a tool name according to NORMALIZE_TOOL_NAMES.
+// Supported modes: "snake" converts camelCase/PascalCase names to snake_case.
+func normalizeToolName(name string) string {
+	switch strings.ToLower(env.GetOrDefault("NORMALIZE_TOOL_NAMES", "")) {
+	case "snake":
+		return toSnakeCase(name)
+	default:
+		return name
+	}
+}
+
+// toSnakeCase converts camelCase and PascalCase identifiers to snake_case.
+// Acronyms are kept together, e.g. "HTTPServer" becomes "http_server".
+func toSnakeCase(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			if i > 0 && runes[i-1] != '_' && runes[i-1] != '-' {
+				prevLowerOrDigit := unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1])
+				nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+				if prevLowerOrDigit || (unicode.IsUpper(runes[i-1]) && nextLower) {
+					b.WriteRune('_')
+				}
+			}
+			b.WriteRune(unicode.ToLower(r))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
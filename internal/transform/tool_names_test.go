@@ -0,0 +1,108 @@
+package transform
+
+import (
+	"testing"
+
+	"github.com/dvcrn/antigravity-proxy/internal/openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestToolNameNormalizationSnakeCase(t *testing.T) {
+	t.Setenv("NORMALIZE_TOOL_NAMES", "snake")
+
+	req := &openai.ChatCompletionRequest{
+		Model: "gemini-2.5-pro",
+		Messages: []openai.Message{
+			{Role: "user", Content: "Update my todos"},
+			{
+				Role: "assistant",
+				ToolCalls: []openai.OpenAIToolCall{
+					{
+						ID:       "call_1",
+						Type:     "function",
+						Function: openai.OpenAIFunctionCall{Name: "TodoWrite", Arguments: `{}`},
+					},
+				},
+			},
+			{Role: "tool", ToolCallID: "call_1", Content: "ok"},
+		},
+		Tools: []openai.Tool{
+			{
+				Type: "function",
+				Function: openai.Function{
+					Name:       "TodoWrite",
+					Parameters: map[string]interface{}{"type": "object"},
+				},
+			},
+		},
+	}
+
+	got, err := ToGeminiRequest(req, "test-project")
+	require.NoError(t, err)
+
+	// Outbound: declarations, prior calls, and tool responses all use the normalized name
+	require.Len(t, got.Request.Tools, 1)
+	assert.Equal(t, "todo_write", got.Request.Tools[0].FunctionDeclarations[0].Name)
+	require.Len(t, got.Request.Contents, 3)
+	assert.Equal(t, "todo_write", got.Request.Contents[1].Parts[0].FunctionCall.Name)
+	assert.Equal(t, "todo_write", got.Request.Contents[2].Parts[0].FunctionResponse.Name)
+
+	// Inbound: model tool calls are mapped back to the client's original name
+	mapping := BuildToolNameMapping(req)
+	assert.Equal(t, "TodoWrite", mapping.Original("todo_write"))
+	assert.Equal(t, "unknown_tool", mapping.Original("unknown_tool"))
+}
+
+func TestToolNameNormalizationDisabledByDefault(t *testing.T) {
+	t.Setenv("NORMALIZE_TOOL_NAMES", "")
+
+	req := &openai.ChatCompletionRequest{
+		Model:    "gemini-2.5-pro",
+		Messages: []openai.Message{{Role: "user", Content: "hi"}},
+		Tools: []openai.Tool{
+			{Type: "function", Function: openai.Function{Name: "TodoWrite"}},
+		},
+	}
+
+	got, err := ToGeminiRequest(req, "test-project")
+	require.NoError(t, err)
+	assert.Equal(t, "TodoWrite", got.Request.Tools[0].FunctionDeclarations[0].Name)
+	assert.Empty(t, BuildToolNameMapping(req))
+}
+
+func TestToSnakeCase(t *testing.T) {
+	cases := map[string]string{
+		"TodoWrite":    "todo_write",
+		"readFile":     "read_file",
+		"HTTPServer":   "http_server",
+		"already_done": "already_done",
+		"web-search":   "web-search",
+		"getV2Data":    "get_v2_data",
+	}
+	for input, expected := range cases {
+		assert.Equal(t, expected, toSnakeCase(input), input)
+	}
+}
+
+func TestToolNameNormalizationRejectsCollisions(t *testing.T) {
+	t.Setenv("NORMALIZE_TOOL_NAMES", "snake")
+
+	req := &openai.ChatCompletionRequest{
+		Model:    "gemini-2.5-pro",
+		Messages: []openai.Message{{Role: "user", Content: "hi"}},
+		Tools: []openai.Tool{
+			{Type: "function", Function: openai.Function{Name: "TodoWrite"}},
+			{Type: "function", Function: openai.Function{Name: "todo_write"}},
+		},
+	}
+
+	_, err := ToGeminiRequest(req, "test-project")
+	require.ErrorIs(t, err, ErrToolNameCollision)
+	assert.Contains(t, err.Error(), `"TodoWrite" and "todo_write"`)
+
+	// The same names are fine when normalization is off
+	t.Setenv("NORMALIZE_TOOL_NAMES", "")
+	_, err = ToGeminiRequest(req, "test-project")
+	require.NoError(t, err)
+}
@@ -0,0 +1,51 @@
+// Package version reports the proxy's build information.
+package version
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+// Set at build time, e.g.
+//
+//	go build -ldflags "-X github.com/dvcrn/antigravity-proxy/internal/version.Version=v1.2.3 \
+//	  -X github.com/dvcrn/antigravity-proxy/internal/version.Commit=$(git rev-parse HEAD) \
+//	  -X github.com/dvcrn/antigravity-proxy/internal/version.BuildTime=$(date -u +%FT%TZ)"
+//
+// Values left empty are filled from the module and VCS info Go embeds in the binary.
+var (
+	Version   = ""
+	Commit    = ""
+	BuildTime = ""
+)
+
+// Info is the proxy's build information.
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	BuildTime string `json:"build_time,omitempty"`
+	GoVersion string `json:"go_version"`
+}
+
+// Get returns the build information, preferring ldflags values over the embedded
+// build info. Version is "dev" when neither source has one.
+func Get() Info {
+	info := Info{Version: Version, Commit: Commit, BuildTime: BuildTime, GoVersion: runtime.Version()}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		if info.Version == "" && bi.Main.Version != "" && bi.Main.Version != "(devel)" {
+			info.Version = bi.Main.Version
+		}
+		for _, setting := range bi.Settings {
+			switch {
+			case setting.Key == "vcs.revision" && info.Commit == "":
+				info.Commit = setting.Value
+			case setting.Key == "vcs.time" && info.BuildTime == "":
+				info.BuildTime = setting.Value
+			}
+		}
+	}
+	if info.Version == "" {
+		info.Version = "dev"
+	}
+	return info
+}
@@ -0,0 +1,60 @@
+package warnings
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+type contextKey struct{}
+
+// Collector gathers client-visible warnings about changes the proxy made to a request
+// (defaulted parameters, pruned parts, renamed tools, ...).
+// A nil *Collector is valid and ignores all calls, so callers don't need to check
+// whether warnings are enabled.
+type Collector struct {
+	mu    sync.Mutex
+	items []string
+}
+
+// NewCollector creates an empty Collector.
+func NewCollector() *Collector {
+	return &Collector{}
+}
+
+// WithCollector returns a context carrying the collector.
+func WithCollector(ctx context.Context, c *Collector) context.Context {
+	return context.WithValue(ctx, contextKey{}, c)
+}
+
+// FromContext returns the collector carried by ctx, or nil if there is none.
+func FromContext(ctx context.Context) *Collector {
+	if ctx == nil {
+		return nil
+	}
+	c, _ := ctx.Value(contextKey{}).(*Collector)
+	return c
+}
+
+// Addf records a formatted warning.
+func (c *Collector) Addf(format string, args ...interface{}) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.items = append(c.items, fmt.Sprintf(format, args...))
+}
+
+// List returns the recorded warnings in the order they were added. It never returns nil
+// so the result marshals as an empty JSON array.
+func (c *Collector) List() []string {
+	if c == nil {
+		return []string{}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := make([]string, len(c.items))
+	copy(out, c.items)
+	return out
+}